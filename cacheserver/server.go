@@ -0,0 +1,312 @@
+package cacheserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+const mediaType = "application/vnd.git-lfs+json"
+
+// hopHeaders are the headers which are not forwarded to the upstream server
+// when proxying a download.
+var hopHeaders = []string{
+	"Accept-Encoding",
+	"Connection",
+	"Host",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Range",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// credentialHeaders are the headers which carry a client's credentials, and
+// which are never forwarded to the upstream server, so that the cache server
+// can't be used to send them to another host.
+var credentialHeaders = []string{
+	"Authorization",
+	"Cookie",
+}
+
+type batchRequest struct {
+	Operation     string         `json:"operation"`
+	Objects       []*batchObject `json:"objects"`
+	HashAlgorithm string         `json:"hash_algo,omitempty"`
+}
+
+type batchResponse struct {
+	Transfer      string         `json:"transfer"`
+	Objects       []*batchObject `json:"objects"`
+	HashAlgorithm string         `json:"hash_algo,omitempty"`
+}
+
+type batchObject struct {
+	Oid           string                  `json:"oid"`
+	Size          int64                   `json:"size"`
+	Authenticated bool                    `json:"authenticated,omitempty"`
+	Actions       map[string]*batchAction `json:"actions,omitempty"`
+	Error         *batchError             `json:"error,omitempty"`
+}
+
+type batchAction struct {
+	Href string `json:"href"`
+}
+
+type batchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server serves the objects in a Store over HTTP. It implements a subset of
+// the Git LFS batch API, which reports the objects in the store as
+// downloadable, and answers basic transfer downloads of them.
+//
+// A download of an object which is not in the store may name the URL it
+// would otherwise be downloaded from in the "source" query parameter. If that
+// URL is on one of the server's source hosts, the server downloads the object
+// from there, forwarding the request's headers other than those carrying
+// credentials, and stores it while passing it on. Objects are only added to
+// the store in this way.
+type Server struct {
+	store       *Store
+	client      *http.Client
+	sourceHosts []string
+}
+
+// NewServer returns a Server for the given store, which downloads objects it
+// doesn't have from the given hosts only, including when redirected. Each host
+// may include a port, in which case only URLs with that port match.
+func NewServer(store *Store, sourceHosts []string) *Server {
+	s := &Server{store: store, sourceHosts: sourceHosts}
+	s.client = &http.Client{
+		Transport: http.DefaultTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !s.isSourceHost(req.URL) {
+				return errors.New(tr.Tr.Get("redirect to disallowed host %q", req.URL.Host))
+			}
+			if len(via) >= 10 {
+				return errors.New(tr.Tr.Get("stopped after 10 redirects"))
+			}
+			return nil
+		},
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tracerx.Printf("cache server: %s %s", r.Method, r.URL.Path)
+
+	switch {
+	case r.URL.Path == "/objects/batch" && r.Method == "POST":
+		s.serveBatch(w, r)
+	case strings.HasPrefix(r.URL.Path, "/objects/"):
+		oid := strings.TrimPrefix(r.URL.Path, "/objects/")
+		algo, err := hashAlgorithm(r.URL.Query().Get("hash_algo"))
+		if err != nil || !algo.IsValidOid(oid) {
+			writeError(w, http.StatusNotFound, tr.Tr.Get("Invalid object ID %q", oid))
+			return
+		}
+
+		switch r.Method {
+		case "GET", "HEAD":
+			s.serveDownload(w, r, oid, algo)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, tr.Tr.Get("Method %s not allowed", r.Method))
+		}
+	default:
+		writeError(w, http.StatusNotFound, tr.Tr.Get("Not found"))
+	}
+}
+
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid batch request: %s", err))
+		return
+	}
+	if req.Operation != "download" {
+		writeError(w, http.StatusUnprocessableEntity, tr.Tr.Get("The cache server only supports downloads"))
+		return
+	}
+
+	algo, err := hashAlgorithm(req.HashAlgorithm)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	res := &batchResponse{
+		Transfer:      "basic",
+		Objects:       make([]*batchObject, 0, len(req.Objects)),
+		HashAlgorithm: algo.String(),
+	}
+	for _, o := range req.Objects {
+		obj := &batchObject{Oid: o.Oid, Size: o.Size}
+		if algo.IsValidOid(o.Oid) && s.store.Has(o.Oid, o.Size) {
+			obj.Authenticated = true
+			obj.Actions = map[string]*batchAction{
+				"download": {Href: objectURL(r.Host, o.Oid, algo)},
+			}
+		} else {
+			obj.Error = &batchError{Code: http.StatusNotFound, Message: tr.Tr.Get("Object not cached")}
+		}
+		res.Objects = append(res.Objects, obj)
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, oid string, algo tools.HashAlgorithm) {
+	f, err := s.store.Open(oid)
+	if err == nil {
+		defer f.Close()
+		http.ServeContent(w, r, oid, time.Time{}, f)
+		return
+	}
+	if !os.IsNotExist(err) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	source := r.URL.Query().Get("source")
+	if len(source) == 0 {
+		writeError(w, http.StatusNotFound, tr.Tr.Get("Object not cached"))
+		return
+	}
+	s.proxyDownload(w, r, oid, algo, source)
+}
+
+// proxyDownload downloads an object from its source URL, passing it on to the
+// client while adding it to the store.
+func (s *Server) proxyDownload(w http.ResponseWriter, r *http.Request, oid string, algo tools.HashAlgorithm, source string) {
+	u, err := url.Parse(source)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid source URL %q", source))
+		return
+	}
+	if !s.isSourceHost(u) {
+		writeError(w, http.StatusForbidden, tr.Tr.Get("Source host %q is not allowed", u.Host))
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, u.String(), nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	for _, h := range credentialHeaders {
+		req.Header.Del(h)
+	}
+
+	tracerx.Printf("cache server: fetching %s from %s://%s", oid, u.Scheme, u.Host)
+	res, err := s.client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer res.Body.Close()
+
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	if res.StatusCode != http.StatusOK || r.Method != "GET" {
+		// Pass errors, such as expired credentials, on to the client
+		// as they are.
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+		return
+	}
+
+	size := res.ContentLength
+	if v := r.URL.Query().Get("size"); len(v) > 0 {
+		size, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	var body io.Reader = res.Body
+	var sw *Writer
+	if size >= 0 {
+		if sw, err = s.store.Create(oid, algo, size); err != nil {
+			tracerx.Printf("cache server: cannot cache %s: %s", oid, err)
+		} else {
+			body = io.TeeReader(res.Body, sw)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		tracerx.Printf("cache server: download of %s failed: %s", oid, err)
+		if sw != nil {
+			sw.Abort()
+		}
+		return
+	}
+
+	if sw != nil {
+		if err := sw.Commit(); err != nil {
+			tracerx.Printf("cache server: cannot cache %s: %s", oid, err)
+		}
+	}
+}
+
+// isSourceHost returns whether the server may download objects from u.
+func (s *Server) isSourceHost(u *url.URL) bool {
+	for _, host := range s.sourceHosts {
+		if strings.Contains(host, ":") {
+			if strings.EqualFold(host, u.Host) {
+				return true
+			}
+		} else if strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// objectURL returns the URL at which the object with the given OID, computed
+// with algo, is served by the cache server at host.
+func objectURL(host, oid string, algo tools.HashAlgorithm) string {
+	u := fmt.Sprintf("http://%s/objects/%s", host, oid)
+	if algo != tools.DefaultHashAlgorithm {
+		u += "?hash_algo=" + algo.String()
+	}
+	return u
+}
+
+// hashAlgorithm returns the hash algorithm with the given name, as sent in a
+// batch request or the "hash_algo" query parameter, where an empty name means
+// SHA-256.
+func hashAlgorithm(name string) (tools.HashAlgorithm, error) {
+	if len(name) == 0 {
+		return tools.DefaultHashAlgorithm, nil
+	}
+	return tools.ParseHashAlgorithm(name)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{message})
+}
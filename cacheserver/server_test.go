@@ -0,0 +1,182 @@
+package cacheserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, sourceHosts ...string) (*httptest.Server, *Store) {
+	store, err := NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(NewServer(store, sourceHosts))
+	t.Cleanup(srv.Close)
+	return srv, store
+}
+
+func TestServerBatch(t *testing.T) {
+	srv, store := newTestServer(t)
+	cached := putString(t, store, "cached")
+	missing := oidOf("missing")
+
+	body := fmt.Sprintf(`{"operation":"download","objects":[{"oid":%q,"size":6},{"oid":%q,"size":7}]}`, cached, missing)
+	res, err := http.Post(srv.URL+"/objects/batch", mediaType, strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+
+	var bRes batchResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&bRes))
+	require.Len(t, bRes.Objects, 2)
+
+	assert.Equal(t, srv.URL+"/objects/"+cached, bRes.Objects[0].Actions["download"].Href)
+	assert.True(t, bRes.Objects[0].Authenticated)
+	assert.Nil(t, bRes.Objects[1].Actions)
+	assert.Equal(t, 404, bRes.Objects[1].Error.Code)
+
+	res, err = http.Post(srv.URL+"/objects/batch", mediaType, strings.NewReader(`{"operation":"upload","objects":[]}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 422, res.StatusCode)
+}
+
+func TestServerDownload(t *testing.T) {
+	srv, store := newTestServer(t)
+	oid := putString(t, store, "uploaded")
+
+	res, err := http.Get(srv.URL + "/objects/" + oidOf("missing"))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 404, res.StatusCode)
+
+	req, err := http.NewRequest("GET", srv.URL+"/objects/"+oid, nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=2-")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	by, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 206, res.StatusCode)
+	assert.Equal(t, "loaded", string(by))
+}
+
+func TestServerRejectsUploads(t *testing.T) {
+	srv, store := newTestServer(t)
+	oid := oidOf("uploaded")
+
+	req, err := http.NewRequest("PUT", srv.URL+"/objects/"+oid, strings.NewReader("uploaded"))
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 405, res.StatusCode)
+	assert.False(t, store.Has(oid, 8))
+}
+
+func TestServerProxiesDownloads(t *testing.T) {
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("X-Fail") != "" {
+			w.WriteHeader(500)
+			return
+		}
+		// Credentials are never forwarded.
+		if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+			w.WriteHeader(400)
+			return
+		}
+		io.WriteString(w, "from upstream")
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	srv, store := newTestServer(t, u.Host)
+	oid := oidOf("from upstream")
+	href := fmt.Sprintf("%s/objects/%s?size=13&source=%s", srv.URL, oid, url.QueryEscape(upstream.URL+"/object"))
+
+	get := func(header string) (int, string) {
+		req, err := http.NewRequest("GET", href, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Cookie", "session=1")
+		if len(header) > 0 {
+			req.Header.Set(header, "1")
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		by, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(by)
+	}
+
+	status, _ := get("X-Fail")
+	assert.Equal(t, 500, status)
+	assert.False(t, store.Has(oid, 13))
+
+	status, body := get("")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "from upstream", body)
+	assert.True(t, store.Has(oid, 13))
+
+	// Once cached, the upstream server isn't asked again.
+	status, body = get("")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "from upstream", body)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestServerProxyRejectsOtherHosts(t *testing.T) {
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		io.WriteString(w, "from upstream")
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	redirect := httptest.NewServer(http.RedirectHandler(upstream.URL+"/object", http.StatusFound))
+	defer redirect.Close()
+	r, err := url.Parse(redirect.URL)
+	require.NoError(t, err)
+
+	for _, hosts := range [][]string{nil, {"storage.example"}, {u.Hostname() + ":1"}} {
+		srv, _ := newTestServer(t, hosts...)
+		res, err := http.Get(fmt.Sprintf("%s/objects/%s?size=13&source=%s", srv.URL, oidOf("from upstream"), url.QueryEscape(upstream.URL+"/object")))
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, 403, res.StatusCode, "hosts %v", hosts)
+	}
+
+	// Redirects to other hosts are refused too.
+	srv, _ := newTestServer(t, r.Host)
+	res, err := http.Get(fmt.Sprintf("%s/objects/%s?size=13&source=%s", srv.URL, oidOf("from upstream"), url.QueryEscape(redirect.URL+"/object")))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 502, res.StatusCode)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
+
+func TestServerProxyRejectsInvalidSource(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	res, err := http.Get(fmt.Sprintf("%s/objects/%s?source=%s", srv.URL, oidOf("x"), url.QueryEscape("file:///etc/passwd")))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 400, res.StatusCode)
+}
@@ -0,0 +1,322 @@
+// Package cacheserver implements a local, content-addressed cache of Git LFS
+// objects which can be shared by many clones on the same machine, along with
+// an HTTP server that serves it.
+// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+package cacheserver
+
+import (
+	"container/list"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// Store is an on-disk store of objects, which evicts the least recently used
+// objects whenever the total size of the objects exceeds a limit.
+type Store struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	oid  string
+	size int64
+}
+
+// NewStore returns a Store of objects in the given directory, which holds at
+// most maxSize bytes of objects. A maxSize of zero or less means the store is
+// unlimited. Any objects already in the directory are added to the store, in
+// order of their modification times, and evicted if they exceed maxSize.
+func NewStore(dir string, maxSize int64) (*Store, error) {
+	s := &Store{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	if err := os.MkdirAll(s.tempDir(), 0755); err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("cache server: cannot create directory"))
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.evict()
+	s.mu.Unlock()
+	return s, nil
+}
+
+func (s *Store) objectsDir() string {
+	return filepath.Join(s.dir, "objects")
+}
+
+func (s *Store) tempDir() string {
+	return filepath.Join(s.dir, "tmp")
+}
+
+func (s *Store) path(oid string) string {
+	return filepath.Join(s.objectsDir(), oid[0:2], oid[2:4], oid)
+}
+
+// load adds the objects already present in the store's directory, least
+// recently used first.
+func (s *Store) load() error {
+	type found struct {
+		entry
+		modTime time.Time
+	}
+
+	var objects []found
+	err := filepath.WalkDir(s.objectsDir(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !validOid(d.Name()) || path != s.path(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, found{entry{d.Name(), info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("cache server: cannot read directory"))
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].modTime.Before(objects[j].modTime)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range objects {
+		s.add(o.entry)
+	}
+	tracerx.Printf("cache server: loaded %d object(s), %d byte(s)", len(objects), s.size)
+	return nil
+}
+
+// Size returns the total size of the objects in the store.
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+// Has returns whether the store contains the object with the given OID and
+// size.
+func (s *Store) Has(oid string, size int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[oid]
+	return ok && el.Value.(*entry).size == size
+}
+
+// Open opens the object with the given OID for reading and marks it as the
+// most recently used. It returns an error satisfying os.IsNotExist if the
+// store does not contain the object.
+func (s *Store) Open(oid string) (*os.File, error) {
+	if !validOid(oid) {
+		return nil, os.ErrNotExist
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[oid]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	f, err := os.Open(s.path(oid))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The file was removed from under us.
+			s.remove(el)
+		}
+		return nil, err
+	}
+
+	s.lru.MoveToFront(el)
+
+	// Record the access so that the order survives a restart.
+	now := time.Now()
+	os.Chtimes(f.Name(), now, now)
+	return f, nil
+}
+
+// Create returns a Writer which adds the object with the given OID and size
+// to the store once its contents have been written and verified against the
+// OID using the hash algorithm algo.
+func (s *Store) Create(oid string, algo tools.HashAlgorithm, size int64) (*Writer, error) {
+	if !algo.IsValidOid(oid) {
+		return nil, errors.New(tr.Tr.Get("cache server: invalid object ID %q", oid))
+	}
+
+	f, err := os.CreateTemp(s.tempDir(), oid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		store: s,
+		oid:   oid,
+		size:  size,
+		file:  f,
+		hash:  algo.New(),
+	}, nil
+}
+
+// Put adds the object with the given OID, computed with algo, and size to the
+// store, reading its contents from r.
+func (s *Store) Put(oid string, algo tools.HashAlgorithm, size int64, r io.Reader) error {
+	w, err := s.Create(oid, algo, size)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+func (s *Store) commit(w *Writer) error {
+	path := s.path(w.oid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(w.file.Name(), path); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[w.oid]; ok {
+		// Another writer stored the same object concurrently.
+		s.lru.MoveToFront(el)
+		return nil
+	}
+
+	s.add(entry{w.oid, w.size})
+	s.evict()
+	return nil
+}
+
+// add adds an entry as the most recently used object in the store. It must be
+// called with s.mu held.
+func (s *Store) add(e entry) {
+	s.entries[e.oid] = s.lru.PushFront(&e)
+	s.size += e.size
+}
+
+// remove removes an entry from the store. It must be called with s.mu held.
+func (s *Store) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.entries, e.oid)
+	s.size -= e.size
+}
+
+// evict removes the least recently used objects until the store is within
+// its size limit. It must be called with s.mu held.
+func (s *Store) evict() {
+	if s.maxSize <= 0 {
+		return
+	}
+
+	for s.size > s.maxSize {
+		el := s.lru.Back()
+		if el == nil {
+			return
+		}
+
+		e := el.Value.(*entry)
+		tracerx.Printf("cache server: evicting %s (%d bytes)", e.oid, e.size)
+		if err := os.Remove(s.path(e.oid)); err != nil && !os.IsNotExist(err) {
+			tracerx.Printf("cache server: cannot remove %s: %s", e.oid, err)
+		}
+		s.remove(el)
+	}
+}
+
+// Writer writes the contents of an object into a Store, and verifies them
+// before making the object available.
+type Writer struct {
+	store *Store
+	oid   string
+	size  int64
+
+	file    *os.File
+	hash    hash.Hash
+	written int64
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.hash.Write(p[:n])
+	w.written += int64(n)
+	return n, err
+}
+
+// Commit verifies the size and OID of the data written and, if they match,
+// adds the object to the store.
+func (w *Writer) Commit() error {
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+
+	if w.written != w.size {
+		os.Remove(w.file.Name())
+		return errors.New(tr.Tr.Get("cache server: expected %d bytes for %s, got %d", w.size, w.oid, w.written))
+	}
+	if actual := hex.EncodeToString(w.hash.Sum(nil)); actual != w.oid {
+		os.Remove(w.file.Name())
+		return errors.New(tr.Tr.Get("cache server: expected OID %s, got %s", w.oid, actual))
+	}
+
+	if err := w.store.commit(w); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort discards the data written.
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+func validOid(oid string) bool {
+	return tools.IsValidOid(oid)
+}
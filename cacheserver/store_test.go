@@ -0,0 +1,117 @@
+package cacheserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func oidOf(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func putString(t *testing.T, s *Store, data string) string {
+	oid := oidOf(data)
+	require.NoError(t, s.Put(oid, tools.SHA256, int64(len(data)), strings.NewReader(data)))
+	return oid
+}
+
+func readObject(t *testing.T, s *Store, oid string) string {
+	f, err := s.Open(oid)
+	require.NoError(t, err)
+	defer f.Close()
+
+	by, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(by)
+}
+
+func TestStorePutOpen(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	oid := putString(t, s, "hello")
+	assert.True(t, s.Has(oid, 5))
+	assert.False(t, s.Has(oid, 6))
+	assert.Equal(t, "hello", readObject(t, s, oid))
+	assert.Equal(t, int64(5), s.Size())
+
+	_, err = s.Open(oidOf("missing"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = s.Open("../../etc/passwd")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStorePutVerifies(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	oid := oidOf("hello")
+	assert.Error(t, s.Put(oid, tools.SHA256, 5, strings.NewReader("jello")))
+	assert.Error(t, s.Put(oid, tools.SHA256, 6, strings.NewReader("hello")))
+	assert.Error(t, s.Put("invalid", tools.SHA256, 5, strings.NewReader("hello")))
+	assert.False(t, s.Has(oid, 5))
+	assert.Equal(t, int64(0), s.Size())
+}
+
+func TestStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	a := putString(t, s, "aaaa")
+	b := putString(t, s, "bbbb")
+
+	// Using a makes b the least recently used object.
+	readObject(t, s, a)
+
+	c := putString(t, s, "cccc")
+	assert.True(t, s.Has(a, 4))
+	assert.False(t, s.Has(b, 4))
+	assert.True(t, s.Has(c, 4))
+	assert.Equal(t, int64(8), s.Size())
+}
+
+func TestStoreLoadsExistingObjects(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewStore(dir, 0)
+	require.NoError(t, err)
+	oid := putString(t, s, "persistent")
+
+	s, err = NewStore(dir, 0)
+	require.NoError(t, err)
+	assert.True(t, s.Has(oid, 10))
+	assert.Equal(t, "persistent", readObject(t, s, oid))
+
+	// A smaller limit evicts what no longer fits.
+	s, err = NewStore(dir, 5)
+	require.NoError(t, err)
+	assert.False(t, s.Has(oid, 10))
+	assert.Equal(t, int64(0), s.Size())
+}
+
+func TestStoreWriterAbort(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	oid := oidOf("data")
+	w, err := s.Create(oid, tools.SHA256, 4)
+	require.NoError(t, err)
+	_, err = io.Copy(w, bytes.NewReader([]byte("da")))
+	require.NoError(t, err)
+	w.Abort()
+
+	assert.False(t, s.Has(oid, 4))
+	entries, err := os.ReadDir(s.tempDir())
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
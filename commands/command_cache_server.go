@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/v3/cacheserver"
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools/humanize"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/spf13/cobra"
+)
+
+const defaultCacheServerListen = "127.0.0.1:8765"
+
+var (
+	cacheServerListen  string
+	cacheServerDir     string
+	cacheServerMaxSize string
+	cacheServerHosts   []string
+)
+
+func cacheServerCommand(cmd *cobra.Command, args []string) {
+	dir, err := cacheServerDirectory()
+	if err != nil {
+		ExitWithError(err)
+	}
+
+	var maxSize uint64
+	if v := cacheServerOption(cacheServerMaxSize, "lfs.cacheserver.maxsize", ""); len(v) > 0 {
+		maxSize, err = humanize.ParseBytes(v)
+		if err != nil {
+			ExitWithError(errors.Wrap(err, tr.Tr.Get("cannot parse --max-size option")))
+		}
+	}
+
+	store, err := cacheserver.NewStore(dir, int64(maxSize))
+	if err != nil {
+		ExitWithError(err)
+	}
+
+	ln, err := net.Listen("tcp", cacheServerOption(cacheServerListen, "lfs.cacheserver.listen", defaultCacheServerListen))
+	if err != nil {
+		ExitWithError(err)
+	}
+
+	hosts := cacheServerSourceHosts()
+	if len(hosts) == 0 {
+		Error(tr.Tr.Get("warning: no source hosts are allowed, so objects will only be served if they are already cached; use --allow-host"))
+	}
+
+	Print(tr.Tr.Get("Serving Git LFS cache in %s at http://%s", dir, ln.Addr()))
+	if err := http.Serve(ln, cacheserver.NewServer(store, hosts)); err != nil {
+		ExitWithError(err)
+	}
+}
+
+// cacheServerOption returns the value of a command-line option if it was
+// given, or else the value of the given configuration key, or else def.
+func cacheServerOption(flag, key, def string) string {
+	if len(flag) > 0 {
+		return flag
+	}
+	if v, ok := cfg.Git.Get(key); ok && len(v) > 0 {
+		return v
+	}
+	return def
+}
+
+// cacheServerSourceHosts returns the hosts from which the cache server may
+// download objects: those given with --allow-host or in
+// lfs.cacheserver.allowedHosts, and, when run in a repository, the hosts of
+// its remotes' Git LFS endpoints.
+func cacheServerSourceHosts() []string {
+	hosts := append([]string{}, cacheServerHosts...)
+	hosts = append(hosts, cfg.Git.GetAll("lfs.cacheserver.allowedhosts")...)
+
+	if cfg.InRepo() {
+		for _, remote := range cfg.Remotes() {
+			e := getAPIClient().Endpoints.Endpoint("download", remote)
+			if u, err := url.Parse(e.Url); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				hosts = append(hosts, u.Host)
+			}
+		}
+	}
+	return hosts
+}
+
+func cacheServerDirectory() (string, error) {
+	if dir := cacheServerOption(cacheServerDir, "lfs.cacheserver.dir", ""); len(dir) > 0 {
+		return filepath.Abs(dir)
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, tr.Tr.Get("cannot determine cache directory; use --dir"))
+	}
+	return filepath.Join(dir, "git-lfs", "cache-server"), nil
+}
+
+func init() {
+	RegisterCommand("cache-server", cacheServerCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVarP(&cacheServerListen, "listen", "l", "", "Address to listen on")
+		cmd.Flags().StringVarP(&cacheServerDir, "dir", "d", "", "Directory to store cached objects in")
+		cmd.Flags().StringVarP(&cacheServerMaxSize, "max-size", "m", "", "Maximum total size of cached objects")
+		cmd.Flags().StringSliceVar(&cacheServerHosts, "allow-host", nil, "Host to download uncached objects from")
+	})
+}
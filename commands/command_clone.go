@@ -85,7 +85,7 @@ func cloneCommand(cmd *cobra.Command, args []string) {
 			// If --no-checkout or --bare then we shouldn't check out, just fetch instead
 			fetchRef(ref.Name, filter, nil)
 		} else {
-			pull(filter)
+			pull(filter, buildPriorityFilter(cfg, nil))
 			err := postCloneSubmodules(args)
 			if err != nil {
 				Exit(tr.Tr.Get("Error performing `git lfs pull` for submodules: %v", err))
@@ -26,6 +26,11 @@ var (
 	fetchDryRunArg  bool
 	fetchJsonArg    bool
 	fetchUseStdin   bool
+	fetchResumeArg  bool
+
+	// fetchJournal records the progress of the objects being fetched, or
+	// is nil if it is not recorded.
+	fetchJournal *tq.Journal
 )
 
 type fetchWatcher struct {
@@ -139,6 +144,10 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 		Exit(tr.Tr.Get("Cannot combine --json with --prune"))
 	}
 
+	if !fetchDryRunArg {
+		fetchJournal = openTransferJournal(cfg.Remote(), tq.Download, fetchResumeArg)
+	}
+
 	success := true
 	include, exclude := getIncludeExcludeArgs(cmd)
 	fetchPruneCfg := lfs.NewFetchPruneConfig(cfg.Git)
@@ -190,6 +199,12 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 		prune(fetchPruneCfg, verify, verifyUnreachable, false, fetchDryRunArg, fetchDryRunArg)
 	}
 
+	if success {
+		fetchJournal.Remove()
+	} else {
+		fetchJournal.Close()
+	}
+
 	if !success {
 		c := getAPIClient()
 		e := c.Endpoints.Endpoint("download", cfg.Remote())
@@ -402,6 +417,7 @@ func fetch(allPointers []*lfs.WrappedPointer, watcher *fetchWatcher) bool {
 	q := newDownloadQueue(
 		getTransferManifestOperationRemote("download", cfg.Remote()),
 		cfg.Remote(), tq.WithProgress(meter), tq.DryRun(fetchDryRunArg),
+		tq.WithJournal(fetchJournal),
 	)
 	var wg sync.WaitGroup
 
@@ -419,7 +435,7 @@ func fetch(allPointers []*lfs.WrappedPointer, watcher *fetchWatcher) bool {
 	for _, p := range pointersToFetch {
 		tracerx.Printf("fetch %v [%v]", p.Name, p.Oid)
 
-		q.Add(downloadTransfer(p))
+		q.AddTransfer(downloadTransfer(p))
 	}
 
 	processQueue := time.Now()
@@ -482,5 +498,6 @@ func init() {
 		cmd.Flags().BoolVarP(&fetchDryRunArg, "dry-run", "d", false, "Do not fetch, only show what would be fetched")
 		cmd.Flags().BoolVarP(&fetchJsonArg, "json", "j", false, "Give the output in a stable JSON format for scripts")
 		cmd.Flags().BoolVarP(&fetchUseStdin, "stdin", "", false, "Read refs from stdin")
+		cmd.Flags().BoolVarP(&fetchResumeArg, "resume", "", false, "Skip objects which an interrupted fetch already downloaded")
 	})
 }
@@ -62,6 +62,7 @@ func filterCommand(cmd *cobra.Command, args []string) {
 
 	skip := filterSmudgeSkip || cfg.Os.Bool("GIT_LFS_SKIP_SMUDGE", false)
 	filter := filepathfilter.New(cfg.FetchIncludePaths(), cfg.FetchExcludePaths(), filepathfilter.GitIgnore, cfg.Git)
+	priority := buildPriorityFilter(cfg, nil)
 
 	ptrs := make(map[string]*lfs.Pointer)
 
@@ -117,12 +118,17 @@ func filterCommand(cmd *cobra.Command, args []string) {
 			if req.Header["can-delay"] == "1" {
 				var ptr *lfs.Pointer
 
-				n, delayed, ptr, err = delayedSmudge(gitfilter, s, w, req.Payload, q, req.Header["pathname"], skip, filter)
+				n, delayed, ptr, err = delayedSmudge(gitfilter, s, w, req.Payload, q, req.Header["pathname"], skip, filter, priority)
 
 				if delayed {
 					ptrs[req.Header["pathname"]] = ptr
 				}
 			} else {
+				// Git is blocked waiting for this file, so
+				// rather than adding its object to "q", which
+				// only sends a batch once it is full or Git
+				// lists the available blobs, smudge downloads
+				// it at once in a queue of its own.
 				s.WriteStatus(statusFromErr(nil))
 				from, ferr := incomingOrCached(req.Payload, ptrs[req.Header["pathname"]])
 				if ferr != nil {
@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -129,7 +128,7 @@ func doFsckObjects(include, exclude string, useIndex bool) []string {
 	gitscanner := lfs.NewGitScanner(cfg, func(p *lfs.WrappedPointer, err error) {
 		if err == nil {
 			var pointerOk bool
-			pointerOk, err = fsckPointer(p.Name, p.Oid, p.Size)
+			pointerOk, err = fsckPointer(p.Name, p.Oid, p.Size, p.HashAlgorithm())
 			if !pointerOk {
 				corruptOids = append(corruptOids, p.Oid)
 			}
@@ -212,7 +211,7 @@ func doFsckPointers(include, exclude string) []corruptPointer {
 	return corruptPointers
 }
 
-func fsckPointer(name, oid string, size int64) (bool, error) {
+func fsckPointer(name, oid string, size int64, algo tools.HashAlgorithm) (bool, error) {
 	path := cfg.Filesystem().ObjectPathname(oid)
 
 	tracerx.Printf("Examining %v (%v)", name, path)
@@ -231,7 +230,7 @@ func fsckPointer(name, oid string, size int64) (bool, error) {
 		return false, err
 	}
 
-	oidHash := sha256.New()
+	oidHash := algo.New()
 	_, err = io.Copy(oidHash, f)
 	f.Close()
 	if err != nil {
@@ -1,12 +1,16 @@
 package commands
 
 import (
+	"bufio"
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/filepathfilter"
 	"github.com/git-lfs/git-lfs/v3/git"
 	"github.com/git-lfs/git-lfs/v3/locking"
 	"github.com/git-lfs/git-lfs/v3/tools"
@@ -29,39 +33,84 @@ func lockCommand(cmd *cobra.Command, args []string) {
 		ExitWithError(err)
 	}
 
+	if locksCmdFlags.TTL < 0 {
+		Exit(tr.Tr.Get("Invalid lock lease: %s", locksCmdFlags.TTL))
+	}
+
 	refUpdate := git.NewRefUpdate(cfg.Git, cfg.PushRemote(), cfg.CurrentRef(), nil)
 	lockClient := newLockClient()
 	lockClient.RemoteRef = refUpdate.RemoteRef()
 	defer lockClient.Close()
 
+	if locksCmdFlags.Stdin {
+		args = append(args, readLockPathsFromStdin()...)
+	}
+
 	success := true
-	locks := make([]locking.Lock, 0, len(args))
-	for _, path := range args {
-		path, err := lockPath(lockData, path)
-		if err != nil {
-			Error(err.Error())
+	results := make([]any, 0, len(args))
+	resolved := resolveLockPaths(lockData, args, lockCandidates(lockData))
+	paths := make([]string, 0, len(resolved))
+	for _, r := range resolved {
+		if r.Err != nil {
+			Error(r.Err.Error())
+			results = appendLockFailure(results, r.Arg, r.Err)
 			success = false
 			continue
 		}
+		paths = append(paths, r.Path)
+	}
 
-		lock, err := lockClient.LockFile(path)
+	var locked []locking.LockResult
+	if !success && locksCmdFlags.Atomic {
+		for _, path := range paths {
+			locked = append(locked, locking.LockResult{Path: path, Err: locking.ErrBatchAborted})
+		}
+	} else if len(paths) == 1 {
+		lock, err := lockClient.LockFileWithTTL(paths[0], locksCmdFlags.TTL)
+		locked = []locking.LockResult{{Path: paths[0], Lock: lock, Err: err}}
+	} else if len(paths) > 1 {
+		locked, err = lockClient.LockFiles(paths, locksCmdFlags.TTL, locksCmdFlags.Atomic)
 		if err != nil {
-			Error(tr.Tr.Get("Locking %s failed: %v", path, errors.Cause(err)))
+			locked = make([]locking.LockResult, 0, len(paths))
+			for _, path := range paths {
+				locked = append(locked, locking.LockResult{Path: path, Err: err})
+			}
+		}
+	}
+
+	for _, r := range locked {
+		if r.Err == locking.ErrQueued {
+			if !locksCmdFlags.JSON {
+				Print(tr.Tr.Get("Queued lock on %s until the server can be reached", r.Path))
+				continue
+			}
+			results = append(results, lockFailure{
+				Path:    r.Path,
+				Pending: true,
+			})
+			continue
+		}
+		if r.Err != nil {
+			Error(tr.Tr.Get("Locking %s failed: %v", r.Path, errors.Cause(r.Err)))
+			results = appendLockFailure(results, r.Path, errors.Cause(r.Err))
 			success = false
 			continue
 		}
 
-		locks = append(locks, lock)
-
 		if locksCmdFlags.JSON {
+			results = append(results, r.Lock)
 			continue
 		}
 
-		Print(tr.Tr.Get("Locked %s", path))
+		if r.Lock.ExpiresAt.IsZero() {
+			Print(tr.Tr.Get("Locked %s", r.Path))
+		} else {
+			Print(tr.Tr.Get("Locked %s until %s", r.Path, r.Lock.ExpiresAt.Local().Format(time.RFC3339)))
+		}
 	}
 
 	if locksCmdFlags.JSON {
-		if err := json.NewEncoder(os.Stdout).Encode(locks); err != nil {
+		if err := json.NewEncoder(os.Stdout).Encode(results); err != nil {
 			Error(err.Error())
 			success = false
 		}
@@ -73,6 +122,155 @@ func lockCommand(cmd *cobra.Command, args []string) {
 	}
 }
 
+// lockFailure describes a path which was not locked in the output of `git lfs
+// lock --json`, alongside the locks on the paths which were: either the reason
+// it could not be locked, or that its lock was queued.
+type lockFailure struct {
+	Path    string `json:"path"`
+	Locked  bool   `json:"locked"`
+	Pending bool   `json:"pending,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// appendLockFailure records in the JSON output that path could not be locked
+// because of err.
+func appendLockFailure(results []any, path string, err error) []any {
+	if locksCmdFlags.JSON {
+		results = append(results, lockFailure{
+			Path:   path,
+			Locked: false,
+			Reason: err.Error(),
+		})
+	}
+	return results
+}
+
+// lockCandidates returns a function listing the files in the working tree
+// which a glob pattern given to `git lfs lock` may match: those which are
+// tracked, or untracked and not ignored.
+func lockCandidates(data *lockData) func() ([]string, error) {
+	return func() ([]string, error) {
+		lsFiles, err := git.NewLsFiles(data.rootDir, true, true)
+		if err != nil {
+			return nil, err
+		}
+
+		paths := make([]string, 0, len(lsFiles.Files))
+		for path := range lsFiles.Files {
+			paths = append(paths, path)
+		}
+		return paths, nil
+	}
+}
+
+// readLockPathsFromStdin returns the paths given on standard input to `git
+// lfs lock` or `git lfs unlock`, one per line.
+func readLockPathsFromStdin() []string {
+	var paths []string
+	scanner := bufio.NewScanner(os.Stdin) // line-delimited
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		ExitWithError(errors.Wrap(err, tr.Tr.Get("Error reading from stdin:")))
+	}
+	return paths
+}
+
+// resolvedLockPath is a path to lock or unlock, resolved from an argument to
+// `git lfs lock` or `git lfs unlock`.
+type resolvedLockPath struct {
+	// Arg is the argument from which the path was resolved.
+	Arg string
+	// Path is the path relative to the root of the repository, as returned
+	// by lockPath.
+	Path string
+	// Pattern is whether Arg was a glob pattern.
+	Pattern bool
+	// Err is the reason Arg could not be resolved, if it could not.
+	Err error
+}
+
+// resolveLockPaths resolves each of the given arguments to a path with
+// lockPath, omitting duplicates.
+//
+// An argument which contains glob characters and does not name an existing
+// file is instead taken as a pattern, and is expanded into each path returned
+// by candidates which it matches. Patterns are interpreted as in a .gitignore
+// file in the working directory, so "*.psd" matches files in subdirectories,
+// too, while "art/*.psd" does not. The candidates are listed once, when the
+// first pattern is found, and should be relative to the root of the
+// repository.
+func resolveLockPaths(data *lockData, args []string, candidates func() ([]string, error)) []resolvedLockPath {
+	var candidatePaths []string
+	var candidatesErr error
+	listed := false
+
+	seen := make(map[string]bool, len(args))
+	resolved := make([]resolvedLockPath, 0, len(args))
+	for _, arg := range args {
+		path, err := lockPath(data, arg)
+		if !isLockPattern(arg) {
+			if err == nil {
+				if seen[path] {
+					continue
+				}
+				seen[path] = true
+			}
+			resolved = append(resolved, resolvedLockPath{Arg: arg, Path: path, Err: err})
+			continue
+		}
+
+		if err != nil {
+			resolved = append(resolved, resolvedLockPath{Arg: arg, Pattern: true, Err: err})
+			continue
+		}
+
+		if !listed {
+			candidatePaths, candidatesErr = candidates()
+			sort.Strings(candidatePaths)
+			listed = true
+		}
+		if candidatesErr != nil {
+			err = errors.New(tr.Tr.Get("unable to expand %q: %v", arg, candidatesErr))
+			resolved = append(resolved, resolvedLockPath{Arg: arg, Pattern: true, Err: err})
+			continue
+		}
+
+		pattern := filepathfilter.NewPattern(path, filepathfilter.GitIgnore, cfg.Git)
+		matched := false
+		for _, candidate := range candidatePaths {
+			if !pattern.Match(candidate) {
+				continue
+			}
+
+			matched = true
+			if !seen[candidate] {
+				seen[candidate] = true
+				resolved = append(resolved, resolvedLockPath{Arg: arg, Path: candidate, Pattern: true})
+			}
+		}
+		if !matched {
+			err = errors.New(tr.Tr.Get("no paths match %q", arg))
+			resolved = append(resolved, resolvedLockPath{Arg: arg, Pattern: true, Err: err})
+		}
+	}
+	return resolved
+}
+
+// isLockPattern returns whether the argument to `git lfs lock` or `git lfs
+// unlock` is a glob pattern rather than a path: that is, whether it contains
+// glob characters and no file by that name exists.
+func isLockPattern(arg string) bool {
+	if !strings.ContainsAny(arg, "*?[") {
+		return false
+	}
+	_, err := os.Lstat(arg)
+	return os.IsNotExist(err)
+}
+
 type lockData struct {
 	rootDir    string
 	workingDir string
@@ -144,5 +342,8 @@ func init() {
 	RegisterCommand("lock", lockCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&lockRemote, "remote", "r", "", "specify which remote to use when interacting with locks")
 		cmd.Flags().BoolVarP(&locksCmdFlags.JSON, "json", "j", false, "Give the output in a stable JSON format for scripts")
+		cmd.Flags().DurationVarP(&locksCmdFlags.TTL, "ttl", "", 0, "expire the lock after the given duration unless it is renewed")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Stdin, "stdin", "", false, "read paths to lock from standard input")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Atomic, "atomic", "", false, "lock all of the paths or none of them")
 	})
 }
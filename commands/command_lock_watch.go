@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"context"
+	"os"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/git"
+	"github.com/git-lfs/git-lfs/v3/lockwatch"
+	"github.com/git-lfs/git-lfs/v3/subprocess"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lockWatchReleaseOnPush bool
+	lockWatchNotifyCommand string
+)
+
+func lockWatchCommand(cmd *cobra.Command, args []string) {
+	if len(lockRemote) > 0 {
+		cfg.SetRemote(lockRemote)
+		cfg.SetPushRemote(lockRemote)
+	}
+
+	setupWorkingCopy()
+	root := cfg.LocalWorkingDir()
+
+	refUpdate := git.NewRefUpdate(cfg.Git, cfg.PushRemote(), cfg.CurrentRef(), nil)
+	lockClient := newLockClient()
+	lockClient.RemoteRef = refUpdate.RemoteRef()
+	defer lockClient.Close()
+
+	notifyCommand := lockWatchNotifyCommand
+	if len(notifyCommand) == 0 {
+		notifyCommand, _ = cfg.Git.Get("lfs.lockwatch.notifycommand")
+	}
+
+	watcher := lockwatch.New(lockClient, root, lockwatch.Options{
+		Remote:        cfg.PushRemote(),
+		ReleaseOnPush: lockWatchReleaseOnPush || cfg.Git.Bool("lfs.lockwatch.releaseonpush", false),
+		ReadOnly:      lockClient.SetLockableFilesReadOnly,
+		Notify: func(message string) {
+			Print(message)
+			if len(notifyCommand) > 0 {
+				runLockWatchNotifyCommand(notifyCommand, message)
+			}
+		},
+	})
+
+	// The watcher's paths are relative to the root of the working tree,
+	// and are passed to Git as such, so run from there.
+	if err := os.Chdir(root); err != nil {
+		ExitWithError(errors.Wrap(err, tr.Tr.Get("could not change to the root of the working tree")))
+	}
+
+	Print(tr.Tr.Get("Watching %s for changes to lockable files", root))
+	if err := watcher.Run(context.Background()); err != nil {
+		ExitWithError(err)
+	}
+}
+
+// runLockWatchNotifyCommand runs the shell command given by
+// lfs.lockwatch.notifycommand or --notify-command to tell the user about
+// message, replacing "%m" in it with the message.
+func runLockWatchNotifyCommand(command, message string) {
+	formatted := subprocess.FormatPercentSequences(command, map[string]string{"m": message})
+	cmd, err := subprocess.ExecCommand("sh", "-c", formatted)
+	if err == nil {
+		err = cmd.Run()
+	}
+	if err != nil {
+		Error(tr.Tr.Get("failed to run notify command %q: %s", formatted, err))
+	}
+}
+
+func init() {
+	RegisterCommand("lock-watch", lockWatchCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVarP(&lockRemote, "remote", "r", "", "specify which remote to use when interacting with locks")
+		cmd.Flags().BoolVarP(&lockWatchReleaseOnPush, "release-on-push", "", false, "release locks once changes are committed and pushed")
+		cmd.Flags().StringVarP(&lockWatchNotifyCommand, "notify-command", "", "", "shell command to run with each notification")
+	})
+}
@@ -1,10 +1,13 @@
 package commands
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/git"
@@ -49,6 +52,64 @@ func locksCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if locksCmdFlags.Sync {
+		if locksCmdFlags.Cached || locksCmdFlags.Local || locksCmdFlags.Verify || locksCmdFlags.Renew {
+			Exit(tr.Tr.Get("--sync option can't be combined with --cached, --local, --verify or --renew"))
+		}
+		if len(filters) > 0 || locksCmdFlags.Limit > 0 {
+			Exit(tr.Tr.Get("--sync option can't be combined with filters or --limit"))
+		}
+		syncLocks(lockClient)
+		return
+	}
+
+	if len(locksCmdFlags.Wait) > 0 || locksCmdFlags.Watch {
+		if locksCmdFlags.Cached || locksCmdFlags.Local || locksCmdFlags.Verify || locksCmdFlags.Renew {
+			Exit(tr.Tr.Get("--wait and --watch options can't be combined with --cached, --local, --verify or --renew"))
+		}
+		if locksCmdFlags.Limit > 0 {
+			Exit(tr.Tr.Get("--wait and --watch options can't be combined with --limit"))
+		}
+	}
+	if len(locksCmdFlags.Wait) > 0 {
+		if locksCmdFlags.Watch || len(filters) > 0 {
+			Exit(tr.Tr.Get("--wait option can't be combined with --watch or filters"))
+		}
+		if locksCmdFlags.TTL != 0 && !locksCmdFlags.Acquire {
+			Exit(tr.Tr.Get("--ttl option requires --renew or --acquire"))
+		}
+		path, err := lockPath(lockData, locksCmdFlags.Wait)
+		if err != nil {
+			Exit(tr.Tr.Get("Unable to determine path: %v", err))
+		}
+		waitForLock(lockClient, path)
+		return
+	} else if locksCmdFlags.Acquire || locksCmdFlags.Timeout != 0 {
+		Exit(tr.Tr.Get("--acquire and --timeout options require --wait"))
+	}
+	if locksCmdFlags.Watch {
+		watchLocks(lockClient, filters)
+		return
+	}
+
+	if locksCmdFlags.Renew {
+		if locksCmdFlags.TTL <= 0 {
+			Exit(tr.Tr.Get("--renew option requires a positive --ttl"))
+		}
+		if locksCmdFlags.Cached {
+			Exit(tr.Tr.Get("--renew option can't be combined with --cached"))
+		}
+		if locksCmdFlags.Local {
+			Exit(tr.Tr.Get("--renew option can't be combined with --local"))
+		}
+		renewLocks(lockClient, filters)
+		return
+	} else if locksCmdFlags.TTL != 0 {
+		Exit(tr.Tr.Get("--ttl option requires --renew"))
+	}
+
+	lockClient.IncludeExpired = locksCmdFlags.Expired
+
 	if locksCmdFlags.Verify {
 		if len(filters) > 0 {
 			Exit(tr.Tr.Get("--verify option can't be combined with filters"))
@@ -80,9 +141,16 @@ func locksCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	pending := pendingLocks(lockClient, filters)
+
 	// Print any we got before exiting
 
 	if locksCmdFlags.JSON {
+		if len(pending) > 0 && !locksCmdFlags.Verify {
+			jsonWriteFunc = func(writer io.Writer) error {
+				return json.NewEncoder(writer).Encode(locksWithPending(locks, pending))
+			}
+		}
 		if err := jsonWriteFunc(os.Stdout); err != nil {
 			Error(err.Error())
 		}
@@ -102,7 +170,23 @@ func locksCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// Queued unlocks are shown alongside the locks they will release, and
+	// queued locks, or unlocks of locks not listed, after them.
+	unlocking := make(map[string]bool)
+	var unlisted []locking.PendingLock
+	for _, p := range pending {
+		if !p.IsLock() {
+			if _, ok := locksByPath[p.Path]; ok {
+				unlocking[p.Path] = true
+				continue
+			}
+		}
+		unlisted = append(unlisted, p)
+		maxPathLen = max(maxPathLen, len(pendingLockPath(p)))
+	}
+
 	sort.Strings(lockPaths)
+	now := time.Now()
 	for _, lockPath := range lockPaths {
 		var ownerName string
 		lock := locksByPath[lockPath]
@@ -121,15 +205,337 @@ func locksCommand(cmd *cobra.Command, args []string) {
 			}
 		}
 
-		Print("%s%s%s\t%s%s\tID:%s", kind, lock.Path, strings.Repeat(" ", pathPadding),
+		status := lockExpiry(lock, now)
+		if unlocking[lock.Path] {
+			status += "\t" + tr.Tr.Get("(pending unlock)")
+		}
+
+		Print("%s%s%s\t%s%s\tID:%s%s", kind, lock.Path, strings.Repeat(" ", pathPadding),
 			ownerName, strings.Repeat(" ", namePadding),
-			lock.Id,
+			lock.Id, status,
 		)
 	}
 
+	for _, p := range unlisted {
+		kind := ""
+		if locksOwned != nil {
+			kind = "O "
+		}
+
+		path := pendingLockPath(p)
+		status := tr.Tr.Get("(pending lock)")
+		if !p.IsLock() {
+			status = tr.Tr.Get("(pending unlock)")
+		}
+		Print("%s%s%s\t%s\t%s", kind, path, strings.Repeat(" ", maxPathLen-len(path)),
+			strings.Repeat(" ", maxNameLen), status)
+	}
+
+	if err != nil {
+		Exit(tr.Tr.Get("Error while retrieving locks: %v", errors.Cause(err)))
+	}
+}
+
+// renewLocks extends the leases of the current user's locks which match the
+// given filters, so that they expire once the duration given by --ttl has
+// passed.
+func renewLocks(lockClient *locking.Client, filters map[string]string) {
+	// A lock whose lease has just expired may still be renewed, if the
+	// server has not yet released it.
+	lockClient.IncludeExpired = true
+	ourLocks, _, err := lockClient.SearchLocksVerifiable(0, false)
 	if err != nil {
 		Exit(tr.Tr.Get("Error while retrieving locks: %v", errors.Cause(err)))
 	}
+
+	// Locks which never expire have no lease to renew, and are only
+	// renewed, so as to give them one, if they were chosen explicitly.
+	selected := len(filters["path"]) > 0 || len(filters["id"]) > 0
+
+	success := true
+	renewed := make([]locking.Lock, 0, len(ourLocks))
+	for _, lock := range ourLocks {
+		if (len(filters["path"]) > 0 && filters["path"] != lock.Path) ||
+			(len(filters["id"]) > 0 && filters["id"] != lock.Id) {
+			continue
+		}
+		if !selected && lock.ExpiresAt.IsZero() {
+			continue
+		}
+
+		renewedLock, err := lockClient.RenewLock(lock.Id, locksCmdFlags.TTL)
+		if err != nil {
+			Error(tr.Tr.Get("Renewing lock on %s failed: %v", lock.Path, errors.Cause(err)))
+			success = false
+			continue
+		}
+
+		renewed = append(renewed, renewedLock)
+		if !locksCmdFlags.JSON {
+			Print(tr.Tr.Get("Renewed lock on %s until %s", renewedLock.Path, renewedLock.ExpiresAt.Local().Format(time.RFC3339)))
+		}
+	}
+
+	if locksCmdFlags.JSON {
+		if err := lockClient.EncodeLocks(renewed, os.Stdout); err != nil {
+			Error(err.Error())
+			success = false
+		}
+	}
+
+	if !success {
+		lockClient.Close()
+		ExitWithCode(2)
+	}
+}
+
+// syncLocks replays the locks and unlocks which were queued because the server
+// could not be reached, reporting those which the server refused.
+func syncLocks(lockClient *locking.Client) {
+	results, err := lockClient.SyncPending()
+
+	success := true
+	synced := make([]lockSyncResult, 0, len(results))
+	for _, r := range results {
+		path := pendingLockPath(r.Pending)
+		result := lockSyncResult{
+			Path:      path,
+			Operation: r.Pending.Operation,
+			Synced:    r.Err == nil,
+		}
+
+		if r.Err != nil {
+			result.Reason = errors.Cause(r.Err).Error()
+			if r.Pending.IsLock() {
+				Error(tr.Tr.Get("Locking %s failed: %v", path, result.Reason))
+			} else {
+				Error(tr.Tr.Get("Unlocking %s failed: %v", path, result.Reason))
+			}
+			success = false
+		} else if r.Pending.IsLock() {
+			result.Lock = &r.Lock
+			if !locksCmdFlags.JSON {
+				Print(tr.Tr.Get("Locked %s", path))
+			}
+		} else if !locksCmdFlags.JSON {
+			Print(tr.Tr.Get("Unlocked %s", path))
+		}
+		synced = append(synced, result)
+	}
+
+	if locksCmdFlags.JSON {
+		if err := json.NewEncoder(os.Stdout).Encode(synced); err != nil {
+			Error(err.Error())
+			success = false
+		}
+	} else if err == nil && len(results) == 0 {
+		Print(tr.Tr.Get("No queued locks or unlocks"))
+	}
+
+	if err != nil {
+		lockClient.Close()
+		Exit(tr.Tr.Get("Unable to reach the server; %d locks or unlocks are still queued: %v",
+			len(pendingLocks(lockClient, nil)), errors.Cause(err)))
+	}
+	if !success {
+		lockClient.Close()
+		ExitWithCode(2)
+	}
+}
+
+// watchLocks reports each lock matching the given filters which is created or
+// deleted on the server, until the command is interrupted.
+func watchLocks(lockClient *locking.Client, filters map[string]string) {
+	if !locksCmdFlags.JSON {
+		Error(tr.Tr.Get("Watching for changes to locks"))
+	}
+
+	err := lockClient.WatchLocks(context.Background(), filters, locksCmdFlags.Interval, func(change locking.LockChange) {
+		notifyLockChange(change.Type, change.Lock, change.Time)
+	})
+	if err != nil {
+		lockClient.Close()
+		Exit(tr.Tr.Get("Error while retrieving locks: %v", errors.Cause(err)))
+	}
+}
+
+// waitForLock blocks until path is unlocked, and then locks it if --acquire
+// was given. If somebody else locks it first, it waits again.
+func waitForLock(lockClient *locking.Client, path string) {
+	ctx := context.Background()
+	if locksCmdFlags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, locksCmdFlags.Timeout)
+		defer cancel()
+	}
+
+	// A lock which cannot be made now is of no use to someone waiting
+	// for it.
+	lockClient.QueueOffline = false
+
+	if !locksCmdFlags.JSON {
+		Error(tr.Tr.Get("Waiting for %s to be unlocked", path))
+	}
+
+	for {
+		released, err := lockClient.WaitForUnlock(ctx, path, locksCmdFlags.Interval)
+		if err == context.DeadlineExceeded {
+			lockClient.Close()
+			Error(tr.Tr.Get("Timed out waiting for %s to be unlocked", path))
+			ExitWithCode(2)
+		} else if err != nil {
+			lockClient.Close()
+			Exit(tr.Tr.Get("Error while retrieving locks: %v", errors.Cause(err)))
+		}
+
+		if len(released.Id) > 0 {
+			notifyLockChange(locking.LockChangeUnlocked, released, time.Now())
+		} else {
+			notifyLockChange(locking.LockChangeUnlocked, locking.Lock{Path: path}, time.Now())
+		}
+		if !locksCmdFlags.Acquire {
+			return
+		}
+
+		lock, err := lockClient.LockFileWithTTL(path, locksCmdFlags.TTL)
+		if err == nil {
+			notifyLockChange(lockAcquired, lock, time.Now())
+			return
+		}
+
+		// Somebody else may have locked the path first, in which case
+		// we wait for them to release it, too.
+		locks, serr := lockClient.SearchLocks(map[string]string{"path": path}, 1, false, false)
+		if serr != nil || len(locks) == 0 {
+			lockClient.Close()
+			Exit(tr.Tr.Get("Locking %s failed: %v", path, errors.Cause(err)))
+		}
+		notifyLockChange(locking.LockChangeLocked, locks[0], time.Now())
+	}
+}
+
+// lockAcquired is the event in the output of `git lfs locks --wait --acquire`
+// when the path being waited for has been locked.
+const lockAcquired = "acquired"
+
+// lockNotification describes a change to a lock in the output of `git lfs
+// locks --watch --json` and `git lfs locks --wait --json`, one per line.
+type lockNotification struct {
+	// Event is one of "locked", "unlocked" or "acquired".
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Message describes the change, for display in a notification.
+	Message string       `json:"message"`
+	Lock    locking.Lock `json:"lock"`
+}
+
+// notifyLockChange reports a change of the given type to lock, seen at the
+// given time, as a line of JSON if --json was given, or as a message
+// otherwise.
+func notifyLockChange(event string, lock locking.Lock, at time.Time) {
+	var message string
+	switch {
+	case event == lockAcquired:
+		message = tr.Tr.Get("Locked %s", lock.Path)
+	case event == locking.LockChangeUnlocked && len(lock.Id) == 0:
+		message = tr.Tr.Get("%s is not locked", lock.Path)
+	case event == locking.LockChangeUnlocked:
+		message = tr.Tr.Get("%s was unlocked", lock.Path)
+	case lock.Owner != nil:
+		message = tr.Tr.Get("%s was locked by %s", lock.Path, lock.Owner.Name)
+	default:
+		message = tr.Tr.Get("%s was locked", lock.Path)
+	}
+
+	if !locksCmdFlags.JSON {
+		Print(message)
+		return
+	}
+
+	err := json.NewEncoder(os.Stdout).Encode(lockNotification{
+		Event:   event,
+		Time:    at,
+		Message: message,
+		Lock:    lock,
+	})
+	if err != nil {
+		Error(err.Error())
+	}
+}
+
+// lockSyncResult describes the result of replaying a queued lock or unlock in
+// the output of `git lfs locks --sync --json`.
+type lockSyncResult struct {
+	Path      string        `json:"path"`
+	Operation string        `json:"operation"`
+	Synced    bool          `json:"synced"`
+	Lock      *locking.Lock `json:"lock,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+}
+
+// pendingLockJSON describes a queued lock or unlock in the output of `git lfs
+// locks --json`, alongside the locks.
+type pendingLockJSON struct {
+	Path     string    `json:"path,omitempty"`
+	Id       string    `json:"id,omitempty"`
+	Pending  string    `json:"pending"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// pendingLocks returns the locks and unlocks queued for the current remote ref
+// which match the given filters.
+func pendingLocks(lockClient *locking.Client, filters map[string]string) []locking.PendingLock {
+	var pending []locking.PendingLock
+	for _, p := range lockClient.PendingLocks() {
+		if p.Ref != lockClient.RemoteRef.Refspec() ||
+			(len(filters["path"]) > 0 && filters["path"] != p.Path) ||
+			(len(filters["id"]) > 0 && filters["id"] != p.Id) {
+			continue
+		}
+		pending = append(pending, p)
+	}
+	return pending
+}
+
+// locksWithPending returns the entries of the output of `git lfs locks --json`
+// for the given locks and queued locks and unlocks.
+func locksWithPending(locks []locking.Lock, pending []locking.PendingLock) []any {
+	entries := make([]any, 0, len(locks)+len(pending))
+	for _, lock := range locks {
+		entries = append(entries, lock)
+	}
+	for _, p := range pending {
+		entries = append(entries, pendingLockJSON{
+			Path:     p.Path,
+			Id:       p.Id,
+			Pending:  p.Operation,
+			QueuedAt: p.QueuedAt,
+		})
+	}
+	return entries
+}
+
+// pendingLockPath returns the path of a queued lock or unlock, or its lock ID
+// if its path is unknown.
+func pendingLockPath(p locking.PendingLock) string {
+	if len(p.Path) == 0 {
+		return "ID:" + p.Id
+	}
+	return p.Path
+}
+
+// lockExpiry returns a column describing when the lease of the lock expires,
+// or an empty string if it does not.
+func lockExpiry(lock locking.Lock, now time.Time) string {
+	if lock.ExpiresAt.IsZero() {
+		return ""
+	}
+
+	expiresAt := lock.ExpiresAt.Local().Format(time.RFC3339)
+	if lock.Expired(now) {
+		return "\t" + tr.Tr.Get("expired %s", expiresAt)
+	}
+	return "\t" + tr.Tr.Get("expires %s", expiresAt)
 }
 
 // locksFlags wraps up and holds all of the flags that can be given to the
@@ -155,6 +561,34 @@ type locksFlags struct {
 	// for non-local queries, verify lock owner on server and
 	// denote our locks in output
 	Verify bool
+	// Expired includes locks whose leases have expired in the results.
+	Expired bool
+	// Renew extends the leases of our locks by TTL.
+	Renew bool
+	// TTL is the length of the lease to take on a lock, after which it
+	// expires unless it is renewed.
+	TTL time.Duration
+	// Stdin reads further paths to lock or unlock from standard input,
+	// one per line.
+	Stdin bool
+	// Atomic locks or unlocks either all of the given paths or none of
+	// them.
+	Atomic bool
+	// Sync replays the locks and unlocks which were queued because the
+	// server could not be reached.
+	Sync bool
+	// Watch reports locks as they are created or deleted on the server.
+	Watch bool
+	// Wait is a path to wait to be unlocked.
+	Wait string
+	// Acquire locks the path given by Wait once it is unlocked.
+	Acquire bool
+	// Interval is how often to search the server for its locks while
+	// watching or waiting, when it does not push changes to them.
+	Interval time.Duration
+	// Timeout is how long to wait for the path given by Wait to be
+	// unlocked, or zero to wait indefinitely.
+	Timeout time.Duration
 }
 
 // Filters produces a filter based on locksFlags instance.
@@ -186,5 +620,14 @@ func init() {
 		cmd.Flags().BoolVarP(&locksCmdFlags.Cached, "cached", "", false, "list cached lock information from the last remote query, instead of actually querying the server")
 		cmd.Flags().BoolVarP(&locksCmdFlags.Verify, "verify", "", false, "verify lock owner on server and mark own locks by 'O'")
 		cmd.Flags().BoolVarP(&locksCmdFlags.JSON, "json", "j", false, "Give the output in a stable JSON format for scripts")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Expired, "expired", "", false, "include locks whose leases have expired")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Renew, "renew", "", false, "renew the leases of own locks for the duration given by --ttl")
+		cmd.Flags().DurationVarP(&locksCmdFlags.TTL, "ttl", "", 0, "length of the lease to renew locks for")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Sync, "sync", "", false, "replay locks and unlocks queued while the server was unreachable")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Watch, "watch", "", false, "report locks as they are created or deleted, until interrupted")
+		cmd.Flags().StringVarP(&locksCmdFlags.Wait, "wait", "", "", "wait until the given path is unlocked")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Acquire, "acquire", "", false, "lock the path given by --wait once it is unlocked")
+		cmd.Flags().DurationVarP(&locksCmdFlags.Interval, "interval", "", locking.DefaultWatchInterval, "how often to check the server for changes to locks")
+		cmd.Flags().DurationVarP(&locksCmdFlags.Timeout, "timeout", "", 0, "give up waiting for --wait after this long")
 	})
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"path/filepath"
 	"strings"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
@@ -14,6 +15,7 @@ import (
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/git-lfs/gitobj/v2"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -49,6 +51,10 @@ var (
 	// commits
 	objectMapFilePath string
 
+	// migrateResume continues a migration from the checkpoint saved when
+	// it was interrupted
+	migrateResume bool
+
 	// migrateNoRewrite is the flag indicating whether or not the
 	// command should rewrite git history
 	migrateNoRewrite bool
@@ -117,9 +123,17 @@ func rewriteOptions(args []string, opts *githistory.RewriteOptions, l *tasklog.L
 
 		UpdateRefs:        opts.UpdateRefs,
 		Verbose:           opts.Verbose,
+		Concurrency:       opts.Concurrency,
 		ObjectMapFilePath: opts.ObjectMapFilePath,
 
+		CheckpointPath: opts.CheckpointPath,
+		CheckpointKey:  opts.CheckpointKey,
+		Resume:         opts.Resume,
+		SaveStateFn:    opts.SaveStateFn,
+		RestoreStateFn: opts.RestoreStateFn,
+
 		BlobFn:            opts.BlobFn,
+		BlobCompleteFn:    opts.BlobCompleteFn,
 		TreePreCallbackFn: opts.TreePreCallbackFn,
 		TreeCallbackFn:    opts.TreeCallbackFn,
 	}, nil
@@ -334,6 +348,22 @@ func getHistoryRewriter(cmd *cobra.Command, db *gitobj.ObjectDatabase, l *tasklo
 		githistory.WithFilter(filter), githistory.WithLogger(l))
 }
 
+// migrateCheckpoint returns the path of the checkpoint saved by the migration
+// given by "cmd" and "args", and the key identifying that migration, which
+// includes its arguments and any flags affecting its result.
+func migrateCheckpoint(cmd *cobra.Command, args []string) (path, key string) {
+	parts := append([]string{cmd.Name()}, args...)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		switch f.Name {
+		case "resume", "verbose", "yes":
+		default:
+			parts = append(parts, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+		}
+	})
+
+	return filepath.Join(cfg.Filesystem().CheckpointDir(), "migrate.json"), strings.Join(parts, " ")
+}
+
 func ensureWorkingCopyClean(in io.Reader, out io.Writer) {
 	dirty, err := git.IsWorkingCopyDirty()
 	if err != nil {
@@ -398,6 +428,7 @@ func init() {
 	importCmd.Flags().StringVar(&migrateImportAboveFmt, "above", "", "--above=<n>")
 	importCmd.Flags().BoolVar(&migrateVerbose, "verbose", false, "Verbose logging")
 	importCmd.Flags().StringVar(&objectMapFilePath, "object-map", "", "Object map file")
+	importCmd.Flags().BoolVar(&migrateResume, "resume", false, "Resume an interrupted migration")
 	importCmd.Flags().BoolVar(&migrateNoRewrite, "no-rewrite", false, "Add new history without rewriting previous")
 	importCmd.Flags().StringVarP(&migrateCommitMessage, "message", "m", "", "With --no-rewrite, an optional commit message")
 	importCmd.Flags().BoolVar(&migrateFixup, "fixup", false, "Infer filepaths based on .gitattributes")
@@ -405,6 +436,7 @@ func init() {
 	exportCmd := NewCommand("export", migrateExportCommand)
 	exportCmd.Flags().BoolVar(&migrateVerbose, "verbose", false, "Verbose logging")
 	exportCmd.Flags().StringVar(&objectMapFilePath, "object-map", "", "Object map file")
+	exportCmd.Flags().BoolVar(&migrateResume, "resume", false, "Resume an interrupted migration")
 	exportCmd.Flags().StringVar(&exportRemote, "remote", "", "Remote from which to download objects")
 
 	RegisterCommand("migrate", nil, func(cmd *cobra.Command) {
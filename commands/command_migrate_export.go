@@ -12,6 +12,7 @@ import (
 	"github.com/git-lfs/git-lfs/v3/lfs"
 	"github.com/git-lfs/git-lfs/v3/tasklog"
 	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tq"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/git-lfs/gitobj/v2"
 	"github.com/spf13/cobra"
@@ -41,9 +42,14 @@ func migrateExportCommand(cmd *cobra.Command, args []string) {
 	tracked := trackedFromExportFilter(filter)
 	gitfilter := lfs.NewGitFilter(cfg)
 
+	checkpointPath, checkpointKey := migrateCheckpoint(cmd, args)
 	opts := &githistory.RewriteOptions{
 		Verbose:           migrateVerbose,
+		Concurrency:       cfg.MigrateConcurrency(),
 		ObjectMapFilePath: objectMapFilePath,
+		CheckpointPath:    checkpointPath,
+		CheckpointKey:     checkpointKey,
+		Resume:            migrateResume,
 		BlobFn: func(path string, b *gitobj.Blob) (*gitobj.Blob, error) {
 			if filepath.Base(path) == ".gitattributes" {
 				return b, nil
@@ -137,7 +143,13 @@ func migrateExportCommand(cmd *cobra.Command, args []string) {
 			}
 
 			if _, err := os.Stat(downloadPath); os.IsNotExist(err) {
-				q.Add(p.Name, downloadPath, p.Oid, p.Size, false, nil)
+				q.AddTransfer(&tq.Transfer{
+					Name:          p.Name,
+					Path:          downloadPath,
+					Oid:           p.Oid,
+					Size:          p.Size,
+					HashAlgorithm: p.HashAlgorithm(),
+				}, nil)
 			}
 		})
 		gs.ScanRefs(opts.Include, opts.Exclude, nil)
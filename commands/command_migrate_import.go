@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/filepathfilter"
@@ -132,6 +134,7 @@ func migrateImportCommand(cmd *cobra.Command, args []string) {
 
 	tracked := trackedFromFilter(rewriter.Filter())
 	exts := tools.NewOrderedSet()
+	patterns := new(sync.Map)
 	gitfilter := lfs.NewGitFilter(cfg)
 
 	var fixups *gitattr.Tree
@@ -146,9 +149,35 @@ func migrateImportCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	checkpointPath, checkpointKey := migrateCheckpoint(cmd, args)
 	migrate(args, rewriter, l, &githistory.RewriteOptions{
 		Verbose:           migrateVerbose,
+		Concurrency:       cfg.MigrateConcurrency(),
 		ObjectMapFilePath: objectMapFilePath,
+		CheckpointPath:    checkpointPath,
+		CheckpointKey:     checkpointKey,
+		Resume:            migrateResume,
+
+		// The patterns accumulated in "exts" are carried over into
+		// later commits, so they must survive a resumed migration.
+		SaveStateFn: func() ([]byte, error) {
+			patterns := make([]string, 0, exts.Cardinality())
+			for pattern := range exts.Iter() {
+				patterns = append(patterns, pattern)
+			}
+			return json.Marshal(patterns)
+		},
+		RestoreStateFn: func(state []byte) error {
+			var patterns []string
+			if err := json.Unmarshal(state, &patterns); err != nil {
+				return err
+			}
+			for _, pattern := range patterns {
+				exts.Add(pattern)
+			}
+			return nil
+		},
+
 		BlobFn: func(path string, b *gitobj.Blob) (*gitobj.Blob, error) {
 			if filepath.Base(path) == ".gitattributes" {
 				return b, nil
@@ -178,9 +207,9 @@ func migrateImportCommand(cmd *cobra.Command, args []string) {
 			}
 
 			if ext := filepath.Ext(path); len(ext) > 0 && above == 0 {
-				exts.Add(fmt.Sprintf("*%s filter=lfs diff=lfs merge=lfs -text", ext))
+				patterns.Store(path, fmt.Sprintf("*%s filter=lfs diff=lfs merge=lfs -text", ext))
 			} else {
-				exts.Add(fmt.Sprintf("/%s filter=lfs diff=lfs merge=lfs -text", escapeGlobCharacters(path)))
+				patterns.Store(path, fmt.Sprintf("/%s filter=lfs diff=lfs merge=lfs -text", escapeGlobCharacters(path)))
 			}
 
 			return &gitobj.Blob{
@@ -188,6 +217,16 @@ func migrateImportCommand(cmd *cobra.Command, args []string) {
 			}, nil
 		},
 
+		// Blobs may be cleaned concurrently, so add their patterns to
+		// "exts" afterwards, in the order in which they would have
+		// been cleaned one at a time.
+		BlobCompleteFn: func(path string) error {
+			if pattern, ok := patterns.LoadAndDelete(path); ok {
+				exts.Add(pattern.(string))
+			}
+			return nil
+		},
+
 		TreePreCallbackFn: func(path string, t *gitobj.Tree) error {
 			if migrateFixup && path == "/" {
 				var err error
@@ -2,7 +2,6 @@ package commands
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -84,7 +83,14 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 
 		var ptr *lfs.Pointer
 		if pointerNoExtensions || !cfg.InRepo() {
-			oidHash := sha256.New()
+			hashAlgo, err := cfg.HashAlgorithm()
+			if err != nil {
+				Error(err.Error())
+				buildFile.Close()
+				ExitWithCode(1)
+			}
+
+			oidHash := hashAlgo.New()
 			size, err := io.Copy(oidHash, buildFile)
 			if err != nil {
 				Error(err.Error())
@@ -92,7 +98,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 				ExitWithCode(1)
 			}
 
-			ptr = lfs.NewPointer(hex.EncodeToString(oidHash.Sum(nil)), size, nil)
+			ptr = lfs.NewPointerWithHashAlgorithm(hex.EncodeToString(oidHash.Sum(nil)), size, nil, hashAlgo)
 		} else {
 			gitfilter := lfs.NewGitFilter(cfg)
 			hasExtensionsConfig = len(cfg.Extensions()) > 0
@@ -175,6 +175,14 @@ func prune(fetchPruneConfig lfs.FetchPruneConfig, verifyRemote, verifyUnreachabl
 		}()
 	}
 
+	// The local object store doesn't record which algorithm each OID was
+	// computed with, and the pointers of unreachable objects can't be
+	// found, so ask the remote using the configured algorithm.
+	hashAlgo, err := cfg.HashAlgorithm()
+	if err != nil {
+		ExitWithError(err)
+	}
+
 	for _, file := range localObjects {
 		if !retainedObjects.Contains(file.Oid) {
 			prunableObjects = append(prunableObjects, file.Oid)
@@ -188,8 +196,8 @@ func prune(fetchPruneConfig lfs.FetchPruneConfig, verifyRemote, verifyUnreachabl
 			}
 
 			if verifyRemote {
-				verifyQueue.Add(downloadTransfer(&lfs.WrappedPointer{
-					Pointer: lfs.NewPointer(file.Oid, file.Size, nil),
+				verifyQueue.AddTransfer(downloadTransfer(&lfs.WrappedPointer{
+					Pointer: lfs.NewPointerWithHashAlgorithm(file.Oid, file.Size, nil, hashAlgo),
 				}))
 			}
 		}
@@ -364,6 +372,10 @@ func pruneDeleteFiles(prunableObjects []string, logger *tasklog.Logger) {
 			problems.WriteRune('\n')
 			continue
 		}
+		if err = cfg.Filesystem().RemoveChunkIndex(oid); err != nil {
+			problems.WriteString(tr.Tr.Get("Failed to remove chunk index for %v: %v", oid, err))
+			problems.WriteRune('\n')
+		}
 		deletedFiles++
 		task.Count(1)
 	}
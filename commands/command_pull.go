@@ -16,6 +16,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	pullPriorityArg string
+)
+
 func pullCommand(cmd *cobra.Command, args []string) {
 	requireGitVersion()
 	setupRepository()
@@ -29,10 +33,17 @@ func pullCommand(cmd *cobra.Command, args []string) {
 
 	includeArg, excludeArg := getIncludeExcludeArgs(cmd)
 	filter := buildFilepathFilter(cfg, includeArg, excludeArg, true)
-	pull(filter)
+
+	var priority *string
+	if cmd.Flag("priority").Changed {
+		priority = &pullPriorityArg
+	}
+	pull(filter, buildPriorityFilter(cfg, priority))
 }
 
-func pull(filter *filepathfilter.Filter) {
+// pull fetches the objects for the current ref which match "filter" and checks
+// them out, fetching those which match "priority", if it is not nil, first.
+func pull(filter, priority *filepathfilter.Filter) {
 	ref, err := git.CurrentRef()
 	if err != nil {
 		Panic(err, tr.Tr.Get("Could not pull"))
@@ -70,7 +81,9 @@ func pull(filter *filepathfilter.Filter) {
 		meter.Add(p.Size)
 		tracerx.Printf("fetch %v [%v]", p.Name, p.Oid)
 		pointers.Add(p)
-		q.Add(downloadTransfer(p))
+		t, err := downloadTransfer(p)
+		t.Priority = transferPriority(priority, p.Name)
+		q.AddTransfer(t, err)
 	})
 
 	gitscanner.Filter = filter
@@ -156,5 +169,6 @@ func init() {
 	RegisterCommand("pull", pullCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&includeArg, "include", "I", "", "Include a list of paths")
 		cmd.Flags().StringVarP(&excludeArg, "exclude", "X", "", "Exclude a list of paths")
+		cmd.Flags().StringVarP(&pullPriorityArg, "priority", "P", "", "Download a list of paths first")
 	})
 }
@@ -18,6 +18,7 @@ var (
 	pushObjectIDs = false
 	pushAll       = false
 	useStdin      = false
+	pushResume    = false
 
 	// shares some global vars and functions with command_pre_push.go
 )
@@ -47,6 +48,7 @@ func pushCommand(cmd *cobra.Command, args []string) {
 	}
 
 	ctx := newUploadContext(pushDryRun)
+	ctx.useJournal(pushResume)
 
 	var argList []string
 	if useStdin {
@@ -171,5 +173,6 @@ func init() {
 		cmd.Flags().BoolVarP(&pushObjectIDs, "object-id", "o", false, "Push LFS object ID(s)")
 		cmd.Flags().BoolVarP(&useStdin, "stdin", "", false, "Read object IDs or refs from stdin")
 		cmd.Flags().BoolVarP(&pushAll, "all", "a", false, "Push all objects for the current ref to the remote.")
+		cmd.Flags().BoolVarP(&pushResume, "resume", "", false, "Skip objects which an interrupted push already uploaded")
 	})
 }
@@ -29,7 +29,7 @@ var (
 //
 // delayedSmudge returns the number of bytes written, whether the checkout was
 // delayed, the *lfs.Pointer that was smudged, and an error, if one occurred.
-func delayedSmudge(gf *lfs.GitFilter, s *git.FilterProcessScanner, to io.Writer, from io.Reader, q *tq.TransferQueue, filename string, skip bool, filter *filepathfilter.Filter) (int64, bool, *lfs.Pointer, error) {
+func delayedSmudge(gf *lfs.GitFilter, s *git.FilterProcessScanner, to io.Writer, from io.Reader, q *tq.TransferQueue, filename string, skip bool, filter, priority *filepathfilter.Filter) (int64, bool, *lfs.Pointer, error) {
 	ptr, pbuf, perr := lfs.DecodeFrom(from)
 	if perr != nil {
 		// Write 'statusFromErr(nil)', even though 'perr != nil', since
@@ -60,7 +60,14 @@ func delayedSmudge(gf *lfs.GitFilter, s *git.FilterProcessScanner, to io.Writer,
 
 	if !skip && filter.Allows(filename) {
 		if _, statErr := os.Stat(path); statErr != nil && ptr.Size != 0 {
-			q.Add(filename, path, ptr.Oid, ptr.Size, false, nil)
+			q.AddTransfer(&tq.Transfer{
+				Name:          filename,
+				Path:          path,
+				Oid:           ptr.Oid,
+				Size:          ptr.Size,
+				Priority:      transferPriority(priority, filename),
+				HashAlgorithm: ptr.HashAlgorithm(),
+			}, nil)
 			return 0, true, ptr, nil
 		}
 
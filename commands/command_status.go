@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -101,7 +100,16 @@ func formatBlobInfo(s *lfs.PointerScanner, entry *lfs.DiffIndexEntry) string {
 		return from
 	}
 
-	toSha, toSrc, err := blobInfoTo(s, entry)
+	// Hash a file in the working tree with the algorithm of the object it
+	// was cleaned to, so that an unmodified file shows the same OID.
+	var hashAlgo tools.HashAlgorithm
+	if p := s.Pointer(); fromSrc == "LFS" && p != nil {
+		hashAlgo = p.HashAlgorithm()
+	} else if hashAlgo, err = cfg.HashAlgorithm(); err != nil {
+		ExitWithError(err)
+	}
+
+	toSha, toSrc, err := blobInfoTo(s, entry, hashAlgo)
 	if err != nil {
 		ExitWithError(err)
 	}
@@ -116,19 +124,26 @@ func blobInfoFrom(s *lfs.PointerScanner, entry *lfs.DiffIndexEntry) (sha, from s
 		blobSha = entry.DstSha
 	}
 
-	return blobInfo(s, blobSha, entry.SrcName)
+	hashAlgo, err := cfg.HashAlgorithm()
+	if err != nil {
+		return "", "", err
+	}
+	return blobInfo(s, blobSha, entry.SrcName, hashAlgo)
 }
 
-func blobInfoTo(s *lfs.PointerScanner, entry *lfs.DiffIndexEntry) (sha, from string, err error) {
+func blobInfoTo(s *lfs.PointerScanner, entry *lfs.DiffIndexEntry, hashAlgo tools.HashAlgorithm) (sha, from string, err error) {
 	var name string = entry.DstName
 	if len(name) == 0 {
 		name = entry.SrcName
 	}
 
-	return blobInfo(s, entry.DstSha, name)
+	return blobInfo(s, entry.DstSha, name, hashAlgo)
 }
 
-func blobInfo(s *lfs.PointerScanner, blobSha, name string) (sha, from string, err error) {
+// blobInfo returns the abbreviated OID of the Git object blobSha, or if that
+// is zero, of the file name in the working tree hashed with hashAlgo, and where
+// it was found.
+func blobInfo(s *lfs.PointerScanner, blobSha, name string, hashAlgo tools.HashAlgorithm) (sha, from string, err error) {
 	if !git.IsZeroObjectID(blobSha) {
 		s.Scan(blobSha)
 		if err := s.Err(); err != nil {
@@ -162,7 +177,7 @@ func blobInfo(s *lfs.PointerScanner, blobSha, name string) (sha, from string, er
 		return tr.Tr.Get("deleted"), tr.Tr.Get("File"), nil
 	}
 
-	shasum := sha256.New()
+	shasum := hashAlgo.New()
 	if _, err = io.Copy(shasum, f); err != nil {
 		return "", "", err
 	}
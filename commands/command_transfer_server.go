@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/lfsserver"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/spf13/cobra"
+)
+
+var (
+	transferServerUser string
+)
+
+func transferServerCommand(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		Exit(tr.Tr.Get("Usage: git lfs transfer-server [--user=<name>] <path> <operation>"))
+	}
+
+	gitDir, err := transferServerGitDir(args[0])
+	if err != nil {
+		ExitWithError(err)
+	}
+
+	name, err := transferServerUserName()
+	if err != nil {
+		ExitWithError(err)
+	}
+
+	f := fs.New(cfg.Os, gitDir, "", "", cfg.RepositoryPermissions(false))
+	if err := tools.MkdirAll(f.LFSStorageDir, f); err != nil {
+		ExitWithError(errors.Wrap(err, tr.Tr.Get("cannot create LFS storage directory")))
+	}
+
+	locks, err := lfsserver.NewLockStore(filepath.Join(f.LFSStorageDir, "server-locks.json"))
+	if err != nil {
+		ExitWithError(err)
+	}
+
+	server := lfsserver.NewServer(lfsserver.NewFilesystemStorage(f), locks)
+	if err := server.ServeTransfer(os.Stdin, os.Stdout, args[1], name); err != nil {
+		ExitWithError(err)
+	}
+}
+
+// transferServerGitDir returns the Git directory of the repository at path,
+// which may name either a bare repository, with or without its ".git"
+// suffix, or a repository's working tree.
+func transferServerGitDir(path string) (string, error) {
+	for _, dir := range []string{path, path + ".git", filepath.Join(path, ".git")} {
+		if fi, err := os.Stat(filepath.Join(dir, "objects")); err == nil && fi.IsDir() {
+			return filepath.Abs(dir)
+		}
+	}
+	return "", errors.New(tr.Tr.Get("not a Git repository: %q", path))
+}
+
+// transferServerUserName returns the name of the user who owns the locks
+// created in this session.
+func transferServerUserName() (string, error) {
+	if len(transferServerUser) > 0 {
+		return transferServerUser, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", errors.Wrap(err, tr.Tr.Get("cannot determine user name; use --user"))
+	}
+	return u.Username, nil
+}
+
+func init() {
+	RegisterCommand("transfer-server", transferServerCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVarP(&transferServerUser, "user", "u", "", "Name of the user who owns locks created in this session")
+	})
+}
@@ -29,6 +29,7 @@ type unlockResponse struct {
 	Id       string `json:"id,omitempty"`
 	Path     string `json:"path,omitempty"`
 	Unlocked bool   `json:"unlocked"`
+	Pending  bool   `json:"pending,omitempty"`
 	Reason   string `json:"reason,omitempty"`
 }
 
@@ -46,6 +47,10 @@ func handleUnlockError(locks []unlockResponse, id string, path string, err error
 }
 
 func unlockCommand(cmd *cobra.Command, args []string) {
+	if locksCmdFlags.Stdin {
+		args = append(args, readLockPathsFromStdin()...)
+	}
+
 	hasPath := len(args) > 0
 	hasId := len(unlockCmdFlags.Id) > 0
 	if hasPath == hasId {
@@ -72,15 +77,17 @@ func unlockCommand(cmd *cobra.Command, args []string) {
 	locks := make([]unlockResponse, 0, len(args))
 	success := true
 	if hasPath {
-		for _, pathspec := range args {
-			path, err := lockPath(lockData, pathspec)
-			if err != nil {
-				if !unlockCmdFlags.Force {
-					locks = handleUnlockError(locks, "", path, errors.New(tr.Tr.Get("Unable to determine path: %v", err.Error())))
+		resolved := resolveLockPaths(lockData, args, unlockCandidates(lockClient))
+		paths := make([]string, 0, len(resolved))
+		for _, r := range resolved {
+			path := r.Path
+			if r.Err != nil {
+				if !unlockCmdFlags.Force || r.Pattern {
+					locks = handleUnlockError(locks, "", r.Path, errors.New(tr.Tr.Get("Unable to determine path: %v", r.Err.Error())))
 					success = false
 					continue
 				}
-				path = pathspec
+				path = r.Arg
 			}
 
 			if err := unlockAbortIfFileModified(path); err != nil {
@@ -88,20 +95,51 @@ func unlockCommand(cmd *cobra.Command, args []string) {
 				success = false
 				continue
 			}
+			paths = append(paths, path)
+		}
 
-			err = lockClient.UnlockFile(path, unlockCmdFlags.Force)
+		var unlocked []locking.LockResult
+		if !success && locksCmdFlags.Atomic {
+			for _, path := range paths {
+				unlocked = append(unlocked, locking.LockResult{Path: path, Err: locking.ErrBatchAborted})
+			}
+		} else if len(paths) == 1 {
+			err := lockClient.UnlockFile(paths[0], unlockCmdFlags.Force)
+			unlocked = []locking.LockResult{{Path: paths[0], Err: err}}
+		} else if len(paths) > 1 {
+			unlocked, err = lockClient.UnlockFiles(paths, unlockCmdFlags.Force, locksCmdFlags.Atomic)
 			if err != nil {
-				locks = handleUnlockError(locks, "", path, errors.Cause(err))
+				unlocked = make([]locking.LockResult, 0, len(paths))
+				for _, path := range paths {
+					unlocked = append(unlocked, locking.LockResult{Path: path, Err: err})
+				}
+			}
+		}
+
+		for _, r := range unlocked {
+			if r.Err == locking.ErrQueued {
+				if !locksCmdFlags.JSON {
+					Print(tr.Tr.Get("Queued unlock of %s until the server can be reached", r.Path))
+					continue
+				}
+				locks = append(locks, unlockResponse{
+					Path:    r.Path,
+					Pending: true,
+				})
+				continue
+			}
+			if r.Err != nil {
+				locks = handleUnlockError(locks, "", r.Path, errors.Cause(r.Err))
 				success = false
 				continue
 			}
 
 			if !locksCmdFlags.JSON {
-				Print(tr.Tr.Get("Unlocked %s", path))
+				Print(tr.Tr.Get("Unlocked %s", r.Path))
 				continue
 			}
 			locks = append(locks, unlockResponse{
-				Path:     path,
+				Path:     r.Path,
 				Unlocked: true,
 			})
 		}
@@ -110,7 +148,16 @@ func unlockCommand(cmd *cobra.Command, args []string) {
 		unlockAbortIfFileModifiedById(unlockCmdFlags.Id, lockClient)
 
 		err := lockClient.UnlockFileById(unlockCmdFlags.Id, unlockCmdFlags.Force)
-		if err != nil {
+		if err == locking.ErrQueued {
+			if !locksCmdFlags.JSON {
+				Print(tr.Tr.Get("Queued unlock of Lock %s until the server can be reached", unlockCmdFlags.Id))
+			} else {
+				locks = append(locks, unlockResponse{
+					Id:      unlockCmdFlags.Id,
+					Pending: true,
+				})
+			}
+		} else if err != nil {
 			locks = handleUnlockError(locks, unlockCmdFlags.Id, "", errors.New(tr.Tr.Get("Unable to unlock %v: %v", unlockCmdFlags.Id, errors.Cause(err))))
 			success = false
 		} else if !locksCmdFlags.JSON {
@@ -136,6 +183,23 @@ func unlockCommand(cmd *cobra.Command, args []string) {
 	}
 }
 
+// unlockCandidates returns a function listing the paths of the locks on the
+// remote, which a glob pattern given to `git lfs unlock` may match.
+func unlockCandidates(lockClient *locking.Client) func() ([]string, error) {
+	return func() ([]string, error) {
+		locks, err := lockClient.SearchLocks(nil, 0, false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		paths := make([]string, 0, len(locks))
+		for _, lock := range locks {
+			paths = append(paths, lock.Path)
+		}
+		return paths, nil
+	}
+}
+
 func unlockAbortIfFileModified(path string) error {
 	modified, err := git.IsFileModified(path)
 
@@ -188,5 +252,7 @@ func init() {
 		cmd.Flags().StringVarP(&unlockCmdFlags.Id, "id", "i", "", "unlock a lock by its ID")
 		cmd.Flags().BoolVarP(&unlockCmdFlags.Force, "force", "f", false, "forcibly break another user's lock(s)")
 		cmd.Flags().BoolVarP(&locksCmdFlags.JSON, "json", "j", false, "Give the output in a stable JSON format for scripts")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Stdin, "stdin", "", false, "read paths to unlock from standard input")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Atomic, "atomic", "", false, "unlock all of the paths or none of them")
 	})
 }
@@ -14,15 +14,18 @@ import (
 
 	"github.com/git-lfs/git-lfs/v3/config"
 	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/events"
 	"github.com/git-lfs/git-lfs/v3/filepathfilter"
 	"github.com/git-lfs/git-lfs/v3/git"
 	"github.com/git-lfs/git-lfs/v3/lfs"
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
 	"github.com/git-lfs/git-lfs/v3/locking"
 	"github.com/git-lfs/git-lfs/v3/subprocess"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tq"
 	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
 )
 
 // Populate man pages
@@ -129,6 +132,26 @@ func newDownloadQueue(manifest tq.Manifest, remote string, options ...tq.Option)
 	)...)
 }
 
+// openTransferJournal opens the journal of transfers in the given direction to
+// or from the remote, resuming from the journal left by an interrupted
+// transfer if "resume" is true. Since transfers work without a journal, it
+// returns nil if the journal cannot be opened.
+func openTransferJournal(remote string, dir tq.Direction, resume bool) *tq.Journal {
+	operation := "download"
+	if dir == tq.Upload {
+		operation = "upload"
+	}
+	endpoint := getAPIClient().Endpoints.Endpoint(operation, remote)
+
+	path := tq.JournalPath(cfg.Filesystem().JournalDir(), remote, dir)
+	j, err := tq.OpenJournal(path, endpoint.Url, resume)
+	if err != nil {
+		tracerx.Printf("unable to open transfer journal: %s", err)
+		return nil
+	}
+	return j
+}
+
 // fetchRemoteRef returns the remote ref for download operations by looking up
 // the upstream tracking branch for the current local ref. Unlike pushRemoteRef,
 // this does not use push.default logic, which is not meaningful for fetches.
@@ -149,9 +172,40 @@ func buildFilepathFilterWithPatternType(config *config.Configuration, includeArg
 	return filepathfilter.New(inc, exc, patternType, config.Git, determineFilepathFilterCache(config))
 }
 
-func downloadTransfer(p *lfs.WrappedPointer) (name, path, oid string, size int64, missing bool, err error) {
-	path, err = cfg.Filesystem().ObjectPath(p.Oid)
-	return p.Name, path, p.Oid, p.Size, false, err
+// buildPriorityFilter returns a filter matching the paths whose objects should
+// be transferred first, given by "priorityArg" if it is set and otherwise by
+// lfs.fetchpriority, or nil if there are none.
+func buildPriorityFilter(config *config.Configuration, priorityArg *string) *filepathfilter.Filter {
+	var patterns []string
+	if priorityArg == nil {
+		patterns = config.FetchPriorityPaths()
+	} else {
+		patterns = tools.CleanPaths(*priorityArg, ",")
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	return filepathfilter.New(patterns, nil, filepathfilter.GitIgnore, config.Git, determineFilepathFilterCache(config))
+}
+
+// transferPriority returns the priority with which to transfer the object for
+// the file at "path", given a filter from buildPriorityFilter.
+func transferPriority(priority *filepathfilter.Filter, path string) tq.Priority {
+	if priority != nil && priority.Allows(path) {
+		return tq.PriorityHigh
+	}
+	return tq.PriorityNormal
+}
+
+func downloadTransfer(p *lfs.WrappedPointer) (*tq.Transfer, error) {
+	path, err := cfg.Filesystem().ObjectPath(p.Oid)
+	return &tq.Transfer{
+		Name:          p.Name,
+		Path:          path,
+		Oid:           p.Oid,
+		Size:          p.Size,
+		HashAlgorithm: p.HashAlgorithm(),
+	}, err
 }
 
 // Get user-readable manual install steps for hooks
@@ -296,6 +350,9 @@ func doCleanup() {
 		fmt.Fprintln(os.Stderr, tr.Tr.Get("Error closing API client: %s", err))
 	}
 
+	telemetry.Shutdown()
+	events.Close()
+
 	if err := cfg.Cleanup(); err != nil {
 		fmt.Fprintln(os.Stderr, tr.Tr.Get("Error clearing old temporary files: %s", err))
 	}
@@ -79,9 +79,15 @@ func (lv *lockVerifier) Verify(ref *git.Ref) {
 				}
 			}
 		}
-	} else if lv.verifyState == verifyStateUnknown {
-		Error(tr.Tr.Get("Locking support detected on remote %q. Consider enabling it with:", cfg.PushRemote()))
-		Error("  $ git config lfs.%s.locksverify true", lv.endpoint.Url)
+	} else {
+		if lv.verifyState == verifyStateUnknown {
+			Error(tr.Tr.Get("Locking support detected on remote %q. Consider enabling it with:", cfg.PushRemote()))
+			Error("  $ git config lfs.%s.locksverify true", lv.endpoint.Url)
+		}
+
+		// Now that the server can be reached, replay any locks
+		// queued while it could not be.
+		ours = append(ours, syncPendingLocks(ref)...)
 	}
 
 	lv.addLocks(ref, ours, lv.ourLocks)
@@ -91,6 +97,35 @@ func (lv *lockVerifier) Verify(ref *git.Ref) {
 	tracerx.Printf("verified locks for %s", ref.Name)
 }
 
+// syncPendingLocks replays the locks and unlocks queued for ref because the
+// server could not be reached, and returns the locks which were created.
+func syncPendingLocks(ref *git.Ref) []locking.Lock {
+	lockClient := newLockClient()
+	lockClient.RemoteRef = ref
+	defer lockClient.Close()
+
+	results, err := lockClient.SyncPending()
+	created := make([]locking.Lock, 0, len(results))
+	for _, r := range results {
+		path := pendingLockPath(r.Pending)
+		switch {
+		case r.Err != nil && r.Pending.IsLock():
+			Error(tr.Tr.Get("warning: queued lock on %s failed: %v", path, errors.Cause(r.Err)))
+		case r.Err != nil:
+			Error(tr.Tr.Get("warning: queued unlock of %s failed: %v", path, errors.Cause(r.Err)))
+		case r.Pending.IsLock():
+			Error(tr.Tr.Get("Locked %s, as queued while the server was unreachable", path))
+			created = append(created, r.Lock)
+		default:
+			Error(tr.Tr.Get("Unlocked %s, as queued while the server was unreachable", path))
+		}
+	}
+	if err != nil {
+		Error(tr.Tr.Get("warning: unable to replay queued locks: %v", errors.Cause(err)))
+	}
+	return created
+}
+
 func (lv *lockVerifier) addLocks(ref *git.Ref, locks []locking.Lock, set map[string]*refLock) {
 	for _, l := range locks {
 		if rl, ok := set[l.Path]; ok {
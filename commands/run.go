@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/events"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/spf13/cobra"
@@ -29,7 +31,7 @@ var (
 // Each command will initialize the local storage ('.git/lfs') directory when
 // run, unless the PreRun hook is set to nil.
 func NewCommand(name string, runFn func(*cobra.Command, []string)) *cobra.Command {
-	return &cobra.Command{Use: name, Run: runFn, PreRun: setupHTTPLogger}
+	return &cobra.Command{Use: name, Run: runFn, PreRun: setupLogging}
 }
 
 // RegisterCommand creates a direct 'git-lfs' subcommand, given a command name,
@@ -191,6 +193,14 @@ func printHelp(commandName string) {
 	}
 }
 
+// setupLogging sets up the HTTP stats log, the export of telemetry and the
+// event stream, if they are enabled.
+func setupLogging(cmd *cobra.Command, args []string) {
+	setupHTTPLogger(cmd, args)
+	setupTelemetry(cmd, args)
+	setupEvents(cmd, args)
+}
+
 func setupHTTPLogger(cmd *cobra.Command, args []string) {
 	if len(os.Getenv("GIT_LOG_STATS")) < 1 {
 		return
@@ -210,3 +220,23 @@ func setupHTTPLogger(cmd *cobra.Command, args []string) {
 		getAPIClient().LogHTTPStats(file)
 	}
 }
+
+func setupTelemetry(cmd *cobra.Command, args []string) {
+	if err := telemetry.Setup(cfg.Git, cfg.Os, cmd.Name()); err != nil {
+		fmt.Fprintln(os.Stderr, tr.Tr.Get("Error exporting telemetry: %s", err))
+	}
+}
+
+func setupEvents(cmd *cobra.Command, args []string) {
+	// The filters are run by Git with their standard output carrying the
+	// files' contents, and pass GIT_LFS_EVENTS on to any process they
+	// start, so they never write events, wherever they are sent.
+	switch cmd.Name() {
+	case "clean", "smudge", "filter-process":
+		return
+	}
+
+	if err := events.Setup(cfg.Os); err != nil {
+		fmt.Fprintln(os.Stderr, tr.Tr.Get("Error writing events: %s", err))
+	}
+}
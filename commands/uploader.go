@@ -69,6 +69,10 @@ type uploadContext struct {
 	logger *tasklog.Logger
 	meter  *tq.Meter
 
+	// journal records the progress of uploads, or is nil if they are not
+	// recorded
+	journal *tq.Journal
+
 	committerName  string
 	committerEmail string
 
@@ -123,9 +127,21 @@ func (c *uploadContext) NewQueue(options ...tq.Option) *tq.TransferQueue {
 		tq.DryRun(c.DryRun),
 		tq.WithProgress(c.meter),
 		tq.WithBatchSize(cfg.TransferBatchSize()),
+		tq.WithJournal(c.journal),
 	)...)
 }
 
+// useJournal records the progress of uploads in the transfer journal for the
+// remote, so that they may be resumed if interrupted, and skips any objects
+// which the journal of an interrupted push records as uploaded if "resume" is
+// true.
+func (c *uploadContext) useJournal(resume bool) {
+	if c.DryRun {
+		return
+	}
+	c.journal = openTransferJournal(c.Remote, tq.Upload, resume)
+}
+
 func (c *uploadContext) scannerError() error {
 	c.errMu.Lock()
 	defer c.errMu.Unlock()
@@ -238,7 +254,7 @@ func (c *uploadContext) UploadPointers(q *tq.TransferQueue, unfiltered ...*lfs.W
 			ExitWithError(err)
 		}
 
-		q.Add(t.Name, t.Path, t.Oid, t.Size, t.Missing, nil)
+		q.AddTransfer(t, nil)
 		c.SetUploaded(p.Oid)
 	}
 }
@@ -262,6 +278,12 @@ func (c *uploadContext) CollectErrors(tqueue *tq.TransferQueue) {
 func (c *uploadContext) ReportErrors() {
 	c.meter.Finish()
 
+	if len(c.otherErrs) == 0 && len(c.missing) == 0 && len(c.corrupt) == 0 {
+		c.journal.Remove()
+	} else {
+		c.journal.Close()
+	}
+
 	for _, err := range c.otherErrs {
 		FullError(err)
 	}
@@ -353,11 +375,12 @@ func (c *uploadContext) uploadTransfer(p *lfs.WrappedPointer) (*tq.Transfer, err
 	}
 
 	return &tq.Transfer{
-		Name:    filename,
-		Path:    localMediaPath,
-		Oid:     oid,
-		Size:    p.Size,
-		Missing: missing,
+		Name:          filename,
+		Path:          localMediaPath,
+		Oid:           oid,
+		Size:          p.Size,
+		Missing:       missing,
+		HashAlgorithm: p.HashAlgorithm(),
 	}, nil
 }
 
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -191,10 +192,37 @@ func (c *Configuration) TusTransfersAllowed() bool {
 	return c.Git.Bool("lfs.tustransfers", false)
 }
 
+// ChunkedTransfersAllowed returns whether to index objects' content-defined
+// chunks when cleaning them and to offer the "chunked" transfer adapter.
+// Default is false, including if the lfs.chunkedtransfers is invalid
+func (c *Configuration) ChunkedTransfersAllowed() bool {
+	return c.Git.Bool("lfs.chunkedtransfers", false)
+}
+
 func (c *Configuration) TransferBatchSize() int {
 	return c.Git.Int("lfs.transfer.batchSize", 0)
 }
 
+// MigrateConcurrency returns the number of blobs which "git lfs migrate"
+// rewrites at once, as configured by lfs.migrate.concurrency. Default is the
+// number of CPUs available.
+func (c *Configuration) MigrateConcurrency() int {
+	if n := c.Git.Int("lfs.migrate.concurrency", 0); n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// HashAlgorithm returns the hash algorithm used to compute the OIDs of newly
+// cleaned objects, as configured by lfs.hashalgorithm. Default is SHA-256.
+func (c *Configuration) HashAlgorithm() (tools.HashAlgorithm, error) {
+	v, ok := c.Git.Get("lfs.hashalgorithm")
+	if !ok || len(v) == 0 {
+		return tools.DefaultHashAlgorithm, nil
+	}
+	return tools.ParseHashAlgorithm(v)
+}
+
 func (c *Configuration) FetchIncludePaths() []string {
 	patterns, _ := c.Git.Get("lfs.fetchinclude")
 	return tools.CleanPaths(patterns, ",")
@@ -205,6 +233,11 @@ func (c *Configuration) FetchExcludePaths() []string {
 	return tools.CleanPaths(patterns, ",")
 }
 
+func (c *Configuration) FetchPriorityPaths() []string {
+	patterns, _ := c.Git.Get("lfs.fetchpriority")
+	return tools.CleanPaths(patterns, ",")
+}
+
 func (c *Configuration) CurrentRef() *git.Ref {
 	c.loading.Lock()
 	defer c.loading.Unlock()
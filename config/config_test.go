@@ -159,6 +159,24 @@ func TestTusTransfersAllowedInvalidValue(t *testing.T) {
 	assert.Equal(t, false, b)
 }
 
+func TestChunkedTransfersAllowedSetValue(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string][]string{
+			"lfs.chunkedtransfers": []string{"true"},
+		},
+	})
+
+	b := cfg.ChunkedTransfersAllowed()
+	assert.Equal(t, true, b)
+}
+
+func TestChunkedTransfersAllowedDefault(t *testing.T) {
+	cfg := NewFrom(Values{})
+
+	b := cfg.ChunkedTransfersAllowed()
+	assert.Equal(t, false, b)
+}
+
 func TestLoadValidExtension(t *testing.T) {
 	cfg := NewFrom(Values{
 		Git: map[string][]string{
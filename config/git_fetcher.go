@@ -187,7 +187,9 @@ var safeKeys = []string{
 	"lfs.allowincompletepush",
 	"lfs.fetchexclude",
 	"lfs.fetchinclude",
+	"lfs.fetchpriority",
 	"lfs.gitprotocol",
+	"lfs.hashalgorithm",
 	"lfs.locksverify",
 	"lfs.pushurl",
 	"lfs.skipdownloaderrors",
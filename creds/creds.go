@@ -2,6 +2,7 @@ package creds
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/url"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/git-lfs/git-lfs/v3/config"
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/subprocess"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/rubyist/tracerx"
@@ -36,6 +38,12 @@ type CredentialHelper interface {
 }
 
 func (credWrapper *CredentialHelperWrapper) FillCreds() error {
+	_, span := telemetry.Start(context.Background(), "lfs.credential.fill",
+		telemetry.String("url.scheme", FirstEntryForKey(credWrapper.Input, "protocol")),
+		telemetry.String("server.address", FirstEntryForKey(credWrapper.Input, "host")),
+	)
+	defer span.End()
+
 	creds, err := credWrapper.CredentialHelper.Fill(credWrapper.Input)
 	if creds == nil || len(creds) < 1 {
 		errmsg := tr.Tr.Get("Git credentials for %s not found", credWrapper.Url)
@@ -46,6 +54,7 @@ func (credWrapper *CredentialHelperWrapper) FillCreds() error {
 		}
 		err = errors.New(errmsg)
 	}
+	span.SetError(err)
 	credWrapper.Creds = creds
 	return err
 }
@@ -0,0 +1,219 @@
+// Package events writes a stream of machine-readable events describing the
+// progress of a Git LFS command, such as the scanning of history, the transfer
+// of each object and the creation and removal of locks, for use by graphical
+// clients and editor integrations.
+//
+// Each event is written as a single line of JSON to the file descriptor,
+// file or Unix socket named by the GIT_LFS_EVENTS environment variable.
+// Nothing is written unless the stream has been set up with Setup.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// The types of events which may be written to the stream.
+const (
+	// ScanStarted and ScanFinished are written when a scan of the
+	// repository for Git LFS pointers begins and ends.
+	ScanStarted  = "scan_started"
+	ScanFinished = "scan_finished"
+
+	// TaskUpdated is written with the message displayed for a task, such
+	// as the progress of a transfer or a count of objects found, and
+	// TaskCompleted is written with its final message.
+	TaskUpdated   = "task_updated"
+	TaskCompleted = "task_completed"
+
+	// The following are written as each object moves through a transfer
+	// queue.
+	ObjectQueued    = "object_queued"
+	ObjectStarted   = "object_started"
+	ObjectProgress  = "object_progress"
+	ObjectCompleted = "object_completed"
+	ObjectSkipped   = "object_skipped"
+	ObjectFailed    = "object_failed"
+	ObjectRetried   = "object_retried"
+
+	// LockCreated, LockDeleted and LockRenewed are written when an attempt
+	// to create, delete or renew the lease of a lock succeeds or fails.
+	LockCreated = "lock_created"
+	LockDeleted = "lock_deleted"
+	LockRenewed = "lock_renewed"
+
+	// LockQueued and UnlockQueued are written when a lock or unlock is
+	// queued because the server cannot be reached.
+	LockQueued   = "lock_queued"
+	UnlockQueued = "unlock_queued"
+)
+
+// Event is a single event in the stream. Fields which do not apply to the
+// type of the event, or whose values are zero, are omitted.
+type Event struct {
+	Type string    `json:"event"`
+	Time time.Time `json:"time"`
+
+	// Direction is the direction of a transfer, such as "upload" or
+	// "download".
+	Direction string `json:"direction,omitempty"`
+	// Oid is the ID of the object being transferred.
+	Oid string `json:"oid,omitempty"`
+	// Path is the path of the file in the working tree to which an event
+	// refers.
+	Path string `json:"path,omitempty"`
+	// Size is the size of the object being transferred.
+	Size int64 `json:"size,omitempty"`
+	// Bytes is the number of bytes of the object transferred so far.
+	Bytes int64 `json:"bytes,omitempty"`
+	// Retry is the number of times the transfer of an object has been
+	// retried.
+	Retry int `json:"retry,omitempty"`
+
+	// Scan is the kind of scan of the repository, such as "refs".
+	Scan string `json:"scan,omitempty"`
+	// Objects is the number of objects found by a scan.
+	Objects int64 `json:"objects,omitempty"`
+
+	// LockID and Owner are the ID and owner's name of a lock.
+	LockID string `json:"lock_id,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	// ExpiresAt is the time at which the lease of a lock expires.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+	// Message is the message displayed for a task.
+	Message string `json:"message,omitempty"`
+	// Error is the message of the error with which an operation failed.
+	Error string `json:"error,omitempty"`
+}
+
+type env interface {
+	Get(key string) (val string, ok bool)
+}
+
+var (
+	mu   sync.Mutex
+	sink io.WriteCloser
+)
+
+// Setup starts writing events to the destination given by the GIT_LFS_EVENTS
+// environment variable, if it is set. Its value may be the number of an open
+// file descriptor, which is closed along with the stream unless it is standard
+// error, the absolute path of a Unix socket to connect to, or the absolute path
+// of a file to which to append. Standard input and output are refused, since
+// the filters exchange data with Git over them.
+func Setup(osEnv env) error {
+	dest, _ := osEnv.Get("GIT_LFS_EVENTS")
+	if len(dest) == 0 {
+		return nil
+	}
+
+	w, err := open(dest)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	sink = w
+	return nil
+}
+
+func open(dest string) (io.WriteCloser, error) {
+	if fd, err := strconv.ParseUint(dest, 10, 32); err == nil {
+		switch fd {
+		case 0, 1:
+			return nil, errors.New(tr.Tr.Get("GIT_LFS_EVENTS must not be standard input or output"))
+		case 2:
+			return stdWriter{os.Stderr}, nil
+		}
+		return os.NewFile(uintptr(fd), "GIT_LFS_EVENTS"), nil
+	}
+
+	if !filepath.IsAbs(dest) {
+		return nil, errors.New(tr.Tr.Get("GIT_LFS_EVENTS must be a file descriptor or an absolute path"))
+	}
+
+	if fi, err := os.Stat(dest); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		return net.Dial("unix", dest)
+	}
+	return os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+}
+
+// stdWriter writes to standard error, which is left open when the stream is
+// closed.
+type stdWriter struct {
+	*os.File
+}
+
+func (w stdWriter) Close() error {
+	return nil
+}
+
+// Enabled returns whether events are being written.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return sink != nil
+}
+
+// Emit writes the event e to the stream, if it has been set up, setting its
+// time to the current time if it is not set. If the event cannot be written,
+// the stream is closed, rather than causing the command to fail.
+func Emit(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if sink == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	by, err := json.Marshal(e)
+	if err == nil {
+		_, err = sink.Write(append(by, '\n'))
+	}
+	if err != nil {
+		tracerx.Printf("events: unable to write event, closing stream: %s", err)
+		sink.Close()
+		sink = nil
+	}
+}
+
+// ErrorOf returns the message of err, or an empty string if it is nil, for use
+// as the Error field of an event.
+func ErrorOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Close stops writing events and closes the stream.
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if sink == nil {
+		return
+	}
+	if err := sink.Close(); err != nil {
+		tracerx.Printf("events: unable to close stream: %s", err)
+	}
+	sink = nil
+}
@@ -0,0 +1,166 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEnv map[string]string
+
+func (e testEnv) Get(key string) (string, bool) {
+	v, ok := e[key]
+	return v, ok
+}
+
+func readEvents(t *testing.T, path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var evs []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		evs = append(evs, ev)
+	}
+	require.NoError(t, scanner.Err())
+	return evs
+}
+
+func TestEmitToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, Setup(testEnv{"GIT_LFS_EVENTS": path}))
+	require.True(t, Enabled())
+
+	Emit(Event{Type: ScanStarted, Scan: "refs"})
+	Emit(Event{
+		Type:      ObjectProgress,
+		Direction: "upload",
+		Oid:       "abc123",
+		Path:      "a.dat",
+		Size:      10,
+		Bytes:     5,
+	})
+	Emit(Event{Type: ObjectFailed, Oid: "abc123", Retry: 2, Error: "failed"})
+	Close()
+	assert.False(t, Enabled())
+
+	// Nothing is written after the stream is closed.
+	Emit(Event{Type: ScanFinished})
+
+	evs := readEvents(t, path)
+	require.Len(t, evs, 3)
+	for _, ev := range evs {
+		assert.NotEmpty(t, ev["time"])
+		delete(ev, "time")
+	}
+
+	assert.Equal(t, map[string]interface{}{"event": "scan_started", "scan": "refs"}, evs[0])
+	assert.Equal(t, map[string]interface{}{
+		"event":     "object_progress",
+		"direction": "upload",
+		"oid":       "abc123",
+		"path":      "a.dat",
+		"size":      10.0,
+		"bytes":     5.0,
+	}, evs[1])
+	assert.Equal(t, map[string]interface{}{
+		"event": "object_failed",
+		"oid":   "abc123",
+		"retry": 2.0,
+		"error": "failed",
+	}, evs[2])
+}
+
+func TestEmitToFileDescriptor(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.NoError(t, Setup(testEnv{"GIT_LFS_EVENTS": strconv.Itoa(int(w.Fd()))}))
+	Emit(Event{Type: LockCreated, Path: "a.dat", LockID: "1", Owner: "user"})
+	Close()
+
+	// The stream owns the file descriptor, and has closed it.
+	assert.Error(t, w.Close())
+
+	by, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	var ev Event
+	require.NoError(t, json.Unmarshal(by, &ev))
+	assert.Equal(t, LockCreated, ev.Type)
+	assert.Equal(t, "a.dat", ev.Path)
+	assert.Equal(t, "1", ev.LockID)
+	assert.Equal(t, "user", ev.Owner)
+}
+
+func TestEmitToSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "events")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unable to listen on Unix socket: %s", err)
+	}
+	defer l.Close()
+
+	received := make(chan Event, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+
+		var ev Event
+		if err := json.NewDecoder(conn).Decode(&ev); err == nil {
+			received <- ev
+		}
+		close(received)
+	}()
+
+	require.NoError(t, Setup(testEnv{"GIT_LFS_EVENTS": path}))
+	Emit(Event{Type: TaskUpdated, Message: "Uploading LFS objects"})
+	Close()
+
+	ev, ok := <-received
+	require.True(t, ok)
+	assert.Equal(t, TaskUpdated, ev.Type)
+	assert.Equal(t, "Uploading LFS objects", ev.Message)
+	assert.False(t, ev.Time.IsZero())
+}
+
+func TestSetupDisabled(t *testing.T) {
+	require.NoError(t, Setup(testEnv{}))
+	assert.False(t, Enabled())
+
+	Emit(Event{Type: ScanStarted})
+}
+
+func TestSetupStandardInputOrOutput(t *testing.T) {
+	for _, fd := range []string{"0", "1"} {
+		err := Setup(testEnv{"GIT_LFS_EVENTS": fd})
+		assert.EqualError(t, err, "GIT_LFS_EVENTS must not be standard input or output")
+		assert.False(t, Enabled())
+	}
+}
+
+func TestSetupRelativePath(t *testing.T) {
+	err := Setup(testEnv{"GIT_LFS_EVENTS": "events.jsonl"})
+	assert.EqualError(t, err, "GIT_LFS_EVENTS must be a file descriptor or an absolute path")
+	assert.False(t, Enabled())
+}
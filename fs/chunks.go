@@ -0,0 +1,165 @@
+package fs
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+// Chunk is a single content-defined chunk of a Git LFS object.
+type Chunk struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// ChunkIndex lists, in order, the content-defined chunks which make up a Git
+// LFS object. The chunks' contents are not stored separately, but are read
+// from the object itself, at the offset given by the sizes of the chunks
+// before them, so that they may be reused by other objects.
+type ChunkIndex struct {
+	Oid           string  `json:"oid"`
+	Size          int64   `json:"size"`
+	HashAlgorithm string  `json:"hash_algo,omitempty"`
+	Chunks        []Chunk `json:"chunks"`
+}
+
+// NewChunkIndex splits the object with the given OID, read from r, into
+// content-defined chunks, and returns an index listing them. Chunk OIDs are
+// computed with algo, the hash algorithm of the object's OID.
+func NewChunkIndex(oid string, algo tools.HashAlgorithm, r io.Reader) (*ChunkIndex, error) {
+	index := &ChunkIndex{
+		Oid:           oid,
+		HashAlgorithm: algo.String(),
+		Chunks:        make([]Chunk, 0),
+	}
+
+	chunker := tools.NewChunker(r)
+	for {
+		data, err := chunker.Next()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, tr.Tr.Get("error chunking object %s", oid))
+		}
+
+		h := algo.New()
+		h.Write(data)
+		index.Chunks = append(index.Chunks, Chunk{Oid: hex.EncodeToString(h.Sum(nil)), Size: int64(len(data))})
+		index.Size += int64(len(data))
+	}
+}
+
+// LFSChunkDir returns the directory in which chunk indexes are stored.
+func (f *Filesystem) LFSChunkDir() string {
+	return filepath.Join(f.LFSStorageDir, "chunks")
+}
+
+// ReadChunkIndex returns the chunk index of the object with the given OID. If
+// there is none, the returned error satisfies os.IsNotExist.
+func (f *Filesystem) ReadChunkIndex(oid string) (*ChunkIndex, error) {
+	if len(oid) < 4 {
+		return nil, errors.New(tr.Tr.Get("too short object ID: %q", oid))
+	}
+
+	by, err := os.ReadFile(f.chunkIndexPathname(oid))
+	if err != nil {
+		return nil, err
+	}
+
+	var index ChunkIndex
+	if err := json.Unmarshal(by, &index); err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("invalid chunk index for %s", oid))
+	}
+	if index.Oid != oid {
+		return nil, errors.New(tr.Tr.Get("chunk index for %s describes %s", oid, index.Oid))
+	}
+	return &index, nil
+}
+
+// WriteChunkIndex saves the given chunk index, replacing any existing index
+// for the same object.
+func (f *Filesystem) WriteChunkIndex(index *ChunkIndex) error {
+	if len(index.Oid) < 4 {
+		return errors.New(tr.Tr.Get("too short object ID: %q", index.Oid))
+	}
+
+	by, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	path := f.chunkIndexPathname(index.Oid)
+	if err := tools.MkdirAll(filepath.Dir(path), f); err != nil {
+		return errors.New(tr.Tr.Get("error trying to create local storage directory in %q: %s", filepath.Dir(path), err))
+	}
+
+	tmp, err := tools.TempFile(f.TempDir(), "chunks", f)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(by)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = tools.RobustRename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// RemoveChunkIndex removes the chunk index of the object with the given OID,
+// if it has one.
+func (f *Filesystem) RemoveChunkIndex(oid string) error {
+	if len(oid) < 4 {
+		return nil
+	}
+	if err := os.Remove(f.chunkIndexPathname(oid)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// EachChunkIndex calls fn with the chunk index of each object in the local
+// object store. Indexes of objects which are no longer present are removed.
+func (f *Filesystem) EachChunkIndex(fn func(*ChunkIndex)) error {
+	dir := f.LFSChunkDir()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	var eachErr error
+	tools.FastWalkDir(dir, func(parentDir string, info os.FileInfo, err error) {
+		if err != nil {
+			eachErr = err
+			return
+		}
+		if eachErr != nil || info.IsDir() || !oidRE.MatchString(info.Name()) {
+			return
+		}
+
+		index, err := f.ReadChunkIndex(info.Name())
+		if err != nil {
+			return
+		}
+		if !f.ObjectExists(index.Oid, index.Size) {
+			f.RemoveChunkIndex(index.Oid)
+			return
+		}
+		fn(index)
+	})
+	return eachErr
+}
+
+func (f *Filesystem) chunkIndexPathname(oid string) string {
+	return filepath.Join(f.LFSChunkDir(), oid[0:2], oid[2:4], oid)
+}
@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkIndex(t *testing.T) {
+	f := &Filesystem{LFSStorageDir: t.TempDir(), repoPerms: 0755}
+
+	data := make([]byte, 3*1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	sum := sha256.Sum256(data)
+	oid := hex.EncodeToString(sum[:])
+
+	index, err := NewChunkIndex(oid, tools.SHA256, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	assert.Equal(t, oid, index.Oid)
+	assert.Equal(t, int64(len(data)), index.Size)
+	assert.Equal(t, "sha256", index.HashAlgorithm)
+	require.NotEmpty(t, index.Chunks)
+
+	var offset int64
+	for _, chunk := range index.Chunks {
+		chunkSum := sha256.Sum256(data[offset : offset+chunk.Size])
+		assert.Equal(t, chunk.Oid, hex.EncodeToString(chunkSum[:]))
+		offset += chunk.Size
+	}
+	assert.Equal(t, int64(len(data)), offset)
+
+	require.NoError(t, f.WriteChunkIndex(index))
+	read, err := f.ReadChunkIndex(oid)
+	require.NoError(t, err)
+	assert.Equal(t, index, read)
+
+	require.NoError(t, f.RemoveChunkIndex(oid))
+	_, err = f.ReadChunkIndex(oid)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReadChunkIndexMissing(t *testing.T) {
+	f := &Filesystem{LFSStorageDir: t.TempDir(), repoPerms: 0755}
+
+	_, err := f.ReadChunkIndex("4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEachChunkIndexRemovesIndexesOfMissingObjects(t *testing.T) {
+	f := &Filesystem{LFSStorageDir: t.TempDir(), repoPerms: 0755}
+
+	present := []byte("present")
+	presentSum := sha256.Sum256(present)
+	presentOid := hex.EncodeToString(presentSum[:])
+	path, err := f.ObjectPath(presentOid)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, present, 0644))
+
+	missingOid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+	for _, index := range []*ChunkIndex{
+		{Oid: presentOid, Size: int64(len(present)), Chunks: []Chunk{{Oid: presentOid, Size: int64(len(present))}}},
+		{Oid: missingOid, Size: 5, Chunks: []Chunk{{Oid: missingOid, Size: 5}}},
+	} {
+		require.NoError(t, f.WriteChunkIndex(index))
+	}
+
+	var seen []string
+	require.NoError(t, f.EachChunkIndex(func(index *ChunkIndex) {
+		seen = append(seen, index.Oid)
+	}))
+	assert.Equal(t, []string{presentOid}, seen)
+
+	_, err = f.ReadChunkIndex(missingOid)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -23,6 +23,7 @@ func (f *Filesystem) cleanupTmp() error {
 	}
 
 	traversedDirectories := &sync.Map{}
+	checkpointDir := filepath.Join(tmpdir, "checkpoints")
 
 	var walkErr error
 	tools.FastWalkDir(tmpdir, func(parentDir string, info os.FileInfo, err error) {
@@ -37,9 +38,14 @@ func (f *Filesystem) cleanupTmp() error {
 			traversedDirectories.Store(path, info)
 			return
 		}
+		if parentDir == checkpointDir {
+			// Checkpoints are kept until the operation which
+			// saved them is resumed.
+			return
+		}
 		parts := strings.SplitN(info.Name(), "-", 2)
 		oid := parts[0]
-		if len(parts) == 2 && len(oid) == 64 {
+		if len(parts) == 2 && tools.IsValidOid(oid) {
 			fi, err := os.Stat(f.ObjectPathname(oid))
 			if err == nil && !fi.IsDir() {
 				tracerx.Printf("Removing existing tmp object file: %s", path)
@@ -76,7 +76,7 @@ func (f *Filesystem) ObjectPath(oid string) (string, error) {
 	if len(oid) < 4 {
 		return "", errors.New(tr.Tr.Get("too short object ID: %q", oid))
 	}
-	if oid == EmptyObjectSHA256 {
+	if tools.IsEmptyObjectOid(oid) {
 		return os.DevNull, nil
 	}
 	dir := f.localObjectDir(oid)
@@ -87,7 +87,7 @@ func (f *Filesystem) ObjectPath(oid string) (string, error) {
 }
 
 func (f *Filesystem) ObjectPathname(oid string) string {
-	if oid == EmptyObjectSHA256 {
+	if tools.IsEmptyObjectOid(oid) {
 		return os.DevNull
 	}
 	return filepath.Join(f.localObjectDir(oid), oid)
@@ -188,6 +188,23 @@ func (f *Filesystem) TempDir() string {
 	return f.tmpdir
 }
 
+// CheckpointDir returns the directory within TempDir in which long-running
+// operations save their progress. Unlike other temporary files, those in it
+// are never removed by Cleanup.
+func (f *Filesystem) CheckpointDir() string {
+	dir := filepath.Join(f.TempDir(), "checkpoints")
+	tools.MkdirAll(dir, f)
+	return dir
+}
+
+// JournalDir returns the directory in which transfers record their progress,
+// so that they may be resumed if interrupted.
+func (f *Filesystem) JournalDir() string {
+	dir := filepath.Join(f.LFSStorageDir, "journal")
+	tools.MkdirAll(dir, f)
+	return dir
+}
+
 func (f *Filesystem) Cleanup() error {
 	if f == nil {
 		return nil
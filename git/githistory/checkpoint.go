@@ -0,0 +1,305 @@
+package githistory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/git"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/git-lfs/gitobj/v2"
+)
+
+var (
+	// checkpointInterval is the minimum time between checkpoints saved
+	// while rewriting.
+	checkpointInterval = 30 * time.Second
+)
+
+// checkpoint is the saved progress of a Rewrite, from which it may be resumed
+// after being interrupted.
+//
+// The checkpoint itself is small, and is replaced as a whole each time it is
+// saved. The contents of the Rewriter's caches, which grow with the history,
+// are instead appended to a journal as they are added (see journalRecord).
+type checkpoint struct {
+	// Key identifies the rewrite which saved the checkpoint, as given
+	// in RewriteOptions.CheckpointKey.
+	Key string `json:"key"`
+	// Refs maps each of the included and excluded refs to the commit it
+	// pointed at when the rewrite began.
+	Refs map[string]string `json:"refs"`
+
+	// Position is the number of commits in the list of commits to
+	// migrate which have already been rewritten.
+	Position int `json:"position"`
+	// Last is the last of those commits.
+	Last string `json:"last,omitempty"`
+
+	// JournalSize is the number of bytes which had been written to the
+	// journal. Anything after them was written by a save which did not
+	// complete, and is ignored.
+	JournalSize int64 `json:"journal_size"`
+	// ObjectMapSize is the number of bytes which had been written to the
+	// object map file.
+	ObjectMapSize int64 `json:"object_map_size"`
+	// State is the state returned by RewriteOptions.SaveStateFn.
+	State []byte `json:"state,omitempty"`
+}
+
+type checkpointEntry struct {
+	Filemode int32  `json:"mode"`
+	Name     string `json:"name"`
+	Oid      string `json:"oid"`
+}
+
+// journalRecord is a line of a checkpoint's journal, which records either a
+// commit or a tree entry added to the Rewriter's caches.
+type journalRecord struct {
+	// Commit is the original commit, and To the one it is rewritten to.
+	Commit string `json:"commit,omitempty"`
+	To     string `json:"to,omitempty"`
+
+	// Entry is the key of the original tree entry, and ToEntry the entry
+	// it is rewritten to.
+	Entry   string           `json:"entry,omitempty"`
+	ToEntry *checkpointEntry `json:"to_entry,omitempty"`
+}
+
+// journalPath returns the path of the journal of the checkpoint saved at
+// opt.CheckpointPath.
+func journalPath(opt *RewriteOptions) string {
+	return opt.CheckpointPath + ".journal"
+}
+
+// newCheckpoint returns a checkpoint for a rewrite which has not yet begun,
+// recording the commits currently pointed at by the included and excluded
+// refs.
+func (r *Rewriter) newCheckpoint(opt *RewriteOptions) (*checkpoint, error) {
+	var refs []*git.Ref
+	var err error
+
+	if root, ok := r.gitDirectory(); ok {
+		refs, err = git.AllRefsIn(root)
+	} else {
+		refs, err = git.AllRefs()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("could not read refs"))
+	}
+
+	shas := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		shas[ref.Refspec()] = ref.Sha
+	}
+
+	cp := &checkpoint{
+		Key:  opt.CheckpointKey,
+		Refs: make(map[string]string),
+	}
+	for _, name := range append(append([]string{}, opt.Include...), opt.Exclude...) {
+		// Names which are not refs are commits, which cannot move.
+		if sha, ok := shas[name]; ok {
+			cp.Refs[name] = sha
+		} else {
+			cp.Refs[name] = name
+		}
+	}
+	return cp, nil
+}
+
+// resumeCheckpoint loads the checkpoint saved at opt.CheckpointPath and
+// restores the state of the rewrite from it, returning an error if it belongs
+// to a different rewrite or if the refs being rewritten have moved since it
+// was saved.
+func (r *Rewriter) resumeCheckpoint(opt *RewriteOptions, current *checkpoint, commits [][]byte) (*checkpoint, error) {
+	by, err := os.ReadFile(opt.CheckpointPath)
+	if os.IsNotExist(err) {
+		return nil, errors.New(tr.Tr.Get("no interrupted migration to resume"))
+	} else if err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("could not read checkpoint"))
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(by, &cp); err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("could not parse checkpoint %q", opt.CheckpointPath))
+	}
+
+	if cp.Key != current.Key {
+		return nil, errors.New(tr.Tr.Get("cannot resume a migration with different arguments"))
+	}
+	if len(cp.Refs) != len(current.Refs) {
+		return nil, errors.New(tr.Tr.Get("cannot resume a migration of different refs"))
+	}
+	for name, sha := range current.Refs {
+		if cp.Refs[name] != sha {
+			return nil, errors.New(tr.Tr.Get("cannot resume migration: %s has moved since it was interrupted", name))
+		}
+	}
+	if cp.Position > len(commits) || (cp.Position > 0 && hex.EncodeToString(commits[cp.Position-1]) != cp.Last) {
+		return nil, errors.New(tr.Tr.Get("cannot resume migration: the commits to migrate have changed"))
+	}
+
+	if err := r.replayJournal(opt, &cp); err != nil {
+		return nil, err
+	}
+
+	if opt.RestoreStateFn != nil {
+		if err := opt.RestoreStateFn(cp.State); err != nil {
+			return nil, err
+		}
+	}
+	return &cp, nil
+}
+
+// replayJournal restores the contents of the Rewriter's caches from the
+// journal of the checkpoint cp.
+func (r *Rewriter) replayJournal(opt *RewriteOptions, cp *checkpoint) error {
+	f, err := os.Open(journalPath(opt))
+	if os.IsNotExist(err) && cp.JournalSize == 0 {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("could not read checkpoint"))
+	}
+	defer f.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	scanner := bufio.NewScanner(io.LimitReader(f, cp.JournalSize))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		n += int64(len(scanner.Bytes())) + 1
+
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return errors.Wrap(err, tr.Tr.Get("could not parse checkpoint %q", journalPath(opt)))
+		}
+
+		switch {
+		case len(rec.Commit) > 0:
+			sha, err := hex.DecodeString(rec.To)
+			if err != nil {
+				return errors.Wrap(err, tr.Tr.Get("could not parse checkpoint %q", journalPath(opt)))
+			}
+			r.commits[rec.Commit] = sha
+		case len(rec.Entry) > 0 && rec.ToEntry != nil:
+			oid, err := hex.DecodeString(rec.ToEntry.Oid)
+			if err != nil {
+				return errors.Wrap(err, tr.Tr.Get("could not parse checkpoint %q", journalPath(opt)))
+			}
+			r.entries[rec.Entry] = &gitobj.TreeEntry{
+				Filemode: rec.ToEntry.Filemode,
+				Name:     rec.ToEntry.Name,
+				Oid:      oid,
+			}
+		default:
+			return errors.New(tr.Tr.Get("could not parse checkpoint %q", journalPath(opt)))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("could not read checkpoint"))
+	}
+	if n != cp.JournalSize {
+		return errors.New(tr.Tr.Get("could not parse checkpoint %q: journal is truncated", journalPath(opt)))
+	}
+	return nil
+}
+
+// saveCheckpoint appends the commits and tree entries added to the Rewriter's
+// caches since the checkpoint was last saved to its journal, and then writes
+// the checkpoint to opt.CheckpointPath.
+func (r *Rewriter) saveCheckpoint(opt *RewriteOptions, cp *checkpoint) error {
+	if opt.SaveStateFn != nil {
+		state, err := opt.SaveStateFn()
+		if err != nil {
+			return err
+		}
+		cp.State = state
+	}
+
+	if err := r.appendJournal(opt, cp); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("could not save checkpoint"))
+	}
+
+	by, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	// Write the checkpoint to a temporary file first so that an
+	// interruption never leaves a partially written checkpoint behind.
+	f, err := os.CreateTemp(filepath.Dir(opt.CheckpointPath), filepath.Base(opt.CheckpointPath)+"-*")
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("could not save checkpoint"))
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(by); err != nil {
+		f.Close()
+		return errors.Wrap(err, tr.Tr.Get("could not save checkpoint"))
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("could not save checkpoint"))
+	}
+	if err := os.Rename(f.Name(), opt.CheckpointPath); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("could not save checkpoint"))
+	}
+	return nil
+}
+
+// appendJournal appends the commits and tree entries which are not yet in the
+// checkpoint's journal to it, and updates cp.JournalSize to match.
+func (r *Rewriter) appendJournal(opt *RewriteOptions, cp *checkpoint) error {
+	r.mu.Lock()
+	commits, entries := len(r.unsavedCommits), len(r.unsavedEntries)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, from := range r.unsavedCommits {
+		enc.Encode(&journalRecord{Commit: from, To: hex.EncodeToString(r.commits[from])})
+	}
+	for _, key := range r.unsavedEntries {
+		e := r.entries[key]
+		enc.Encode(&journalRecord{Entry: key, ToEntry: &checkpointEntry{
+			Filemode: e.Filemode,
+			Name:     e.Name,
+			Oid:      hex.EncodeToString(e.Oid),
+		}})
+	}
+	r.mu.Unlock()
+
+	f, err := os.OpenFile(journalPath(opt), os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	// Discard anything written after the checkpoint was last saved,
+	// including any journal left behind by an earlier rewrite.
+	err = f.Truncate(cp.JournalSize)
+	if err == nil {
+		_, err = f.WriteAt(buf.Bytes(), cp.JournalSize)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	cp.JournalSize += int64(buf.Len())
+
+	r.mu.Lock()
+	r.unsavedCommits = r.unsavedCommits[commits:]
+	r.unsavedEntries = r.unsavedEntries[entries:]
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,209 @@
+package githistory
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/gitobj/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// incrementingBlobFn returns a BlobRewriteFn which increments the number held
+// in each blob, failing on the blob holding "fail" and counting its calls in
+// "calls".
+func incrementingBlobFn(fail string, calls *int) BlobRewriteFn {
+	return func(path string, b *gitobj.Blob) (*gitobj.Blob, error) {
+		contents, err := io.ReadAll(b.Contents)
+		if err != nil {
+			return nil, err
+		}
+		if string(contents) == fail {
+			return nil, errors.New("interrupted")
+		}
+		*calls++
+
+		n, err := strconv.Atoi(string(contents))
+		if err != nil {
+			return nil, err
+		}
+		rewritten := strconv.Itoa(n + 1)
+
+		return &gitobj.Blob{
+			Contents: strings.NewReader(rewritten),
+			Size:     int64(len(rewritten)),
+		}, nil
+	}
+}
+
+func TestRewriterResumesFromCheckpoint(t *testing.T) {
+	db := DatabaseFromFixture(t, "linear-history.git")
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	objectMap := filepath.Join(t.TempDir(), "object-map.txt")
+
+	var calls int
+	var restored []byte
+	opts := &RewriteOptions{
+		Include:           []string{"refs/heads/master"},
+		ObjectMapFilePath: objectMap,
+		CheckpointPath:    checkpoint,
+		CheckpointKey:     "increment",
+		BlobFn:            incrementingBlobFn("3", &calls),
+		SaveStateFn: func() ([]byte, error) {
+			return []byte(strconv.Itoa(calls)), nil
+		},
+	}
+
+	_, err := NewRewriter(db).Rewrite(opts)
+	assert.EqualError(t, err, "interrupted")
+	assert.Equal(t, 2, calls)
+	assert.FileExists(t, checkpoint)
+
+	calls = 0
+	opts.Resume = true
+	opts.BlobFn = incrementingBlobFn("", &calls)
+	opts.RestoreStateFn = func(state []byte) error {
+		restored = state
+		return nil
+	}
+
+	tip, err := NewRewriter(db).Rewrite(opts)
+	require.NoError(t, err)
+
+	// Only the blob of the last commit is rewritten once resumed.
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "2", string(restored))
+	assert.NoFileExists(t, checkpoint)
+	assert.NoFileExists(t, checkpoint+".journal")
+
+	// The result is the same as that of an uninterrupted rewrite (see
+	// TestRewriterRewritesHistory).
+	AssertCommitTree(t, db, hex.EncodeToString(tip), "ad0aebd16e34cf047820994ea7538a6d4a111082")
+	AssertCommitParent(t, db, hex.EncodeToString(tip), "4aaa3f49ffeabbb874250fe13ffeb8c683aba650")
+
+	by, err := os.ReadFile(objectMap)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(by)), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasSuffix(lines[2], ","+hex.EncodeToString(tip)))
+}
+
+func TestRewriterJournalsCachesOnce(t *testing.T) {
+	defer func(interval time.Duration) { checkpointInterval = interval }(checkpointInterval)
+	checkpointInterval = 0
+
+	db := DatabaseFromFixture(t, "linear-history.git")
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	var calls int
+	opts := &RewriteOptions{
+		Include:        []string{"refs/heads/master"},
+		CheckpointPath: checkpoint,
+		BlobFn:         incrementingBlobFn("3", &calls),
+	}
+
+	_, err := NewRewriter(db).Rewrite(opts)
+	assert.EqualError(t, err, "interrupted")
+
+	// The checkpoint was saved after each commit, but each commit and
+	// entry is journaled only once.
+	by, err := os.ReadFile(checkpoint + ".journal")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(by)), "\n")
+	seen := make(map[string]bool)
+	var commits int
+	for _, line := range lines {
+		var rec journalRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		key := rec.Commit + rec.Entry
+		assert.False(t, seen[key], "journaled twice: %s", key)
+		seen[key] = true
+		if len(rec.Commit) > 0 {
+			commits++
+		}
+	}
+	assert.Equal(t, 2, commits)
+
+	// A journal written past the end of the checkpoint, as by a save
+	// which was interrupted, is ignored when resuming.
+	f, err := os.OpenFile(checkpoint+".journal", os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"commit":"partial`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	calls = 0
+	opts.Resume = true
+	opts.BlobFn = incrementingBlobFn("", &calls)
+	tip, err := NewRewriter(db).Rewrite(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	AssertCommitTree(t, db, hex.EncodeToString(tip), "ad0aebd16e34cf047820994ea7538a6d4a111082")
+}
+
+func TestRewriterDoesNotResumeWhenRefsMoved(t *testing.T) {
+	db := DatabaseFromFixture(t, "linear-history.git")
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	var calls int
+	opts := &RewriteOptions{
+		Include:        []string{"refs/heads/master"},
+		CheckpointPath: checkpoint,
+		BlobFn:         incrementingBlobFn("3", &calls),
+	}
+
+	_, err := NewRewriter(db).Rewrite(opts)
+	assert.EqualError(t, err, "interrupted")
+
+	// Move master back to its parent.
+	master, err := db.Commit(HexDecode(t, "e669b63f829bfb0b91fc52a5bcea53dd7977a0ee"))
+	require.NoError(t, err)
+	root, _ := db.Root()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "..", "refs", "heads", "master"),
+		[]byte(hex.EncodeToString(master.ParentIDs[0])+"\n"), 0644))
+
+	opts.Resume = true
+	_, err = NewRewriter(db).Rewrite(opts)
+	assert.EqualError(t, err, "cannot resume migration: refs/heads/master has moved since it was interrupted")
+	assert.FileExists(t, checkpoint)
+}
+
+func TestRewriterDoesNotResumeDifferentRewrite(t *testing.T) {
+	db := DatabaseFromFixture(t, "linear-history.git")
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	var calls int
+	opts := &RewriteOptions{
+		Include:        []string{"refs/heads/master"},
+		CheckpointPath: checkpoint,
+		CheckpointKey:  "import --include=*.txt",
+		BlobFn:         incrementingBlobFn("3", &calls),
+	}
+
+	_, err := NewRewriter(db).Rewrite(opts)
+	assert.EqualError(t, err, "interrupted")
+
+	opts.Resume = true
+	opts.CheckpointKey = "import --include=*.bin"
+	_, err = NewRewriter(db).Rewrite(opts)
+	assert.EqualError(t, err, "cannot resume a migration with different arguments")
+}
+
+func TestRewriterResumeRequiresCheckpoint(t *testing.T) {
+	db := DatabaseFromFixture(t, "linear-history.git")
+
+	_, err := NewRewriter(db).Rewrite(&RewriteOptions{
+		Include:        []string{"refs/heads/master"},
+		CheckpointPath: filepath.Join(t.TempDir(), "checkpoint.json"),
+		Resume:         true,
+	})
+	assert.EqualError(t, err, "no interrupted migration to resume")
+}
@@ -1,12 +1,16 @@
 package githistory
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/filepathfilter"
@@ -28,6 +32,12 @@ type Rewriter struct {
 	// commits is a mapping of old commit SHAs to new ones, where the ASCII
 	// hex encoding of the SHA1 values are used as map keys.
 	commits map[string][]byte
+	// unsavedEntries and unsavedCommits are the keys of the entries and
+	// commits cached since the checkpoint was last saved, if one is kept.
+	unsavedEntries []string
+	unsavedCommits []string
+	// checkpointing is whether a checkpoint is kept.
+	checkpointing bool
 	// filter is an optional value used to specify which tree entries
 	// (blobs, subtrees) are modifiable given a BlobFn. If non-nil, this
 	// filter will cull out any unmodifiable subtrees and blobs.
@@ -56,10 +66,33 @@ type RewriteOptions struct {
 	// Verbose mode prints migrated objects.
 	Verbose bool
 
+	// Concurrency is the number of blobs which may be rewritten at once.
+	// If it is greater than one, BlobFn must be safe to call from
+	// multiple goroutines. The rewritten history is the same regardless.
+	Concurrency int
+
 	// ObjectMapFilePath is the path to the map of old sha1 to new sha1
 	// commits
 	ObjectMapFilePath string
 
+	// CheckpointPath, if given, is the path of a file to which the
+	// progress of the rewrite is periodically saved, so that it may be
+	// continued with Resume if interrupted. It is removed once the rewrite
+	// completes.
+	CheckpointPath string
+	// CheckpointKey identifies the rewrite which saves a checkpoint. A
+	// checkpoint is only resumed by a rewrite with the same key.
+	CheckpointKey string
+	// Resume continues the rewrite saved at CheckpointPath, provided that
+	// none of the Include and Exclude refs have moved since.
+	Resume bool
+	// SaveStateFn returns any state kept by the callbacks below across
+	// commits, which is saved with each checkpoint.
+	SaveStateFn func() ([]byte, error)
+	// RestoreStateFn restores the state returned by SaveStateFn when a
+	// rewrite is resumed from a checkpoint.
+	RestoreStateFn func(state []byte) error
+
 	// BlobFn specifies a function to rewrite blobs.
 	//
 	// It is called once per unique, unchanged path. That is to say, if
@@ -68,6 +101,12 @@ type RewriteOptions struct {
 	// each blob for subsequent revisions, so long as each entry remains
 	// unchanged.
 	BlobFn BlobRewriteFn
+	// BlobCompleteFn specifies a function to be called with the path of
+	// each blob once it has been rewritten by BlobFn. It is never called
+	// concurrently, and is called in the same order whatever the
+	// Concurrency, so it may do work which depends on the order in which
+	// blobs are rewritten.
+	BlobCompleteFn BlobCompleteFn
 	// TreePreCallbackFn specifies a function to be called before opening a
 	// tree for rewriting. It will be called on all trees throughout history
 	// in topological ordering through the tree, starting at the root.
@@ -87,6 +126,15 @@ func (r *RewriteOptions) blobFn() BlobRewriteFn {
 	return r.BlobFn
 }
 
+// blobCompleteFn returns a usable BlobCompleteFn, either the one that was given
+// in the *RewriteOptions, or a noopBlobCompleteFn.
+func (r *RewriteOptions) blobCompleteFn() BlobCompleteFn {
+	if r.BlobCompleteFn == nil {
+		return noopBlobCompleteFn
+	}
+	return r.BlobCompleteFn
+}
+
 // treePreFn returns a usable TreePreCallbackFn, either the one that was given
 // in the *RewriteOptions, or a noopTreePreFn.
 func (r *RewriteOptions) treePreFn() TreePreCallbackFn {
@@ -121,6 +169,13 @@ func (r *RewriteOptions) treeFn() TreeCallbackFn {
 // of filepath.Join(...) or os.PathSeparator.
 type BlobRewriteFn func(path string, b *gitobj.Blob) (*gitobj.Blob, error)
 
+// BlobCompleteFn specifies a function to call after a blob has been rewritten
+// by a BlobRewriteFn, given the same path.
+//
+// If the BlobCompleteFn returns an error, it will be returned from the
+// Rewrite() invocation.
+type BlobCompleteFn func(path string) error
+
 // TreePreCallbackFn specifies a function to call upon opening a new tree for
 // rewriting.
 //
@@ -169,6 +224,9 @@ var (
 	// noopBlobFn is a no-op implementation of the BlobRewriteFn. It returns
 	// the blob that it was given, and returns no error.
 	noopBlobFn = func(path string, b *gitobj.Blob) (*gitobj.Blob, error) { return b, nil }
+	// noopBlobCompleteFn is a no-op implementation of the BlobCompleteFn.
+	// It returns no error.
+	noopBlobCompleteFn = func(path string) error { return nil }
 	// noopTreePreFn is a no-op implementation of the TreePreRewriteFn. It
 	// returns the tree that it was given, and returns no error.
 	noopTreePreFn = func(path string, t *gitobj.Tree) error { return nil }
@@ -216,9 +274,36 @@ func (r *Rewriter) Rewrite(opt *RewriteOptions) ([]byte, error) {
 		vPerc = perc
 	}
 
+	var cp *checkpoint
+	if len(opt.CheckpointPath) > 0 {
+		r.checkpointing = true
+		if cp, err = r.newCheckpoint(opt); err != nil {
+			return nil, err
+		}
+		if opt.Resume {
+			if cp, err = r.resumeCheckpoint(opt, cp, commits); err != nil {
+				return nil, err
+			}
+			perc.Count(uint64(cp.Position))
+		}
+	}
+
 	var objectMapFile *os.File
+	var objectMapSize int64
 	if len(opt.ObjectMapFilePath) > 0 {
-		objectMapFile, err = os.OpenFile(opt.ObjectMapFilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if cp != nil && opt.Resume {
+			// Discard anything written to the object map after
+			// the checkpoint was saved.
+			objectMapFile, err = os.OpenFile(opt.ObjectMapFilePath, os.O_RDWR|os.O_CREATE, 0666)
+			if err == nil {
+				objectMapSize = cp.ObjectMapSize
+				if err = objectMapFile.Truncate(objectMapSize); err == nil {
+					_, err = objectMapFile.Seek(objectMapSize, io.SeekStart)
+				}
+			}
+		} else {
+			objectMapFile, err = os.OpenFile(opt.ObjectMapFilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		}
 		if err != nil {
 			return nil, errors.New(tr.Tr.Get("could not create object map file: %v", err))
 		}
@@ -228,73 +313,32 @@ func (r *Rewriter) Rewrite(opt *RewriteOptions) ([]byte, error) {
 	// Keep track of the last commit that we rewrote. Callers often want
 	// this so that they can perform a git-update-ref(1).
 	var tip []byte
-	for _, oid := range commits {
-		// Load the original commit to access the data necessary in
-		// order to rewrite it.
-		original, err := r.db.Commit(oid)
-		if err != nil {
-			return nil, err
-		}
+	var position int
+	if cp != nil && cp.Position > 0 {
+		position = cp.Position
+		tip, _ = r.uncacheCommit(commits[position-1])
+	}
 
-		// Rewrite the tree given at that commit.
-		rewrittenTree, err := r.rewriteTree(oid, original.TreeID, "", opt.blobFn(), opt.treePreFn(), opt.treeFn(), vPerc)
+	saved := time.Now()
+	for _, oid := range commits[position:] {
+		newSha, err := r.rewriteCommit(oid, opt, vPerc)
 		if err != nil {
-			return nil, err
-		}
-
-		// Create a new list of parents from the original commit to
-		// point at the rewritten parents in order to create a
-		// topologically equivalent DAG.
-		//
-		// This operation is safe since we are visiting the commits in
-		// reverse topological order and therefore have seen all parents
-		// before children (in other words, r.uncacheCommit(...) will
-		// always return a value, if the prospective parent is a part of
-		// the migration).
-		rewrittenParents := make([][]byte, 0, len(original.ParentIDs))
-		for _, originalParent := range original.ParentIDs {
-			rewrittenParent, ok := r.uncacheCommit(originalParent)
-			if !ok {
-				// If we haven't seen the parent before, this
-				// means that we're doing a partial migration
-				// and the parent that we're looking for isn't
-				// included.
-				//
-				// Use the original parent to properly link
-				// history across the migration boundary.
-				rewrittenParent = originalParent
+			if cp != nil {
+				// Save the progress made so far, since a
+				// failed rewrite may well be resumed once
+				// its cause is fixed. An error in doing so is
+				// less interesting than the original one.
+				r.saveCheckpoint(opt, cp)
 			}
-
-			rewrittenParents = append(rewrittenParents, rewrittenParent)
-		}
-
-		// Construct a new commit using the original header information,
-		// but the rewritten set of parents as well as root tree.
-		rewrittenCommit := &gitobj.Commit{
-			Author:       original.Author,
-			Committer:    original.Committer,
-			ExtraHeaders: original.ExtraHeaders,
-			Message:      original.Message,
-
-			ParentIDs: rewrittenParents,
-			TreeID:    rewrittenTree,
+			return nil, err
 		}
 
-		var newSha []byte
-
-		if original.Equal(rewrittenCommit) {
-			newSha = make([]byte, len(oid))
-			copy(newSha, oid)
-		} else {
-			newSha, err = r.db.WriteCommit(rewrittenCommit)
+		if objectMapFile != nil && !bytes.Equal(oid, newSha) {
+			n, err := fmt.Fprintf(objectMapFile, "%x,%x\n", oid, newSha)
 			if err != nil {
 				return nil, err
 			}
-			if objectMapFile != nil {
-				if _, err := fmt.Fprintf(objectMapFile, "%x,%x\n", oid, newSha); err != nil {
-					return nil, err
-				}
-			}
+			objectMapSize += int64(n)
 		}
 
 		// Cache that commit so that we can reassign children of this
@@ -306,6 +350,20 @@ func (r *Rewriter) Rewrite(opt *RewriteOptions) ([]byte, error) {
 
 		// Move the tip forward.
 		tip = newSha
+		position++
+
+		if cp != nil {
+			cp.Position = position
+			cp.Last = hex.EncodeToString(oid)
+			cp.ObjectMapSize = objectMapSize
+
+			if time.Since(saved) >= checkpointInterval {
+				if err := r.saveCheckpoint(opt, cp); err != nil {
+					return nil, err
+				}
+				saved = time.Now()
+			}
+		}
 	}
 
 	if opt.UpdateRefs {
@@ -329,9 +387,93 @@ func (r *Rewriter) Rewrite(opt *RewriteOptions) ([]byte, error) {
 		}
 	}
 
+	if cp != nil {
+		for _, path := range []string{opt.CheckpointPath, journalPath(opt)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, errors.Wrap(err, tr.Tr.Get("could not remove checkpoint"))
+			}
+		}
+	}
+
 	return tip, err
 }
 
+// rewriteCommit rewrites the commit given by "oid", whose parents must already
+// have been rewritten, and returns the ID of the rewritten commit. The original
+// commit is returned if rewriting it changed nothing.
+func (r *Rewriter) rewriteCommit(oid []byte, opt *RewriteOptions, perc *tasklog.PercentageTask) ([]byte, error) {
+	// Load the original commit to access the data necessary in
+	// order to rewrite it.
+	original, err := r.db.Commit(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	tpfn := opt.treePreFn()
+	if opt.Concurrency > 1 {
+		// Rewrite the blobs of the commit up front, so that
+		// rewriteTree finds each of them cached.
+		if err := r.rewriteBlobs(oid, original.TreeID, opt, perc); err != nil {
+			return nil, err
+		}
+
+		// rewriteBlobs has already called the TreePreCallbackFn on
+		// each tree that rewriteTree will open.
+		tpfn = noopTreePreFn
+	}
+
+	// Rewrite the tree given at that commit.
+	rewrittenTree, err := r.rewriteTree(oid, original.TreeID, "", opt.blobFn(), opt.blobCompleteFn(), tpfn, opt.treeFn(), perc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a new list of parents from the original commit to
+	// point at the rewritten parents in order to create a
+	// topologically equivalent DAG.
+	//
+	// This operation is safe since we are visiting the commits in
+	// reverse topological order and therefore have seen all parents
+	// before children (in other words, r.uncacheCommit(...) will
+	// always return a value, if the prospective parent is a part of
+	// the migration).
+	rewrittenParents := make([][]byte, 0, len(original.ParentIDs))
+	for _, originalParent := range original.ParentIDs {
+		rewrittenParent, ok := r.uncacheCommit(originalParent)
+		if !ok {
+			// If we haven't seen the parent before, this
+			// means that we're doing a partial migration
+			// and the parent that we're looking for isn't
+			// included.
+			//
+			// Use the original parent to properly link
+			// history across the migration boundary.
+			rewrittenParent = originalParent
+		}
+
+		rewrittenParents = append(rewrittenParents, rewrittenParent)
+	}
+
+	// Construct a new commit using the original header information,
+	// but the rewritten set of parents as well as root tree.
+	rewrittenCommit := &gitobj.Commit{
+		Author:       original.Author,
+		Committer:    original.Committer,
+		ExtraHeaders: original.ExtraHeaders,
+		Message:      original.Message,
+
+		ParentIDs: rewrittenParents,
+		TreeID:    rewrittenTree,
+	}
+
+	if original.Equal(rewrittenCommit) {
+		newSha := make([]byte, len(oid))
+		copy(newSha, oid)
+		return newSha, nil
+	}
+	return r.db.WriteCommit(rewrittenCommit)
+}
+
 // rewriteTree is a recursive function which rewrites a tree given by the ID
 // "sha" and path "path". It uses the given BlobRewriteFn to rewrite all blobs
 // within the tree, either calling that function or recurring down into subtrees
@@ -344,7 +486,7 @@ func (r *Rewriter) Rewrite(opt *RewriteOptions) ([]byte, error) {
 // It returns the new SHA of the rewritten tree, or an error if the tree was
 // unable to be rewritten.
 func (r *Rewriter) rewriteTree(commitOID []byte, treeOID []byte, path string,
-	fn BlobRewriteFn, tpfn TreePreCallbackFn, tfn TreeCallbackFn,
+	fn BlobRewriteFn, bcfn BlobCompleteFn, tpfn TreePreCallbackFn, tfn TreeCallbackFn,
 	perc *tasklog.PercentageTask) ([]byte, error) {
 
 	tree, err := r.db.Tree(treeOID)
@@ -387,8 +529,11 @@ func (r *Rewriter) rewriteTree(commitOID []byte, treeOID []byte, path string,
 		switch entry.Type() {
 		case gitobj.BlobObjectType:
 			oid, err = r.rewriteBlob(commitOID, entry.Oid, fullpath, fn, perc)
+			if err == nil {
+				err = bcfn(fullpath)
+			}
 		case gitobj.TreeObjectType:
-			oid, err = r.rewriteTree(commitOID, entry.Oid, fullpath, fn, tpfn, tfn, perc)
+			oid, err = r.rewriteTree(commitOID, entry.Oid, fullpath, fn, bcfn, tpfn, tfn, perc)
 		default:
 			oid = entry.Oid
 
@@ -415,6 +560,119 @@ func (r *Rewriter) rewriteTree(commitOID []byte, treeOID []byte, path string,
 	return r.db.WriteTree(rewritten)
 }
 
+// blobJob is a blob which rewriteBlobs must rewrite.
+type blobJob struct {
+	path  string
+	entry *gitobj.TreeEntry
+}
+
+// rewriteBlobs rewrites each of the blobs which rewriteTree would rewrite
+// given the tree "treeOID", using opt.Concurrency workers, and caches the
+// results so that rewriteTree need not rewrite them again.
+//
+// The results are cached, and the BlobCompleteFn called, in the order that
+// rewriteTree would have rewritten the blobs, stopping at the first which
+// failed, so the outcome is the same as if rewriteTree had done the work
+// itself.
+func (r *Rewriter) rewriteBlobs(commitOID, treeOID []byte, opt *RewriteOptions, perc *tasklog.PercentageTask) error {
+	jobs, err := r.findBlobs(treeOID, "", opt.treePreFn())
+	if err != nil {
+		return err
+	}
+
+	fn := opt.blobFn()
+	oids := make([][]byte, len(jobs))
+	errs := make([]error, len(jobs))
+
+	var failed atomic.Bool
+	work := make(chan int)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < opt.Concurrency && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for n := range work {
+				job := jobs[n]
+				if oids[n], errs[n] = r.rewriteBlob(commitOID, job.entry.Oid, job.path, fn, perc); errs[n] != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for n := range jobs {
+		if failed.Load() {
+			break
+		}
+		work <- n
+	}
+	close(work)
+	wg.Wait()
+
+	bcfn := opt.blobCompleteFn()
+	for n, job := range jobs {
+		if errs[n] != nil {
+			return errs[n]
+		}
+		if oids[n] == nil {
+			break
+		}
+
+		r.cacheEntry(job.path, job.entry, &gitobj.TreeEntry{
+			Filemode: job.entry.Filemode,
+			Name:     job.entry.Name,
+			Oid:      oids[n],
+		})
+		if err := bcfn(job.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findBlobs returns the blobs which rewriteTree would rewrite given the tree
+// "treeOID" at "path", in the order in which it would rewrite them, calling
+// the TreePreCallbackFn "tpfn" on each tree that it would open.
+func (r *Rewriter) findBlobs(treeOID []byte, path string, tpfn TreePreCallbackFn) ([]*blobJob, error) {
+	tree, err := r.db.Tree(treeOID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tpfn("/"+path, tree); err != nil {
+		return nil, err
+	}
+
+	var jobs []*blobJob
+	for _, entry := range tree.Entries {
+		var fullpath string
+		if len(path) > 0 {
+			fullpath = strings.Join([]string{path, entry.Name}, "/")
+		} else {
+			fullpath = entry.Name
+		}
+
+		if !r.allows(entry.Type(), fullpath) || entry.Filemode == 0120000 {
+			continue
+		}
+		if r.uncacheEntry(fullpath, entry) != nil {
+			continue
+		}
+
+		switch entry.Type() {
+		case gitobj.BlobObjectType:
+			jobs = append(jobs, &blobJob{path: fullpath, entry: entry})
+		case gitobj.TreeObjectType:
+			subtree, err := r.findBlobs(entry.Oid, fullpath, tpfn)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, subtree...)
+		}
+	}
+	return jobs, nil
+}
+
 func copyEntry(e *gitobj.TreeEntry) *gitobj.TreeEntry {
 	if e == nil {
 		return nil
@@ -596,7 +854,11 @@ func (r *Rewriter) cacheEntry(path string, from, to *gitobj.TreeEntry) *gitobj.T
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.entries[r.entryKey(path, from)] = to
+	key := r.entryKey(path, from)
+	r.entries[key] = to
+	if r.checkpointing {
+		r.unsavedEntries = append(r.unsavedEntries, key)
+	}
 
 	return to
 }
@@ -622,7 +884,11 @@ func (r *Rewriter) cacheCommit(from, to []byte) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.commits[hex.EncodeToString(from)] = to
+	key := hex.EncodeToString(from)
+	r.commits[key] = to
+	if r.checkpointing {
+		r.unsavedCommits = append(r.unsavedCommits, key)
+	}
 }
 
 // uncacheCommit returns a *git/gitobj.Commit that is cached from the given
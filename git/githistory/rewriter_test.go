@@ -511,3 +511,69 @@ func debug(t *testing.T, db *gitobj.ObjectDatabase, tip []byte, err error) {
 	t.Logf("* err=%s\n", err)
 	t.Log(strings.Repeat("*", 80))
 }
+
+func TestRewriterRewritesBlobsConcurrently(t *testing.T) {
+	for _, fixture := range []string{
+		"linear-history.git",
+		"repeated-subtrees.git",
+		"non-repeated-subtrees.git",
+		"octopus-merge.git",
+	} {
+		t.Run(fixture, func(t *testing.T) {
+			rewrite := func(concurrency int) ([]byte, []string) {
+				db := DatabaseFromFixture(t, fixture)
+				r := NewRewriter(db)
+
+				var completed []string
+				tip, err := r.Rewrite(&RewriteOptions{
+					Include:     []string{"refs/heads/master"},
+					Concurrency: concurrency,
+					BlobFn: func(path string, b *gitobj.Blob) (*gitobj.Blob, error) {
+						suffix := strings.NewReader("_" + path)
+
+						return &gitobj.Blob{
+							Contents: io.MultiReader(b.Contents, suffix),
+							Size:     b.Size + int64(suffix.Len()),
+						}, nil
+					},
+					BlobCompleteFn: func(path string) error {
+						completed = append(completed, path)
+						return nil
+					},
+				})
+				assert.NoError(t, err)
+				return tip, completed
+			}
+
+			serialTip, serialCompleted := rewrite(1)
+			concurrentTip, concurrentCompleted := rewrite(4)
+
+			assert.Equal(t, hex.EncodeToString(serialTip), hex.EncodeToString(concurrentTip))
+			assert.Equal(t, serialCompleted, concurrentCompleted)
+		})
+	}
+}
+
+func TestRewriterConcurrentBlobFnPropagatesErrors(t *testing.T) {
+	db := DatabaseFromFixture(t, "non-repeated-subtrees.git")
+	r := NewRewriter(db)
+
+	var completed []string
+	_, err := r.Rewrite(&RewriteOptions{
+		Include:     []string{"refs/heads/master"},
+		Concurrency: 4,
+		BlobFn: func(path string, b *gitobj.Blob) (*gitobj.Blob, error) {
+			if path == "subdir/b.txt" {
+				return nil, errors.New("git/githistory: BlobFn error")
+			}
+			return b, nil
+		},
+		BlobCompleteFn: func(path string) error {
+			completed = append(completed, path)
+			return nil
+		},
+	})
+
+	assert.EqualError(t, err, "git/githistory: BlobFn error")
+	assert.NotContains(t, completed, "subdir/b.txt")
+}
@@ -2,7 +2,6 @@ package lfs
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/hex"
 	"hash"
 	"io"
@@ -12,6 +11,7 @@ import (
 	"github.com/git-lfs/git-lfs/v3/config"
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/subprocess"
+	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
 )
 
@@ -20,6 +20,7 @@ type pipeRequest struct {
 	reader     io.Reader
 	fileName   string
 	extensions []config.Extension
+	hashAlgo   tools.HashAlgorithm
 }
 
 type pipeResponse struct {
@@ -85,7 +86,7 @@ func pipeExtensions(cfg *config.Configuration, request *pipeRequest) (response p
 		extcmds = append(extcmds, ec)
 	}
 
-	hasher := sha256.New()
+	hasher := request.hashAlgo.New()
 	pipeReader, pipeWriter := io.Pipe()
 	multiWriter := io.MultiWriter(hasher, pipeWriter)
 
@@ -101,7 +102,7 @@ func pipeExtensions(cfg *config.Configuration, request *pipeRequest) (response p
 
 	last := len(extcmds) - 1
 	for i, ec := range extcmds {
-		ec.hasher = sha256.New()
+		ec.hasher = request.hashAlgo.New()
 
 		if i == last {
 			ec.cmd.Stdout = io.MultiWriter(ec.hasher, output)
@@ -2,12 +2,12 @@ package lfs
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/hex"
 	"io"
 	"os"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/fs"
 	"github.com/git-lfs/git-lfs/v3/tools"
 )
 
@@ -22,12 +22,17 @@ func (f *GitFilter) Clean(reader io.Reader, fileName string, fileSize int64, cb
 		return nil, err
 	}
 
+	hashAlgo, err := f.cfg.HashAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
 	var oid string
 	var size int64
 	var tmp *os.File
 	var exts []*PointerExtension
 	if len(extensions) > 0 {
-		request := &pipeRequest{"clean", reader, fileName, extensions}
+		request := &pipeRequest{"clean", reader, fileName, extensions, hashAlgo}
 
 		var response pipeResponse
 		if response, err = pipeExtensions(f.cfg, request); err != nil {
@@ -44,22 +49,28 @@ func (f *GitFilter) Clean(reader io.Reader, fileName string, fileSize int64, cb
 
 		for _, result := range response.results {
 			if result.oidIn != result.oidOut {
-				ext := NewPointerExtension(result.name, len(exts), result.oidIn)
+				ext := NewPointerExtensionWithHashAlgorithm(result.name, len(exts), result.oidIn, hashAlgo)
 				exts = append(exts, ext)
 			}
 		}
 	} else {
-		oid, size, tmp, err = f.copyToTemp(reader, fileSize, cb)
+		oid, size, tmp, err = f.copyToTemp(reader, fileSize, hashAlgo, cb)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	pointer := NewPointer(oid, size, exts)
+	if f.cfg.ChunkedTransfersAllowed() {
+		if err = f.indexChunks(oid, hashAlgo, tmp.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	pointer := NewPointerWithHashAlgorithm(oid, size, exts, hashAlgo)
 	return &cleanedAsset{tmp.Name(), pointer}, err
 }
 
-func (f *GitFilter) copyToTemp(reader io.Reader, fileSize int64, cb tools.CopyCallback) (oid string, size int64, tmp *os.File, err error) {
+func (f *GitFilter) copyToTemp(reader io.Reader, fileSize int64, hashAlgo tools.HashAlgorithm, cb tools.CopyCallback) (oid string, size int64, tmp *os.File, err error) {
 	tmp, err = TempFile(f.cfg, "")
 	if err != nil {
 		return
@@ -67,7 +78,7 @@ func (f *GitFilter) copyToTemp(reader io.Reader, fileSize int64, cb tools.CopyCa
 
 	defer tmp.Close()
 
-	oidHash := sha256.New()
+	oidHash := hashAlgo.New()
 	writer := io.MultiWriter(oidHash, tmp)
 
 	ptr, buf, err := DecodeFrom(reader)
@@ -98,6 +109,27 @@ func (f *GitFilter) copyToTemp(reader io.Reader, fileSize int64, cb tools.CopyCa
 	return
 }
 
+// indexChunks splits the cleaned object at path into content-defined chunks
+// and records them in the object's chunk index, so that the "chunked" transfer
+// adapter need only transfer those chunks which the destination is missing.
+func (f *GitFilter) indexChunks(oid string, hashAlgo tools.HashAlgorithm, path string) error {
+	if _, err := f.fs.ReadChunkIndex(oid); err == nil {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	index, err := fs.NewChunkIndex(oid, hashAlgo, file)
+	if err != nil {
+		return err
+	}
+	return f.fs.WriteChunkIndex(index)
+}
+
 func (a *cleanedAsset) Teardown() error {
 	return os.Remove(a.Filename)
 }
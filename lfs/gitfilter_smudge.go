@@ -98,6 +98,19 @@ func (f *GitFilter) Smudge(writer io.Writer, ptr *Pointer, workingfile string, d
 	return n, nil
 }
 
+// downloadTransfer returns the transfer which downloads the object of ptr to
+// mediafile, for the file at workingfile. It is the only transfer in its
+// queue, so it needs no priority.
+func downloadTransfer(ptr *Pointer, workingfile, mediafile string) *tq.Transfer {
+	return &tq.Transfer{
+		Name:          filepath.Base(workingfile),
+		Path:          mediafile,
+		Oid:           ptr.Oid,
+		Size:          ptr.Size,
+		HashAlgorithm: ptr.HashAlgorithm(),
+	}
+}
+
 func (f *GitFilter) downloadFile(writer io.Writer, ptr *Pointer, workingfile, mediafile string, manifest tq.Manifest, cb tools.CopyCallback) (int64, error) {
 	fmt.Fprintln(os.Stderr, tr.Tr.Get("Downloading %s (%s)", workingfile, humanize.FormatBytes(uint64(ptr.Size))))
 
@@ -112,7 +125,7 @@ func (f *GitFilter) downloadFile(writer io.Writer, ptr *Pointer, workingfile, me
 		tq.RemoteRef(f.RemoteRef()),
 		tq.WithBatchSize(f.cfg.TransferBatchSize()),
 	)
-	q.Add(filepath.Base(workingfile), mediafile, ptr.Oid, ptr.Size, false, nil)
+	q.AddTransfer(downloadTransfer(ptr, workingfile, mediafile), nil)
 	q.Wait()
 
 	if errs := q.Errors(); len(errs) > 0 {
@@ -135,7 +148,7 @@ func (f *GitFilter) downloadFileFallBack(writer io.Writer, ptr *Pointer, working
 			tq.RemoteRef(f.RemoteRef()),
 			tq.WithBatchSize(f.cfg.TransferBatchSize()),
 		)
-		q.Add(filepath.Base(workingfile), mediafile, ptr.Oid, ptr.Size, false, nil)
+		q.AddTransfer(downloadTransfer(ptr, workingfile, mediafile), nil)
 		q.Wait()
 
 		if errs := q.Errors(); len(errs) > 0 {
@@ -192,7 +205,7 @@ func (f *GitFilter) readLocalFile(writer io.Writer, ptr *Pointer, mediafile stri
 			extsR = append(extsR, ext)
 		}
 
-		request := &pipeRequest{"smudge", reader, workingfile, extsR}
+		request := &pipeRequest{"smudge", reader, workingfile, extsR, ptr.HashAlgorithm()}
 
 		response, err := pipeExtensions(f.cfg, request)
 		if err != nil {
@@ -2,9 +2,11 @@ package lfs
 
 import (
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/events"
 	"github.com/git-lfs/git-lfs/v3/filepathfilter"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/rubyist/tracerx"
@@ -86,9 +88,12 @@ func (s *GitScanner) ScanMultiRangeToRemote(include string, exclude []string, cb
 
 	s.mode = ScanRangeToRemoteMode
 
+	callback, finish := startScanEvents("range-to-remote", callback)
+
 	start := time.Now()
 	err = scanRefsToChanSingleIncludeMultiExclude(s, callback, include, exclude, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanMultiRangeToRemote", start)
+	finish(err)
 
 	return err
 }
@@ -102,9 +107,12 @@ func (s *GitScanner) ScanRefs(include, exclude []string, cb GitScannerFoundPoint
 		return err
 	}
 
+	callback, finish := startScanEvents("refs", callback)
+
 	start := time.Now()
 	err = scanRefsToChan(s, callback, include, exclude, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanRefs", start)
+	finish(err)
 
 	return err
 }
@@ -118,9 +126,12 @@ func (s *GitScanner) ScanRefRange(include, exclude string, cb GitScannerFoundPoi
 		return err
 	}
 
+	callback, finish := startScanEvents("ref-range", callback)
+
 	start := time.Now()
 	err = scanRefsToChanSingleIncludeExclude(s, callback, include, exclude, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanRefRange", start)
+	finish(err)
 
 	return err
 }
@@ -137,9 +148,12 @@ func (s *GitScanner) ScanRefRangeByTree(include, exclude string, cb GitScannerFo
 
 	s.commitsOnly = true
 
+	callback, finish := startScanEvents("ref-range", callback)
+
 	start := time.Now()
 	err = scanRefsByTree(s, callback, []string{include}, []string{exclude}, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanRefRangeByTree", start)
+	finish(err)
 
 	return err
 }
@@ -160,9 +174,12 @@ func (s *GitScanner) ScanRef(ref string, cb GitScannerFoundPointer) error {
 
 	s.skipDeletedBlobs = true
 
+	callback, finish := startScanEvents("ref", callback)
+
 	start := time.Now()
 	err = scanRefsToChanSingleIncludeExclude(s, callback, ref, "", s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanRef", start)
+	finish(err)
 
 	return err
 }
@@ -179,9 +196,12 @@ func (s *GitScanner) ScanRefByTree(ref string, cb GitScannerFoundPointer) error
 	s.skipDeletedBlobs = true
 	s.commitsOnly = true
 
+	callback, finish := startScanEvents("ref", callback)
+
 	start := time.Now()
 	err = scanRefsByTree(s, callback, []string{ref}, []string{}, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanRefByTree", start)
+	finish(err)
 
 	return err
 }
@@ -196,9 +216,12 @@ func (s *GitScanner) ScanAll(cb GitScannerFoundPointer) error {
 
 	s.mode = ScanAllMode
 
+	callback, finish := startScanEvents("all", callback)
+
 	start := time.Now()
 	err = scanRefsToChanSingleIncludeExclude(s, callback, "", "", s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanAll", start)
+	finish(err)
 
 	return err
 }
@@ -212,9 +235,12 @@ func (s *GitScanner) ScanTree(ref string, cb GitScannerFoundPointer) error {
 		return err
 	}
 
+	callback, finish := startScanEvents("tree", callback)
+
 	start := time.Now()
 	err = runScanTree(callback, ref, s.Filter, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanTree", start)
+	finish(err)
 
 	return err
 }
@@ -228,9 +254,12 @@ func (s *GitScanner) ScanLFSFiles(ref string, cb GitScannerFoundPointer) error {
 		return err
 	}
 
+	callback, finish := startScanEvents("lfs-files", callback)
+
 	start := time.Now()
 	err = runScanLFSFiles(callback, ref, s.Filter, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanLFSFiles", start)
+	finish(err)
 
 	return err
 }
@@ -243,9 +272,12 @@ func (s *GitScanner) ScanUnpushed(remote string, cb GitScannerFoundPointer) erro
 		return err
 	}
 
+	callback, finish := startScanEvents("unpushed", callback)
+
 	start := time.Now()
 	err = scanUnpushed(callback, remote)
 	tracerx.PerformanceSince("ScanUnpushed", start)
+	finish(err)
 
 	return err
 }
@@ -257,9 +289,12 @@ func (s *GitScanner) ScanStashed(cb GitScannerFoundPointer) error {
 		return err
 	}
 
+	callback, finish := startScanEvents("stashed", callback)
+
 	start := time.Now()
 	err = scanStashed(callback)
 	tracerx.PerformanceSince("ScanStashed", start)
+	finish(err)
 
 	return err
 }
@@ -274,9 +309,12 @@ func (s *GitScanner) ScanPreviousVersions(ref string, since time.Time, cb GitSca
 		return err
 	}
 
+	callback, finish := startScanEvents("previous-versions", callback)
+
 	start := time.Now()
 	err = logPreviousSHAs(callback, ref, s.Filter, since)
 	tracerx.PerformanceSince("ScanPreviousVersions", start)
+	finish(err)
 
 	return err
 }
@@ -288,9 +326,12 @@ func (s *GitScanner) ScanIndex(ref string, workingDir string, cb GitScannerFound
 		return err
 	}
 
+	callback, finish := startScanEvents("index", callback)
+
 	start := time.Now()
 	err = scanIndex(callback, ref, workingDir, s.Filter, s.cfg.GitEnv(), s.cfg.OSEnv())
 	tracerx.PerformanceSince("ScanIndex", start)
+	finish(err)
 
 	return err
 }
@@ -305,3 +346,31 @@ func firstGitScannerCallback(callbacks ...GitScannerFoundPointer) (GitScannerFou
 
 	return nil, missingCallbackErr
 }
+
+// startScanEvents writes an event to the event stream recording the start of
+// a scan of the given kind, and returns a callback which counts the pointers
+// passed to cb, along with a function to record the end of the scan.
+func startScanEvents(kind string, cb GitScannerFoundPointer) (GitScannerFoundPointer, func(error)) {
+	if !events.Enabled() {
+		return cb, func(error) {}
+	}
+
+	events.Emit(events.Event{Type: events.ScanStarted, Scan: kind})
+
+	var found int64
+	counter := func(p *WrappedPointer, err error) {
+		if err == nil {
+			atomic.AddInt64(&found, 1)
+		}
+		cb(p, err)
+	}
+	finish := func(err error) {
+		events.Emit(events.Event{
+			Type:    events.ScanFinished,
+			Scan:    kind,
+			Objects: atomic.LoadInt64(&found),
+			Error:   events.ErrorOf(err),
+		})
+	}
+	return counter, finish
+}
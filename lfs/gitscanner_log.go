@@ -35,7 +35,7 @@ var (
 		"--no-ext-diff",
 		"--no-textconv",
 		"--color=never",
-		"-G", "oid sha256:", // only diffs which include an lfs file SHA change
+		"-G", "oid sha[0-9]+:", // only diffs which include an lfs file SHA change
 		"-p",                             // include diff so we can read the SHA
 		"-U12",                           // Make sure diff context is always big enough to support 10 extension lines to get whole pointer
 		`--format=lfs-commit-sha: %H %P`, // just a predictable commit header we can detect
@@ -227,7 +227,7 @@ func newLogScanner(dir LogDiffDirection, r io.Reader) *logScanner {
 		commitHeaderRegex:    regexp.MustCompile(fmt.Sprintf(`^lfs-commit-sha: (%s)(?: (%s))*`, git.ObjectIDRegex, git.ObjectIDRegex)),
 		fileHeaderRegex:      regexp.MustCompile(`^diff --git "?a\/(.+?)\s+"?b\/(.+)`),
 		fileMergeHeaderRegex: regexp.MustCompile(`^diff --cc (.+)`),
-		pointerDataRegex:     regexp.MustCompile(`^([\+\- ])(version https://git-lfs|oid sha256|size|ext-).*$`),
+		pointerDataRegex:     regexp.MustCompile(`^([\+\- ])(version https://git-lfs|oid sha[0-9]+|size|ext-).*$`),
 	}
 }
 
@@ -13,6 +13,7 @@ import (
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/git-lfs/gitobj/v2"
 )
@@ -24,8 +25,6 @@ var (
 		"https://git-lfs.github.com/spec/v1", // public launch
 	}
 	latest      = "https://git-lfs.github.com/spec/v1"
-	oidType     = "sha256"
-	oidRE       = regexp.MustCompile(`\A[0-9a-f]{64}\z`)
 	matcherRE   = regexp.MustCompile("git-media|hawser|git-lfs")
 	extRE       = regexp.MustCompile(`\Aext-\d{1}-\w+`)
 	pointerKeys = []string{"version", "oid", "size"}
@@ -54,12 +53,35 @@ func (p ByPriority) Len() int           { return len(p) }
 func (p ByPriority) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 func (p ByPriority) Less(i, j int) bool { return p[i].Priority < p[j].Priority }
 
+// NewPointer returns a new *Pointer for the given SHA-256 OID.
 func NewPointer(oid string, size int64, exts []*PointerExtension) *Pointer {
-	return &Pointer{latest, oid, size, oidType, exts, true}
+	return NewPointerWithHashAlgorithm(oid, size, exts, tools.DefaultHashAlgorithm)
 }
 
+// NewPointerWithHashAlgorithm returns a new *Pointer for the given OID,
+// computed with the given hash algorithm.
+func NewPointerWithHashAlgorithm(oid string, size int64, exts []*PointerExtension, h tools.HashAlgorithm) *Pointer {
+	return &Pointer{latest, oid, size, h.OrDefault().String(), exts, true}
+}
+
+// NewPointerExtension returns a new *PointerExtension for the given SHA-256
+// OID.
 func NewPointerExtension(name string, priority int, oid string) *PointerExtension {
-	return &PointerExtension{name, priority, oid, oidType}
+	return NewPointerExtensionWithHashAlgorithm(name, priority, oid, tools.DefaultHashAlgorithm)
+}
+
+// NewPointerExtensionWithHashAlgorithm returns a new *PointerExtension for
+// the given OID, computed with the given hash algorithm.
+func NewPointerExtensionWithHashAlgorithm(name string, priority int, oid string, h tools.HashAlgorithm) *PointerExtension {
+	return &PointerExtension{name, priority, oid, h.OrDefault().String()}
+}
+
+// HashAlgorithm returns the hash algorithm used to compute the pointer's OID.
+func (p *Pointer) HashAlgorithm() tools.HashAlgorithm {
+	if h, err := tools.ParseHashAlgorithm(p.OidType); err == nil {
+		return h
+	}
+	return tools.DefaultHashAlgorithm
 }
 
 func (p *Pointer) Encode(writer io.Writer) (int, error) {
@@ -183,7 +205,7 @@ func decodeKV(data []byte) (*Pointer, error) {
 		return nil, errors.New(tr.Tr.Get("Invalid OID"))
 	}
 
-	oid, err := parseOid(value)
+	oid, h, err := parseOid(value)
 	if err != nil {
 		return nil, err
 	}
@@ -209,22 +231,25 @@ func decodeKV(data []byte) (*Pointer, error) {
 		sort.Sort(ByPriority(extensions))
 	}
 
-	return NewPointer(oid, size, extensions), nil
+	return NewPointerWithHashAlgorithm(oid, size, extensions, h), nil
 }
 
-func parseOid(value string) (string, error) {
+// parseOid parses an OID of the form "<type>:<oid>", returning the OID and
+// the hash algorithm named by its type.
+func parseOid(value string) (string, tools.HashAlgorithm, error) {
 	parts := strings.SplitN(value, ":", 2)
 	if len(parts) != 2 {
-		return "", errors.New(tr.Tr.Get("Invalid OID value: %s", value))
+		return "", "", errors.New(tr.Tr.Get("Invalid OID value: %s", value))
 	}
-	if parts[0] != oidType {
-		return "", errors.New(tr.Tr.Get("Invalid OID type: %s", parts[0]))
+	h, err := tools.ParseHashAlgorithm(parts[0])
+	if err != nil || h.String() != parts[0] {
+		return "", "", errors.New(tr.Tr.Get("Invalid OID type: %s", parts[0]))
 	}
 	oid := parts[1]
-	if !oidRE.MatchString(oid) {
-		return "", errors.New(tr.Tr.Get("Invalid OID: %s", oid))
+	if !h.IsValidOid(oid) {
+		return "", "", errors.New(tr.Tr.Get("Invalid OID: %s", oid))
 	}
-	return oid, nil
+	return oid, h, nil
 }
 
 func parsePointerExtension(key string, value string) (*PointerExtension, error) {
@@ -240,12 +265,12 @@ func parsePointerExtension(key string, value string) (*PointerExtension, error)
 
 	name := keyParts[2]
 
-	oid, err := parseOid(value)
+	oid, h, err := parseOid(value)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewPointerExtension(name, p, oid), nil
+	return NewPointerExtensionWithHashAlgorithm(name, p, oid, h), nil
 }
 
 func validatePointerExtensions(exts []*PointerExtension) error {
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -99,6 +100,32 @@ size 12345`
 	assertEqualWithExample(t, ex, int64(12345), p.Size)
 }
 
+func TestDecodeSHA512(t *testing.T) {
+	ex := `version https://git-lfs.github.com/spec/v1
+oid sha512:ee26b0dd4af7e749aa1a8ee3c10ae9923f618980772e473f8819a5d4940e0db27ac185f8a0e1d5f84f88bc887fd67b143732c304cc5fa9ad8e6f57f50028a8ff
+size 4`
+
+	p, err := DecodePointer(bytes.NewBufferString(ex))
+	assertEqualWithExample(t, ex, nil, err)
+	assertEqualWithExample(t, ex, "ee26b0dd4af7e749aa1a8ee3c10ae9923f618980772e473f8819a5d4940e0db27ac185f8a0e1d5f84f88bc887fd67b143732c304cc5fa9ad8e6f57f50028a8ff", p.Oid)
+	assertEqualWithExample(t, ex, "sha512", p.OidType)
+	assertEqualWithExample(t, ex, tools.SHA512, p.HashAlgorithm())
+	assertEqualWithExample(t, ex, int64(4), p.Size)
+}
+
+func TestDecodeBLAKE3(t *testing.T) {
+	ex := `version https://git-lfs.github.com/spec/v1
+oid blake3:aca4f0133c931ea1d8420a3a9b96d7a15ef245b1755224d80db917cee17c86c7
+size 6`
+
+	p, err := DecodePointer(bytes.NewBufferString(ex))
+	assertEqualWithExample(t, ex, nil, err)
+	assertEqualWithExample(t, ex, "aca4f0133c931ea1d8420a3a9b96d7a15ef245b1755224d80db917cee17c86c7", p.Oid)
+	assertEqualWithExample(t, ex, "blake3", p.OidType)
+	assertEqualWithExample(t, ex, tools.BLAKE3, p.HashAlgorithm())
+	assertEqualWithExample(t, ex, ex+"\n", p.Encoded())
+}
+
 func TestDecodeExtensions(t *testing.T) {
 	ex := `version https://git-lfs.github.com/spec/v1
 ext-0-foo sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff
@@ -248,6 +275,16 @@ size 12345`,
 		// bad oid type
 		`version https://git-lfs.github.com/spec/v1
 oid shazam:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345`,
+
+		// non-canonical oid type
+		`version https://git-lfs.github.com/spec/v1
+oid SHA256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345`,
+
+		// oid length does not match oid type
+		`version https://git-lfs.github.com/spec/v1
+oid sha512:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
 size 12345`,
 
 		// no oid
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/git-lfs/git-lfs/v3/config"
 	"github.com/git-lfs/git-lfs/v3/creds"
@@ -27,6 +28,7 @@ type EndpointFinder interface {
 	NewEndpoint(operation, rawurl string) lfshttp.Endpoint
 	Endpoint(operation, remote string) lfshttp.Endpoint
 	RemoteEndpoint(operation, remote string) lfshttp.Endpoint
+	MirrorEndpoints(remote string) []lfshttp.Endpoint
 	GitRemoteURL(remote string, forpush bool) string
 	AccessFor(rawurl string) creds.Access
 	SetAccess(access creds.Access)
@@ -153,6 +155,38 @@ func (e *endpointGitFinder) RemoteEndpoint(operation, remote string) lfshttp.End
 	return lfshttp.Endpoint{}
 }
 
+// MirrorEndpoints returns the endpoints of the read-only mirrors from which
+// objects may be downloaded for the given remote, as configured with
+// lfs.<remote>.mirrors, in the order in which they were listed. Uploads and
+// locks always use the endpoint returned by Endpoint.
+func (e *endpointGitFinder) MirrorEndpoints(remote string) []lfshttp.Endpoint {
+	if e.gitEnv == nil {
+		return nil
+	}
+
+	if len(remote) == 0 {
+		remote = defaultRemote
+	}
+
+	var endpoints []lfshttp.Endpoint
+	for _, value := range e.gitEnv.GetAll("lfs." + remote + ".mirrors") {
+		for _, rawurl := range strings.FieldsFunc(value, isMirrorSeparator) {
+			endpoint := e.NewEndpoint("download", strings.TrimSuffix(rawurl, "/"))
+			if len(endpoint.SSHMetadata.UserAndHost) > 0 {
+				tracerx.Printf("ignoring SSH mirror %q for remote %q", rawurl, remote)
+				continue
+			}
+			endpoint.Operation = "download"
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
+
+func isMirrorSeparator(r rune) bool {
+	return r == ',' || unicode.IsSpace(r)
+}
+
 func parseFetchHead(filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
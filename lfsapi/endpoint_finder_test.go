@@ -778,3 +778,26 @@ func TestExtractRemoteUrlNoURL(t *testing.T) {
 		assert.Equal(t, "", result)
 	}
 }
+
+func TestMirrorEndpoints(t *testing.T) {
+	finder := NewEndpointFinder(lfshttp.NewContext(nil, nil, map[string]string{
+		"remote.origin.lfsurl": "https://primary.example/lfs",
+		"lfs.origin.mirrors":   "https://eu.example/lfs/, https://us.example/lfs git@ssh.example:lfs",
+		"lfs.other.mirrors":    "https://other.example/lfs",
+	}))
+
+	endpoints := finder.MirrorEndpoints("")
+	if assert.Len(t, endpoints, 2) {
+		assert.Equal(t, "https://eu.example/lfs", endpoints[0].Url)
+		assert.Equal(t, "download", endpoints[0].Operation)
+		assert.Equal(t, "https://us.example/lfs", endpoints[1].Url)
+	}
+
+	endpoints = finder.MirrorEndpoints("other")
+	if assert.Len(t, endpoints, 1) {
+		assert.Equal(t, "https://other.example/lfs", endpoints[0].Url)
+	}
+
+	assert.Empty(t, finder.MirrorEndpoints("missing"))
+	assert.Equal(t, "https://primary.example/lfs", finder.Endpoint("download", "").Url)
+}
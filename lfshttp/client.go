@@ -327,7 +327,10 @@ func (c *Client) DoWithRedirect(cli *http.Client, req *http.Request, remote stri
 
 	requests := max(0, retries) + 1
 	for i := 0; i < requests; i++ {
+		span := startRequestSpan(req, i)
+		start := time.Now()
 		res, err = cli.Do(req)
+		endRequestSpan(span, req, tracedReq, res, err, i, time.Since(start))
 		if err == nil {
 			break
 		}
@@ -408,7 +411,10 @@ func (c *Client) doWithRedirects(cli *http.Client, req *http.Request, remote str
 	return c.doWithRedirects(cli, redirectedReq, remote, via)
 }
 
-func (c *Client) configureProtocols(u *url.URL, transport *http.Transport) error {
+// configureProtocols configures the transport to use the HTTP version given by
+// http.<url>.version, returning whether HTTP/3 should be used, in which case
+// the transport is configured as the fallback for when it cannot be.
+func (c *Client) configureProtocols(u *url.URL, transport *http.Transport) (bool, error) {
 	version, _ := c.uc.Get("http", u.String(), "version")
 	switch version {
 	case "HTTP/1.1":
@@ -416,16 +422,22 @@ func (c *Client) configureProtocols(u *url.URL, transport *http.Transport) error
 		transport.TLSNextProto = make(map[string]func(authority string, c *tls.Conn) http.RoundTripper)
 	case "HTTP/2":
 		if u.Scheme != "https" {
-			return errors.New(tr.Tr.Get("HTTP/2 cannot be used except with TLS"))
+			return false, errors.New(tr.Tr.Get("HTTP/2 cannot be used except with TLS"))
 		}
 		http2.ConfigureTransport(transport)
 		delete(transport.TLSNextProto, "http/1.1")
+	case "HTTP/3":
+		if u.Scheme != "https" {
+			return false, errors.New(tr.Tr.Get("HTTP/3 cannot be used except with TLS"))
+		}
+		http2.ConfigureTransport(transport)
+		return true, nil
 	case "":
 		http2.ConfigureTransport(transport)
 	default:
-		return errors.New(tr.Tr.Get("Unknown HTTP version %q", version))
+		return false, errors.New(tr.Tr.Get("Unknown HTTP version %q", version))
 	}
-	return nil
+	return false, nil
 }
 
 func (c *Client) Transport(u *url.URL, access creds.AccessMode) (http.RoundTripper, error) {
@@ -518,15 +530,26 @@ func (c *Client) Transport(u *url.URL, access creds.AccessMode) (http.RoundTripp
 		tr.TLSClientConfig.RootCAs = getRootCAsForHostFromGitconfig(c, host)
 	}
 
-	if err := c.configureProtocols(u, tr); err != nil {
+	useHTTP3, err := c.configureProtocols(u, tr)
+	if err != nil {
 		return nil, err
 	}
 
 	if access == creds.NegotiateAccess {
+		if useHTTP3 {
+			tracerx.Printf("http: not using HTTP/3 for %s with Negotiate authentication", host)
+		}
 		// This technically copies a mutex, but we know since we've just created
 		// the object that this mutex is unlocked.
 		return &spnego.Transport{Transport: *tr}, nil
 	}
+	if useHTTP3 {
+		var idleTimeout time.Duration
+		if activityTimeout > 0 {
+			idleTimeout = time.Duration(activityTimeout) * time.Second
+		}
+		return newHTTP3Transport(tr, time.Duration(tlstime)*time.Second, idleTimeout), nil
+	}
 	return tr, nil
 }
 
@@ -0,0 +1,115 @@
+package lfshttp
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/rubyist/tracerx"
+)
+
+// http3Transport is an http.RoundTripper which makes requests using HTTP/3
+// over QUIC, as selected by setting http.<url>.version to "HTTP/3".
+//
+// Since QUIC runs over UDP, which may be blocked where TCP is not, and cannot
+// be sent through an HTTP proxy, requests which would go through a proxy are
+// made using the fallback transport instead, which uses HTTP/2 where the server
+// supports it. Likewise, once an HTTP/3 request fails, that request and all
+// later ones are made using the fallback transport.
+type http3Transport struct {
+	h3       *http3.Transport
+	fallback *http.Transport
+
+	// failed is true once an HTTP/3 request has failed.
+	failed atomic.Bool
+}
+
+// newHTTP3Transport returns an http3Transport which uses the TLS configuration
+// of "fallback", giving up on establishing a connection after
+// "handshakeTimeout", and closing connections after "idleTimeout" without
+// activity, unless it is zero.
+func newHTTP3Transport(fallback *http.Transport, handshakeTimeout, idleTimeout time.Duration) *http3Transport {
+	return &http3Transport{
+		h3: &http3.Transport{
+			TLSClientConfig: fallback.TLSClientConfig.Clone(),
+			QUICConfig: &quic.Config{
+				HandshakeIdleTimeout: handshakeTimeout,
+				MaxIdleTimeout:       idleTimeout,
+			},
+		},
+		fallback: fallback,
+	}
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.failed.Load() {
+		return t.fallback.RoundTrip(req)
+	}
+
+	if t.fallback.Proxy != nil {
+		proxyURL, err := t.fallback.Proxy(req)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL != nil {
+			tracerx.Printf("http: not using HTTP/3 for %s with proxy %s", req.URL.Host, proxyURL.Host)
+			return t.fallback.RoundTrip(req)
+		}
+	}
+
+	// Keep the request body open if the request fails, so that it may be
+	// sent again using the fallback transport.
+	body, rewindable := req.Body.(ReadSeekCloser)
+	h3Req := req
+	if rewindable {
+		h3Req = req.Clone(req.Context())
+		h3Req.Body = io.NopCloser(body)
+	}
+
+	res, err := t.h3.RoundTrip(h3Req)
+	if err == nil {
+		if rewindable {
+			res.Body = &http3ResponseBody{ReadCloser: res.Body, reqBody: body}
+		}
+		return res, nil
+	}
+
+	if req.Context().Err() != nil {
+		return nil, err
+	}
+	t.failed.Store(true)
+	tracerx.Printf("http: HTTP/3 request to %s failed, falling back to HTTP/2: %s", req.URL.Host, err)
+
+	if req.Body != nil && req.Body != http.NoBody {
+		if !rewindable {
+			return nil, err
+		}
+		if _, serr := body.Seek(0, io.SeekStart); serr != nil {
+			body.Close()
+			return nil, err
+		}
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both the HTTP/3 and
+// fallback transports.
+func (t *http3Transport) CloseIdleConnections() {
+	t.h3.CloseIdleConnections()
+	t.fallback.CloseIdleConnections()
+}
+
+// http3ResponseBody closes the body of a request made using HTTP/3 once its
+// response has been read, since the HTTP/3 transport was not allowed to.
+type http3ResponseBody struct {
+	io.ReadCloser
+	reqBody io.Closer
+}
+
+func (b *http3ResponseBody) Close() error {
+	b.reqBody.Close()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,142 @@
+package lfshttp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHTTP3TestServer returns a TLS test server which also serves HTTP/3 on the
+// same port, using the given handler for both.
+func newHTTP3TestServer(t *testing.T, handler http.Handler) *httptest.Server {
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	addr, err := net.ResolveUDPAddr("udp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	conn, err := net.ListenUDP("udp", addr)
+	require.NoError(t, err)
+
+	h3srv := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(srv.TLS),
+	}
+	go h3srv.Serve(conn)
+	t.Cleanup(func() {
+		h3srv.Close()
+		conn.Close()
+	})
+	return srv
+}
+
+func TestHTTP3(t *testing.T) {
+	var called uint32
+	srv := newHTTP3TestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(&called, 1)
+		assert.Equal(t, "HTTP/3.0", r.Proto)
+
+		by, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "body", string(by))
+		w.WriteHeader(200)
+	}))
+
+	c := NewClient(NewContext(nil, nil, map[string]string{
+		"http.sslverify": "false",
+		"http.version":   "HTTP/3",
+	}))
+	stats := &bytes.Buffer{}
+	c.LogHTTPStats(nopCloser(stats))
+	verbose := &bytes.Buffer{}
+	c.Verbose = true
+	c.VerboseOut = verbose
+
+	req, err := http.NewRequest("POST", srv.URL, nil)
+	require.NoError(t, err)
+	req = c.LogRequest(req, "http3-test")
+	req.Body = NewByteBody([]byte("body"))
+	req.ContentLength = 4
+
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	require.NoError(t, c.Close())
+
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "HTTP/3.0", res.Proto)
+	assert.EqualValues(t, 1, called)
+
+	assert.Contains(t, stats.String(), "key=http3-test event=response url="+srv.URL+" method=POST status=200")
+	assert.Contains(t, verbose.String(), "< HTTP/3.0 200 OK")
+}
+
+func TestHTTP3FallsBackToHTTP2(t *testing.T) {
+	var called uint32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(&called, 1)
+		assert.Equal(t, "HTTP/2.0", r.Proto)
+
+		by, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "body", string(by))
+		w.WriteHeader(200)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := NewClient(NewContext(nil, nil, map[string]string{
+		"http.sslverify": "false",
+		"http.version":   "HTTP/3",
+		"lfs.tlstimeout": "1",
+	}))
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", srv.URL, nil)
+		require.NoError(t, err)
+		req.Body = NewByteBody([]byte("body"))
+		req.ContentLength = 4
+
+		res, err := c.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, 200, res.StatusCode)
+	}
+	assert.EqualValues(t, 2, called)
+
+	// Once HTTP/3 has failed, it is no longer tried.
+	require.Len(t, c.hostClients, 1)
+	for _, cli := range c.hostClients {
+		require.IsType(t, &http3Transport{}, cli.Transport)
+		assert.True(t, cli.Transport.(*http3Transport).failed.Load())
+	}
+}
+
+func TestHTTP3RequiresTLS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	c := NewClient(NewContext(nil, nil, map[string]string{
+		"http.version": "HTTP/3",
+	}))
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	require.NoError(t, err)
+
+	_, err = c.Do(req)
+	require.Error(t, err)
+	assert.Equal(t, "HTTP/3 cannot be used except with TLS", err.Error())
+}
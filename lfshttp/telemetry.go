@@ -0,0 +1,64 @@
+package lfshttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
+)
+
+var (
+	httpDuration      = telemetry.NewHistogram("lfs.http.client.duration", "Time taken to receive the headers of HTTP responses")
+	httpRequests      = telemetry.NewCounter("lfs.http.client.requests", "{request}", "Number of HTTP requests made")
+	httpRetries       = telemetry.NewCounter("lfs.http.client.retries", "{request}", "Number of HTTP requests retried after a network error")
+	httpErrors        = telemetry.NewCounter("lfs.http.client.errors", "{request}", "Number of HTTP requests which failed or received an error status")
+	httpRequestBytes  = telemetry.NewCounter("lfs.http.client.request.size", "By", "Number of bytes sent in HTTP request bodies")
+	httpResponseBytes = telemetry.NewCounter("lfs.http.client.response.size", "By", "Number of bytes received in HTTP response bodies")
+)
+
+// startRequestSpan starts a span for an attempt to send req, which is the
+// given retry of the request, and sets the traceparent header of req to
+// identify it.
+func startRequestSpan(req *http.Request, retry int) *telemetry.Span {
+	ctx, span := telemetry.StartClient(req.Context(), "HTTP "+req.Method,
+		telemetry.String("http.request.method", req.Method),
+		telemetry.String("url.full", telemetry.RedactURL(req.URL.String())),
+		telemetry.String("server.address", req.URL.Hostname()),
+	)
+	if retry > 0 {
+		span.SetAttributes(telemetry.Int("http.request.resend_count", int64(retry)))
+	}
+	telemetry.Inject(ctx, req.Header)
+	return span
+}
+
+// endRequestSpan ends the span for an attempt to send req which took time d,
+// and records its metrics.
+func endRequestSpan(span *telemetry.Span, req *http.Request, tracedReq *tracedRequest, res *http.Response, err error, retry int, d time.Duration) {
+	attrs := []telemetry.Attribute{
+		telemetry.String("http.request.method", req.Method),
+		telemetry.String("server.address", req.URL.Hostname()),
+	}
+
+	httpRequests.Add(1, attrs...)
+	httpDuration.Record(d, attrs...)
+	if retry > 0 {
+		httpRetries.Add(1, attrs...)
+	}
+	if tracedReq != nil {
+		httpRequestBytes.Add(tracedReq.BodySize, attrs...)
+	}
+
+	if err != nil {
+		httpErrors.Add(1, attrs...)
+		span.SetError(err)
+	} else if res != nil {
+		span.SetAttributes(telemetry.Int("http.response.status_code", int64(res.StatusCode)))
+		if res.StatusCode >= 400 {
+			httpErrors.Add(1, attrs...)
+			span.SetError(errors.New(res.Status))
+		}
+	}
+	span.End()
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/rubyist/tracerx"
 )
@@ -108,6 +109,11 @@ func (r *tracedResponse) Read(b []byte) (int, error) {
 
 	if err == io.EOF && !r.eof {
 		r.httpLogger.LogResponse(r.response.Request, r.response.StatusCode, r.BodySize)
+		req := r.response.Request
+		httpResponseBytes.Add(r.BodySize,
+			telemetry.String("http.request.method", req.Method),
+			telemetry.String("server.address", req.URL.Hostname()),
+		)
 		r.eof = true
 	}
 	return n, err
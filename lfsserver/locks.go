@@ -0,0 +1,436 @@
+package lfsserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+// Lock is a lock on a path, as described by the locking API.
+type Lock struct {
+	Id       string    `json:"id"`
+	Path     string    `json:"path"`
+	LockedAt time.Time `json:"locked_at"`
+	Owner    *User     `json:"owner,omitempty"`
+	// ExpiresAt is the time at which the lock's lease expires, or zero if
+	// it does not expire.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// User is the owner of a lock.
+type User struct {
+	Name string `json:"name"`
+}
+
+// ownedBy returns whether the lock is owned by the named user.
+func (l *Lock) ownedBy(name string) bool {
+	return l.Owner != nil && l.Owner.Name == name
+}
+
+// expired returns whether the lock's lease had expired at the given time.
+func (l *Lock) expired(at time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !at.Before(l.ExpiresAt)
+}
+
+// LockStore holds the locks served by a Server. Locks are not scoped to refs;
+// a path may be locked only once in the whole repository.
+//
+// A LockStore which persists its locks may share its file with other
+// processes, such as concurrent git-lfs-transfer-server sessions. Each
+// operation holds an exclusive lock on the file, and reloads the locks from
+// it first.
+type LockStore struct {
+	path string
+
+	mu    sync.Mutex
+	locks []Lock
+}
+
+// NewLockStore returns a LockStore which persists its locks as JSON in the
+// file at path, loading any locks already there. If path is empty, the locks
+// are kept only in memory.
+func NewLockStore(path string) (*LockStore, error) {
+	s := &LockStore{path: path}
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	unlock()
+	return s, nil
+}
+
+// Create locks path on behalf of the named owner, until expiresAt, if it is
+// not zero. If the path is already locked, the existing lock is returned, and
+// created is false. A lock whose lease has expired is replaced.
+func (s *LockStore) Create(path, owner string, expiresAt time.Time) (lock Lock, created bool, err error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Lock{}, false, err
+	}
+	defer unlock()
+
+	now := time.Now()
+	prev := s.locks
+	locks := make([]Lock, 0, len(s.locks)+1)
+	for _, l := range s.locks {
+		if l.Path != path {
+			locks = append(locks, l)
+		} else if !l.expired(now) {
+			return l, false, nil
+		}
+	}
+
+	lock, err = newLock(path, owner, now, expiresAt)
+	if err != nil {
+		return Lock{}, false, err
+	}
+	s.locks = append(locks, lock)
+	if err := s.save(); err != nil {
+		s.locks = prev
+		return Lock{}, false, err
+	}
+	return lock, true, nil
+}
+
+// LockResult is the result of locking or unlocking one of the paths given to
+// CreateAll or DeleteAll. Lock is the lock which was created or deleted, or
+// the lock which prevented the path from being locked. Message is the reason
+// the path was not locked or unlocked, if it was not.
+type LockResult struct {
+	Path    string
+	Lock    *Lock
+	Message string
+}
+
+// CreateAll locks each of paths on behalf of the named owner, as Create does.
+// If atomic is true and any of the paths is already locked, none of them are
+// locked.
+func (s *LockStore) CreateAll(paths []string, owner string, expiresAt time.Time, atomic bool) ([]LockResult, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	now := time.Now()
+	held := make(map[string]Lock, len(s.locks))
+	for _, l := range s.locks {
+		if !l.expired(now) {
+			held[l.Path] = l
+		}
+	}
+
+	results := make([]LockResult, len(paths))
+	created := make(map[string]Lock, len(paths))
+	failed := false
+	for i, path := range paths {
+		results[i].Path = path
+		if l, ok := held[path]; ok {
+			results[i].Lock = &l
+			results[i].Message = tr.Tr.Get("already created lock")
+			failed = true
+			continue
+		}
+
+		lock, err := newLock(path, owner, now, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		held[path] = lock
+		created[path] = lock
+		results[i].Lock = &lock
+	}
+
+	if failed && atomic {
+		abortResults(results)
+		return results, nil
+	}
+
+	prev := s.locks
+	locks := make([]Lock, 0, len(s.locks)+len(created))
+	for _, l := range s.locks {
+		if _, ok := created[l.Path]; !ok {
+			locks = append(locks, l)
+		}
+	}
+	for _, r := range results {
+		if len(r.Message) == 0 {
+			locks = append(locks, *r.Lock)
+		}
+	}
+	s.locks = locks
+	if err := s.save(); err != nil {
+		s.locks = prev
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeleteAll removes the lock on each of paths on behalf of the named user, who
+// must own them unless force is given. If atomic is true and any of the paths
+// cannot be unlocked, none of them are.
+func (s *LockStore) DeleteAll(paths []string, user string, force, atomic bool) ([]LockResult, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	held := make(map[string]Lock, len(s.locks))
+	for _, l := range s.locks {
+		held[l.Path] = l
+	}
+
+	results := make([]LockResult, len(paths))
+	deleted := make(map[string]bool, len(paths))
+	failed := false
+	for i, path := range paths {
+		results[i].Path = path
+		l, ok := held[path]
+		if !ok || deleted[l.Id] {
+			results[i].Message = tr.Tr.Get("unable to find lock")
+			failed = true
+		} else if !force && !l.ownedBy(user) {
+			results[i].Message = tr.Tr.Get("lock %s is owned by another user", l.Id)
+			failed = true
+		} else {
+			results[i].Lock = &l
+			deleted[l.Id] = true
+		}
+	}
+
+	if failed && atomic {
+		abortResults(results)
+		return results, nil
+	}
+
+	prev := s.locks
+	locks := make([]Lock, 0, len(s.locks))
+	for _, l := range s.locks {
+		if !deleted[l.Id] {
+			locks = append(locks, l)
+		}
+	}
+	s.locks = locks
+	if err := s.save(); err != nil {
+		s.locks = prev
+		return nil, err
+	}
+	return results, nil
+}
+
+// abortResults marks each of the successful results as aborted, because
+// another path in their batch failed.
+func abortResults(results []LockResult) {
+	for i := range results {
+		if len(results[i].Message) == 0 {
+			results[i].Lock = nil
+			results[i].Message = tr.Tr.Get("aborted because another path failed")
+		}
+	}
+}
+
+// Renew sets the time at which the lease of the lock with the given ID expires
+// to expiresAt, and returns the renewed lock.
+func (s *LockStore) Renew(id string, expiresAt time.Time) (Lock, bool, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Lock{}, false, err
+	}
+	defer unlock()
+
+	for i, l := range s.locks {
+		if l.Id != id {
+			continue
+		}
+
+		prev := l
+		s.locks[i].ExpiresAt = expiresAt.UTC().Truncate(time.Second)
+		if err := s.save(); err != nil {
+			s.locks[i] = prev
+			return Lock{}, false, err
+		}
+		return s.locks[i], true, nil
+	}
+	return Lock{}, false, nil
+}
+
+// Get returns the lock with the given ID, if there is one.
+func (s *LockStore) Get(id string) (Lock, bool, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Lock{}, false, err
+	}
+	defer unlock()
+
+	for _, l := range s.locks {
+		if l.Id == id {
+			return l, true, nil
+		}
+	}
+	return Lock{}, false, nil
+}
+
+// Delete removes the lock with the given ID, and returns it.
+func (s *LockStore) Delete(id string) (Lock, bool, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return Lock{}, false, err
+	}
+	defer unlock()
+
+	for i, l := range s.locks {
+		if l.Id != id {
+			continue
+		}
+
+		locks := make([]Lock, 0, len(s.locks)-1)
+		locks = append(locks, s.locks[:i]...)
+		locks = append(locks, s.locks[i+1:]...)
+
+		prev := s.locks
+		s.locks = locks
+		if err := s.save(); err != nil {
+			s.locks = prev
+			return Lock{}, false, err
+		}
+		return l, true, nil
+	}
+	return Lock{}, false, nil
+}
+
+// List returns the locks matching path and id, either of which may be empty
+// to match any lock, in the order they were created. The list starts at the
+// lock whose ID is cursor, if cursor is given, and holds at most limit locks,
+// if limit is positive. If there are more locks after them, the ID of the
+// next one is returned as the cursor to list them with.
+func (s *LockStore) List(path, id, cursor string, limit int) ([]Lock, string, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, "", err
+	}
+	defer unlock()
+
+	locks := make([]Lock, 0, len(s.locks))
+	seenCursor := len(cursor) == 0
+	for _, l := range s.locks {
+		if !seenCursor {
+			if l.Id != cursor {
+				continue
+			}
+			seenCursor = true
+		}
+		if len(path) > 0 && l.Path != path {
+			continue
+		}
+		if len(id) > 0 && l.Id != id {
+			continue
+		}
+		if limit > 0 && len(locks) == limit {
+			return locks, l.Id, nil
+		}
+		locks = append(locks, l)
+	}
+	return locks, "", nil
+}
+
+// newLock returns a new lock on path for the named owner, locked at now.
+func newLock(path, owner string, now, expiresAt time.Time) (Lock, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Lock{}, err
+	}
+
+	return Lock{
+		Id:   hex.EncodeToString(id),
+		Path: path,
+		// The SSH protocol only transfers whole seconds, so locks are
+		// stored without the rest.
+		LockedAt:  now.UTC().Truncate(time.Second),
+		Owner:     &User{Name: owner},
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}, nil
+}
+
+// lock takes the store's lock, which is shared with other processes using the
+// same file if the locks are persisted, and then reloads the locks from the
+// file. The returned function releases the lock.
+func (s *LockStore) lock() (func(), error) {
+	s.mu.Lock()
+	if len(s.path) == 0 {
+		return s.mu.Unlock, nil
+	}
+
+	f, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, errors.Wrap(err, tr.Tr.Get("LFS server: cannot open lock file"))
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		s.mu.Unlock()
+		return nil, errors.Wrap(err, tr.Tr.Get("LFS server: cannot lock %q", f.Name()))
+	}
+	unlock := func() {
+		unlockFile(f)
+		f.Close()
+		s.mu.Unlock()
+	}
+
+	if err := s.load(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// load replaces the locks with those in the store's file, if it exists.
+func (s *LockStore) load() error {
+	by, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.locks = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var locks []Lock
+	if err := json.Unmarshal(by, &locks); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("LFS server: cannot read locks from %q", s.path))
+	}
+	s.locks = locks
+	return nil
+}
+
+func (s *LockStore) save() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	by, err := json.Marshal(s.locks)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(by)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
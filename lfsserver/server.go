@@ -0,0 +1,259 @@
+package lfsserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	mediaType = "application/vnd.git-lfs+json"
+
+	// anonymousUser owns the locks created by HTTP requests which carry
+	// no username.
+	anonymousUser = "anonymous"
+)
+
+var (
+	batchRE  = regexp.MustCompile(`\A(.*)/objects/batch\z`)
+	objectRE = regexp.MustCompile(`\A(.*)/objects/([0-9a-f]+)(/verify)?\z`)
+	locksRE  = regexp.MustCompile(`\A.*/locks(?:/(verify|batch)|/([^/]+)/(unlock|renew))?\z`)
+)
+
+type batchRequest struct {
+	Operation     string         `json:"operation"`
+	Transfers     []string       `json:"transfers,omitempty"`
+	Ref           *ref           `json:"ref,omitempty"`
+	Objects       []*batchObject `json:"objects"`
+	HashAlgorithm string         `json:"hash_algo,omitempty"`
+}
+
+type batchResponse struct {
+	Transfer      string         `json:"transfer"`
+	Objects       []*batchObject `json:"objects"`
+	HashAlgorithm string         `json:"hash_algo,omitempty"`
+}
+
+type batchObject struct {
+	Oid           string                  `json:"oid"`
+	Size          int64                   `json:"size"`
+	Authenticated bool                    `json:"authenticated,omitempty"`
+	Actions       map[string]*batchAction `json:"actions,omitempty"`
+	Error         *batchError             `json:"error,omitempty"`
+}
+
+type batchAction struct {
+	Href string `json:"href"`
+}
+
+type batchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type ref struct {
+	Name string `json:"name"`
+}
+
+type verifyRequest struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// Server is a Git LFS server for the objects in a Storage and the locks in a
+// LockStore. Over HTTP, it serves the batch API with the basic transfer
+// adapter, and the locking API, beneath any path prefix; that is, a client
+// whose LFS endpoint is "http://host/repo.git/info/lfs" finds the batch API
+// at "/repo.git/info/lfs/objects/batch". See ServeTransfer for the SSH
+// protocol.
+//
+// The server performs no authentication. Locks created over HTTP are owned by
+// the username given with basic authentication, if any.
+type Server struct {
+	storage *Storage
+	locks   *LockStore
+}
+
+// NewServer returns a Server for the given objects and locks.
+func NewServer(storage *Storage, locks *LockStore) *Server {
+	return &Server{storage: storage, locks: locks}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tracerx.Printf("LFS server: %s %s", r.Method, r.URL.Path)
+
+	if m := batchRE.FindStringSubmatch(r.URL.Path); m != nil && r.Method == "POST" {
+		s.serveBatch(w, r, m[1])
+	} else if m := objectRE.FindStringSubmatch(r.URL.Path); m != nil {
+		algo, err := hashAlgorithm(r.URL.Query().Get("hash_algo"))
+		if err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if !algo.IsValidOid(m[2]) {
+			writeError(w, http.StatusUnprocessableEntity, tr.Tr.Get("Invalid object ID %q", m[2]))
+			return
+		}
+
+		switch {
+		case len(m[3]) > 0 && r.Method == "POST":
+			s.serveVerify(w, r, m[2], algo)
+		case len(m[3]) == 0 && (r.Method == "GET" || r.Method == "HEAD"):
+			s.serveDownload(w, r, m[2], algo)
+		case len(m[3]) == 0 && r.Method == "PUT":
+			s.serveUpload(w, r, m[2], algo)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, tr.Tr.Get("Method %s not allowed", r.Method))
+		}
+	} else if m := locksRE.FindStringSubmatch(r.URL.Path); m != nil {
+		switch {
+		case m[1] == "verify" && r.Method == "POST":
+			s.serveVerifyLocks(w, r)
+		case m[1] == "batch" && r.Method == "POST":
+			s.serveLockBatch(w, r)
+		case len(m[2]) > 0 && m[3] == "unlock" && r.Method == "POST":
+			s.serveUnlock(w, r, m[2])
+		case len(m[2]) > 0 && m[3] == "renew" && r.Method == "POST":
+			s.serveRenew(w, r, m[2])
+		case len(m[1]) == 0 && len(m[2]) == 0 && r.Method == "GET":
+			s.serveListLocks(w, r)
+		case len(m[1]) == 0 && len(m[2]) == 0 && r.Method == "POST":
+			s.serveCreateLock(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, tr.Tr.Get("Method %s not allowed", r.Method))
+		}
+	} else {
+		writeError(w, http.StatusNotFound, tr.Tr.Get("Not found"))
+	}
+}
+
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request, prefix string) {
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid batch request: %s", err))
+		return
+	}
+	if req.Operation != "download" && req.Operation != "upload" {
+		writeError(w, http.StatusUnprocessableEntity, tr.Tr.Get("Invalid operation %q", req.Operation))
+		return
+	}
+	algo, err := hashAlgorithm(req.HashAlgorithm)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := fmt.Sprintf("%s://%s%s/objects/", scheme, r.Host, prefix)
+	var query string
+	if algo != tools.DefaultHashAlgorithm {
+		query = "?" + url.Values{"hash_algo": {algo.String()}}.Encode()
+	}
+
+	res := &batchResponse{
+		Transfer:      "basic",
+		Objects:       make([]*batchObject, 0, len(req.Objects)),
+		HashAlgorithm: algo.String(),
+	}
+	for _, o := range req.Objects {
+		obj := &batchObject{Oid: o.Oid, Size: o.Size}
+		switch {
+		case !algo.IsValidOid(o.Oid) || o.Size < 0:
+			obj.Error = &batchError{Code: http.StatusUnprocessableEntity, Message: tr.Tr.Get("Invalid object")}
+		case req.Operation == "download" && s.storage.Has(o.Oid, algo, o.Size):
+			obj.Actions = map[string]*batchAction{
+				"download": {Href: base + o.Oid + query},
+			}
+		case req.Operation == "download":
+			obj.Error = &batchError{Code: http.StatusNotFound, Message: tr.Tr.Get("Object does not exist")}
+		case !s.storage.Has(o.Oid, algo, o.Size):
+			obj.Actions = map[string]*batchAction{
+				"upload": {Href: base + o.Oid + query},
+				"verify": {Href: base + o.Oid + "/verify" + query},
+			}
+		}
+		res.Objects = append(res.Objects, obj)
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, oid string, algo tools.HashAlgorithm) {
+	f, err := s.storage.Open(oid, algo)
+	if os.IsNotExist(err) {
+		writeError(w, http.StatusNotFound, tr.Tr.Get("Object does not exist"))
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	http.ServeContent(w, r, oid, time.Time{}, f)
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, oid string, algo tools.HashAlgorithm) {
+	if err := s.storage.Put(oid, algo, r.ContentLength, r.Body); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) serveVerify(w http.ResponseWriter, r *http.Request, oid string, algo tools.HashAlgorithm) {
+	var req verifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid verify request: %s", err))
+		return
+	}
+	if req.Oid != oid || !s.storage.Has(oid, algo, req.Size) {
+		writeError(w, http.StatusNotFound, tr.Tr.Get("Object does not exist"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// hashAlgorithm returns the hash algorithm with the given name, as given in a
+// batch request or an action's URL, or the default algorithm if it is empty.
+func hashAlgorithm(name string) (tools.HashAlgorithm, error) {
+	if len(name) == 0 {
+		return tools.DefaultHashAlgorithm, nil
+	}
+	algo, err := tools.ParseHashAlgorithm(name)
+	if err != nil {
+		return "", errors.New(tr.Tr.Get("Unsupported hash algorithm %q", name))
+	}
+	return algo, nil
+}
+
+// httpUser returns the name of the user making an HTTP request.
+func httpUser(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok && len(user) > 0 {
+		return user
+	}
+	return anonymousUser
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Message string `json:"message"`
+	}{message})
+}
@@ -0,0 +1,260 @@
+package lfsserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+type lockRequest struct {
+	Path      string    `json:"path"`
+	Ref       *ref      `json:"ref,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+type lockResponse struct {
+	Lock    *Lock  `json:"lock,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type lockList struct {
+	Locks      []Lock `json:"locks"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type unlockRequest struct {
+	Force bool `json:"force"`
+	Ref   *ref `json:"ref,omitempty"`
+}
+
+type renewRequest struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Ref       *ref      `json:"ref,omitempty"`
+}
+
+type lockBatchRequest struct {
+	Operation string    `json:"operation"`
+	Paths     []string  `json:"paths"`
+	Ref       *ref      `json:"ref,omitempty"`
+	Atomic    bool      `json:"atomic,omitempty"`
+	Force     bool      `json:"force,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+type lockBatchResult struct {
+	Path    string `json:"path"`
+	Lock    *Lock  `json:"lock,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type lockBatchResponse struct {
+	Results []lockBatchResult `json:"results"`
+}
+
+type verifyLocksRequest struct {
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Ref    *ref   `json:"ref,omitempty"`
+}
+
+type verifyLocksResponse struct {
+	Ours       []Lock `json:"ours"`
+	Theirs     []Lock `json:"theirs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func (s *Server) serveCreateLock(w http.ResponseWriter, r *http.Request) {
+	var req lockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid lock request: %s", err))
+		return
+	}
+	if len(req.Path) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, tr.Tr.Get("Missing lock path"))
+		return
+	}
+
+	lock, created, err := s.locks.Create(req.Path, httpUser(r), req.ExpiresAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+	} else if !created {
+		writeJSON(w, http.StatusConflict, &lockResponse{Lock: &lock, Message: tr.Tr.Get("already created lock")})
+	} else {
+		writeJSON(w, http.StatusCreated, &lockResponse{Lock: &lock})
+	}
+}
+
+func (s *Server) serveListLocks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var limit int
+	if v := q.Get("limit"); len(v) > 0 {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid limit %q", v))
+			return
+		}
+	}
+
+	locks, next, err := s.locks.List(q.Get("path"), q.Get("id"), q.Get("cursor"), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, &lockList{Locks: locks, NextCursor: next})
+}
+
+func (s *Server) serveVerifyLocks(w http.ResponseWriter, r *http.Request) {
+	var req verifyLocksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid lock verification request: %s", err))
+		return
+	}
+
+	user := httpUser(r)
+	locks, next, err := s.locks.List("", "", req.Cursor, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	res := &verifyLocksResponse{
+		Ours:       make([]Lock, 0, len(locks)),
+		Theirs:     make([]Lock, 0, len(locks)),
+		NextCursor: next,
+	}
+	for _, l := range locks {
+		if l.ownedBy(user) {
+			res.Ours = append(res.Ours, l)
+		} else {
+			res.Theirs = append(res.Theirs, l)
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) serveUnlock(w http.ResponseWriter, r *http.Request, id string) {
+	var req unlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid unlock request: %s", err))
+		return
+	}
+
+	status, lock, err := s.unlock(id, httpUser(r), req.Force)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, status, &lockResponse{Lock: &lock})
+}
+
+// unlock removes the lock with the given ID on behalf of the named user, who
+// must own it unless force is given. It returns the status code to respond
+// with.
+func (s *Server) unlock(id, user string, force bool) (int, Lock, error) {
+	lock, ok, err := s.locks.Get(id)
+	if err != nil {
+		return http.StatusInternalServerError, Lock{}, err
+	} else if !ok {
+		return http.StatusNotFound, Lock{}, errors.New(tr.Tr.Get("unable to find lock"))
+	}
+	if !force && !lock.ownedBy(user) {
+		return http.StatusForbidden, Lock{}, errors.New(tr.Tr.Get("lock %s is owned by another user", id))
+	}
+
+	lock, ok, err = s.locks.Delete(id)
+	if err != nil {
+		return http.StatusInternalServerError, Lock{}, err
+	} else if !ok {
+		return http.StatusNotFound, Lock{}, errors.New(tr.Tr.Get("unable to find lock"))
+	}
+	return http.StatusOK, lock, nil
+}
+
+func (s *Server) serveRenew(w http.ResponseWriter, r *http.Request, id string) {
+	var req renewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid lock renewal request: %s", err))
+		return
+	}
+
+	status, lock, err := s.renew(id, httpUser(r), req.ExpiresAt)
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, status, &lockResponse{Lock: &lock})
+}
+
+// renew extends the lease of the lock with the given ID on behalf of the named
+// user, who must own it, until expiresAt. It returns the status code to
+// respond with.
+func (s *Server) renew(id, user string, expiresAt time.Time) (int, Lock, error) {
+	if expiresAt.IsZero() {
+		return http.StatusUnprocessableEntity, Lock{}, errors.New(tr.Tr.Get("missing lock expiry"))
+	}
+
+	lock, ok, err := s.locks.Get(id)
+	if err != nil {
+		return http.StatusInternalServerError, Lock{}, err
+	} else if !ok {
+		return http.StatusNotFound, Lock{}, errors.New(tr.Tr.Get("unable to find lock"))
+	}
+	if !lock.ownedBy(user) {
+		return http.StatusForbidden, Lock{}, errors.New(tr.Tr.Get("lock %s is owned by another user", id))
+	}
+
+	lock, ok, err = s.locks.Renew(id, expiresAt)
+	if err != nil {
+		return http.StatusInternalServerError, Lock{}, err
+	} else if !ok {
+		return http.StatusNotFound, Lock{}, errors.New(tr.Tr.Get("unable to find lock"))
+	}
+	return http.StatusOK, lock, nil
+}
+
+func (s *Server) serveLockBatch(w http.ResponseWriter, r *http.Request) {
+	var req lockBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, tr.Tr.Get("Invalid lock batch request: %s", err))
+		return
+	}
+
+	status, results, err := s.lockBatch(&req, httpUser(r))
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+
+	res := &lockBatchResponse{Results: make([]lockBatchResult, 0, len(results))}
+	for _, result := range results {
+		res.Results = append(res.Results, lockBatchResult{Path: result.Path, Lock: result.Lock, Message: result.Message})
+	}
+	writeJSON(w, status, res)
+}
+
+// lockBatch locks or unlocks the paths in req on behalf of the named user. It
+// returns the status code to respond with.
+func (s *Server) lockBatch(req *lockBatchRequest, user string) (int, []LockResult, error) {
+	if len(req.Paths) == 0 {
+		return http.StatusUnprocessableEntity, nil, errors.New(tr.Tr.Get("Missing lock paths"))
+	}
+
+	var results []LockResult
+	var err error
+	switch req.Operation {
+	case "lock":
+		results, err = s.locks.CreateAll(req.Paths, user, req.ExpiresAt, req.Atomic)
+	case "unlock":
+		results, err = s.locks.DeleteAll(req.Paths, user, req.Force, req.Atomic)
+	default:
+		return http.StatusUnprocessableEntity, nil, errors.New(tr.Tr.Get("Invalid lock batch operation %q", req.Operation))
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, results, nil
+}
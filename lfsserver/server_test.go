@@ -0,0 +1,280 @@
+package lfsserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/git"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/locking"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *Server) {
+	storage, err := NewStorage(t.TempDir())
+	require.NoError(t, err)
+	locks, err := NewLockStore("")
+	require.NoError(t, err)
+
+	s := NewServer(storage, locks)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv, s
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server) *lfsapi.Client {
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url": srv.URL + "/repo.git/info/lfs",
+	}))
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func newTestFilesystem(t *testing.T) *fs.Filesystem {
+	gitDir := t.TempDir()
+	return fs.New(config.EnvironmentOf(config.MapFetcher(nil)), gitDir, "", filepath.Join(gitDir, "lfs"), 0755)
+}
+
+func runTransfers(t *testing.T, cli *lfsapi.Client, f *fs.Filesystem, dir tq.Direction, objects map[string]string) []error {
+	q := tq.NewTransferQueue(dir, tq.NewManifest(f, cli, "", "origin"), "origin")
+	for data, path := range objects {
+		q.Add(path, path, oidOf(data), int64(len(data)), false, nil)
+	}
+	q.Wait()
+	return q.Errors()
+}
+
+func TestServerTransfers(t *testing.T) {
+	srv, s := newTestServer(t)
+
+	upload := newTestFilesystem(t)
+	objects := make(map[string]string)
+	for _, data := range []string{"first object", "second object"} {
+		path := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+		objects[data] = path
+	}
+
+	require.Empty(t, runTransfers(t, newTestClient(t, srv), upload, tq.Upload, objects))
+	for data := range objects {
+		assert.True(t, s.storage.Has(oidOf(data), tools.SHA256, int64(len(data))))
+	}
+
+	download := newTestFilesystem(t)
+	for data := range objects {
+		objects[data] = download.ObjectPathname(oidOf(data))
+		require.NoError(t, os.MkdirAll(filepath.Dir(objects[data]), 0755))
+	}
+	objects["missing object"] = download.ObjectPathname(oidOf("missing object"))
+
+	errs := runTransfers(t, newTestClient(t, srv), download, tq.Download, objects)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "Object does not exist")
+	for data, path := range objects {
+		if data == "missing object" {
+			continue
+		}
+		by, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, data, string(by))
+	}
+}
+
+func TestServerTransfersWithHashAlgorithm(t *testing.T) {
+	srv, s := newTestServer(t)
+
+	for _, algo := range []tools.HashAlgorithm{tools.SHA512, tools.BLAKE3} {
+		data := "object with " + algo.String()
+		oid := oidWith(algo, data)
+		path := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+		q := tq.NewTransferQueue(tq.Upload, tq.NewManifest(newTestFilesystem(t), newTestClient(t, srv), "", "origin"), "origin")
+		q.AddTransfer(&tq.Transfer{Name: path, Path: path, Oid: oid, Size: int64(len(data)), HashAlgorithm: algo}, nil)
+		q.Wait()
+		require.Empty(t, q.Errors(), algo)
+		assert.True(t, s.storage.Has(oid, algo, int64(len(data))), algo)
+
+		download := newTestFilesystem(t)
+		path = download.ObjectPathname(oid)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		q = tq.NewTransferQueue(tq.Download, tq.NewManifest(download, newTestClient(t, srv), "", "origin"), "origin")
+		q.AddTransfer(&tq.Transfer{Name: path, Path: path, Oid: oid, Size: int64(len(data)), HashAlgorithm: algo}, nil)
+		q.Wait()
+		require.Empty(t, q.Errors(), algo)
+		by, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, data, string(by), algo)
+	}
+
+	// OIDs of the wrong length for the algorithm are rejected.
+	oid := oidWith(tools.SHA512, "x")
+	res, err := http.Get(srv.URL + "/objects/" + oid)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 422, res.StatusCode)
+
+	res, err = http.Get(srv.URL + "/objects/" + oid + "?hash_algo=md5")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 409, res.StatusCode)
+}
+
+func TestServerRejectsCorruptUploads(t *testing.T) {
+	srv, s := newTestServer(t)
+	oid := oidOf("expected")
+
+	req, err := http.NewRequest("PUT", srv.URL+"/objects/"+oid, strings.NewReader("actually"))
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, 422, res.StatusCode)
+	assert.False(t, s.storage.Has(oid, tools.SHA256, 8))
+}
+
+func TestServerLocks(t *testing.T) {
+	srv, s := newTestServer(t)
+
+	client := locking.NewClient("origin", newTestClient(t, srv), config.New())
+	defer client.Close()
+	require.NoError(t, client.SetupFileCache(t.TempDir()))
+	client.RemoteRef = &git.Ref{Name: "refs/heads/main"}
+
+	lock, err := client.LockFile("a.psd")
+	require.NoError(t, err)
+	assert.Equal(t, "a.psd", lock.Path)
+	assert.Equal(t, anonymousUser, lock.Owner.Name)
+
+	_, err = client.LockFile("a.psd")
+	assert.ErrorContains(t, err, "already created lock")
+
+	// A lock created by somebody else.
+	theirs, _, err := s.locks.Create("b.psd", "somebody else", time.Time{})
+	require.NoError(t, err)
+
+	locks, err := client.SearchLocks(map[string]string{"path": "b.psd"}, 0, false, false)
+	require.NoError(t, err)
+	assert.Equal(t, []locking.Lock{{
+		Id:       theirs.Id,
+		Path:     "b.psd",
+		Owner:    &locking.User{Name: "somebody else"},
+		LockedAt: theirs.LockedAt,
+	}}, locks)
+
+	ours, others, err := client.SearchLocksVerifiable(0, false)
+	require.NoError(t, err)
+	require.Len(t, ours, 1)
+	assert.Equal(t, lock.Id, ours[0].Id)
+	require.Len(t, others, 1)
+	assert.Equal(t, theirs.Id, others[0].Id)
+
+	assert.ErrorContains(t, client.UnlockFileById(theirs.Id, false), "owned by another user")
+	require.NoError(t, client.UnlockFileById(theirs.Id, true))
+	require.NoError(t, client.UnlockFileById(lock.Id, false))
+
+	remaining, _, err := s.locks.List("", "", "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+}
+
+func TestServerLockLeases(t *testing.T) {
+	srv, s := newTestServer(t)
+
+	client := locking.NewClient("origin", newTestClient(t, srv), config.New())
+	defer client.Close()
+	require.NoError(t, client.SetupFileCache(t.TempDir()))
+	client.RemoteRef = &git.Ref{Name: "refs/heads/main"}
+
+	lock, err := client.LockFileWithTTL("a.psd", time.Hour)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), lock.ExpiresAt, 2*time.Second)
+
+	renewed, err := client.RenewLock(lock.Id, 2*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, lock.Id, renewed.Id)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), renewed.ExpiresAt, 2*time.Second)
+
+	// A lock whose lease has expired is left out of searches, unless they
+	// include expired locks.
+	theirs, _, err := s.locks.Create("b.psd", "somebody else", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	locks, err := client.SearchLocks(nil, 0, false, false)
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+	assert.Equal(t, lock.Id, locks[0].Id)
+
+	ours, others, err := client.SearchLocksVerifiable(0, false)
+	require.NoError(t, err)
+	assert.Len(t, ours, 1)
+	assert.Empty(t, others)
+
+	client.IncludeExpired = true
+	locks, err = client.SearchLocks(map[string]string{"path": "b.psd"}, 0, false, false)
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+	assert.Equal(t, theirs.Id, locks[0].Id)
+	assert.True(t, locks[0].Expired(time.Now()))
+
+	_, err = client.RenewLock(theirs.Id, time.Hour)
+	assert.ErrorContains(t, err, "owned by another user")
+
+	// The expired lock does not prevent the path from being locked.
+	lock, err = client.LockFile("b.psd")
+	require.NoError(t, err)
+	assert.True(t, lock.ExpiresAt.IsZero())
+}
+
+func TestServerLockBatch(t *testing.T) {
+	srv, s := newTestServer(t)
+
+	client := locking.NewClient("origin", newTestClient(t, srv), config.New())
+	defer client.Close()
+	require.NoError(t, client.SetupFileCache(t.TempDir()))
+	client.RemoteRef = &git.Ref{Name: "refs/heads/main"}
+
+	theirs, _, err := s.locks.Create("c.psd", "somebody else", time.Time{})
+	require.NoError(t, err)
+
+	results, err := client.LockFiles([]string{"a.psd", "b.psd", "c.psd"}, 0, true)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.ErrorContains(t, results[0].Err, "aborted")
+	assert.ErrorContains(t, results[2].Err, "already created lock")
+	assert.Equal(t, theirs.Id, results[2].Lock.Id)
+
+	results, err = client.LockFiles([]string{"a.psd", "b.psd", "c.psd"}, time.Hour, false)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, "a.psd", results[0].Lock.Path)
+	assert.False(t, results[0].Lock.ExpiresAt.IsZero())
+
+	locks, err := client.SearchLocks(nil, 0, true, false)
+	require.NoError(t, err)
+	assert.Len(t, locks, 2)
+
+	results, err = client.UnlockFiles([]string{"a.psd", "b.psd", "c.psd"}, false, false)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+	assert.ErrorContains(t, results[2].Err, "owned by another user")
+
+	remaining, _, err := s.locks.List("", "", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []Lock{theirs}, remaining)
+}
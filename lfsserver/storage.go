@@ -0,0 +1,116 @@
+// Package lfsserver implements a self-contained Git LFS server, which speaks
+// the batch API, basic transfers and the locking API over HTTP, and the
+// git-lfs-transfer protocol over any pair of streams, such as an SSH session.
+// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+package lfsserver
+
+import (
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+// Storage holds the objects served by a Server on disk, in the same layout
+// that Git LFS uses for a repository's local objects.
+type Storage struct {
+	objectPath func(oid string) string
+	tempDir    func() string
+}
+
+// NewStorage returns a Storage which keeps objects in the "objects" directory
+// beneath dir.
+func NewStorage(dir string) (*Storage, error) {
+	tmp := filepath.Join(dir, "tmp")
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("LFS server: cannot create directory"))
+	}
+
+	return &Storage{
+		objectPath: func(oid string) string {
+			return filepath.Join(dir, "objects", oid[0:2], oid[2:4], oid)
+		},
+		tempDir: func() string { return tmp },
+	}, nil
+}
+
+// NewFilesystemStorage returns a Storage which keeps objects in the object
+// directory of the given Filesystem, so that a repository's objects can be
+// served directly.
+func NewFilesystemStorage(f *fs.Filesystem) *Storage {
+	return &Storage{
+		objectPath: f.ObjectPathname,
+		tempDir:    f.TempDir,
+	}
+}
+
+// Has returns whether the object with the given OID, computed with algo, and
+// size is stored.
+func (s *Storage) Has(oid string, algo tools.HashAlgorithm, size int64) bool {
+	if !algo.IsValidOid(oid) {
+		return false
+	}
+	if size == 0 {
+		// The empty object is always available, and never stored.
+		return oid == algo.EmptyOid()
+	}
+	return tools.FileExistsOfSize(s.objectPath(oid), size)
+}
+
+// Open opens the object with the given OID, computed with algo, for reading.
+// If the object isn't stored, the error satisfies os.IsNotExist.
+func (s *Storage) Open(oid string, algo tools.HashAlgorithm) (*os.File, error) {
+	if !algo.IsValidOid(oid) {
+		return nil, os.ErrNotExist
+	}
+	if oid == algo.EmptyOid() {
+		return os.Open(os.DevNull)
+	}
+	return os.Open(s.objectPath(oid))
+}
+
+// Put stores the object with the given OID, reading its contents from r. The
+// contents are verified against the OID using algo, and against size unless
+// it is negative, before the object is made available.
+func (s *Storage) Put(oid string, algo tools.HashAlgorithm, size int64, r io.Reader) error {
+	if !algo.IsValidOid(oid) {
+		return errors.New(tr.Tr.Get("LFS server: invalid object ID %q", oid))
+	}
+
+	f, err := os.CreateTemp(s.tempDir(), oid)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	hasher := algo.New()
+	written, err := io.Copy(io.MultiWriter(f, hasher), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if size >= 0 && written != size {
+		return errors.New(tr.Tr.Get("LFS server: expected %d bytes for %s, got %d", size, oid, written))
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != oid {
+		return errors.New(tr.Tr.Get("LFS server: expected OID %s, got %s", oid, actual))
+	}
+	if written == 0 {
+		// The empty object is always available, and never stored.
+		return nil
+	}
+
+	path := s.objectPath(oid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
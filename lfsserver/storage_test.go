@@ -0,0 +1,274 @@
+package lfsserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func oidOf(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func oidWith(algo tools.HashAlgorithm, data string) string {
+	h := algo.New()
+	io.WriteString(h, data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readObject(t *testing.T, s *Storage, oid string) string {
+	f, err := s.Open(oid, tools.SHA256)
+	require.NoError(t, err)
+	defer f.Close()
+
+	by, err := io.ReadAll(f)
+	require.NoError(t, err)
+	return string(by)
+}
+
+func TestStoragePutOpen(t *testing.T) {
+	s, err := NewStorage(t.TempDir())
+	require.NoError(t, err)
+
+	oid := oidOf("hello")
+	require.NoError(t, s.Put(oid, tools.SHA256, 5, strings.NewReader("hello")))
+	assert.True(t, s.Has(oid, tools.SHA256, 5))
+	assert.False(t, s.Has(oid, tools.SHA256, 6))
+	assert.Equal(t, "hello", readObject(t, s, oid))
+
+	// The size isn't checked when it's unknown.
+	oid = oidOf("unknown size")
+	require.NoError(t, s.Put(oid, tools.SHA256, -1, strings.NewReader("unknown size")))
+	assert.True(t, s.Has(oid, tools.SHA256, 12))
+
+	// The empty object is always present.
+	assert.True(t, s.Has(oidOf(""), tools.SHA256, 0))
+	assert.Equal(t, "", readObject(t, s, oidOf("")))
+
+	_, err = s.Open(oidOf("missing"), tools.SHA256)
+	assert.True(t, os.IsNotExist(err))
+	_, err = s.Open("../../etc/passwd", tools.SHA256)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStoragePutVerifies(t *testing.T) {
+	s, err := NewStorage(t.TempDir())
+	require.NoError(t, err)
+
+	oid := oidOf("hello")
+	assert.Error(t, s.Put(oid, tools.SHA256, 5, strings.NewReader("jello")))
+	assert.Error(t, s.Put(oid, tools.SHA256, 6, strings.NewReader("hello")))
+	assert.Error(t, s.Put("invalid", tools.SHA256, 5, strings.NewReader("hello")))
+	assert.False(t, s.Has(oid, tools.SHA256, 5))
+}
+
+func TestStorageHashAlgorithms(t *testing.T) {
+	s, err := NewStorage(t.TempDir())
+	require.NoError(t, err)
+
+	for _, algo := range tools.HashAlgorithms() {
+		oid := oidWith(algo, "hello")
+		require.NoError(t, s.Put(oid, algo, 5, strings.NewReader("hello")), algo)
+		assert.True(t, s.Has(oid, algo, 5), algo)
+
+		// Only the empty object of the algorithm is always present.
+		assert.True(t, s.Has(algo.EmptyOid(), algo, 0), algo)
+		assert.False(t, s.Has(oidWith(algo, "missing"), algo, 0), algo)
+	}
+
+	assert.False(t, s.Has(tools.SHA256.EmptyOid(), tools.BLAKE3, 0))
+	assert.False(t, s.Has(tools.SHA256.EmptyOid(), tools.SHA512, 0))
+	assert.Error(t, s.Put(oidWith(tools.SHA512, "hello"), tools.SHA256, 5, strings.NewReader("hello")))
+}
+
+func TestFilesystemStorage(t *testing.T) {
+	f := newTestFilesystem(t)
+	s := NewFilesystemStorage(f)
+
+	oid := oidOf("shared")
+	require.NoError(t, s.Put(oid, tools.SHA256, 6, strings.NewReader("shared")))
+	assert.True(t, f.ObjectExists(oid, 6))
+}
+
+func TestLockStorePersists(t *testing.T) {
+	path := t.TempDir() + "/locks.json"
+
+	s, err := NewLockStore(path)
+	require.NoError(t, err)
+	a, created, err := s.Create("a", "alice", time.Time{})
+	require.NoError(t, err)
+	assert.True(t, created)
+	b, _, err := s.Create("b", "bob", time.Time{})
+	require.NoError(t, err)
+	c, _, err := s.Create("c", "alice", time.Time{})
+	require.NoError(t, err)
+
+	existing, created, err := s.Create("a", "bob", time.Time{})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, a, existing)
+
+	_, ok, err := s.Delete(b.Id)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	s, err = NewLockStore(path)
+	require.NoError(t, err)
+
+	locks, next, err := s.List("", "", "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Lock{a}, locks)
+	assert.Equal(t, c.Id, next)
+
+	locks, next, err = s.List("", "", next, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Lock{c}, locks)
+	assert.Empty(t, next)
+}
+
+func TestLockStoreSharedFile(t *testing.T) {
+	path := t.TempDir() + "/locks.json"
+
+	// Each store stands in for a separate process using the same file.
+	stores := make([]*LockStore, 4)
+	for i := range stores {
+		var err error
+		stores[i], err = NewLockStore(path)
+		require.NoError(t, err)
+	}
+
+	a, created, err := stores[0].Create("a", "alice", time.Time{})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	// Locks made by one store are seen by the others.
+	existing, created, err := stores[1].Create("a", "bob", time.Time{})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, a, existing)
+
+	var wg sync.WaitGroup
+	for i, s := range stores {
+		wg.Add(1)
+		go func(i int, s *LockStore) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, created, err := s.Create(fmt.Sprintf("%d-%d", i, j), "alice", time.Time{})
+				assert.NoError(t, err)
+				assert.True(t, created)
+				_, created, err = s.Create("shared", "alice", time.Time{})
+				assert.NoError(t, err)
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	_, ok, err := stores[2].Delete(a.Id)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	locks, _, err := stores[3].List("", "", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, locks, len(stores)*10+1)
+	locks, _, err = stores[0].List("shared", "", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, locks, 1)
+	_, ok, err = stores[1].Get(a.Id)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestLockStoreLeases(t *testing.T) {
+	s, err := NewLockStore("")
+	require.NoError(t, err)
+
+	expired, created, err := s.Create("a", "alice", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// An expired lock is replaced by a new one.
+	a, created, err := s.Create("a", "bob", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.NotEqual(t, expired.Id, a.Id)
+	assert.Equal(t, "bob", a.Owner.Name)
+
+	_, created, err = s.Create("a", "alice", time.Time{})
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	expiresAt := time.Now().Add(2 * time.Hour)
+	renewed, ok, err := s.Renew(a.Id, expiresAt)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, expiresAt.UTC().Truncate(time.Second), renewed.ExpiresAt)
+
+	locks, _, err := s.List("a", "", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []Lock{renewed}, locks)
+
+	_, ok, err = s.Renew("missing", expiresAt)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestLockStoreBatch(t *testing.T) {
+	s, err := NewLockStore("")
+	require.NoError(t, err)
+
+	b, _, err := s.Create("b", "bob", time.Time{})
+	require.NoError(t, err)
+
+	// Nothing is locked by an atomic batch which includes a locked path.
+	results, err := s.CreateAll([]string{"a", "b", "c"}, "alice", time.Time{}, true)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Nil(t, results[0].Lock)
+	assert.Contains(t, results[0].Message, "aborted")
+	assert.Equal(t, &b, results[1].Lock)
+	assert.Equal(t, "already created lock", results[1].Message)
+	assert.Nil(t, results[2].Lock)
+	locks, _, err := s.List("", "", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, locks, 1)
+
+	results, err = s.CreateAll([]string{"a", "b", "c"}, "alice", time.Time{}, false)
+	require.NoError(t, err)
+	assert.Empty(t, results[0].Message)
+	assert.Equal(t, "alice", results[0].Lock.Owner.Name)
+	assert.Equal(t, "already created lock", results[1].Message)
+	assert.Empty(t, results[2].Message)
+	locks, _, err = s.List("", "", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, locks, 3)
+
+	// Alice cannot unlock Bob's lock without forcing it.
+	results, err = s.DeleteAll([]string{"a", "b"}, "alice", false, true)
+	require.NoError(t, err)
+	assert.Contains(t, results[0].Message, "aborted")
+	assert.Contains(t, results[1].Message, "owned by another user")
+	locks, _, err = s.List("", "", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, locks, 3)
+
+	results, err = s.DeleteAll([]string{"a", "b", "d"}, "alice", true, false)
+	require.NoError(t, err)
+	assert.Empty(t, results[0].Message)
+	assert.Equal(t, b.Id, results[1].Lock.Id)
+	assert.Equal(t, "unable to find lock", results[2].Message)
+	locks, _, err = s.List("", "", "", 0)
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+	assert.Equal(t, "c", locks[0].Path)
+}
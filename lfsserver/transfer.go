@@ -0,0 +1,502 @@
+package lfsserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/git-lfs/pktline"
+	"github.com/rubyist/tracerx"
+)
+
+// transferRequest is a single request of the git-lfs-transfer protocol.
+type transferRequest struct {
+	command string
+	args    map[string]string
+
+	// lines holds the text which follows a delimiter, for requests other
+	// than put-object.
+	lines []string
+	// data reads the binary data which follows a delimiter in a put-object
+	// request.
+	data io.Reader
+}
+
+// transferSession serves one connection of the git-lfs-transfer protocol.
+type transferSession struct {
+	server    *Server
+	pl        *pktline.Pktline
+	operation string
+	user      string
+	versioned bool
+
+	// pending is the data of the current request, which must be read in
+	// full before responding.
+	pending io.Reader
+}
+
+// ServeTransfer serves the git-lfs-transfer protocol, as spoken by the SSH
+// transfer adapter, reading requests from r and writing responses to w until
+// the client quits or r is closed. The operation is either "upload" or
+// "download", as given to git-lfs-transfer, and user is the name of the
+// authenticated user, who owns the locks they create.
+//
+// See docs/proposals/ssh_adapter.md for the protocol.
+func (s *Server) ServeTransfer(r io.Reader, w io.Writer, operation, user string) error {
+	if operation != "upload" && operation != "download" {
+		return errors.New(tr.Tr.Get("LFS server: invalid operation %q", operation))
+	}
+
+	sess := &transferSession{
+		server:    s,
+		pl:        pktline.NewPktline(r, w),
+		operation: operation,
+		user:      user,
+	}
+	return sess.serve()
+}
+
+func (s *transferSession) serve() error {
+	if err := s.pl.WritePacketList([]string{"version=1", "locking", "lock-batch"}); err != nil {
+		return err
+	}
+
+	for {
+		req, err := s.readRequest()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.NewProtocolError(tr.Tr.Get("LFS server: cannot read request"), err)
+		}
+
+		tracerx.Printf("LFS server: %s", req.command)
+		if req.command == "quit" {
+			return s.writeStatus(http.StatusOK, nil)
+		}
+		if err := s.handle(req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *transferSession) readRequest() (*transferRequest, error) {
+	command, pktLen, err := s.pl.ReadPacketTextWithLength()
+	if err != nil {
+		return nil, err
+	}
+	if pktLen < 4 {
+		return nil, errors.New(tr.Tr.Get("expected command, got %04x", pktLen))
+	}
+
+	req := &transferRequest{command: command, args: make(map[string]string)}
+	for {
+		line, pktLen, err := s.pl.ReadPacketTextWithLength()
+		if err != nil {
+			return nil, err
+		}
+		switch pktLen {
+		case 0:
+			return req, nil
+		case 1:
+			if strings.HasPrefix(command, "put-object ") {
+				req.data = pktline.NewPktlineReaderFromPktline(s.pl, 65536)
+				s.pending = req.data
+				return req, nil
+			}
+			req.lines, err = s.readLines()
+			return req, err
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+		req.args[key] = value
+	}
+}
+
+func (s *transferSession) readLines() ([]string, error) {
+	var lines []string
+	for {
+		line, pktLen, err := s.pl.ReadPacketTextWithLength()
+		if err != nil {
+			return nil, err
+		}
+		if pktLen == 0 {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+func (s *transferSession) handle(req *transferRequest) error {
+	command, arg, _ := strings.Cut(req.command, " ")
+	if command == "version" {
+		if arg != "1" {
+			return s.writeError(http.StatusBadRequest, tr.Tr.Get("unsupported version %q", arg))
+		}
+		s.versioned = true
+		return s.writeStatus(http.StatusOK, nil)
+	}
+	if !s.versioned {
+		return s.writeError(http.StatusBadRequest, tr.Tr.Get("version not negotiated"))
+	}
+
+	switch command {
+	case "batch":
+		return s.batch(req)
+	case "get-object":
+		if s.operation != "download" {
+			break
+		}
+		return s.getObject(arg, req)
+	case "put-object":
+		if s.operation != "upload" {
+			break
+		}
+		return s.putObject(arg, req)
+	case "verify-object":
+		if s.operation != "upload" {
+			break
+		}
+		return s.verifyObject(arg, req)
+	case "lock":
+		if s.operation != "upload" {
+			break
+		}
+		return s.lock(req)
+	case "unlock":
+		if s.operation != "upload" {
+			break
+		}
+		return s.unlock(arg, req)
+	case "renew":
+		if s.operation != "upload" {
+			break
+		}
+		return s.renew(arg, req)
+	case "lock-batch":
+		if s.operation != "upload" {
+			break
+		}
+		return s.lockBatch(req)
+	case "list-lock":
+		return s.listLocks(req)
+	default:
+		return s.writeError(http.StatusBadRequest, tr.Tr.Get("unknown command %q", command))
+	}
+	return s.writeError(http.StatusForbidden, tr.Tr.Get("%s not allowed for %s", command, s.operation))
+}
+
+func (s *transferSession) batch(req *transferRequest) error {
+	algo, err := hashAlgorithm(req.args["hash-algo"])
+	if err != nil {
+		return s.writeError(http.StatusConflict, err.Error())
+	}
+
+	// The object commands carry no hash algorithm, so any other than the
+	// default is given to the client as each object's ID, which it passes
+	// back to them.
+	var id string
+	if algo != tools.DefaultHashAlgorithm {
+		id = " id=" + algo.String()
+	}
+
+	lines := make([]string, 0, len(req.lines))
+	for _, line := range req.lines {
+		fields := strings.Split(line, " ")
+		if len(fields) < 2 {
+			return s.writeError(http.StatusBadRequest, tr.Tr.Get("malformed object %q", line))
+		}
+		oid := fields[0]
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 || !algo.IsValidOid(oid) {
+			return s.writeError(http.StatusBadRequest, tr.Tr.Get("malformed object %q", line))
+		}
+
+		// Objects missing from a download, like those present for an
+		// upload, have nothing to be done.
+		has := s.server.storage.Has(oid, algo, size)
+		if has && s.operation == "download" {
+			lines = append(lines, fmt.Sprintf("%s %d download%s", oid, size, id))
+		} else if !has && s.operation == "upload" {
+			lines = append(lines, fmt.Sprintf("%s %d upload%s", oid, size, id))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s %d noop", oid, size))
+		}
+	}
+
+	return s.writeStatusWithLines(http.StatusOK, []string{"hash-algo=" + algo.String()}, lines)
+}
+
+// objectHashAlgorithm returns the hash algorithm of the object named in req,
+// which is given as its ID by batch.
+func (s *transferSession) objectHashAlgorithm(oid string, req *transferRequest) (tools.HashAlgorithm, error) {
+	algo, err := hashAlgorithm(req.args["id"])
+	if err != nil {
+		return "", err
+	}
+	if !algo.IsValidOid(oid) {
+		return "", errors.New(tr.Tr.Get("invalid object ID %q", oid))
+	}
+	return algo, nil
+}
+
+func (s *transferSession) getObject(oid string, req *transferRequest) error {
+	algo, err := s.objectHashAlgorithm(oid, req)
+	if err != nil {
+		return s.writeError(http.StatusBadRequest, err.Error())
+	}
+
+	f, err := s.server.storage.Open(oid, algo)
+	if err != nil {
+		return s.writeError(http.StatusNotFound, tr.Tr.Get("object %s does not exist", oid))
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return s.writeError(http.StatusInternalServerError, err.Error())
+	}
+
+	if err := s.writeStatusLine(http.StatusOK); err != nil {
+		return err
+	}
+	if err := s.pl.WritePacketText(fmt.Sprintf("size=%d", fi.Size())); err != nil {
+		return err
+	}
+	if err := s.pl.WriteDelim(); err != nil {
+		return err
+	}
+	pw := pktline.NewPktlineWriterFromPktline(s.pl, 0)
+	if _, err := io.Copy(pw, f); err != nil {
+		return err
+	}
+	return pw.Flush()
+}
+
+func (s *transferSession) putObject(oid string, req *transferRequest) error {
+	size, err := strconv.ParseInt(req.args["size"], 10, 64)
+	if err != nil || size < 0 {
+		return s.writeError(http.StatusBadRequest, tr.Tr.Get("missing or invalid size"))
+	}
+
+	algo, err := s.objectHashAlgorithm(oid, req)
+	if err != nil {
+		return s.writeError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := s.server.storage.Put(oid, algo, size, req.data); err != nil {
+		return s.writeError(http.StatusUnprocessableEntity, err.Error())
+	}
+	return s.writeStatus(http.StatusOK, nil)
+}
+
+func (s *transferSession) verifyObject(oid string, req *transferRequest) error {
+	size, err := strconv.ParseInt(req.args["size"], 10, 64)
+	if err != nil || size < 0 {
+		return s.writeError(http.StatusBadRequest, tr.Tr.Get("missing or invalid size"))
+	}
+
+	algo, err := s.objectHashAlgorithm(oid, req)
+	if err != nil {
+		return s.writeError(http.StatusBadRequest, err.Error())
+	}
+
+	if !s.server.storage.Has(oid, algo, size) {
+		return s.writeError(http.StatusNotFound, tr.Tr.Get("object %s does not exist", oid))
+	}
+	return s.writeStatus(http.StatusOK, nil)
+}
+
+func (s *transferSession) lock(req *transferRequest) error {
+	path := req.args["path"]
+	if len(path) == 0 {
+		return s.writeError(http.StatusBadRequest, tr.Tr.Get("missing lock path"))
+	}
+
+	var expiresAt time.Time
+	if v, ok := req.args["expires-at"]; ok {
+		var err error
+		if expiresAt, err = time.Parse(time.RFC3339, v); err != nil {
+			return s.writeError(http.StatusBadRequest, tr.Tr.Get("invalid expires-at %q", v))
+		}
+	}
+
+	lock, created, err := s.server.locks.Create(path, s.user, expiresAt)
+	if err != nil {
+		return s.writeError(http.StatusInternalServerError, err.Error())
+	}
+	if !created {
+		return s.writeStatusWithLines(http.StatusConflict, lockArgs(lock), []string{tr.Tr.Get("already created lock")})
+	}
+	return s.writeStatus(http.StatusCreated, lockArgs(lock))
+}
+
+func (s *transferSession) unlock(id string, req *transferRequest) error {
+	status, lock, err := s.server.unlock(id, s.user, req.args["force"] == "true")
+	if err != nil {
+		return s.writeError(status, err.Error())
+	}
+	return s.writeStatus(status, lockArgs(lock))
+}
+
+func (s *transferSession) renew(id string, req *transferRequest) error {
+	expiresAt, err := time.Parse(time.RFC3339, req.args["expires-at"])
+	if err != nil {
+		return s.writeError(http.StatusBadRequest, tr.Tr.Get("missing or invalid expires-at"))
+	}
+
+	status, lock, err := s.server.renew(id, s.user, expiresAt)
+	if err != nil {
+		return s.writeError(status, err.Error())
+	}
+	return s.writeStatus(status, lockArgs(lock))
+}
+
+func (s *transferSession) lockBatch(req *transferRequest) error {
+	breq := &lockBatchRequest{
+		Operation: req.args["operation"],
+		Paths:     req.lines,
+		Atomic:    req.args["atomic"] == "true",
+		Force:     req.args["force"] == "true",
+	}
+	if v, ok := req.args["expires-at"]; ok {
+		var err error
+		if breq.ExpiresAt, err = time.Parse(time.RFC3339, v); err != nil {
+			return s.writeError(http.StatusBadRequest, tr.Tr.Get("invalid expires-at %q", v))
+		}
+	}
+
+	status, results, err := s.server.lockBatch(breq, s.user)
+	if err != nil {
+		return s.writeError(status, err.Error())
+	}
+
+	lines := make([]string, 0, 5*len(results))
+	for i, r := range results {
+		lines = append(lines, fmt.Sprintf("path %d %s", i, r.Path))
+		if r.Lock != nil {
+			lines = append(lines,
+				fmt.Sprintf("id %d %s", i, r.Lock.Id),
+				fmt.Sprintf("locked-at %d %s", i, r.Lock.LockedAt.Format(time.RFC3339)),
+				fmt.Sprintf("ownername %d %s", i, ownerName(*r.Lock)))
+			if !r.Lock.ExpiresAt.IsZero() {
+				lines = append(lines, fmt.Sprintf("expires-at %d %s", i, r.Lock.ExpiresAt.Format(time.RFC3339)))
+			}
+		}
+		if len(r.Message) > 0 {
+			lines = append(lines, fmt.Sprintf("message %d %s", i, r.Message))
+		}
+	}
+	return s.writeStatusWithLines(status, nil, lines)
+}
+
+func (s *transferSession) listLocks(req *transferRequest) error {
+	var limit int
+	if v, ok := req.args["limit"]; ok {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return s.writeError(http.StatusBadRequest, tr.Tr.Get("invalid limit %q", v))
+		}
+	}
+
+	locks, next, err := s.server.locks.List(req.args["path"], req.args["id"], req.args["cursor"], limit)
+	if err != nil {
+		return s.writeError(http.StatusInternalServerError, err.Error())
+	}
+
+	var args []string
+	if len(next) > 0 {
+		args = append(args, fmt.Sprintf("next-cursor=%s", next))
+	}
+	lines := make([]string, 0, 5*len(locks))
+	for _, l := range locks {
+		owner := "theirs"
+		if l.ownedBy(s.user) {
+			owner = "ours"
+		}
+		lines = append(lines,
+			fmt.Sprintf("lock %s", l.Id),
+			fmt.Sprintf("path %s %s", l.Id, l.Path),
+			fmt.Sprintf("locked-at %s %s", l.Id, l.LockedAt.Format(time.RFC3339)),
+			fmt.Sprintf("ownername %s %s", l.Id, ownerName(l)),
+			fmt.Sprintf("owner %s %s", l.Id, owner))
+		if !l.ExpiresAt.IsZero() {
+			lines = append(lines, fmt.Sprintf("expires-at %s %s", l.Id, l.ExpiresAt.Format(time.RFC3339)))
+		}
+	}
+	return s.writeStatusWithLines(http.StatusOK, args, lines)
+}
+
+func lockArgs(l Lock) []string {
+	args := []string{
+		fmt.Sprintf("id=%s", l.Id),
+		fmt.Sprintf("path=%s", l.Path),
+		fmt.Sprintf("locked-at=%s", l.LockedAt.Format(time.RFC3339)),
+		fmt.Sprintf("ownername=%s", ownerName(l)),
+	}
+	if !l.ExpiresAt.IsZero() {
+		args = append(args, fmt.Sprintf("expires-at=%s", l.ExpiresAt.Format(time.RFC3339)))
+	}
+	return args
+}
+
+func ownerName(l Lock) string {
+	if l.Owner == nil {
+		return ""
+	}
+	return l.Owner.Name
+}
+
+// writeStatusLine begins a response with the given status, once any data left
+// in the request has been read and discarded.
+func (s *transferSession) writeStatusLine(status int) error {
+	if s.pending != nil {
+		if _, err := io.Copy(io.Discard, s.pending); err != nil {
+			return err
+		}
+		s.pending = nil
+	}
+	return s.pl.WritePacketText(fmt.Sprintf("status %d", status))
+}
+
+func (s *transferSession) writeStatus(status int, args []string) error {
+	if err := s.writeStatusLine(status); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := s.pl.WritePacketText(arg); err != nil {
+			return err
+		}
+	}
+	return s.pl.WriteFlush()
+}
+
+func (s *transferSession) writeStatusWithLines(status int, args, lines []string) error {
+	if err := s.writeStatusLine(status); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := s.pl.WritePacketText(arg); err != nil {
+			return err
+		}
+	}
+	if err := s.pl.WriteDelim(); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if err := s.pl.WritePacketText(line); err != nil {
+			return err
+		}
+	}
+	return s.pl.WriteFlush()
+}
+
+func (s *transferSession) writeError(status int, message string) error {
+	tracerx.Printf("LFS server: status %d: %s", status, message)
+	return s.writeStatusWithLines(status, nil, []string{message})
+}
@@ -0,0 +1,299 @@
+package lfsserver
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/pktline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transferClient speaks the client side of the git-lfs-transfer protocol to
+// a Server.
+type transferClient struct {
+	t    *testing.T
+	pl   *pktline.Pktline
+	w    io.Closer
+	done chan error
+}
+
+func newTransferClient(t *testing.T, s *Server, operation, user string) *transferClient {
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	c := &transferClient{
+		t:    t,
+		pl:   pktline.NewPktline(cr, cw),
+		w:    cw,
+		done: make(chan error, 1),
+	}
+	go func() {
+		c.done <- s.ServeTransfer(sr, sw, operation, user)
+		sw.Close()
+	}()
+
+	caps, err := c.pl.ReadPacketList()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"version=1", "locking", "lock-batch"}, caps)
+
+	status, _, _ := c.request("version 1", nil, nil)
+	require.Equal(t, 200, status)
+	return c
+}
+
+// request sends a request, with lines following a delimiter if lines is not
+// nil, and returns the status, arguments and lines of the response.
+func (c *transferClient) request(command string, args, lines []string) (int, []string, []string) {
+	require.NoError(c.t, c.pl.WritePacketText(command))
+	for _, arg := range args {
+		require.NoError(c.t, c.pl.WritePacketText(arg))
+	}
+	if lines != nil {
+		require.NoError(c.t, c.pl.WriteDelim())
+		for _, line := range lines {
+			require.NoError(c.t, c.pl.WritePacketText(line))
+		}
+	}
+	require.NoError(c.t, c.pl.WriteFlush())
+	return c.readResponse()
+}
+
+func (c *transferClient) readResponse() (int, []string, []string) {
+	var status int
+	var args, lines []string
+	var delim bool
+
+	s, err := c.pl.ReadPacketText()
+	require.NoError(c.t, err)
+	_, err = fmt.Sscanf(s, "status %d", &status)
+	require.NoError(c.t, err)
+
+	for {
+		s, pktLen, err := c.pl.ReadPacketTextWithLength()
+		require.NoError(c.t, err)
+		switch {
+		case pktLen == 0:
+			return status, args, lines
+		case pktLen == 1:
+			delim = true
+		case delim:
+			lines = append(lines, s)
+		default:
+			args = append(args, s)
+		}
+	}
+}
+
+func (c *transferClient) putObject(oid, data string, args ...string) (int, []string) {
+	require.NoError(c.t, c.pl.WritePacketText("put-object "+oid))
+	require.NoError(c.t, c.pl.WritePacketText(fmt.Sprintf("size=%d", len(data))))
+	for _, arg := range args {
+		require.NoError(c.t, c.pl.WritePacketText(arg))
+	}
+	require.NoError(c.t, c.pl.WriteDelim())
+	w := pktline.NewPktlineWriterFromPktline(c.pl, 0)
+	_, err := io.WriteString(w, data)
+	require.NoError(c.t, err)
+	require.NoError(c.t, w.Flush())
+
+	status, _, lines := c.readResponse()
+	return status, lines
+}
+
+func (c *transferClient) quit() {
+	status, _, _ := c.request("quit", nil, nil)
+	assert.Equal(c.t, 200, status)
+	assert.NoError(c.t, <-c.done)
+	c.w.Close()
+}
+
+func TestServeTransferUploadAndDownload(t *testing.T) {
+	_, s := newTestServer(t)
+	data := "uploaded over ssh"
+	oid := oidOf(data)
+	object := fmt.Sprintf("%s %d", oid, len(data))
+
+	up := newTransferClient(t, s, "upload", "alice")
+	status, args, lines := up.request("batch", []string{"transfer=ssh", "hash-algo=sha256"}, []string{object})
+	require.Equal(t, 200, status)
+	assert.Equal(t, []string{"hash-algo=sha256"}, args)
+	assert.Equal(t, []string{object + " upload"}, lines)
+
+	status, lines = up.putObject(oid, "not the right data")
+	assert.Equal(t, 422, status)
+	assert.Len(t, lines, 1)
+
+	status, _ = up.putObject(oid, data)
+	require.Equal(t, 200, status)
+
+	status, _, _ = up.request("verify-object "+oid, []string{fmt.Sprintf("size=%d", len(data))}, nil)
+	assert.Equal(t, 200, status)
+
+	status, _, _ = up.request("get-object "+oid, nil, nil)
+	assert.Equal(t, 403, status)
+	up.quit()
+
+	down := newTransferClient(t, s, "download", "bob")
+	missing := fmt.Sprintf("%s 7", oidOf("missing"))
+	status, _, lines = down.request("batch", nil, []string{object, missing})
+	require.Equal(t, 200, status)
+	assert.Equal(t, []string{object + " download", missing + " noop"}, lines)
+
+	status, args, lines = down.request("get-object "+oid, []string{fmt.Sprintf("size=%d", len(data))}, nil)
+	require.Equal(t, 200, status)
+	assert.Equal(t, []string{fmt.Sprintf("size=%d", len(data))}, args)
+	assert.Equal(t, []string{data}, lines)
+	down.quit()
+}
+
+func TestServeTransferHashAlgorithm(t *testing.T) {
+	_, s := newTestServer(t)
+	data := "uploaded with blake3"
+	oid := oidWith(tools.BLAKE3, data)
+	object := fmt.Sprintf("%s %d", oid, len(data))
+	size := fmt.Sprintf("size=%d", len(data))
+
+	up := newTransferClient(t, s, "upload", "alice")
+	status, args, lines := up.request("batch", []string{"transfer=ssh", "hash-algo=blake3"}, []string{object})
+	require.Equal(t, 200, status)
+	assert.Equal(t, []string{"hash-algo=blake3"}, args)
+	assert.Equal(t, []string{object + " upload id=blake3"}, lines)
+
+	// Without the ID, the OID is taken to be computed with SHA-256.
+	status, _ = up.putObject(oid, data)
+	assert.Equal(t, 422, status)
+
+	status, _ = up.putObject(oid, data, "id=blake3")
+	require.Equal(t, 200, status)
+	assert.True(t, s.storage.Has(oid, tools.BLAKE3, int64(len(data))))
+
+	status, _, _ = up.request("verify-object "+oid, []string{size, "id=blake3"}, nil)
+	assert.Equal(t, 200, status)
+
+	sha512 := oidWith(tools.SHA512, data)
+	status, _, _ = up.request("verify-object "+sha512, []string{size}, nil)
+	assert.Equal(t, 400, status)
+	up.quit()
+
+	down := newTransferClient(t, s, "download", "bob")
+	status, _, lines = down.request("batch", []string{"hash-algo=blake3"}, []string{object})
+	require.Equal(t, 200, status)
+	assert.Equal(t, []string{object + " download id=blake3"}, lines)
+
+	status, _, lines = down.request("get-object "+oid, []string{size, "id=blake3"}, nil)
+	require.Equal(t, 200, status)
+	assert.Equal(t, []string{data}, lines)
+
+	status, _, _ = down.request("batch", []string{"hash-algo=md5"}, []string{object})
+	assert.Equal(t, 409, status)
+	down.quit()
+}
+
+func TestServeTransferLocks(t *testing.T) {
+	_, s := newTestServer(t)
+
+	alice := newTransferClient(t, s, "upload", "alice")
+	status, args, _ := alice.request("lock", []string{"path=a.psd", "refname=refs/heads/main"}, nil)
+	require.Equal(t, 201, status)
+	require.Len(t, args, 4)
+	id := strings.TrimPrefix(args[0], "id=")
+	assert.Equal(t, "path=a.psd", args[1])
+	assert.Equal(t, "ownername=alice", args[3])
+
+	bob := newTransferClient(t, s, "upload", "bob")
+	status, args, lines := bob.request("lock", []string{"path=a.psd"}, nil)
+	assert.Equal(t, 409, status)
+	assert.Equal(t, "id="+id, args[0])
+	assert.Equal(t, []string{"already created lock"}, lines)
+
+	status, _, lines = bob.request("list-lock", nil, nil)
+	require.Equal(t, 200, status)
+	require.Len(t, lines, 5)
+	assert.Equal(t, "lock "+id, lines[0])
+	assert.Equal(t, fmt.Sprintf("path %s a.psd", id), lines[1])
+	assert.Equal(t, fmt.Sprintf("ownername %s alice", id), lines[3])
+	assert.Equal(t, fmt.Sprintf("owner %s theirs", id), lines[4])
+
+	status, _, _ = bob.request("unlock "+id, nil, nil)
+	assert.Equal(t, 403, status)
+	bob.quit()
+
+	status, args, _ = alice.request("unlock "+id, []string{"refname=refs/heads/main"}, nil)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "id="+id, args[0])
+
+	status, _, lines = alice.request("list-lock", nil, nil)
+	assert.Equal(t, 200, status)
+	assert.Empty(t, lines)
+	alice.quit()
+}
+
+func TestServeTransferLockLeases(t *testing.T) {
+	_, s := newTestServer(t)
+
+	alice := newTransferClient(t, s, "upload", "alice")
+	status, args, _ := alice.request("lock", []string{"path=a.psd", "expires-at=2100-01-02T03:04:05Z"}, nil)
+	require.Equal(t, 201, status)
+	require.Len(t, args, 5)
+	id := strings.TrimPrefix(args[0], "id=")
+	assert.Equal(t, "expires-at=2100-01-02T03:04:05Z", args[4])
+
+	status, _, lines := alice.request("list-lock", nil, nil)
+	require.Equal(t, 200, status)
+	require.Len(t, lines, 6)
+	assert.Equal(t, fmt.Sprintf("expires-at %s 2100-01-02T03:04:05Z", id), lines[5])
+
+	status, args, _ = alice.request("renew "+id, []string{"expires-at=2100-02-03T04:05:06Z"}, nil)
+	require.Equal(t, 200, status)
+	assert.Equal(t, "expires-at=2100-02-03T04:05:06Z", args[4])
+
+	status, _, _ = alice.request("renew "+id, nil, nil)
+	assert.Equal(t, 400, status)
+
+	bob := newTransferClient(t, s, "upload", "bob")
+	status, _, _ = bob.request("renew "+id, []string{"expires-at=2100-02-03T04:05:06Z"}, nil)
+	assert.Equal(t, 403, status)
+	bob.quit()
+	alice.quit()
+}
+
+func TestServeTransferLockBatch(t *testing.T) {
+	_, s := newTestServer(t)
+
+	alice := newTransferClient(t, s, "upload", "alice")
+	status, _, lines := alice.request("lock-batch", []string{"operation=lock", "expires-at=2100-01-02T03:04:05Z"}, []string{"a.psd", "b c.psd"})
+	require.Equal(t, 200, status)
+	require.Len(t, lines, 10)
+	assert.Equal(t, "path 0 a.psd", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "id 0 "))
+	assert.Equal(t, "ownername 0 alice", lines[3])
+	assert.Equal(t, "expires-at 0 2100-01-02T03:04:05Z", lines[4])
+	assert.Equal(t, "path 1 b c.psd", lines[5])
+
+	bob := newTransferClient(t, s, "upload", "bob")
+	status, _, lines = bob.request("lock-batch", []string{"operation=unlock", "atomic=true"}, []string{"a.psd"})
+	require.Equal(t, 200, status)
+	assert.Equal(t, "path 0 a.psd", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "message 0 lock "))
+
+	status, _, _ = bob.request("lock-batch", []string{"operation=steal"}, []string{"a.psd"})
+	assert.Equal(t, 422, status)
+	bob.quit()
+
+	status, _, lines = alice.request("lock-batch", []string{"operation=unlock"}, []string{"a.psd", "b c.psd"})
+	require.Equal(t, 200, status)
+	assert.Len(t, lines, 10)
+	locks, _, err := s.locks.List("", "", "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, locks)
+
+	download := newTransferClient(t, s, "download", "alice")
+	status, _, _ = download.request("lock-batch", []string{"operation=lock"}, []string{"a.psd"})
+	assert.Equal(t, 403, status)
+	download.quit()
+	alice.quit()
+}
@@ -1,9 +1,12 @@
 package locking
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/git"
@@ -15,8 +18,11 @@ import (
 type lockClient interface {
 	Lock(remote string, lockReq *lockRequest) (*lockResponse, int, error)
 	Unlock(ref *git.Ref, remote, id string, force bool) (*unlockResponse, int, error)
+	Renew(ref *git.Ref, remote, id string, expiresAt time.Time) (*renewResponse, int, error)
+	Batch(remote string, breq *lockBatchRequest) (*lockBatchResponse, int, error)
 	Search(remote string, searchReq *lockSearchRequest) (*lockList, int, error)
 	SearchVerifiable(remote string, vreq *lockVerifiableRequest) (*lockVerifiableList, int, error)
+	Events(ctx context.Context, remote string, channel *lockEventChannel) (io.ReadCloser, int, error)
 }
 
 type httpLockClient struct {
@@ -33,6 +39,9 @@ type lockRequest struct {
 	// Path is the path that the client would like to obtain a lock against.
 	Path string   `json:"path"`
 	Ref  *lockRef `json:"ref,omitempty"`
+	// ExpiresAt is the optional time at which the client would like the
+	// lock to expire, unless it is renewed.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
 }
 
 // LockResponse encapsulates the information sent over the API in response to
@@ -141,6 +150,61 @@ func (c *httpLockClient) Unlock(ref *git.Ref, remote, id string, force bool) (*u
 	return unlockRes, res.StatusCode, nil
 }
 
+// renewRequest encapsulates the data sent in an API request to extend the
+// lease of a lock.
+type renewRequest struct {
+	// ExpiresAt is the time at which the client would like the lock to
+	// expire, unless it is renewed again.
+	ExpiresAt time.Time `json:"expires_at"`
+	Ref       *lockRef  `json:"ref,omitempty"`
+}
+
+// renewResponse is the result sent back from the API when asked to extend the
+// lease of a lock.
+type renewResponse struct {
+	// Lock is the renewed lock, holding its new expiry time. If the lock
+	// could not be renewed, this field will take the zero-value of Lock,
+	// and Message will be set.
+	Lock *Lock `json:"lock"`
+
+	// Message is an optional field which holds any error that was
+	// experienced while renewing the lock.
+	Message          string `json:"message,omitempty"`
+	DocumentationURL string `json:"documentation_url,omitempty"`
+	RequestID        string `json:"request_id,omitempty"`
+}
+
+func (c *httpLockClient) Renew(ref *git.Ref, remote, id string, expiresAt time.Time) (*renewResponse, int, error) {
+	e := c.Endpoints.Endpoint("upload", remote)
+	suffix := fmt.Sprintf("locks/%s/renew", id)
+	req, err := c.NewRequest("POST", e, suffix, &renewRequest{
+		ExpiresAt: expiresAt,
+		Ref:       &lockRef{Name: ref.Refspec()},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req = c.Client.LogRequest(req, "lfs.locks.renew")
+	res, err := c.DoAPIRequestWithAuth(remote, req)
+	if err != nil {
+		if res != nil {
+			return nil, res.StatusCode, err
+		}
+		return nil, 0, err
+	}
+
+	renewRes := &renewResponse{}
+	err = lfshttp.DecodeJSON(res, renewRes)
+	if err != nil {
+		return nil, res.StatusCode, err
+	}
+	if renewRes.Lock == nil && len(renewRes.Message) == 0 {
+		return nil, res.StatusCode, errors.New(tr.Tr.Get("invalid server response"))
+	}
+	return renewRes, res.StatusCode, nil
+}
+
 // Filter represents a single qualifier to apply against a set of locks.
 type lockFilter struct {
 	// Property is the property to search against.
@@ -199,6 +263,10 @@ type lockList struct {
 	// cursor to, if there are multiple pages of results for a particular
 	// `LockListRequest`.
 	NextCursor string `json:"next_cursor,omitempty"`
+	// Events optionally advertises a channel over which the server pushes
+	// changes to its locks as they happen, instead of the client polling
+	// for them.
+	Events *lockEventChannel `json:"events,omitempty"`
 	// Message populates any error that was encountered during the search. If no
 	// error was encountered and the operation was successful, then a value
 	// of nil will be passed here.
@@ -360,6 +428,10 @@ func (c *genericLockClient) Unlock(ref *git.Ref, remote, id string, force bool)
 	return c.getClient(remote, "upload").Unlock(ref, remote, id, force)
 }
 
+func (c *genericLockClient) Renew(ref *git.Ref, remote, id string, expiresAt time.Time) (*renewResponse, int, error) {
+	return c.getClient(remote, "upload").Renew(ref, remote, id, expiresAt)
+}
+
 func (c *genericLockClient) Search(remote string, searchReq *lockSearchRequest) (*lockList, int, error) {
 	return c.getClient(remote, "download").Search(remote, searchReq)
 }
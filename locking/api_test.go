@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-lfs/git-lfs/v3/git"
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
@@ -118,6 +119,60 @@ func TestAPIUnlock(t *testing.T) {
 	assert.Equal(t, "response", unlockRes.Lock.Path)
 }
 
+func TestAPIRenew(t *testing.T) {
+	require.NotNil(t, renewReqSchema)
+	require.NotNil(t, createResSchema)
+
+	expiresAt := time.Date(2100, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/locks/123/renew" {
+			w.WriteHeader(404)
+			return
+		}
+
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, lfshttp.MediaType, r.Header.Get("Accept"))
+		assert.Equal(t, lfshttp.RequestContentType, r.Header.Get("Content-Type"))
+
+		reqLoader, body := gojsonschema.NewReaderLoader(r.Body)
+		renewReq := &renewRequest{}
+		err := json.NewDecoder(body).Decode(renewReq)
+		r.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, expiresAt, renewReq.ExpiresAt)
+		assert.Equal(t, "refs/heads/master", renewReq.Ref.Name)
+		assertSchema(t, renewReqSchema, reqLoader)
+
+		w.Header().Set("Content-Type", "application/json")
+		resLoader, resWriter := gojsonschema.NewWriterLoader(w)
+		err = json.NewEncoder(resWriter).Encode(&renewResponse{
+			Lock: &Lock{
+				Id:        "123",
+				Path:      "response",
+				ExpiresAt: expiresAt,
+			},
+		})
+		assert.Nil(t, err)
+		assertSchema(t, createResSchema, resLoader)
+	}))
+	defer srv.Close()
+
+	c := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url": srv.URL + "/api",
+	}))
+
+	lc := &httpLockClient{Client: c}
+	renewRes, status, err := lc.Renew(&git.Ref{
+		Name: "master",
+		Sha:  "6161616161616161616161616161616161616161",
+		Type: git.RefTypeLocalBranch,
+	}, "", "123", expiresAt)
+	require.Nil(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "123", renewRes.Lock.Id)
+	assert.Equal(t, expiresAt, renewRes.Lock.ExpiresAt)
+}
+
 func TestAPISearch(t *testing.T) {
 	require.NotNil(t, listResSchema)
 
@@ -221,12 +276,73 @@ func TestAPISearchVerifiable(t *testing.T) {
 	assert.Equal(t, "3", locks.Theirs[0].Id)
 }
 
+func TestAPIBatch(t *testing.T) {
+	require.NotNil(t, batchReqSchema)
+	require.NotNil(t, batchResSchema)
+
+	expiresAt := time.Date(2100, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/locks/batch" {
+			w.WriteHeader(404)
+			return
+		}
+
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, lfshttp.MediaType, r.Header.Get("Accept"))
+		assert.Equal(t, lfshttp.RequestContentType, r.Header.Get("Content-Type"))
+
+		reqLoader, body := gojsonschema.NewReaderLoader(r.Body)
+		batchReq := &lockBatchRequest{}
+		err := json.NewDecoder(body).Decode(batchReq)
+		r.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, "lock", batchReq.Operation)
+		assert.Equal(t, []string{"a", "b"}, batchReq.Paths)
+		assert.True(t, batchReq.Atomic)
+		assert.Equal(t, expiresAt, batchReq.ExpiresAt)
+		assertSchema(t, batchReqSchema, reqLoader)
+
+		w.Header().Set("Content-Type", "application/json")
+		resLoader, resWriter := gojsonschema.NewWriterLoader(w)
+		err = json.NewEncoder(resWriter).Encode(&lockBatchResponse{
+			Results: []lockBatchResult{
+				{Path: "a", Lock: &Lock{Id: "1", Path: "a", ExpiresAt: expiresAt}},
+				{Path: "b", Lock: &Lock{Id: "2", Path: "b"}, Message: "already created lock"},
+			},
+		})
+		assert.Nil(t, err)
+		assertSchema(t, batchResSchema, resLoader)
+	}))
+	defer srv.Close()
+
+	c := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url": srv.URL + "/api",
+	}))
+
+	lc := &httpLockClient{Client: c}
+	batchRes, status, err := lc.Batch("", &lockBatchRequest{
+		Operation: "lock",
+		Paths:     []string{"a", "b"},
+		Atomic:    true,
+		ExpiresAt: expiresAt,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 200, status)
+	require.Len(t, batchRes.Results, 2)
+	assert.Equal(t, "1", batchRes.Results[0].Lock.Id)
+	assert.Empty(t, batchRes.Results[0].Message)
+	assert.Equal(t, "already created lock", batchRes.Results[1].Message)
+}
+
 var (
 	createReqSchema *sourcedSchema
 	createResSchema *sourcedSchema
 	delReqSchema    *sourcedSchema
+	renewReqSchema  *sourcedSchema
 	listResSchema   *sourcedSchema
 	verifyResSchema *sourcedSchema
+	batchReqSchema  *sourcedSchema
+	batchResSchema  *sourcedSchema
 )
 
 func init() {
@@ -239,8 +355,11 @@ func init() {
 	createReqSchema = getSchema(wd, "schemas/http-lock-create-request-schema.json")
 	createResSchema = getSchema(wd, "schemas/http-lock-create-response-schema.json")
 	delReqSchema = getSchema(wd, "schemas/http-lock-delete-request-schema.json")
+	renewReqSchema = getSchema(wd, "schemas/http-lock-renew-request-schema.json")
 	listResSchema = getSchema(wd, "schemas/http-lock-list-response-schema.json")
 	verifyResSchema = getSchema(wd, "schemas/http-lock-verify-response-schema.json")
+	batchReqSchema = getSchema(wd, "schemas/http-lock-batch-request-schema.json")
+	batchResSchema = getSchema(wd, "schemas/http-lock-batch-response-schema.json")
 }
 
 type sourcedSchema struct {
@@ -0,0 +1,307 @@
+package locking
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/events"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// ErrBatchAborted is the error of each path in an all-or-nothing batch which
+// was not locked or unlocked because another path in the batch failed.
+var ErrBatchAborted = errors.New(tr.Tr.Get("aborted because another path failed"))
+
+// lockBatchRequest encapsulates the request sent to the server when the client
+// would like to lock or unlock many paths at once.
+type lockBatchRequest struct {
+	// Operation is either "lock" or "unlock".
+	Operation string `json:"operation"`
+	// Paths is the set of paths to lock or unlock.
+	Paths []string `json:"paths"`
+	Ref   *lockRef `json:"ref,omitempty"`
+	// Atomic asks the server to lock or unlock either all of the paths or
+	// none of them.
+	Atomic bool `json:"atomic,omitempty"`
+	// Force asks the server to unlock paths locked by other users.
+	Force bool `json:"force,omitempty"`
+	// ExpiresAt is the optional time at which the client would like the
+	// locks it creates to expire, unless they are renewed.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// lockBatchResult is the result of locking or unlocking a single path in a
+// lockBatchRequest.
+type lockBatchResult struct {
+	// Path is the path which was to be locked or unlocked.
+	Path string `json:"path"`
+	// Lock is the lock which was created or deleted. If the path was
+	// already locked, it is the existing lock, and Message is set.
+	Lock *Lock `json:"lock,omitempty"`
+	// Message is the error which prevented the path from being locked or
+	// unlocked, if there was one.
+	Message string `json:"message,omitempty"`
+}
+
+// lockBatchResponse encapsulates the results sent back from the API in
+// response to a lockBatchRequest.
+type lockBatchResponse struct {
+	// Results holds the result for each of the paths in the request.
+	Results []lockBatchResult `json:"results"`
+
+	// Message populates any error that prevented the request as a whole
+	// from being handled.
+	Message          string `json:"message,omitempty"`
+	DocumentationURL string `json:"documentation_url,omitempty"`
+	RequestID        string `json:"request_id,omitempty"`
+}
+
+func (c *httpLockClient) Batch(remote string, breq *lockBatchRequest) (*lockBatchResponse, int, error) {
+	e := c.Endpoints.Endpoint("upload", remote)
+	req, err := c.NewRequest("POST", e, "locks/batch", breq)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req = c.Client.LogRequest(req, "lfs.locks.batch")
+	res, err := c.DoAPIRequestWithAuth(remote, req)
+	if err != nil {
+		if res != nil {
+			return nil, res.StatusCode, err
+		}
+		return nil, 0, err
+	}
+
+	batchRes := &lockBatchResponse{}
+	err = lfshttp.DecodeJSON(res, batchRes)
+	if err != nil {
+		return nil, res.StatusCode, err
+	}
+	return batchRes, res.StatusCode, nil
+}
+
+func (c *genericLockClient) Batch(remote string, breq *lockBatchRequest) (*lockBatchResponse, int, error) {
+	return c.getClient(remote, "upload").Batch(remote, breq)
+}
+
+// LockResult is the result of an attempt to lock or unlock one of the paths
+// given to LockFiles or UnlockFiles.
+type LockResult struct {
+	// Path is the path which was to be locked or unlocked.
+	Path string
+	// Lock is the lock which was created or deleted. If the path could not
+	// be locked because it was already locked, it is the existing lock, if
+	// the server described it.
+	Lock Lock
+	// Err is the reason the path was not locked or unlocked, or nil if it
+	// was.
+	Err error
+}
+
+// LockFiles attempts to lock each of the given paths on the current remote,
+// asking for the locks to expire once ttl has passed, if it is not zero. If
+// atomic is true, either all of the paths are locked or none of them are.
+//
+// The paths are locked with a single request if the server supports it, and
+// otherwise one at a time. The result for each path is returned in the order
+// of paths, or an error if the request as a whole failed. If the server cannot
+// be reached, the locks are queued as by LockFileWithTTL, unless atomic is
+// true.
+func (c *Client) LockFiles(paths []string, ttl time.Duration, atomic bool) ([]LockResult, error) {
+	res, status, err := c.client.Batch(c.Remote, &lockBatchRequest{
+		Operation: "lock",
+		Paths:     paths,
+		Ref:       &lockRef{Name: c.RemoteRef.Refspec()},
+		Atomic:    atomic,
+		ExpiresAt: expiryOf(ttl),
+	})
+	if batchUnsupported(status) {
+		tracerx.Printf("locking: batch locking not supported by server, locking each path")
+		return c.lockFilesEach(paths, ttl, atomic), nil
+	}
+	if err != nil && !atomic && c.shouldQueue(err) {
+		// Each path is queued in turn.
+		return c.lockFilesEach(paths, ttl, false), nil
+	}
+	if err := batchError(res, err); err != nil {
+		return nil, err
+	}
+
+	results := batchResults(paths, res, "server unable to create lock: %s")
+	for i := range results {
+		r := &results[i]
+		if r.Err == nil {
+			r.Err = c.lockAcquired(r.Path, r.Lock)
+		}
+		emitLockEvent(events.LockCreated, r.Path, r.Lock, r.Err)
+	}
+	return results, nil
+}
+
+// lockFilesEach locks each of the given paths with a separate request, like
+// LockFiles. If atomic is true, once a path cannot be locked no more are
+// attempted, and those already locked are unlocked again.
+func (c *Client) lockFilesEach(paths []string, ttl time.Duration, atomic bool) []LockResult {
+	results := make([]LockResult, len(paths))
+	failed := false
+	for i, path := range paths {
+		results[i].Path = path
+		if failed && atomic {
+			results[i].Err = ErrBatchAborted
+			continue
+		}
+
+		results[i].Lock, results[i].Err = c.LockFileWithTTL(path, ttl)
+		if results[i].Err != nil {
+			failed = true
+		}
+	}
+
+	if failed && atomic {
+		for i := range results {
+			if results[i].Err != nil {
+				continue
+			}
+
+			if err := c.UnlockFileById(results[i].Lock.Id, false); err != nil {
+				results[i].Err = errors.New(tr.Tr.Get("unable to release lock after another path failed: %v", err))
+			} else {
+				results[i].Err = ErrBatchAborted
+			}
+		}
+	}
+	return results
+}
+
+// UnlockFiles attempts to unlock each of the given paths on the current remote,
+// including those locked by other users if force is true. If atomic is true,
+// either all of the paths are unlocked or none of them are.
+//
+// The paths are unlocked with a single request if the server supports it, and
+// otherwise one at a time. The result for each path is returned in the order
+// of paths, or an error if the request as a whole failed. If the server cannot
+// be reached, the unlocks are queued as by UnlockFile, unless atomic is true.
+func (c *Client) UnlockFiles(paths []string, force, atomic bool) ([]LockResult, error) {
+	res, status, err := c.client.Batch(c.Remote, &lockBatchRequest{
+		Operation: "unlock",
+		Paths:     paths,
+		Ref:       &lockRef{Name: c.RemoteRef.Refspec()},
+		Atomic:    atomic,
+		Force:     force,
+	})
+	if batchUnsupported(status) {
+		tracerx.Printf("locking: batch unlocking not supported by server, unlocking each path")
+		return c.unlockFilesEach(paths, force, atomic), nil
+	}
+	if err != nil && !atomic && c.shouldQueue(err) {
+		results := make([]LockResult, len(paths))
+		for i, path := range paths {
+			results[i] = LockResult{Path: path, Err: c.UnlockFile(path, force)}
+		}
+		return results, nil
+	}
+	if err := batchError(res, err); err != nil {
+		return nil, err
+	}
+
+	results := batchResults(paths, res, "server unable to unlock: %s")
+	for i := range results {
+		r := &results[i]
+		if r.Err == nil {
+			r.Err = c.lockReleased(r.Lock.Id, &r.Lock)
+		}
+		emitLockEvent(events.LockDeleted, r.Path, r.Lock, r.Err)
+	}
+	return results, nil
+}
+
+// unlockFilesEach unlocks each of the given paths with a separate request,
+// like UnlockFiles. If atomic is true, nothing is unlocked unless the locks on
+// all of the paths can be found; a lock which the server then refuses to
+// delete does not prevent the others from being unlocked.
+func (c *Client) unlockFilesEach(paths []string, force, atomic bool) []LockResult {
+	results := make([]LockResult, len(paths))
+	ids := make([]string, len(paths))
+	failed := false
+	for i, path := range paths {
+		results[i].Path = path
+
+		id, err := c.lockIdFromPath(path)
+		if err != nil {
+			results[i].Err = errors.New(tr.Tr.Get("unable to get lock ID: %v", err))
+			failed = true
+		}
+		ids[i] = id
+	}
+
+	for i := range results {
+		r := &results[i]
+		if r.Err == nil && failed && atomic {
+			r.Err = ErrBatchAborted
+		} else if r.Err == nil {
+			r.Lock, r.Err = c.unlockFileById(ids[i], force)
+		}
+		emitLockEvent(events.LockDeleted, r.Path, r.Lock, r.Err)
+	}
+	return results
+}
+
+// batchUnsupported returns whether a batch request received the given status
+// because the server does not support batch requests.
+func batchUnsupported(status int) bool {
+	switch status {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	default:
+		return false
+	}
+}
+
+// batchError returns the error with which a batch request as a whole failed,
+// given the response and the error returned in making it.
+func batchError(res *lockBatchResponse, err error) error {
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("locking API"))
+	}
+
+	if len(res.Message) > 0 {
+		if len(res.RequestID) > 0 {
+			tracerx.Printf("Server Request ID: %s", res.RequestID)
+		}
+		return errors.New(tr.Tr.Get("server unable to handle batch: %s", res.Message))
+	}
+	return nil
+}
+
+// batchResults returns the result of the batch response res for each of the
+// given paths, using format to describe the errors reported by the server.
+func batchResults(paths []string, res *lockBatchResponse, format string) []LockResult {
+	byPath := make(map[string]lockBatchResult, len(res.Results))
+	for _, r := range res.Results {
+		byPath[r.Path] = r
+	}
+
+	results := make([]LockResult, len(paths))
+	for i, path := range paths {
+		results[i].Path = path
+
+		r, ok := byPath[path]
+		if !ok {
+			results[i].Err = errors.New(tr.Tr.Get("no result from server for %s", path))
+			continue
+		}
+
+		if r.Lock != nil {
+			results[i].Lock = *r.Lock
+		}
+		if len(r.Message) > 0 {
+			results[i].Err = errors.New(tr.Tr.Get(format, r.Message))
+		} else if r.Lock == nil {
+			results[i].Err = errors.New(tr.Tr.Get("invalid server response"))
+		}
+	}
+	return results
+}
@@ -0,0 +1,134 @@
+package locking
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/git"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBatchlessServer returns a server which does not support batch requests,
+// on which "b" is locked by somebody else, and the client to use with it.
+func newBatchlessServer(t *testing.T) (*Client, map[string]Lock) {
+	locks := map[string]Lock{
+		"b": {Id: "b", Path: "b", Owner: &User{Name: "somebody else"}},
+	}
+
+	srv := httptest.NewServer(batchlessHandler(locks))
+	t.Cleanup(srv.Close)
+
+	return newTestLockClient(t, srv.URL+"/api"), locks
+}
+
+// batchlessHandler returns a handler for the locking API which does not
+// support batch requests, and keeps its locks in locks.
+func batchlessHandler(locks map[string]Lock) http.Handler {
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/locks/batch":
+			w.WriteHeader(404)
+		case r.URL.Path == "/api/locks" && r.Method == "GET":
+			list := &lockList{Locks: []Lock{}}
+			if l, ok := locks[r.URL.Query().Get("path")]; ok {
+				list.Locks = append(list.Locks, l)
+			}
+			json.NewEncoder(w).Encode(list)
+		case r.URL.Path == "/api/locks" && r.Method == "POST":
+			req := &lockRequest{}
+			json.NewDecoder(r.Body).Decode(req)
+			if l, ok := locks[req.Path]; ok {
+				w.WriteHeader(409)
+				json.NewEncoder(w).Encode(&lockResponse{Lock: &l, Message: "already created lock"})
+				return
+			}
+			l := Lock{Id: req.Path, Path: req.Path, Owner: &User{Name: "Fred"}}
+			locks[req.Path] = l
+			w.WriteHeader(201)
+			json.NewEncoder(w).Encode(&lockResponse{Lock: &l})
+		case strings.HasSuffix(r.URL.Path, "/unlock"):
+			id := strings.Split(r.URL.Path, "/")[3]
+			l := locks[id]
+			delete(locks, id)
+			json.NewEncoder(w).Encode(&unlockResponse{Lock: &l})
+		default:
+			w.WriteHeader(500)
+		}
+	})
+}
+
+// newTestLockClient returns a client of the locking API at url, with a lock
+// cache.
+func newTestLockClient(t *testing.T, url string) *Client {
+	lfsclient := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url":    url,
+		"user.name":  "Fred",
+		"user.email": "fred@bloggs.com",
+	}))
+
+	client := NewClient("", lfsclient, config.New())
+	t.Cleanup(func() { client.Close() })
+	require.Nil(t, client.SetupFileCache(t.TempDir()))
+	client.RemoteRef = &git.Ref{Name: "refs/heads/master"}
+	return client
+}
+
+func TestLockFilesFallback(t *testing.T) {
+	client, locks := newBatchlessServer(t)
+
+	results, err := client.LockFiles([]string{"a", "b", "c"}, 0, false)
+	require.Nil(t, err)
+	require.Len(t, results, 3)
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, "a", results[0].Lock.Id)
+	assert.ErrorContains(t, results[1].Err, "already created lock")
+	assert.Nil(t, results[2].Err)
+	assert.Len(t, locks, 3)
+}
+
+func TestLockFilesFallbackAtomic(t *testing.T) {
+	client, locks := newBatchlessServer(t)
+
+	results, err := client.LockFiles([]string{"a", "b", "c"}, 0, true)
+	require.Nil(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, ErrBatchAborted, results[0].Err)
+	assert.ErrorContains(t, results[1].Err, "already created lock")
+	assert.Equal(t, ErrBatchAborted, results[2].Err)
+
+	// The lock on "a" was released again, and "c" was never locked.
+	assert.Len(t, locks, 1)
+	assert.Contains(t, locks, "b")
+}
+
+func TestUnlockFilesFallback(t *testing.T) {
+	client, locks := newBatchlessServer(t)
+	locks["a"] = Lock{Id: "a", Path: "a", Owner: &User{Name: "Fred"}}
+
+	results, err := client.UnlockFiles([]string{"a", "c"}, false, true)
+	require.Nil(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, ErrBatchAborted, results[0].Err)
+	assert.ErrorContains(t, results[1].Err, "unable to get lock ID")
+	assert.Contains(t, locks, "a")
+
+	results, err = client.UnlockFiles([]string{"a", "c"}, false, false)
+	require.Nil(t, err)
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, "a", results[0].Lock.Path)
+	assert.Error(t, results[1].Err)
+	assert.NotContains(t, locks, "a")
+}
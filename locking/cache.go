@@ -11,6 +11,9 @@ const (
 	// list all locks, prefix the id->path map in a way we can identify (something
 	// that won't be in a path)
 	idKeyPrefix string = "*id*://"
+	// Locks and unlocks queued while the server is unreachable are kept in
+	// the same file, under keys with a different prefix
+	pendingKeyPrefix string = "*pending*://"
 )
 
 type LockCache struct {
@@ -63,7 +66,7 @@ func (c *LockCache) Locks() []Lock {
 	var locks []Lock
 	c.kv.Visit(func(key string, val interface{}) bool {
 		// Only report file->id entries not reverse
-		if !c.isIdKey(key) {
+		if !c.isIdKey(key) && !c.isPendingKey(key) {
 			lock := val.(*Lock)
 			locks = append(locks, *lock)
 		}
@@ -72,9 +75,44 @@ func (c *LockCache) Locks() []Lock {
 	return locks
 }
 
-// Clear the cache
+// Queue a lock or unlock until the server can be reached
+func (c *LockCache) AddPending(p PendingLock) error {
+	c.kv.Set(c.encodePendingKey(p), &p)
+	return nil
+}
+
+// Remove a queued lock or unlock because it has been replayed or replaced
+func (c *LockCache) RemovePending(p PendingLock) error {
+	c.kv.Remove(c.encodePendingKey(p))
+	return nil
+}
+
+// Get the list of queued locks and unlocks
+func (c *LockCache) Pending() []PendingLock {
+	var pending []PendingLock
+	c.kv.Visit(func(key string, val interface{}) bool {
+		if c.isPendingKey(key) {
+			p := val.(*PendingLock)
+			pending = append(pending, *p)
+		}
+		return true // continue
+	})
+	return pending
+}
+
+// Clear the cached locks, keeping any queued locks and unlocks, which are not
+// known to the server
 func (c *LockCache) Clear() {
-	c.kv.RemoveAll()
+	var keys []string
+	c.kv.Visit(func(key string, val interface{}) bool {
+		if !c.isPendingKey(key) {
+			keys = append(keys, key)
+		}
+		return true // continue
+	})
+	for _, key := range keys {
+		c.kv.Remove(key)
+	}
 }
 
 // Save the cache
@@ -101,3 +139,15 @@ func (c *LockCache) decodeIdKey(key string) string {
 func (c *LockCache) isIdKey(key string) bool {
 	return strings.HasPrefix(key, idKeyPrefix)
 }
+
+func (c *LockCache) encodePendingKey(p PendingLock) string {
+	// An unlock by ID may not know its path
+	if len(p.Path) == 0 {
+		return pendingKeyPrefix + p.Ref + ":" + idKeyPrefix + p.Id
+	}
+	return pendingKeyPrefix + p.Ref + ":" + p.Path
+}
+
+func (c *LockCache) isPendingKey(key string) bool {
+	return strings.HasPrefix(key, pendingKeyPrefix)
+}
@@ -2,6 +2,7 @@ package locking
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -58,3 +59,34 @@ func TestLockCache(t *testing.T) {
 	}
 	assert.Equal(t, len(testLocks), len(locks))
 }
+
+func TestLockCachePending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lockcache.db")
+	cache, err := NewLockCache(path)
+	assert.Nil(t, err)
+
+	lock := Lock{Path: "a.dat", Id: "101"}
+	queuedLock := PendingLock{Operation: "lock", Path: "b.dat", Ref: "refs/heads/main"}
+	queuedUnlock := PendingLock{Operation: "unlock", Id: "102", Ref: "refs/heads/main"}
+
+	assert.Nil(t, cache.Add(lock))
+	assert.Nil(t, cache.AddPending(queuedLock))
+	assert.Nil(t, cache.AddPending(queuedUnlock))
+
+	assert.Equal(t, []Lock{lock}, cache.Locks())
+	assert.ElementsMatch(t, []PendingLock{queuedLock, queuedUnlock}, cache.Pending())
+
+	// Clearing the cached locks keeps the queue, which the server does
+	// not know about.
+	cache.Clear()
+	assert.Empty(t, cache.Locks())
+	assert.Len(t, cache.Pending(), 2)
+
+	assert.Nil(t, cache.Save())
+	cache, err = NewLockCache(path)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []PendingLock{queuedLock, queuedUnlock}, cache.Pending())
+
+	assert.Nil(t, cache.RemovePending(queuedLock))
+	assert.Equal(t, []PendingLock{queuedUnlock}, cache.Pending())
+}
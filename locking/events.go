@@ -0,0 +1,22 @@
+package locking
+
+import (
+	"github.com/git-lfs/git-lfs/v3/events"
+)
+
+// emitLockEvent writes an event of the given type to the event stream for an
+// attempt to create, delete or renew the lock on path, which failed with err,
+// if it is not nil.
+func emitLockEvent(typ, path string, lock Lock, err error) {
+	e := events.Event{
+		Type:      typ,
+		Path:      path,
+		LockID:    lock.Id,
+		ExpiresAt: lock.ExpiresAt,
+		Error:     events.ErrorOf(err),
+	}
+	if lock.Owner != nil {
+		e.Owner = lock.Owner.Name
+	}
+	events.Emit(e)
+}
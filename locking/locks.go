@@ -11,6 +11,7 @@ import (
 
 	"github.com/git-lfs/git-lfs/v3/config"
 	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/events"
 	"github.com/git-lfs/git-lfs/v3/filepathfilter"
 	"github.com/git-lfs/git-lfs/v3/git"
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
@@ -34,6 +35,9 @@ type LockCacher interface {
 	RemoveByPath(filePath string) error
 	RemoveById(id string) error
 	Locks() []Lock
+	AddPending(p PendingLock) error
+	RemovePending(p PendingLock) error
+	Pending() []PendingLock
 	Clear()
 	Save() error
 }
@@ -55,6 +59,13 @@ type Client struct {
 	LocalGitDir              string
 	SetLockableFilesReadOnly bool
 	ModifyIgnoredFiles       bool
+	// IncludeExpired causes searches to report locks whose leases have
+	// expired, which are otherwise treated as released and left out.
+	IncludeExpired bool
+	// QueueOffline causes locks and unlocks which cannot be made because
+	// the server is unreachable to be queued, to be replayed later by
+	// SyncPending.
+	QueueOffline bool
 }
 
 // NewClient creates a new locking client with the given configuration
@@ -67,6 +78,7 @@ func NewClient(remote string, lfsClient *lfsapi.Client, cfg *config.Configuratio
 		cache:              &nilLockCacher{},
 		cfg:                cfg,
 		ModifyIgnoredFiles: lfsClient.GitEnv().Bool("lfs.lockignoredfiles", false),
+		QueueOffline:       lfsClient.GitEnv().Bool("lfs.queuelocksoffline", false),
 		LocalWorkingDir:    cfg.LocalWorkingDir(),
 		LocalGitDir:        cfg.LocalGitDir(),
 	}
@@ -102,9 +114,33 @@ func (c *Client) Close() error {
 // path must be relative to the root of the repository
 // Returns the lock id if successful, or an error
 func (c *Client) LockFile(path string) (Lock, error) {
+	return c.LockFileWithTTL(path, 0)
+}
+
+// LockFileWithTTL attempts to lock a file on the current remote like LockFile,
+// asking for the lock to expire once ttl has passed, unless it is renewed.  If
+// ttl is zero, the lock does not expire.
+//
+// If the server cannot be reached and QueueOffline is set, the lock is queued
+// instead, and ErrQueued is returned.
+func (c *Client) LockFileWithTTL(path string, ttl time.Duration) (Lock, error) {
+	lock, err := c.lockFile(path, ttl)
+	if err != nil && c.shouldQueue(err) {
+		lock, err = c.queueLock(path, ttl)
+		if err == ErrQueued {
+			emitLockEvent(events.LockQueued, path, lock, nil)
+			return lock, err
+		}
+	}
+	emitLockEvent(events.LockCreated, path, lock, err)
+	return lock, err
+}
+
+func (c *Client) lockFile(path string, ttl time.Duration) (Lock, error) {
 	lockRes, _, err := c.client.Lock(c.Remote, &lockRequest{
-		Path: path,
-		Ref:  &lockRef{Name: c.RemoteRef.Refspec()},
+		Path:      path,
+		Ref:       &lockRef{Name: c.RemoteRef.Refspec()},
+		ExpiresAt: expiryOf(ttl),
 	})
 	if err != nil {
 		return Lock{}, errors.Wrap(err, tr.Tr.Get("locking API"))
@@ -118,25 +154,78 @@ func (c *Client) LockFile(path string) (Lock, error) {
 	}
 
 	lock := *lockRes.Lock
+	if err := c.lockAcquired(path, lock); err != nil {
+		return Lock{}, err
+	}
+	return lock, nil
+}
+
+// lockAcquired records that lock has been acquired on path, and makes the file
+// at path writeable, if it exists.
+func (c *Client) lockAcquired(path string, lock Lock) error {
 	if err := c.cache.Add(lock); err != nil {
-		return Lock{}, errors.Wrap(err, tr.Tr.Get("lock cache"))
+		return errors.Wrap(err, tr.Tr.Get("lock cache"))
 	}
 
 	abs, err := c.getAbsolutePath(path)
 	if err != nil {
-		return Lock{}, errors.Wrap(err, tr.Tr.Get("make lock path absolute"))
+		return errors.Wrap(err, tr.Tr.Get("make lock path absolute"))
 	}
 
 	// If the file exists, ensure that it's writeable on return
 	if tools.FileExists(abs) {
 		if err := tools.SetFileWriteFlag(abs, true); err != nil {
-			return Lock{}, errors.Wrap(err, tr.Tr.Get("set file write flag"))
+			return errors.Wrap(err, tr.Tr.Get("set file write flag"))
 		}
 	}
 
+	return nil
+}
+
+// RenewLock extends the lease of the lock with the given id on the current
+// remote, so that it expires once ttl has passed, and returns the renewed lock.
+func (c *Client) RenewLock(id string, ttl time.Duration) (Lock, error) {
+	lock, err := c.renewLock(id, ttl)
+	emitLockEvent(events.LockRenewed, lock.Path, lock, err)
+	return lock, err
+}
+
+func (c *Client) renewLock(id string, ttl time.Duration) (Lock, error) {
+	if ttl <= 0 {
+		return Lock{Id: id}, errors.New(tr.Tr.Get("lock lease must be positive"))
+	}
+
+	renewRes, _, err := c.client.Renew(c.RemoteRef, c.Remote, id, expiryOf(ttl))
+	if err != nil {
+		return Lock{Id: id}, errors.Wrap(err, tr.Tr.Get("locking API"))
+	}
+
+	if len(renewRes.Message) > 0 {
+		if len(renewRes.RequestID) > 0 {
+			tracerx.Printf("Server Request ID: %s", renewRes.RequestID)
+		}
+		return Lock{Id: id}, errors.New(tr.Tr.Get("server unable to renew lock: %s", renewRes.Message))
+	}
+
+	lock := *renewRes.Lock
+	if err := c.cache.RemoveById(id); err != nil {
+		return lock, errors.Wrap(err, tr.Tr.Get("lock cache"))
+	}
+	if err := c.cache.Add(lock); err != nil {
+		return lock, errors.Wrap(err, tr.Tr.Get("lock cache"))
+	}
 	return lock, nil
 }
 
+// expiryOf returns the time at which a lease of length ttl starting now
+// expires, truncated to whole seconds, or the zero time if ttl is zero.
+func expiryOf(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl).UTC().Truncate(time.Second)
+}
+
 // getAbsolutePath takes a repository-relative path and makes it absolute.
 //
 // For instance, given a repository in /usr/local/src/my-repo and a file called
@@ -150,42 +239,96 @@ func (c *Client) getAbsolutePath(p string) (string, error) {
 // UnlockFile attempts to unlock a file on the current remote
 // path must be relative to the root of the repository
 // Force causes the file to be unlocked from other users as well
+// If the server cannot be reached and QueueOffline is set, the unlock is queued
+// instead, and ErrQueued is returned
 func (c *Client) UnlockFile(path string, force bool) error {
+	// A lock which is still queued can simply be forgotten
+	if cancelled, err := c.cancelQueuedLock(path); cancelled || err != nil {
+		emitLockEvent(events.LockDeleted, path, Lock{Path: path}, err)
+		return err
+	}
+
 	id, err := c.lockIdFromPath(path)
 	if err != nil {
-		return errors.New(tr.Tr.Get("unable to get lock ID: %v", err))
+		if c.shouldQueue(err) {
+			return c.queueUnlockAndEmit(path, "", force)
+		}
+		err = errors.New(tr.Tr.Get("unable to get lock ID: %v", err))
+		emitLockEvent(events.LockDeleted, path, Lock{}, err)
+		return err
 	}
 
-	return c.UnlockFileById(id, force)
+	lock, err := c.unlockFileById(id, force)
+	if err != nil && c.shouldQueue(err) {
+		return c.queueUnlockAndEmit(path, id, force)
+	}
+	emitLockEvent(events.LockDeleted, path, lock, err)
+	return err
 }
 
 // UnlockFileById attempts to unlock a lock with a given id on the current remote
 // Force causes the file to be unlocked from other users as well
+// If the server cannot be reached and QueueOffline is set, the unlock is queued
+// instead, and ErrQueued is returned
 func (c *Client) UnlockFileById(id string, force bool) error {
+	lock, err := c.unlockFileById(id, force)
+	if err != nil && c.shouldQueue(err) {
+		return c.queueUnlockAndEmit("", id, force)
+	}
+	emitLockEvent(events.LockDeleted, lock.Path, lock, err)
+	return err
+}
+
+// queueUnlockAndEmit queues an unlock like queueUnlock, and emits an event
+// recording that it was queued.
+func (c *Client) queueUnlockAndEmit(path, id string, force bool) error {
+	lock, err := c.queueUnlock(path, id, force)
+	if err == ErrQueued {
+		emitLockEvent(events.UnlockQueued, lock.Path, lock, nil)
+	} else {
+		emitLockEvent(events.LockDeleted, lock.Path, lock, err)
+	}
+	return err
+}
+
+// unlockFileById unlocks the lock with the given id like UnlockFileById, and
+// returns the lock, as far as it is known.
+func (c *Client) unlockFileById(id string, force bool) (Lock, error) {
+	lock := Lock{Id: id}
 	unlockRes, _, err := c.client.Unlock(c.RemoteRef, c.Remote, id, force)
 	if err != nil {
-		return errors.Wrap(err, tr.Tr.Get("locking API"))
+		return lock, errors.Wrap(err, tr.Tr.Get("locking API"))
 	}
 
 	if len(unlockRes.Message) > 0 {
 		if len(unlockRes.RequestID) > 0 {
 			tracerx.Printf("Server Request ID: %s", unlockRes.RequestID)
 		}
-		return errors.New(tr.Tr.Get("server unable to unlock: %s", unlockRes.Message))
+		return lock, errors.New(tr.Tr.Get("server unable to unlock: %s", unlockRes.Message))
 	}
 
+	if unlockRes.Lock != nil {
+		lock = *unlockRes.Lock
+	}
+	return lock, c.lockReleased(id, unlockRes.Lock)
+}
+
+// lockReleased records that the lock with the given id has been released, and
+// makes its file read-only if required. The lock is nil if the server did not
+// describe it.
+func (c *Client) lockReleased(id string, lock *Lock) error {
 	if err := c.cache.RemoveById(id); err != nil {
 		return errors.New(tr.Tr.Get("error caching unlock information: %v", err))
 	}
 
-	if unlockRes.Lock != nil {
-		abs, err := c.getAbsolutePath(unlockRes.Lock.Path)
+	if lock != nil {
+		abs, err := c.getAbsolutePath(lock.Path)
 		if err != nil {
 			return errors.Wrap(err, tr.Tr.Get("make lock path absolute"))
 		}
 
 		// Make non-writeable if required
-		if c.SetLockableFilesReadOnly && c.IsFileLockable(unlockRes.Lock.Path) && tools.FileExists(abs) {
+		if c.SetLockableFilesReadOnly && c.IsFileLockable(lock.Path) && tools.FileExists(abs) {
 			return tools.SetFileWriteFlag(abs, false)
 		}
 	}
@@ -205,6 +348,15 @@ type Lock struct {
 	Owner *User `json:"owner,omitempty"`
 	// LockedAt is the time at which this lock was acquired.
 	LockedAt time.Time `json:"locked_at"`
+	// ExpiresAt is the time at which this lock's lease expires, after
+	// which it is treated as released. It is zero if the lock does not
+	// expire.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Expired returns whether the lock's lease had expired at the given time.
+func (l Lock) Expired(at time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !at.Before(l.ExpiresAt)
 }
 
 // SearchLocks returns a channel of locks which match the given name/value filter
@@ -222,7 +374,7 @@ func (c *Client) SearchLocks(filter map[string]string, limit int, localOnly bool
 		err := c.readLocksFromCacheFile("remote", func(decoder *json.Decoder) error {
 			return decoder.Decode(&locks)
 		})
-		return locks, err
+		return c.withoutExpired(locks), err
 	} else {
 		locks, err := c.searchRemoteLocks(filter, limit)
 		if err != nil {
@@ -252,7 +404,7 @@ func (c *Client) SearchLocksVerifiable(limit int, cached bool) (ourLocks, theirL
 		err := c.readLocksFromCacheFile("verifiable", func(decoder *json.Decoder) error {
 			return decoder.Decode(&locks)
 		})
-		return locks.Ours, locks.Theirs, err
+		return c.withoutExpired(locks.Ours), c.withoutExpired(locks.Theirs), err
 	} else {
 		var requestRef *lockRef
 		if c.RemoteRef != nil {
@@ -286,7 +438,11 @@ func (c *Client) SearchLocksVerifiable(limit int, cached bool) (ourLocks, theirL
 				return ourLocks, theirLocks, errors.New(tr.Tr.Get("server error searching locks: %s", list.Message))
 			}
 
+			now := time.Now()
 			for _, l := range list.Ours {
+				if c.isHidden(l, now) {
+					continue
+				}
 				c.cache.Add(l)
 				ourLocks = append(ourLocks, l)
 				if limit > 0 && (len(ourLocks)+len(theirLocks)) >= limit {
@@ -295,6 +451,9 @@ func (c *Client) SearchLocksVerifiable(limit int, cached bool) (ourLocks, theirL
 			}
 
 			for _, l := range list.Theirs {
+				if c.isHidden(l, now) {
+					continue
+				}
 				c.cache.Add(l)
 				theirLocks = append(theirLocks, l)
 				if limit > 0 && (len(ourLocks)+len(theirLocks)) >= limit {
@@ -325,12 +484,16 @@ func (c *Client) searchLocalLocks(filter map[string]string, limit int) ([]Lock,
 	id, filterById := filter["id"]
 	lockCount := 0
 	locks := make([]Lock, 0, len(cachedlocks))
+	now := time.Now()
 	for _, l := range cachedlocks {
 		// Manually filter by Path/Id
 		if (filterByPath && path != l.Path) ||
 			(filterById && id != l.Id) {
 			continue
 		}
+		if c.isHidden(l, now) {
+			continue
+		}
 		locks = append(locks, l)
 		lockCount++
 		if limit > 0 && lockCount >= limit {
@@ -341,6 +504,15 @@ func (c *Client) searchLocalLocks(filter map[string]string, limit int) ([]Lock,
 }
 
 func (c *Client) searchRemoteLocks(filter map[string]string, limit int) ([]Lock, error) {
+	locks, _, err := c.searchRemoteLockList(filter, limit)
+	return locks, err
+}
+
+// searchRemoteLockList returns the locks on the server which match filter, up
+// to limit, along with the channel the server advertised for pushing changes
+// to its locks, if it advertised one.
+func (c *Client) searchRemoteLockList(filter map[string]string, limit int) ([]Lock, *lockEventChannel, error) {
+	var channel *lockEventChannel
 	locks := make([]Lock, 0, limit)
 
 	apifilters := make([]lockFilter, 0, len(filter))
@@ -357,21 +529,29 @@ func (c *Client) searchRemoteLocks(filter map[string]string, limit int) ([]Lock,
 	for {
 		list, _, err := c.client.Search(c.Remote, query)
 		if err != nil {
-			return locks, errors.Wrap(err, tr.Tr.Get("locking"))
+			return locks, channel, errors.Wrap(err, tr.Tr.Get("locking"))
 		}
 
 		if list.Message != "" {
 			if len(list.RequestID) > 0 {
 				tracerx.Printf("Server Request ID: %s", list.RequestID)
 			}
-			return locks, errors.New(tr.Tr.Get("server error searching for locks: %s", list.Message))
+			return locks, channel, errors.New(tr.Tr.Get("server error searching for locks: %s", list.Message))
 		}
 
+		if list.Events != nil {
+			channel = list.Events
+		}
+
+		now := time.Now()
 		for _, l := range list.Locks {
+			if c.isHidden(l, now) {
+				continue
+			}
 			locks = append(locks, l)
 			if limit > 0 && len(locks) >= limit {
 				// Exit outer loop too
-				return locks, nil
+				return locks, channel, nil
 			}
 		}
 
@@ -382,7 +562,26 @@ func (c *Client) searchRemoteLocks(filter map[string]string, limit int) ([]Lock,
 		}
 	}
 
-	return locks, nil
+	return locks, channel, nil
+}
+
+// isHidden returns whether the lock l should be left out of the results of a
+// search made at the given time, because its lease has expired.
+func (c *Client) isHidden(l Lock, at time.Time) bool {
+	return !c.IncludeExpired && l.Expired(at)
+}
+
+// withoutExpired returns the locks which should be included in the results of a
+// search made now.
+func (c *Client) withoutExpired(locks []Lock) []Lock {
+	now := time.Now()
+	filtered := make([]Lock, 0, len(locks))
+	for _, l := range locks {
+		if !c.isHidden(l, now) {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
 }
 
 // lockIdFromPath makes a call to the LFS API and resolves the ID for the locked
@@ -519,6 +718,15 @@ func (c *nilLockCacher) RemoveById(id string) error {
 func (c *nilLockCacher) Locks() []Lock {
 	return nil
 }
+func (c *nilLockCacher) AddPending(p PendingLock) error {
+	return nil
+}
+func (c *nilLockCacher) RemovePending(p PendingLock) error {
+	return nil
+}
+func (c *nilLockCacher) Pending() []PendingLock {
+	return nil
+}
 func (c *nilLockCacher) Clear() {}
 func (c *nilLockCacher) Save() error {
 	return nil
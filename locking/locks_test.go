@@ -310,3 +310,91 @@ func TestSearchLocksVerifiableWithCache(t *testing.T) {
 	sort.Sort(LocksById(theirLocks))
 	assert.Equal(t, expectedTheirLocks, theirLocks)
 }
+
+func TestSearchLocksExpired(t *testing.T) {
+	expired := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/locks":
+			assert.Nil(t, json.NewEncoder(w).Encode(&lockList{
+				Locks: []Lock{
+					Lock{Id: "100", Path: "expired.dat", ExpiresAt: expired},
+					Lock{Id: "101", Path: "leased.dat", ExpiresAt: expires},
+					Lock{Id: "102", Path: "held.dat"},
+				},
+			}))
+		case "/api/locks/verify":
+			assert.Nil(t, json.NewEncoder(w).Encode(&lockVerifiableList{
+				Ours:   []Lock{Lock{Id: "101", Path: "leased.dat", ExpiresAt: expires}},
+				Theirs: []Lock{Lock{Id: "100", Path: "expired.dat", ExpiresAt: expired}},
+			}))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+
+	lfsclient := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url": srv.URL + "/api",
+	}))
+
+	client := NewClient("", lfsclient, config.New())
+	defer client.Close()
+
+	assert.Nil(t, client.SetupFileCache(t.TempDir()))
+	client.RemoteRef = &git.Ref{Name: "refs/heads/master"}
+
+	ids := func(locks []Lock) []string {
+		ids := make([]string, 0, len(locks))
+		for _, l := range locks {
+			ids = append(ids, l.Id)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// Expired locks do not count towards the limit.
+	locks, err := client.SearchLocks(nil, 1, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"101"}, ids(locks))
+
+	locks, err = client.SearchLocks(nil, 0, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"101", "102"}, ids(locks))
+
+	ours, theirs, err := client.SearchLocksVerifiable(0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"101"}, ids(ours))
+	assert.Empty(t, theirs)
+
+	locks, err = client.SearchLocks(nil, 0, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"101"}, ids(locks))
+
+	client.IncludeExpired = true
+	locks, err = client.SearchLocks(nil, 0, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"100", "101", "102"}, ids(locks))
+
+	locks, err = client.SearchLocks(nil, 0, false, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"100", "101", "102"}, ids(locks))
+
+	// Locks which were cached before their leases expired are left out
+	// once they have.
+	client.IncludeExpired = false
+	locks, err = client.SearchLocks(nil, 0, false, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"101", "102"}, ids(locks))
+}
+
+func TestLockExpired(t *testing.T) {
+	now := time.Now()
+	assert.False(t, Lock{}.Expired(now))
+	assert.False(t, Lock{ExpiresAt: now.Add(time.Second)}.Expired(now))
+	assert.True(t, Lock{ExpiresAt: now}.Expired(now))
+	assert.True(t, Lock{ExpiresAt: now.Add(-time.Second)}.Expired(now))
+}
@@ -0,0 +1,250 @@
+package locking
+
+import (
+	goerrors "errors"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/events"
+	"github.com/git-lfs/git-lfs/v3/tools/kv"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// ErrQueued is returned by LockFile, UnlockFile and related methods when the
+// server could not be reached, and the lock or unlock has instead been queued
+// to be replayed by SyncPending.
+var ErrQueued = errors.New(tr.Tr.Get("server unreachable; queued until it can be reached"))
+
+const (
+	pendingLock   = "lock"
+	pendingUnlock = "unlock"
+)
+
+// PendingLock is a lock or unlock which could not be made because the server
+// could not be reached, and which is queued until it can be.
+type PendingLock struct {
+	// Operation is either "lock" or "unlock".
+	Operation string
+	// Path is the path to lock or unlock. It may be empty for an unlock by
+	// ID of a lock which was not cached.
+	Path string
+	// Id is the ID of the lock to release, if it is known.
+	Id string
+	// Ref is the refspec of the remote ref for which the lock is to be
+	// created or deleted.
+	Ref string
+	// Force is whether to unlock the path even if somebody else locked
+	// it.
+	Force bool
+	// TTL is the length of the lease to ask for when creating the lock,
+	// starting from when it is replayed, or zero for no lease.
+	TTL time.Duration
+	// QueuedAt is when the lock or unlock was queued.
+	QueuedAt time.Time
+}
+
+// IsLock returns whether p is a lock, rather than an unlock.
+func (p PendingLock) IsLock() bool {
+	return p.Operation == pendingLock
+}
+
+// PendingResult is the result of replaying a PendingLock with SyncPending.
+type PendingResult struct {
+	Pending PendingLock
+	// Lock is the lock which was created or deleted, as far as it is
+	// known.
+	Lock Lock
+	// Err is the reason the server refused the lock or unlock, or nil if
+	// it was accepted.
+	Err error
+}
+
+// PendingLocks returns the locks and unlocks which are queued until the server
+// can be reached, in the order in which they were queued.
+func (c *Client) PendingLocks() []PendingLock {
+	pending := c.cache.Pending()
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].QueuedAt.Before(pending[j].QueuedAt)
+	})
+	return pending
+}
+
+// SyncPending replays the locks and unlocks queued for the current remote ref,
+// in the order in which they were queued. Each is removed from the queue once
+// the server has accepted or refused it, and the result of each is returned.
+//
+// If the server still cannot be reached, the remaining locks and unlocks stay
+// queued, and the error is returned with the results so far.
+func (c *Client) SyncPending() ([]PendingResult, error) {
+	var results []PendingResult
+	for _, p := range c.PendingLocks() {
+		if p.Ref != c.RemoteRef.Refspec() {
+			continue
+		}
+
+		var lock Lock
+		var err error
+		if p.IsLock() {
+			lock, err = c.lockFile(p.Path, p.TTL)
+			if err == nil || !isUnreachable(err) {
+				emitLockEvent(events.LockCreated, p.Path, lock, err)
+			}
+		} else {
+			lock, err = c.replayUnlock(p)
+			if err == nil || !isUnreachable(err) {
+				emitLockEvent(events.LockDeleted, p.Path, lock, err)
+			}
+		}
+
+		if err != nil && isUnreachable(err) {
+			return results, err
+		}
+		if err != nil && p.IsLock() {
+			err = c.lockConflict(p.Path, err)
+		}
+
+		if rerr := c.cache.RemovePending(p); rerr != nil {
+			return results, errors.Wrap(rerr, tr.Tr.Get("lock cache"))
+		}
+		results = append(results, PendingResult{Pending: p, Lock: lock, Err: err})
+	}
+	return results, nil
+}
+
+// replayUnlock deletes the lock to be released by the queued unlock p.
+func (c *Client) replayUnlock(p PendingLock) (Lock, error) {
+	id := p.Id
+	if len(id) == 0 {
+		var err error
+		if id, err = c.lockIdFromPath(p.Path); err != nil {
+			return Lock{Path: p.Path}, errors.New(tr.Tr.Get("unable to get lock ID: %v", err))
+		}
+	}
+	return c.unlockFileById(id, p.Force)
+}
+
+// lockConflict returns the reason the server refused to create the lock on
+// path with err, naming the owner of the existing lock on it, if there is one.
+func (c *Client) lockConflict(path string, err error) error {
+	locks, serr := c.searchRemoteLocks(map[string]string{"path": path}, 1)
+	if serr != nil || len(locks) == 0 || locks[0].Owner == nil {
+		return err
+	}
+	return errors.New(tr.Tr.Get("already locked by %s", locks[0].Owner.Name))
+}
+
+// queueLock queues a lock on path, to be created with a lease of ttl once the
+// server can be reached. A queued unlock of the same path is cancelled
+// instead, since the lock it would release is still held; the cached lock is
+// then returned with no error.
+func (c *Client) queueLock(path string, ttl time.Duration) (Lock, error) {
+	if p, ok := c.pendingFor(path, ""); ok && !p.IsLock() {
+		if err := c.cache.RemovePending(p); err != nil {
+			return Lock{}, errors.Wrap(err, tr.Tr.Get("lock cache"))
+		}
+		for _, l := range c.cache.Locks() {
+			if l.Path == path {
+				return l, nil
+			}
+		}
+	}
+
+	return Lock{Path: path}, c.queue(PendingLock{
+		Operation: pendingLock,
+		Path:      path,
+		TTL:       ttl,
+	})
+}
+
+// queueUnlock queues an unlock of the lock with the given id on path, either
+// of which may be empty if it is unknown, to be made once the server can be
+// reached.
+func (c *Client) queueUnlock(path, id string, force bool) (Lock, error) {
+	lock := Lock{Id: id, Path: path}
+	for _, l := range c.cache.Locks() {
+		if (len(id) > 0 && l.Id == id) || (len(id) == 0 && l.Path == path) {
+			lock = l
+			break
+		}
+	}
+
+	return lock, c.queue(PendingLock{
+		Operation: pendingUnlock,
+		Path:      lock.Path,
+		Id:        lock.Id,
+		Force:     force,
+	})
+}
+
+// cancelQueuedLock removes a queued lock on path, returning whether there was
+// one to remove, so that unlocking it needs no request to the server.
+func (c *Client) cancelQueuedLock(path string) (bool, error) {
+	p, ok := c.pendingFor(path, "")
+	if !ok || !p.IsLock() {
+		return false, nil
+	}
+	if err := c.cache.RemovePending(p); err != nil {
+		return false, errors.Wrap(err, tr.Tr.Get("lock cache"))
+	}
+	return true, nil
+}
+
+// pendingFor returns the lock or unlock queued for the current remote ref on
+// path, or of the lock with the given id, if there is one.
+func (c *Client) pendingFor(path, id string) (PendingLock, bool) {
+	for _, p := range c.cache.Pending() {
+		if p.Ref != c.RemoteRef.Refspec() {
+			continue
+		}
+		if (len(path) > 0 && p.Path == path) || (len(id) > 0 && p.Id == id) {
+			return p, true
+		}
+	}
+	return PendingLock{}, false
+}
+
+// queue adds p to the queue for the current remote ref, replacing any lock or
+// unlock already queued for the same path, and returns ErrQueued.
+func (c *Client) queue(p PendingLock) error {
+	p.Ref = c.RemoteRef.Refspec()
+	p.QueuedAt = time.Now()
+
+	if existing, ok := c.pendingFor(p.Path, p.Id); ok {
+		if err := c.cache.RemovePending(existing); err != nil {
+			return errors.Wrap(err, tr.Tr.Get("lock cache"))
+		}
+	}
+	if err := c.cache.AddPending(p); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("lock cache"))
+	}
+
+	tracerx.Printf("locking: server unreachable, queued %s of %q", p.Operation, p.Path)
+	return ErrQueued
+}
+
+// shouldQueue returns whether a lock or unlock which failed with err should be
+// queued until the server can be reached.
+func (c *Client) shouldQueue(err error) bool {
+	// Without a lock cache there is nowhere to keep the queue.
+	if _, ok := c.cache.(*nilLockCacher); ok {
+		return false
+	}
+	return c.QueueOffline && isUnreachable(err)
+}
+
+// isUnreachable returns whether err means that the server could not be
+// reached at all, rather than that it refused a request.
+func isUnreachable(err error) bool {
+	cause := errors.Cause(err)
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return goerrors.As(cause, &opErr) || goerrors.As(cause, &dnsErr)
+}
+
+func init() {
+	kv.RegisterTypeForStorage(&PendingLock{})
+}
@@ -0,0 +1,148 @@
+package locking
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOfflineServer returns a client of a locking API server which is not yet
+// running, on which "b" is locked by somebody else, and a function which
+// starts the server.
+func newOfflineServer(t *testing.T) (*Client, map[string]Lock, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	locks := map[string]Lock{
+		"b": {Id: "b", Path: "b", Owner: &User{Name: "somebody else"}},
+	}
+	client := newTestLockClient(t, "http://"+addr+"/api")
+	client.QueueOffline = true
+
+	start := func() {
+		ln, err := net.Listen("tcp", addr)
+		require.NoError(t, err)
+
+		srv := httptest.NewUnstartedServer(batchlessHandler(locks))
+		srv.Listener.Close()
+		srv.Listener = ln
+		srv.Start()
+		t.Cleanup(srv.Close)
+	}
+	return client, locks, start
+}
+
+func TestLockFileQueuedWhenUnreachable(t *testing.T) {
+	client, locks, start := newOfflineServer(t)
+
+	_, err := client.LockFileWithTTL("a", time.Hour)
+	assert.Equal(t, ErrQueued, err)
+	_, err = client.LockFile("b")
+	assert.Equal(t, ErrQueued, err)
+
+	pending := client.PendingLocks()
+	require.Len(t, pending, 2)
+	assert.Equal(t, "a", pending[0].Path)
+	assert.True(t, pending[0].IsLock())
+	assert.Equal(t, time.Hour, pending[0].TTL)
+	assert.Equal(t, client.RemoteRef.Refspec(), pending[0].Ref)
+	assert.Empty(t, client.cache.Locks())
+
+	results, err := client.SyncPending()
+	assert.Error(t, err)
+	assert.Empty(t, results)
+	assert.Len(t, client.PendingLocks(), 2, "queue kept while unreachable")
+
+	start()
+	results, err = client.SyncPending()
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "a", results[0].Pending.Path)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "a", results[0].Lock.Id)
+	assert.Contains(t, locks, "a")
+
+	assert.Equal(t, "b", results[1].Pending.Path)
+	assert.EqualError(t, results[1].Err, "already locked by somebody else")
+
+	assert.Empty(t, client.PendingLocks())
+	assert.Equal(t, []Lock{locks["a"]}, client.cache.Locks())
+}
+
+func TestUnlockFileQueuedWhenUnreachable(t *testing.T) {
+	client, locks, start := newOfflineServer(t)
+
+	lock := Lock{Id: "c", Path: "c", Owner: &User{Name: "Fred"}}
+	locks["c"] = lock
+	require.NoError(t, client.cache.Add(lock))
+
+	assert.Equal(t, ErrQueued, client.UnlockFile("c", false))
+
+	pending := client.PendingLocks()
+	require.Len(t, pending, 1)
+	assert.False(t, pending[0].IsLock())
+	assert.Equal(t, "c", pending[0].Id)
+	assert.Equal(t, []Lock{lock}, client.cache.Locks(), "lock kept until unlocked")
+
+	start()
+	results, err := client.SyncPending()
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.NotContains(t, locks, "c")
+	assert.Empty(t, client.cache.Locks())
+	assert.Empty(t, client.PendingLocks())
+}
+
+func TestQueuedLocksCancelUnlocks(t *testing.T) {
+	client, _, _ := newOfflineServer(t)
+
+	lock := Lock{Id: "c", Path: "c", Owner: &User{Name: "Fred"}}
+	require.NoError(t, client.cache.Add(lock))
+
+	// Unlocking a queued lock forgets it.
+	_, err := client.LockFile("a")
+	assert.Equal(t, ErrQueued, err)
+	assert.NoError(t, client.UnlockFile("a", false))
+	assert.Empty(t, client.PendingLocks())
+
+	// Locking a path whose unlock is queued keeps the existing lock.
+	assert.Equal(t, ErrQueued, client.UnlockFile("c", false))
+	relocked, err := client.LockFile("c")
+	assert.NoError(t, err)
+	assert.Equal(t, lock, relocked)
+	assert.Empty(t, client.PendingLocks())
+}
+
+func TestLockFilesQueuedWhenUnreachable(t *testing.T) {
+	client, _, _ := newOfflineServer(t)
+
+	results, err := client.LockFiles([]string{"a", "c"}, 0, false)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, ErrQueued, results[0].Err)
+	assert.Equal(t, ErrQueued, results[1].Err)
+	assert.Len(t, client.PendingLocks(), 2)
+
+	// An all-or-nothing batch cannot be replayed as one, so it fails.
+	_, err = client.LockFiles([]string{"d", "e"}, 0, true)
+	assert.Error(t, err)
+	assert.Len(t, client.PendingLocks(), 2)
+}
+
+func TestLockFileNotQueuedWhenDisabled(t *testing.T) {
+	client, _, _ := newOfflineServer(t)
+	client.QueueOffline = false
+
+	_, err := client.LockFile("a")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrQueued, err)
+	assert.Empty(t, client.PendingLocks())
+}
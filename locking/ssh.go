@@ -2,6 +2,7 @@ package locking
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -45,6 +46,12 @@ func (c *sshLockClient) parseLockResponse(status int, args []string, lines []str
 					return lock, "", errors.New(tr.Tr.Get("lock response: invalid locked-at: %s", entry))
 				}
 				seen["locked-at"] = struct{}{}
+			} else if strings.HasPrefix(entry, "expires-at=") {
+				// Leases are optional, so this is not required.
+				lock.ExpiresAt, err = time.Parse(time.RFC3339, entry[11:])
+				if err != nil {
+					return lock, "", errors.New(tr.Tr.Get("lock response: invalid expires-at: %s", entry))
+				}
 			}
 		}
 		if len(seen) != 4 {
@@ -120,6 +127,11 @@ func (c *sshLockClient) parseListLockResponse(status int, args []string, lines [
 					if err != nil {
 						return nil, nil, nil, "", "", errors.New(tr.Tr.Get("lock response: invalid locked-at: %s", entry))
 					}
+				case "expires-at":
+					last.lock.ExpiresAt, err = time.Parse(time.RFC3339, values[2])
+					if err != nil {
+						return nil, nil, nil, "", "", errors.New(tr.Tr.Get("lock response: invalid expires-at: %s", entry))
+					}
 				}
 			}
 		}
@@ -146,6 +158,9 @@ func (c *sshLockClient) Lock(remote string, lockReq *lockRequest) (*lockResponse
 	if lockReq.Ref != nil {
 		args = append(args, fmt.Sprintf("refname=%s", lockReq.Ref.Name))
 	}
+	if !lockReq.ExpiresAt.IsZero() {
+		args = append(args, fmt.Sprintf("expires-at=%s", lockReq.ExpiresAt.Format(time.RFC3339)))
+	}
 	conn, err := c.connection()
 	if err != nil {
 		return nil, 0, err
@@ -191,6 +206,126 @@ func (c *sshLockClient) Unlock(ref *git.Ref, remote, id string, force bool) (*un
 	return &lock, status, err
 }
 
+func (c *sshLockClient) Renew(ref *git.Ref, remote, id string, expiresAt time.Time) (*renewResponse, int, error) {
+	args := make([]string, 0, 2)
+	if ref != nil {
+		args = append(args, fmt.Sprintf("refname=%s", ref.Name))
+	}
+	args = append(args, fmt.Sprintf("expires-at=%s", expiresAt.Format(time.RFC3339)))
+	conn, err := c.connection()
+	if err != nil {
+		return nil, 0, err
+	}
+	conn.Lock()
+	defer conn.Unlock()
+	err = conn.SendMessage(fmt.Sprintf("renew %s", id), args)
+	if err != nil {
+		return nil, 0, err
+	}
+	status, args, lines, err := conn.ReadStatusWithLines()
+	if err != nil {
+		return nil, status, err
+	}
+	var lock renewResponse
+	lock.Lock, lock.Message, err = c.parseLockResponse(status, args, lines)
+	return &lock, status, err
+}
+
+func (c *sshLockClient) parseBatchResponse(status int, args []string, lines []string) ([]lockBatchResult, string, error) {
+	if status < 200 || status > 299 {
+		var message string
+		if len(lines) > 0 {
+			message = lines[0]
+		}
+		return nil, message, nil
+	}
+
+	var results []lockBatchResult
+	for _, entry := range lines {
+		values := strings.SplitN(entry, " ", 3)
+		if len(values) != 3 {
+			return nil, "", errors.New(tr.Tr.Get("lock response: invalid response: %q", entry))
+		}
+		if values[0] == "path" {
+			if values[1] != fmt.Sprintf("%d", len(results)) {
+				return nil, "", errors.New(tr.Tr.Get("lock response: interspersed response: %q", entry))
+			}
+			results = append(results, lockBatchResult{Path: values[2]})
+			continue
+		} else if len(results) == 0 || values[1] != fmt.Sprintf("%d", len(results)-1) {
+			return nil, "", errors.New(tr.Tr.Get("lock response: interspersed response: %q", entry))
+		}
+
+		result := &results[len(results)-1]
+		if result.Lock == nil && values[0] != "message" {
+			result.Lock = &Lock{Path: result.Path}
+		}
+		var err error
+		switch values[0] {
+		case "id":
+			result.Lock.Id = values[2]
+		case "ownername":
+			result.Lock.Owner = &User{Name: values[2]}
+		case "locked-at":
+			result.Lock.LockedAt, err = time.Parse(time.RFC3339, values[2])
+			if err != nil {
+				return nil, "", errors.New(tr.Tr.Get("lock response: invalid locked-at: %s", entry))
+			}
+		case "expires-at":
+			result.Lock.ExpiresAt, err = time.Parse(time.RFC3339, values[2])
+			if err != nil {
+				return nil, "", errors.New(tr.Tr.Get("lock response: invalid expires-at: %s", entry))
+			}
+		case "message":
+			result.Message = values[2]
+		}
+	}
+	for _, result := range results {
+		if result.Lock != nil && len(result.Lock.Id) == 0 {
+			return nil, "", errors.New(tr.Tr.Get("incomplete fields for lock"))
+		}
+	}
+	return results, "", nil
+}
+
+func (c *sshLockClient) Batch(remote string, breq *lockBatchRequest) (*lockBatchResponse, int, error) {
+	conn, err := c.connection()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !conn.HasCapability("lock-batch") {
+		return nil, http.StatusNotImplemented, errors.New(tr.Tr.Get("server does not support batch locking"))
+	}
+
+	args := make([]string, 0, 5)
+	args = append(args, fmt.Sprintf("operation=%s", breq.Operation))
+	if breq.Ref != nil {
+		args = append(args, fmt.Sprintf("refname=%s", breq.Ref.Name))
+	}
+	if breq.Atomic {
+		args = append(args, "atomic=true")
+	}
+	if breq.Force {
+		args = append(args, "force=true")
+	}
+	if !breq.ExpiresAt.IsZero() {
+		args = append(args, fmt.Sprintf("expires-at=%s", breq.ExpiresAt.Format(time.RFC3339)))
+	}
+	conn.Lock()
+	defer conn.Unlock()
+	err = conn.SendMessageWithLines("lock-batch", args, breq.Paths)
+	if err != nil {
+		return nil, 0, err
+	}
+	status, args, lines, err := conn.ReadStatusWithLines()
+	if err != nil {
+		return nil, status, err
+	}
+	var res lockBatchResponse
+	res.Results, res.Message, err = c.parseBatchResponse(status, args, lines)
+	return &res, status, err
+}
+
 func (c *sshLockClient) Search(remote string, searchReq *lockSearchRequest) (*lockList, int, error) {
 	values := searchReq.QueryValues()
 	args := make([]string, 0, len(values))
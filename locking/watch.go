@@ -0,0 +1,334 @@
+package locking
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// DefaultWatchInterval is how often WatchLocks and WaitForUnlock ask the server
+// for its locks when it does not push changes to them.
+const DefaultWatchInterval = 10 * time.Second
+
+// The types of a LockChange.
+const (
+	LockChangeLocked   = "locked"
+	LockChangeUnlocked = "unlocked"
+)
+
+// LockChange is a lock which was created or deleted on the server while it was
+// being watched.
+type LockChange struct {
+	// Type is either LockChangeLocked or LockChangeUnlocked.
+	Type string
+	// Lock is the lock which was created or deleted.
+	Lock Lock
+	// Time is when the change was seen.
+	Time time.Time
+}
+
+// lockEventChannel is a channel advertised by the server in the response to a
+// search for locks, over which it pushes changes to its locks as they happen.
+type lockEventChannel struct {
+	// Href is the URL to which to send a GET request to open the channel.
+	Href string `json:"href"`
+	// Header is the set of extra headers to send with that request.
+	Header map[string]string `json:"header,omitempty"`
+}
+
+// lockEvent is a single change pushed by the server over a lockEventChannel,
+// which sends each as a line of JSON.
+type lockEvent struct {
+	// Event is either "locked" or "unlocked".
+	Event string `json:"event"`
+	Lock  Lock   `json:"lock"`
+}
+
+func (c *httpLockClient) Events(ctx context.Context, remote string, channel *lockEventChannel) (io.ReadCloser, int, error) {
+	// The request is sent with our credentials for the Git LFS server, so
+	// refuse to send it anywhere else.
+	e := c.Endpoints.Endpoint("download", remote)
+	if !sameOrigin(channel.Href, e.Url) {
+		return nil, 0, errors.New(tr.Tr.Get("lock event channel %q is not on the Git LFS server %q", channel.Href, e.Url))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", channel.Href, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", lfshttp.MediaType)
+	for key, value := range channel.Header {
+		req.Header.Set(key, value)
+	}
+
+	res, err := c.DoAPIRequestWithAuth(remote, req)
+	if err != nil {
+		if res != nil {
+			return nil, res.StatusCode, err
+		}
+		return nil, 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, res.StatusCode, errors.New(tr.Tr.Get("unexpected status opening lock event channel: %d", res.StatusCode))
+	}
+	return res.Body, res.StatusCode, nil
+}
+
+// sameOrigin returns whether the URLs a and b have the same scheme and host.
+func sameOrigin(a, b string) bool {
+	au, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	bu, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return len(au.Host) > 0 &&
+		strings.EqualFold(au.Scheme, bu.Scheme) &&
+		strings.EqualFold(au.Host, bu.Host)
+}
+
+func (c *sshLockClient) Events(ctx context.Context, remote string, channel *lockEventChannel) (io.ReadCloser, int, error) {
+	return nil, http.StatusNotImplemented, errors.New(tr.Tr.Get("lock event channels are not supported over SSH"))
+}
+
+func (c *genericLockClient) Events(ctx context.Context, remote string, channel *lockEventChannel) (io.ReadCloser, int, error) {
+	return c.getClient(remote, "download").Events(ctx, remote, channel)
+}
+
+// WatchLocks calls fn with each lock matching filter which is created or
+// deleted on the server, until ctx is done. Locks held when it starts are not
+// reported.
+//
+// If the server advertises a channel over which it pushes changes to its
+// locks, the changes are read from it as they happen. Otherwise, or if the
+// channel closes, the server is searched for its locks once every interval.
+// An error is returned only if the first search fails.
+func (c *Client) WatchLocks(ctx context.Context, filter map[string]string, interval time.Duration, fn func(LockChange)) error {
+	return c.watchLocks(ctx, filter, interval, func(held map[string]Lock, change *LockChange) {
+		if change != nil {
+			fn(*change)
+		}
+	})
+}
+
+// WaitForUnlock blocks until no lock is held on path, returning the lock which
+// was held when it started and has since been released, or an empty Lock if
+// path was not locked. A lock which is replaced by another, such as when the
+// path changes hands, is waited for until the new lock is released, too. The
+// server is watched as by WatchLocks. If ctx is done first, its error is
+// returned.
+func (c *Client) WaitForUnlock(ctx context.Context, path string, interval time.Duration) (Lock, error) {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var waiting map[string]Lock
+	var released Lock
+	var unlocked bool
+	err := c.watchLocks(watchCtx, map[string]string{"path": path}, interval, func(held map[string]Lock, change *LockChange) {
+		if change == nil {
+			waiting = make(map[string]Lock, len(held))
+			for id, l := range held {
+				waiting[id] = l
+			}
+		} else if l, ok := waiting[change.Lock.Id]; ok && change.Type == LockChangeUnlocked {
+			released = l
+		}
+
+		if len(held) > 0 {
+			return
+		}
+		unlocked = true
+		cancel()
+	})
+	if err != nil {
+		return Lock{}, err
+	}
+	if !unlocked {
+		return Lock{}, ctx.Err()
+	}
+	return released, nil
+}
+
+// lockWatch holds the locks matching filter which are known to be held on the
+// server, while they are watched by watchLocks.
+type lockWatch struct {
+	c       *Client
+	filter  map[string]string
+	held    map[string]Lock
+	changed func(held map[string]Lock, change *LockChange)
+}
+
+// watchLocks watches the server for changes to the locks matching filter, as
+// described by WatchLocks. The function changed is called with the locks held
+// once they are first found, with a nil change, and again for each change, with
+// the locks held once every change found alongside it has been applied.
+func (c *Client) watchLocks(ctx context.Context, filter map[string]string, interval time.Duration, changed func(held map[string]Lock, change *LockChange)) error {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	locks, channel, err := c.searchRemoteLockList(filter, 0)
+	if err != nil {
+		return err
+	}
+
+	w := &lockWatch{
+		c:       c,
+		filter:  filter,
+		held:    make(map[string]Lock, len(locks)),
+		changed: changed,
+	}
+	for _, l := range locks {
+		w.held[l.Id] = l
+	}
+	changed(w.held, nil)
+
+	for ctx.Err() == nil {
+		if channel != nil {
+			if err := w.follow(ctx, channel); err != nil && ctx.Err() == nil {
+				tracerx.Printf("locking: lock event channel closed: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+
+		if channel, err = w.poll(); err != nil {
+			tracerx.Printf("locking: unable to search for locks: %v", err)
+		}
+	}
+	return nil
+}
+
+// poll searches the server for the locks matching the filter, reporting those
+// created or deleted since the last search, and returns the channel the server
+// advertised for pushing changes, if any.
+func (w *lockWatch) poll() (*lockEventChannel, error) {
+	locks, channel, err := w.c.searchRemoteLockList(w.filter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]Lock, len(locks))
+	for _, l := range locks {
+		current[l.Id] = l
+	}
+
+	now := time.Now()
+	var unlocked, locked []Lock
+	for id, l := range w.held {
+		if _, ok := current[id]; !ok {
+			unlocked = append(unlocked, l)
+		}
+	}
+	for id, l := range current {
+		if _, ok := w.held[id]; !ok {
+			locked = append(locked, l)
+		}
+	}
+
+	// Every change is applied before any is reported, so that a path
+	// which changed hands between two searches is never seen as free.
+	for _, l := range unlocked {
+		delete(w.held, l.Id)
+	}
+	for _, l := range locked {
+		w.held[l.Id] = l
+	}
+
+	// Report unlocks before locks, so that a path which changed hands
+	// between two searches is released before it is taken.
+	for _, l := range sortedByPath(unlocked) {
+		w.changed(w.held, &LockChange{Type: LockChangeUnlocked, Lock: l, Time: now})
+	}
+	for _, l := range sortedByPath(locked) {
+		w.changed(w.held, &LockChange{Type: LockChangeLocked, Lock: l, Time: now})
+	}
+	return channel, nil
+}
+
+// follow reads the changes pushed over channel until it closes or ctx is done.
+func (w *lockWatch) follow(ctx context.Context, channel *lockEventChannel) error {
+	body, _, err := w.c.client.Events(ctx, w.c.Remote, channel)
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("locking"))
+	}
+	defer body.Close()
+
+	// Changes made before the channel was opened are not pushed over it,
+	// so search once more now that it is open.
+	if _, err := w.poll(); err != nil {
+		return err
+	}
+	tracerx.Printf("locking: following lock event channel at %s", channel.Href)
+
+	dec := json.NewDecoder(body)
+	for {
+		var ev lockEvent
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		w.apply(ev)
+	}
+}
+
+// apply reports the change ev pushed by the server, if it is to a lock
+// matching the filter and is not already known.
+func (w *lockWatch) apply(ev lockEvent) {
+	now := time.Now()
+	switch ev.Event {
+	case LockChangeLocked:
+		if _, ok := w.held[ev.Lock.Id]; ok || !matchesFilter(ev.Lock, w.filter) || w.c.isHidden(ev.Lock, now) {
+			return
+		}
+		w.held[ev.Lock.Id] = ev.Lock
+		w.changed(w.held, &LockChange{Type: LockChangeLocked, Lock: ev.Lock, Time: now})
+	case LockChangeUnlocked:
+		l, ok := w.held[ev.Lock.Id]
+		if !ok {
+			return
+		}
+		delete(w.held, l.Id)
+		w.changed(w.held, &LockChange{Type: LockChangeUnlocked, Lock: l, Time: now})
+	default:
+		tracerx.Printf("locking: ignoring unknown lock event %q", ev.Event)
+	}
+}
+
+// matchesFilter returns whether the lock l matches the path and ID given in
+// filter, as a search by the server would.
+func matchesFilter(l Lock, filter map[string]string) bool {
+	if path, ok := filter["path"]; ok && len(path) > 0 && path != l.Path {
+		return false
+	}
+	if id, ok := filter["id"]; ok && len(id) > 0 && id != l.Id {
+		return false
+	}
+	return true
+}
+
+func sortedByPath(locks []Lock) []Lock {
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Path < locks[j].Path
+	})
+	return locks
+}
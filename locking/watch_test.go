@@ -0,0 +1,234 @@
+package locking
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchServer is a locking API server which returns its locks one per page,
+// and which pushes changes to them over an event channel if push is set.
+type watchServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	locks    []Lock
+	push     bool
+	searches int
+	events   chan lockEvent
+	// eventsURL is the URL of the event channel advertised if push is
+	// set, which is the server's own unless it is set.
+	eventsURL string
+}
+
+func newWatchServer(t *testing.T, push bool, locks ...Lock) *watchServer {
+	s := &watchServer{locks: locks, push: push, events: make(chan lockEvent, 16)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *watchServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/locks/events" {
+		w.WriteHeader(200)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case ev := <-s.events:
+				json.NewEncoder(w).Encode(ev)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches++
+
+	var matched []Lock
+	for _, l := range s.locks {
+		if path := r.URL.Query().Get("path"); len(path) == 0 || path == l.Path {
+			matched = append(matched, l)
+		}
+	}
+
+	list := &lockList{Locks: []Lock{}}
+	i, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+	if i < len(matched) {
+		list.Locks = append(list.Locks, matched[i])
+	}
+	if i+1 < len(matched) {
+		list.NextCursor = strconv.Itoa(i + 1)
+	}
+	if s.push {
+		list.Events = &lockEventChannel{Href: s.URL + "/api/locks/events"}
+		if len(s.eventsURL) > 0 {
+			list.Events.Href = s.eventsURL
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *watchServer) setLocks(locks ...Lock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks = locks
+}
+
+// watchChanges watches the locks matching filter on the server at url in the
+// background, returning the channel to which changes are sent.
+func watchChanges(t *testing.T, url string, filter map[string]string, interval time.Duration) <-chan LockChange {
+	client := newTestLockClient(t, url+"/api")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	changes := make(chan LockChange, 16)
+	started := make(chan error, 1)
+	go func() {
+		started <- client.watchLocks(ctx, filter, interval, func(held map[string]Lock, change *LockChange) {
+			if change == nil {
+				started <- nil
+				return
+			}
+			changes <- *change
+		})
+	}()
+	require.NoError(t, <-started)
+	return changes
+}
+
+func nextChange(t *testing.T, changes <-chan LockChange) LockChange {
+	t.Helper()
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change to locks reported")
+	}
+	return LockChange{}
+}
+
+func TestWatchLocksPolls(t *testing.T) {
+	a := Lock{Id: "1", Path: "a.dat", Owner: &User{Name: "Jane"}}
+	b := Lock{Id: "2", Path: "b.dat", Owner: &User{Name: "John"}}
+	c := Lock{Id: "3", Path: "c.dat", Owner: &User{Name: "Jane"}}
+	srv := newWatchServer(t, false, a, b)
+
+	changes := watchChanges(t, srv.URL, nil, 10*time.Millisecond)
+	srv.setLocks(b, c)
+
+	change := nextChange(t, changes)
+	assert.Equal(t, LockChangeUnlocked, change.Type)
+	assert.Equal(t, a, change.Lock)
+
+	change = nextChange(t, changes)
+	assert.Equal(t, LockChangeLocked, change.Type)
+	assert.Equal(t, c, change.Lock)
+}
+
+func TestWatchLocksFollowsEventChannel(t *testing.T) {
+	a := Lock{Id: "1", Path: "a.dat", Owner: &User{Name: "Jane"}}
+	b := Lock{Id: "2", Path: "b.dat", Owner: &User{Name: "John"}}
+	srv := newWatchServer(t, true, a)
+
+	changes := watchChanges(t, srv.URL, map[string]string{"path": "a.dat"}, time.Hour)
+
+	srv.events <- lockEvent{Event: LockChangeLocked, Lock: b}
+	srv.events <- lockEvent{Event: LockChangeUnlocked, Lock: Lock{Id: "1"}}
+
+	change := nextChange(t, changes)
+	assert.Equal(t, LockChangeUnlocked, change.Type)
+	assert.Equal(t, a, change.Lock, "the lock as it was found by the search")
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Equal(t, 2, srv.searches, "searched again when the channel opened, and not since")
+}
+
+func TestWatchLocksRefusesEventChannelOnOtherHost(t *testing.T) {
+	var requests int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(200)
+	}))
+	defer other.Close()
+
+	a := Lock{Id: "1", Path: "a.dat", Owner: &User{Name: "Jane"}}
+	srv := newWatchServer(t, true, a)
+	srv.eventsURL = other.URL + "/api/locks/events"
+
+	changes := watchChanges(t, srv.URL, nil, 10*time.Millisecond)
+	srv.setLocks()
+
+	// The server is polled instead.
+	change := nextChange(t, changes)
+	assert.Equal(t, LockChangeUnlocked, change.Type)
+	assert.Equal(t, a, change.Lock)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
+
+func TestWaitForUnlock(t *testing.T) {
+	a := Lock{Id: "1", Path: "a.dat", Owner: &User{Name: "Jane"}}
+	srv := newWatchServer(t, false, a)
+	client := newTestLockClient(t, srv.URL+"/api")
+
+	time.AfterFunc(50*time.Millisecond, func() { srv.setLocks() })
+
+	released, err := client.WaitForUnlock(context.Background(), "a.dat", 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, a, released)
+
+	released, err = client.WaitForUnlock(context.Background(), "a.dat", 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, Lock{}, released, "not locked")
+}
+
+func TestWaitForUnlockAfterChangeOfOwner(t *testing.T) {
+	a := Lock{Id: "1", Path: "a.dat", Owner: &User{Name: "Jane"}}
+	b := Lock{Id: "2", Path: "a.dat", Owner: &User{Name: "John"}}
+	srv := newWatchServer(t, false, a)
+	client := newTestLockClient(t, srv.URL+"/api")
+
+	// The path changes hands between two searches, and is only released
+	// once the new owner unlocks it.
+	time.AfterFunc(50*time.Millisecond, func() { srv.setLocks(b) })
+	unlocked := make(chan struct{})
+	time.AfterFunc(200*time.Millisecond, func() {
+		srv.setLocks()
+		close(unlocked)
+	})
+
+	released, err := client.WaitForUnlock(context.Background(), "a.dat", 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, a, released, "the lock held when waiting started")
+
+	select {
+	case <-unlocked:
+	default:
+		t.Fatal("reported unlocked while the path was still locked")
+	}
+}
+
+func TestWaitForUnlockTimeout(t *testing.T) {
+	srv := newWatchServer(t, false, Lock{Id: "1", Path: "a.dat"})
+	client := newTestLockClient(t, srv.URL+"/api")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.WaitForUnlock(ctx, "a.dat", 10*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,170 @@
+//go:build linux
+// +build linux
+
+package lockwatch
+
+import (
+	"context"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// fileEvents are the inotify events which indicate that a file has
+	// been, or is about to be, written.
+	fileEvents = unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO |
+		unix.IN_CREATE | unix.IN_ATTRIB
+
+	watchMask = fileEvents | unix.IN_ONLYDIR
+)
+
+// inotifyWatcher holds the inotify watches on each of the directories of a
+// working tree.
+type inotifyWatcher struct {
+	fd   int
+	dirs map[int32]string
+}
+
+// watchTree sends the path of each file below root which is modified, or made
+// writable, to changes, until ctx is done.
+func watchTree(ctx context.Context, root string, changes chan<- string) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("unable to watch working tree"))
+	}
+
+	// A non-blocking descriptor is read through the runtime poller, so
+	// that closing the file interrupts a pending read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	w := &inotifyWatcher{fd: fd, dirs: make(map[int32]string)}
+	if err := w.addTree(root, nil); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, tr.Tr.Get("unable to watch working tree"))
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := string(trimNul(buf[nameStart : nameStart+nameLen]))
+			offset = nameStart + nameLen
+
+			w.handle(ctx, wd, mask, name, changes)
+		}
+	}
+}
+
+// handle deals with a single inotify event, sending the path of the file it
+// concerns to changes if the file has been modified.
+func (w *inotifyWatcher) handle(ctx context.Context, wd int32, mask uint32, name string, changes chan<- string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		tracerx.Printf("lockwatch: inotify queue overflowed, some changes may be missed")
+		return
+	}
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return
+	}
+
+	dir, ok := w.dirs[wd]
+	if !ok || len(name) == 0 {
+		return
+	}
+	path := filepath.Join(dir, name)
+
+	if mask&unix.IN_ISDIR != 0 {
+		if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			// Files may have been written to the new directory
+			// before it could be watched, so they are reported as
+			// though they had changed.
+			if err := w.addTree(path, func(file string) {
+				send(ctx, changes, file)
+			}); err != nil {
+				tracerx.Printf("lockwatch: %v", err)
+			}
+		}
+		return
+	}
+
+	// A change of attributes alone only matters when it makes the file
+	// writable, which is how a read-only lockable file is usually made
+	// ready to be edited.
+	if mask&fileEvents == unix.IN_ATTRIB && unix.Access(path, unix.W_OK) != nil {
+		return
+	}
+	send(ctx, changes, path)
+}
+
+// addTree watches the directory at root and each directory below it, except
+// for the Git directory, calling found, if it is not nil, with each file.
+func (w *inotifyWatcher) addTree(root string, found func(string)) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The directory may have been removed since it
+			// was seen.
+			if path != root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !d.IsDir() {
+			if found != nil {
+				found(path)
+			}
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		wd, err := unix.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			return errors.Wrap(err, tr.Tr.Get("unable to watch %q", path))
+		}
+		w.dirs[int32(wd)] = path
+		return nil
+	})
+}
+
+// send sends path to changes, unless ctx is done first.
+func send(ctx context.Context, changes chan<- string, path string) {
+	select {
+	case changes <- path:
+	case <-ctx.Done():
+	}
+}
+
+// trimNul returns b up to its first NUL byte, which is how inotify pads the
+// names of files in its events.
+func trimNul(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
@@ -0,0 +1,72 @@
+//go:build linux
+// +build linux
+
+package lockwatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchTree(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "ro.dat"), []byte("ro"), 0444))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan string, 16)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- watchTree(ctx, root, changes)
+	}()
+
+	// Give the watches time to be added before making changes.
+	time.Sleep(100 * time.Millisecond)
+
+	gitDir := filepath.Join(root, ".git")
+	expect := func(path string) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case changed := <-changes:
+				assert.NotContains(t, changed, gitDir)
+				if changed == path {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no change reported for %s", path)
+			}
+		}
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".git", "index"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dir", "a.dat"), []byte("a"), 0644))
+	expect(filepath.Join(root, "dir", "a.dat"))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "new", "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new", "sub", "b.dat"), []byte("b"), 0644))
+	expect(filepath.Join(root, "new", "sub", "b.dat"))
+
+	require.NoError(t, os.Chmod(filepath.Join(root, "ro.dat"), 0644))
+	expect(filepath.Join(root, "ro.dat"))
+
+	cancel()
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watchTree did not return once cancelled")
+	}
+
+	for len(changes) > 0 {
+		assert.NotContains(t, <-changes, gitDir)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package lockwatch
+
+import (
+	"context"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+// watchTree is not supported on this platform.
+func watchTree(ctx context.Context, root string, changes chan<- string) error {
+	return errors.New(tr.Tr.Get("watching the working tree is not supported on this platform"))
+}
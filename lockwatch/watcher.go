@@ -0,0 +1,269 @@
+// Package lockwatch watches the working tree of a repository for changes to
+// lockable files, and locks each of them on behalf of the user when it is
+// first modified, so that they need not remember to run `git lfs lock` before
+// they start editing.
+package lockwatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/git"
+	"github.com/git-lfs/git-lfs/v3/locking"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	// DefaultRetryInterval is how long a Watcher waits by default before
+	// trying again to lock a file which somebody else has locked.
+	DefaultRetryInterval = time.Minute
+
+	// DefaultPollInterval is how often a Watcher checks by default whether
+	// the current branch has been pushed, when releasing locks on push.
+	DefaultPollInterval = 2 * time.Second
+)
+
+// Client is the part of a *locking.Client used by a Watcher.
+type Client interface {
+	LockFile(path string) (locking.Lock, error)
+	UnlockFileById(id string, force bool) error
+	SearchLocks(filter map[string]string, limit int, localOnly bool, cached bool) ([]locking.Lock, error)
+	IsFileLockable(path string) bool
+	IsFileLockedByCurrentCommitter(path string) bool
+}
+
+// Options configures a Watcher.
+type Options struct {
+	// Remote is the remote to which the current branch is pushed.
+	Remote string
+	// ReleaseOnPush releases the locks taken by the Watcher once the
+	// changes to their files have been committed and pushed to Remote.
+	ReleaseOnPush bool
+	// ReadOnly indicates that lockable files are made read-only while
+	// they are not locked, so that one which has been made writable is
+	// about to be edited, even if its contents have not yet changed.
+	ReadOnly bool
+	// RetryInterval is how long to wait before trying again to lock a
+	// file which somebody else has locked. It defaults to
+	// DefaultRetryInterval.
+	RetryInterval time.Duration
+	// PollInterval is how often to check whether the current branch has
+	// been pushed, if ReleaseOnPush is set. It defaults to
+	// DefaultPollInterval.
+	PollInterval time.Duration
+	// Notify is called with each message for the user, such as when a
+	// file has been locked, or is locked by somebody else.
+	Notify func(message string)
+}
+
+// Watcher locks lockable files in a working tree as they are modified.
+type Watcher struct {
+	client Client
+	root   string
+	opts   Options
+
+	mu sync.Mutex
+	// held holds the locks taken by the Watcher, by path.
+	held map[string]locking.Lock
+	// refused holds the times at which paths were last found to be locked
+	// by somebody else.
+	refused map[string]time.Time
+	// pushed is the commit at the tip of the remote-tracking branch of the
+	// current branch when it was last checked.
+	pushed string
+
+	// modified reports whether the file at a path differs from the index.
+	modified func(path string) (bool, error)
+}
+
+// New returns a Watcher of the working tree at root, which takes locks with
+// client. Since paths are given to Git relative to root, the Watcher must be
+// run from root.
+func New(client Client, root string, opts Options) *Watcher {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Notify == nil {
+		opts.Notify = func(string) {}
+	}
+
+	return &Watcher{
+		client:   client,
+		root:     root,
+		opts:     opts,
+		held:     make(map[string]locking.Lock),
+		refused:  make(map[string]time.Time),
+		modified: git.IsFileModified,
+	}
+}
+
+// Run watches the working tree until ctx is done, or watching it fails.
+func (w *Watcher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes := make(chan string, 64)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- watchTree(ctx, w.root, changes)
+	}()
+
+	var poll <-chan time.Time
+	if w.opts.ReleaseOnPush {
+		w.CheckPushed()
+
+		ticker := time.NewTicker(w.opts.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case path := <-changes:
+			rel, err := filepath.Rel(w.root, path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			w.Changed(filepath.ToSlash(rel))
+		case <-poll:
+			w.CheckPushed()
+		}
+	}
+}
+
+// Changed handles a change to the file at path, relative to the root of the
+// working tree. If the file is lockable, is being edited, and is not already
+// locked by the user, it is locked, or if somebody else has locked it, the
+// user is told who.
+func (w *Watcher) Changed(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.held[path]; ok {
+		return
+	}
+	if at, ok := w.refused[path]; ok && time.Since(at) < w.opts.RetryInterval {
+		return
+	}
+	if !w.client.IsFileLockable(path) || !w.edited(path) || w.client.IsFileLockedByCurrentCommitter(path) {
+		return
+	}
+
+	lock, err := w.client.LockFile(path)
+	if err == nil {
+		delete(w.refused, path)
+		w.held[path] = lock
+		w.opts.Notify(tr.Tr.Get("Locked %s", path))
+		return
+	}
+
+	w.refused[path] = time.Now()
+	if err == locking.ErrQueued {
+		w.opts.Notify(tr.Tr.Get("Queued lock on %s until the server can be reached", path))
+		return
+	}
+	locks, serr := w.client.SearchLocks(map[string]string{"path": path}, 1, false, false)
+	if serr == nil && len(locks) > 0 && locks[0].Owner != nil {
+		w.opts.Notify(tr.Tr.Get("%s is locked by %s; your changes to it cannot be pushed", path, locks[0].Owner.Name))
+		return
+	}
+	w.opts.Notify(tr.Tr.Get("Unable to lock %s: %v", path, errors.Cause(err)))
+}
+
+// edited returns whether the file at path is being edited by the user, rather
+// than having just been written by Git, such as when checking out a commit.
+func (w *Watcher) edited(path string) bool {
+	if modified, err := w.modified(path); err == nil && modified {
+		return true
+	}
+	if !w.opts.ReadOnly {
+		return false
+	}
+
+	fi, err := os.Stat(filepath.Join(w.root, path))
+	return err == nil && fi.Mode().IsRegular() && fi.Mode().Perm()&0200 != 0
+}
+
+// Held returns the locks taken by the Watcher which it has not yet released.
+func (w *Watcher) Held() []locking.Lock {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	locks := make([]locking.Lock, 0, len(w.held))
+	for _, lock := range w.held {
+		locks = append(locks, lock)
+	}
+	return locks
+}
+
+// CheckPushed releases the locks taken by the Watcher on files whose changes
+// have all been committed and pushed, if ReleaseOnPush is set and the
+// remote-tracking branch of the current branch has moved since it was last
+// checked.
+func (w *Watcher) CheckPushed() {
+	if !w.opts.ReleaseOnPush {
+		return
+	}
+
+	current, err := git.CurrentRef()
+	if err != nil || current.Type != git.RefTypeLocalBranch {
+		return
+	}
+	tracking, err := git.ResolveRef("refs/remotes/" + w.opts.Remote + "/" + current.Name)
+	if err != nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The branch is only taken to have been pushed once it moves, so
+	// that locks taken since starting are not released straight away.
+	first := len(w.pushed) == 0
+	if tracking.Sha == w.pushed {
+		return
+	}
+	w.pushed = tracking.Sha
+	if first || len(w.held) == 0 {
+		return
+	}
+
+	unpushed, err := git.GetFilesChanged(tracking.Sha, current.Sha)
+	if err != nil {
+		tracerx.Printf("lockwatch: unable to compare %s with %s: %v", tracking.Sha, current.Sha, err)
+		return
+	}
+	changed := make(map[string]bool, len(unpushed))
+	for _, path := range unpushed {
+		changed[path] = true
+	}
+
+	for path, lock := range w.held {
+		if changed[path] {
+			continue
+		}
+		if modified, err := w.modified(path); err != nil || modified {
+			continue
+		}
+
+		if err := w.client.UnlockFileById(lock.Id, false); err != nil {
+			w.opts.Notify(tr.Tr.Get("Unable to release lock on %s: %v", path, errors.Cause(err)))
+			continue
+		}
+		delete(w.held, path)
+		w.opts.Notify(tr.Tr.Get("Released lock on %s", path))
+	}
+}
@@ -0,0 +1,146 @@
+package lockwatch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/locking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient locks paths in memory, as user "me", except for those already
+// locked by somebody else.
+type fakeClient struct {
+	locks    map[string]locking.Lock
+	attempts int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{locks: make(map[string]locking.Lock)}
+}
+
+func (c *fakeClient) LockFile(path string) (locking.Lock, error) {
+	c.attempts++
+	if _, ok := c.locks[path]; ok {
+		return locking.Lock{}, errors.New("lock exists")
+	}
+
+	lock := locking.Lock{Id: fmt.Sprintf("%d", c.attempts), Path: path, Owner: &locking.User{Name: "me"}}
+	c.locks[path] = lock
+	return lock, nil
+}
+
+func (c *fakeClient) UnlockFileById(id string, force bool) error {
+	for path, lock := range c.locks {
+		if lock.Id == id {
+			delete(c.locks, path)
+			return nil
+		}
+	}
+	return errors.New("no such lock")
+}
+
+func (c *fakeClient) SearchLocks(filter map[string]string, limit int, localOnly bool, cached bool) ([]locking.Lock, error) {
+	if lock, ok := c.locks[filter["path"]]; ok {
+		return []locking.Lock{lock}, nil
+	}
+	return nil, nil
+}
+
+func (c *fakeClient) IsFileLockable(path string) bool {
+	return filepath.Ext(path) == ".dat"
+}
+
+func (c *fakeClient) IsFileLockedByCurrentCommitter(path string) bool {
+	lock, ok := c.locks[path]
+	return ok && lock.Owner.Name == "me"
+}
+
+func newTestWatcher(client Client, opts Options, modified ...string) (*Watcher, *[]string) {
+	var messages []string
+	opts.Notify = func(message string) {
+		messages = append(messages, message)
+	}
+
+	w := New(client, "", opts)
+	w.modified = func(path string) (bool, error) {
+		for _, m := range modified {
+			if m == path {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return w, &messages
+}
+
+func TestWatcherLocksModifiedLockableFiles(t *testing.T) {
+	client := newFakeClient()
+	w, messages := newTestWatcher(client, Options{}, "a.dat", "b.txt")
+
+	w.Changed("a.dat")
+	w.Changed("a.dat")
+	w.Changed("b.txt")
+	w.Changed("c.dat")
+
+	assert.Equal(t, 1, client.attempts)
+	assert.Contains(t, client.locks, "a.dat")
+	assert.Equal(t, []string{"Locked a.dat"}, *messages)
+	require.Len(t, w.Held(), 1)
+	assert.Equal(t, "a.dat", w.Held()[0].Path)
+}
+
+func TestWatcherSkipsFilesAlreadyLocked(t *testing.T) {
+	client := newFakeClient()
+	client.locks["a.dat"] = locking.Lock{Id: "mine", Path: "a.dat", Owner: &locking.User{Name: "me"}}
+	w, messages := newTestWatcher(client, Options{}, "a.dat")
+
+	w.Changed("a.dat")
+
+	assert.Equal(t, 0, client.attempts)
+	assert.Empty(t, *messages)
+	assert.Empty(t, w.Held())
+}
+
+func TestWatcherNotifiesOfOtherOwners(t *testing.T) {
+	client := newFakeClient()
+	client.locks["a.dat"] = locking.Lock{Id: "theirs", Path: "a.dat", Owner: &locking.User{Name: "them"}}
+	w, messages := newTestWatcher(client, Options{}, "a.dat")
+
+	w.Changed("a.dat")
+	w.Changed("a.dat")
+
+	assert.Equal(t, 1, client.attempts, "retried before RetryInterval")
+	assert.Equal(t, []string{"a.dat is locked by them; your changes to it cannot be pushed"}, *messages)
+	assert.Empty(t, w.Held())
+
+	delete(client.locks, "a.dat")
+	w.refused["a.dat"] = time.Now().Add(-DefaultRetryInterval)
+	w.Changed("a.dat")
+
+	assert.Equal(t, 2, client.attempts)
+	assert.Contains(t, *messages, "Locked a.dat")
+}
+
+func TestWatcherLocksWritableReadOnlyFiles(t *testing.T) {
+	// Paths are relative to the root of the working tree, not the current
+	// directory.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.dat"), []byte("a"), 0444))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.dat"), []byte("b"), 0644))
+
+	client := newFakeClient()
+	w, _ := newTestWatcher(client, Options{ReadOnly: true})
+	w.root = dir
+
+	w.Changed("a.dat")
+	w.Changed("b.dat")
+
+	assert.NotContains(t, client.locks, "a.dat")
+	assert.Contains(t, client.locks, "b.dat")
+}
@@ -1,13 +1,17 @@
 package ssh
 
 import (
+	"context"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/subprocess"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tr"
 )
 
@@ -17,6 +21,58 @@ type PktlineConnection struct {
 	mu  sync.Mutex
 	cmd *subprocess.Cmd
 	pl  Pktline
+
+	// capabilities are the capabilities advertised by the server.
+	capabilities []string
+
+	// op is the span of the operation in progress, from when its
+	// command is sent until its status is read, and opCommand and
+	// opStart are its command's name and when it started.
+	op        *telemetry.Span
+	opCommand string
+	opStart   time.Time
+}
+
+var (
+	sshDuration = telemetry.NewHistogram("lfs.ssh.duration", "Time taken by SSH operations")
+	sshErrors   = telemetry.NewCounter("lfs.ssh.errors", "{operation}", "Number of SSH operations which failed or received an error status")
+)
+
+// startOperation starts a span for the operation which sends the given
+// command.
+func (conn *PktlineConnection) startOperation(command string) {
+	if conn.op != nil {
+		conn.endOperation(0, errors.New(tr.Tr.Get("no status received")))
+	}
+
+	conn.opCommand = strings.SplitN(command, " ", 2)[0]
+	conn.opStart = time.Now()
+	_, conn.op = telemetry.StartClient(context.Background(), "ssh "+conn.opCommand,
+		telemetry.String("lfs.ssh.command", conn.opCommand),
+	)
+}
+
+// endOperation ends the span of the operation in progress, which received the
+// given status, or failed with err.
+func (conn *PktlineConnection) endOperation(status int, err error) {
+	if conn.op == nil {
+		return
+	}
+
+	attrs := []telemetry.Attribute{telemetry.String("lfs.ssh.command", conn.opCommand)}
+	sshDuration.Record(time.Since(conn.opStart), attrs...)
+	if err == nil {
+		conn.op.SetAttributes(telemetry.Int("lfs.ssh.status", int64(status)))
+		if status >= 400 {
+			err = errors.New(tr.Tr.Get("status %d", status))
+		}
+	}
+	if err != nil {
+		sshErrors.Add(1, attrs...)
+		conn.op.SetError(err)
+	}
+	conn.op.End()
+	conn.op = nil
 }
 
 func (conn *PktlineConnection) Lock() {
@@ -58,6 +114,7 @@ func (conn *PktlineConnection) negotiateVersion() error {
 			ok = true
 		}
 	}
+	conn.capabilities = pkts
 	if !ok {
 		return errors.NewProtocolError(tr.Tr.Get("Unable to negotiate version with remote side (missing version=1)"), nil)
 	}
@@ -79,7 +136,14 @@ func (conn *PktlineConnection) negotiateVersion() error {
 	return nil
 }
 
+// HasCapability returns whether the server advertised the named capability
+// when the connection was started.
+func (conn *PktlineConnection) HasCapability(name string) bool {
+	return slices.Contains(conn.capabilities, name)
+}
+
 func (conn *PktlineConnection) SendMessage(command string, args []string) error {
+	conn.startOperation(command)
 	err := conn.pl.WritePacketText(command)
 	if err != nil {
 		return err
@@ -94,6 +158,7 @@ func (conn *PktlineConnection) SendMessage(command string, args []string) error
 }
 
 func (conn *PktlineConnection) SendMessageWithLines(command string, args []string, lines []string) error {
+	conn.startOperation(command)
 	err := conn.pl.WritePacketText(command)
 	if err != nil {
 		return err
@@ -118,6 +183,7 @@ func (conn *PktlineConnection) SendMessageWithLines(command string, args []strin
 }
 
 func (conn *PktlineConnection) SendMessageWithData(command string, args []string, data io.Reader) error {
+	conn.startOperation(command)
 	err := conn.pl.WritePacketText(command)
 	if err != nil {
 		return err
@@ -149,6 +215,12 @@ func (conn *PktlineConnection) SendMessageWithData(command string, args []string
 }
 
 func (conn *PktlineConnection) ReadStatus() (int, error) {
+	status, err := conn.readStatus()
+	conn.endOperation(status, err)
+	return status, err
+}
+
+func (conn *PktlineConnection) readStatus() (int, error) {
 	status := 0
 	seenStatus := false
 	for {
@@ -181,6 +253,12 @@ func (conn *PktlineConnection) ReadStatus() (int, error) {
 // ReadStatusWithData reads a status, arguments, and any binary data.  Note that
 // the reader must be fully exhausted before invoking any other read methods.
 func (conn *PktlineConnection) ReadStatusWithData() (int, []string, io.Reader, error) {
+	status, args, r, err := conn.readStatusWithData()
+	conn.endOperation(status, err)
+	return status, args, r, err
+}
+
+func (conn *PktlineConnection) readStatusWithData() (int, []string, io.Reader, error) {
 	args := make([]string, 0, 100)
 	status := 0
 	seenStatus := false
@@ -216,6 +294,12 @@ func (conn *PktlineConnection) ReadStatusWithData() (int, []string, io.Reader, e
 
 // ReadStatusWithLines reads a status, arguments, and a set of text lines.
 func (conn *PktlineConnection) ReadStatusWithLines() (int, []string, []string, error) {
+	status, args, lines, err := conn.readStatusWithLines()
+	conn.endOperation(status, err)
+	return status, args, lines, err
+}
+
+func (conn *PktlineConnection) readStatusWithLines() (int, []string, []string, error) {
 	args := make([]string, 0, 100)
 	lines := make([]string, 0, 100)
 	status := 0
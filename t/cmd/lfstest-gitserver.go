@@ -7,9 +7,11 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -19,6 +21,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"math"
@@ -39,6 +42,7 @@ import (
 	"unicode"
 
 	"github.com/klauspost/compress/zstd"
+	"github.com/zeebo/blake3"
 )
 
 var (
@@ -63,9 +67,11 @@ var (
 		"status-storage-403", "status-storage-404", "status-storage-410", "status-storage-422", "status-storage-500", "status-storage-503",
 		"return-expired-action", "return-expired-action-forever", "return-invalid-size",
 		"object-authenticated", "storage-upload-retry", "storage-upload-retry-later", "storage-upload-retry-later-no-header", "unknown-oid",
+		"storage-upload-integrity",
 		"storage-download-corrupt",
 		"storage-download-retry-later", "storage-download-retry-later-no-header", "storage-download-retry",
 		"storage-download-retry-range", "storage-download-retry-range-rejected", "storage-download-retry-no-invalid-range",
+		"storage-download-expired-range",
 		"storage-download-encoding-gzip", "storage-download-encoding-zstd", "storage-download-encoding-zstd-retry-range",
 		"storage-download-encoding-zstd-1", "storage-download-encoding-zstd-2", "storage-download-encoding-zstd-3",
 		"send-verify-action", "send-deprecated-links", "redirect-storage-upload", "batch-hash-algo-empty", "batch-hash-algo-invalid",
@@ -204,6 +210,8 @@ type lfsLink struct {
 	Header    map[string]string `json:"header,omitempty"`
 	ExpiresAt time.Time         `json:"expires_at,omitempty"`
 	ExpiresIn int               `json:"expires_in,omitempty"`
+
+	IntegrityHeaders string `json:"integrity_headers,omitempty"`
 }
 
 type lfsError struct {
@@ -248,7 +256,7 @@ func lfsHandler(w http.ResponseWriter, r *http.Request, id string) {
 			return
 		}
 
-		if strings.HasSuffix(r.URL.String(), "batch") {
+		if strings.HasSuffix(r.URL.String(), "batch") && !strings.HasSuffix(r.URL.Path, "/locks/batch") {
 			lfsBatchHandler(w, r, id, repo)
 		} else {
 			locksHandler(w, r, repo)
@@ -377,10 +385,11 @@ func lfsDeleteHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 }
 
 type batchReq struct {
-	Transfers []string    `json:"transfers"`
-	Operation string      `json:"operation"`
-	Objects   []lfsObject `json:"objects"`
-	Ref       *Ref        `json:"ref,omitempty"`
+	Transfers     []string    `json:"transfers"`
+	Operation     string      `json:"operation"`
+	Objects       []lfsObject `json:"objects"`
+	Ref           *Ref        `json:"ref,omitempty"`
+	HashAlgorithm string      `json:"hash_algo,omitempty"`
 }
 
 func (r *batchReq) RefName() string {
@@ -475,6 +484,9 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 	var transferChoice string
 	var searchForTransfer string
 	hashAlgo := "sha256"
+	if objs.HashAlgorithm == "sha512" || objs.HashAlgorithm == "blake3" {
+		hashAlgo = objs.HashAlgorithm
+	}
 	if testingTus {
 		searchForTransfer = "tus"
 	} else if testingCustomTransfer {
@@ -553,7 +565,16 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 					Href:   lfsUrl(repo, obj.Oid, handler == "redirect-storage-upload"),
 					Header: map[string]string{},
 				}
+				if hashAlgo == "blake3" {
+					a.Href += "&hash_algo=blake3"
+				}
 				a = serveExpired(a, repo, handler)
+				if handler == "storage-download-expired-range" && action == "download" {
+					a = serveExpiring(a, repo, obj.Oid)
+				}
+				if handler == "storage-upload-integrity" && action == "upload" {
+					a.IntegrityHeaders = "Content-MD5, Digest, x-amz-checksum-sha256"
+				}
 
 				if handler == "send-deprecated-links" {
 					o.Links[action] = a
@@ -643,6 +664,61 @@ func serveExpired(a *lfsLink, repo, handler string) *lfsLink {
 	return a
 }
 
+// expiringTokens is a map keyed by resource key, valuing to the number of
+// download actions served for the object, and expiredTokens to the token of
+// the action which has expired, if any.
+var (
+	expiringTokens = map[string]int{}
+	expiredTokens  = map[string]string{}
+)
+
+// serveExpiring adds a new token to the given download action, so that the
+// storage handler can reject it once it has expired.
+func serveExpiring(a *lfsLink, repo, oid string) *lfsLink {
+	emu.Lock()
+	defer emu.Unlock()
+
+	key := getResourceKey("storage", "download", repo, oid)
+	expiringTokens[key]++
+	a.Href += "&token=" + strconv.Itoa(expiringTokens[key])
+	return a
+}
+
+// expireToken returns whether the token of the given request to resume a
+// download has expired. The token of the first such request expires
+// immediately, as if its signed URL had expired while the object was being
+// downloaded, whereas those of later actions do not.
+func expireToken(r *http.Request, repo, oid string) bool {
+	emu.Lock()
+	defer emu.Unlock()
+
+	key := getResourceKey("storage", "download", repo, oid)
+	token := r.URL.Query().Get("token")
+	if len(expiredTokens[key]) == 0 {
+		expiredTokens[key] = token
+	}
+	return expiredTokens[key] == token
+}
+
+// checkIntegrityHeaders returns an error unless the request carries each of the
+// integrity headers requested by the "storage-upload-integrity" handler, and
+// each matches the uploaded data.
+func checkIntegrityHeaders(r *http.Request, by []byte) error {
+	md5sum := md5.Sum(by)
+	sha256sum := sha256.Sum256(by)
+	want := map[string]string{
+		"Content-MD5":           base64.StdEncoding.EncodeToString(md5sum[:]),
+		"Digest":                "SHA-256=" + base64.StdEncoding.EncodeToString(sha256sum[:]),
+		"X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(sha256sum[:]),
+	}
+	for name, value := range want {
+		if got := r.Header.Get(name); got != value {
+			return fmt.Errorf("%s mismatch: got %q, want %q", name, got, value)
+		}
+	}
+	return nil
+}
+
 // canServeExpired returns whether or not a repository is capable of serving an
 // expired object. In other words, canServeExpired returns whether or not the
 // given repo has yet served an expired object.
@@ -738,8 +814,8 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 			if len(r.Header.Get("Authorization")) > 0 {
 				w.WriteHeader(400)
 				w.Write([]byte("Should not send authentication"))
+				return
 			}
-			return
 		case "storage-upload-retry":
 			if retries, ok := incrementRetriesFor("storage", "upload", repo, oid, false); ok && retries < 3 {
 				w.WriteHeader(500)
@@ -774,10 +850,17 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		hash := sha256.New()
+		hash := newOidHash(oid, r.URL.Query().Get("hash_algo"))
 		buf := &bytes.Buffer{}
 
 		io.Copy(io.MultiWriter(hash, buf), r.Body)
+		if oidHandlers[oid] == "storage-upload-integrity" {
+			if err := checkIntegrityHeaders(r, buf.Bytes()); err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte(err.Error()))
+				return
+			}
+		}
 		oid := hex.EncodeToString(hash.Sum(nil))
 		if !strings.HasSuffix(r.URL.Path, "/"+oid) {
 			w.WriteHeader(403)
@@ -796,6 +879,11 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 
 		if by, ok := largeObjects.Get(repo, oid); ok {
 			switch oidHandlers[oid] {
+			case "object-authenticated":
+				if len(r.Header.Get("Authorization")) > 0 {
+					statusCode = 400
+					by = []byte("Should not send authentication")
+				}
 			case "storage-download-corrupt":
 				// Since the object contents are entirely
 				// lowercase we can "invert" the case of each
@@ -825,6 +913,18 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 				byteLimit = len(oidHandlers[oid]) / 2
+			case "storage-download-expired-range":
+				// Interrupt the initial download, and reject the
+				// first attempt to resume it, as if its signed URL
+				// had expired.
+				if r.Header.Get("Range") != "" && expireToken(r, repo, oid) {
+					w.WriteHeader(403)
+					return
+				}
+				if handleRangeRequest(w, r, by) {
+					return
+				}
+				byteLimit = len(oidHandlers[oid]) / 2
 			case "storage-download-retry-range-rejected":
 				// Fail any Range: request even though we said we supported it
 				// To make sure client can fall back
@@ -1196,15 +1296,17 @@ type User struct {
 }
 
 type Lock struct {
-	Id       string    `json:"id"`
-	Path     string    `json:"path"`
-	Owner    User      `json:"owner"`
-	LockedAt time.Time `json:"locked_at"`
+	Id        string    `json:"id"`
+	Path      string    `json:"path"`
+	Owner     User      `json:"owner"`
+	LockedAt  time.Time `json:"locked_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
 }
 
 type LockRequest struct {
-	Path string `json:"path"`
-	Ref  *Ref   `json:"ref,omitempty"`
+	Path      string    `json:"path"`
+	Ref       *Ref      `json:"ref,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
 }
 
 func (r *LockRequest) RefName() string {
@@ -1236,10 +1338,56 @@ type UnlockResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+type RenewRequest struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Ref       *Ref      `json:"ref,omitempty"`
+}
+
+type LockBatchRequest struct {
+	Operation string    `json:"operation"`
+	Paths     []string  `json:"paths"`
+	Ref       *Ref      `json:"ref,omitempty"`
+	Atomic    bool      `json:"atomic,omitempty"`
+	Force     bool      `json:"force,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+func (r *LockBatchRequest) RefName() string {
+	if r.Ref == nil {
+		return ""
+	}
+	return r.Ref.Name
+}
+
+type LockBatchResult struct {
+	Path    string `json:"path"`
+	Lock    *Lock  `json:"lock,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type LockBatchResponse struct {
+	Results []LockBatchResult `json:"results"`
+	Message string            `json:"message,omitempty"`
+}
+
 type LockList struct {
-	Locks      []Lock `json:"locks"`
-	NextCursor string `json:"next_cursor,omitempty"`
-	Message    string `json:"message,omitempty"`
+	Locks      []Lock            `json:"locks"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Events     *LockEventChannel `json:"events,omitempty"`
+	Message    string            `json:"message,omitempty"`
+}
+
+// LockEventChannel is advertised in a LockList to clients which may watch for
+// changes to a repository's locks.
+type LockEventChannel struct {
+	Href string `json:"href"`
+}
+
+// LockEvent is a change to a lock, pushed as a line of JSON to clients watching
+// a repository's locks.
+type LockEvent struct {
+	Event string `json:"event"`
+	Lock  Lock   `json:"lock"`
 }
 
 type Ref struct {
@@ -1271,11 +1419,74 @@ var (
 	repoLocks = map[string][]Lock{}
 )
 
+var (
+	lsmu            sync.Mutex
+	lockSubscribers = map[string]map[chan LockEvent]bool{}
+)
+
+// subscribeLocks returns a channel to which changes to the locks of repo are
+// sent, and a function to stop sending them.
+func subscribeLocks(repo string) (chan LockEvent, func()) {
+	lsmu.Lock()
+	defer lsmu.Unlock()
+
+	ch := make(chan LockEvent, 16)
+	if lockSubscribers[repo] == nil {
+		lockSubscribers[repo] = make(map[chan LockEvent]bool)
+	}
+	lockSubscribers[repo][ch] = true
+
+	return ch, func() {
+		lsmu.Lock()
+		defer lsmu.Unlock()
+		delete(lockSubscribers[repo], ch)
+	}
+}
+
+// publishLocks sends a change of the given kind to each of the locks to the
+// clients watching the locks of repo.
+func publishLocks(repo, event string, locks ...Lock) {
+	lsmu.Lock()
+	defer lsmu.Unlock()
+
+	for ch := range lockSubscribers[repo] {
+		for _, l := range locks {
+			select {
+			case ch <- LockEvent{Event: event, Lock: l}:
+			default:
+			}
+		}
+	}
+}
+
+// streamLockEvents pushes each change to the locks of repo to the client as a
+// line of JSON, until it disconnects.
+func streamLockEvents(w http.ResponseWriter, r *http.Request, repo string) {
+	ch, unsubscribe := subscribeLocks(repo)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev := <-ch:
+			enc.Encode(ev)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
 func addLocks(repo string, l ...Lock) {
 	lmu.Lock()
 	defer lmu.Unlock()
 	repoLocks[repo] = append(repoLocks[repo], l...)
 	sort.Sort(LocksByCreatedAt(repoLocks[repo]))
+	publishLocks(repo, "locked", l...)
 }
 
 func getLocks(repo string) []Lock {
@@ -1353,9 +1564,100 @@ func delLock(repo string, id string) *Lock {
 		locks = append(locks, l)
 	}
 	repoLocks[repo] = locks
+	if deleted != nil {
+		publishLocks(repo, "unlocked", *deleted)
+	}
 	return deleted
 }
 
+func renewLock(repo string, id string, expiresAt time.Time) *Lock {
+	lmu.Lock()
+	defer lmu.Unlock()
+
+	for i, l := range repoLocks[repo] {
+		if l.Id == id {
+			repoLocks[repo][i].ExpiresAt = expiresAt
+			renewed := repoLocks[repo][i]
+			return &renewed
+		}
+	}
+	return nil
+}
+
+// batchLocks locks or unlocks each of the paths in req. If the request is
+// atomic and any path fails, none of them are locked or unlocked.
+func batchLocks(repo string, req *LockBatchRequest) []LockBatchResult {
+	lmu.Lock()
+	defer lmu.Unlock()
+
+	now := time.Now()
+	held := make(map[string]Lock)
+	for _, l := range repoLocks[repo] {
+		held[l.Path] = l
+	}
+
+	results := make([]LockBatchResult, len(req.Paths))
+	failed := false
+	for i, path := range req.Paths {
+		results[i].Path = path
+		l, ok := held[path]
+		switch {
+		case req.Operation == "lock" && ok && (l.ExpiresAt.IsZero() || now.Before(l.ExpiresAt)):
+			results[i].Lock = &l
+			results[i].Message = "lock already created"
+		case req.Operation == "lock":
+			var id [20]byte
+			rand.Read(id[:])
+			l = Lock{
+				Id:        fmt.Sprintf("%x", id[:]),
+				Path:      path,
+				Owner:     User{Name: "Git LFS Tests"},
+				LockedAt:  now,
+				ExpiresAt: req.ExpiresAt,
+			}
+			held[path] = l
+			results[i].Lock = &l
+			continue
+		case ok:
+			delete(held, path)
+			results[i].Lock = &l
+			continue
+		default:
+			results[i].Message = "unable to find lock"
+		}
+		failed = true
+	}
+
+	if failed && req.Atomic {
+		for i := range results {
+			if len(results[i].Message) == 0 {
+				results[i].Lock = nil
+				results[i].Message = "aborted because another path failed"
+			}
+		}
+		return results
+	}
+
+	locks := make([]Lock, 0, len(held))
+	for _, l := range held {
+		locks = append(locks, l)
+	}
+	sort.Sort(LocksByCreatedAt(locks))
+	repoLocks[repo] = locks
+
+	for _, result := range results {
+		if result.Lock == nil || len(result.Message) > 0 {
+			continue
+		}
+		if req.Operation == "lock" {
+			publishLocks(repo, "locked", *result.Lock)
+		} else {
+			publishLocks(repo, "unlocked", *result.Lock)
+		}
+	}
+	return results
+}
+
 type LocksByCreatedAt []Lock
 
 func (c LocksByCreatedAt) Len() int           { return len(c) }
@@ -1365,6 +1667,7 @@ func (c LocksByCreatedAt) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
 var (
 	lockRe   = regexp.MustCompile(`/locks/?$`)
 	unlockRe = regexp.MustCompile(`locks/([^/]+)/unlock\z`)
+	renewRe  = regexp.MustCompile(`locks/([^/]+)/renew\z`)
 )
 
 func locksHandler(w http.ResponseWriter, r *http.Request, repo string) {
@@ -1381,6 +1684,11 @@ func locksHandler(w http.ResponseWriter, r *http.Request, repo string) {
 
 	switch r.Method {
 	case "GET":
+		if strings.HasSuffix(r.URL.Path, "/locks/events") && strings.Contains(repo, "lock-events") {
+			streamLockEvents(w, r, repo)
+			return
+		}
+
 		if !lockRe.MatchString(r.URL.Path) {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusNotFound)
@@ -1419,6 +1727,18 @@ func locksHandler(w http.ResponseWriter, r *http.Request, repo string) {
 			ll.NextCursor = nextCursor
 		}
 
+		// Repositories whose names contain "lock-events" push changes
+		// to their locks to clients which ask for them.
+		if strings.Contains(repo, "lock-events") {
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			ll.Events = &LockEventChannel{
+				Href: fmt.Sprintf("%s://%s%s/events", scheme, r.Host, strings.TrimSuffix(r.URL.Path, "/")),
+			}
+		}
+
 		enc.Encode(ll)
 		return
 	case "POST":
@@ -1459,6 +1779,51 @@ func locksHandler(w http.ResponseWriter, r *http.Request, repo string) {
 			return
 		}
 
+		if matches := renewRe.FindStringSubmatch(r.URL.Path); len(matches) > 1 {
+			renewRequest := &RenewRequest{}
+			if err := dec.Decode(renewRequest); err != nil {
+				enc.Encode(&LockResponse{Message: err.Error()})
+				return
+			}
+
+			if l := renewLock(repo, matches[1], renewRequest.ExpiresAt); l != nil {
+				enc.Encode(&LockResponse{Lock: l})
+			} else {
+				enc.Encode(&LockResponse{Message: "unable to find lock"})
+			}
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/locks/batch") {
+			if strings.Contains(repo, "no-lock-batch") {
+				w.WriteHeader(http.StatusNotFound)
+				enc.Encode(&LockBatchResponse{Message: "not found"})
+				return
+			}
+
+			batchRequest := &LockBatchRequest{}
+			if err := dec.Decode(batchRequest); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				enc.Encode(&LockBatchResponse{Message: err.Error()})
+				return
+			}
+
+			if strings.HasSuffix(repo, "branch-required") {
+				parts := strings.Split(repo, "-")
+				lenParts := len(parts)
+				if lenParts > 3 && "refs/heads/"+parts[lenParts-3] != batchRequest.RefName() {
+					w.WriteHeader(403)
+					enc.Encode(struct {
+						Message string `json:"message"`
+					}{fmt.Sprintf("Expected ref %q, got %q", "refs/heads/"+parts[lenParts-3], batchRequest.RefName())})
+					return
+				}
+			}
+
+			enc.Encode(&LockBatchResponse{Results: batchLocks(repo, batchRequest)})
+			return
+		}
+
 		if strings.HasSuffix(r.URL.Path, "/locks/verify") {
 			if strings.HasSuffix(repo, "verify-5xx") {
 				w.WriteHeader(500)
@@ -1546,20 +1911,26 @@ func locksHandler(w http.ResponseWriter, r *http.Request, repo string) {
 			}
 
 			for _, l := range getLocks(repo) {
-				if l.Path == lockRequest.Path {
+				if l.Path != lockRequest.Path {
+					continue
+				}
+				if l.ExpiresAt.IsZero() || time.Now().Before(l.ExpiresAt) {
 					enc.Encode(&LockResponse{Message: "lock already created"})
 					return
 				}
+				// A lock whose lease has expired is released.
+				delLock(repo, l.Id)
 			}
 
 			var id [20]byte
 			rand.Read(id[:])
 
 			lock := &Lock{
-				Id:       fmt.Sprintf("%x", id[:]),
-				Path:     lockRequest.Path,
-				Owner:    User{Name: "Git LFS Tests"},
-				LockedAt: time.Now(),
+				Id:        fmt.Sprintf("%x", id[:]),
+				Path:      lockRequest.Path,
+				Owner:     User{Name: "Git LFS Tests"},
+				LockedAt:  time.Now(),
+				ExpiresAt: lockRequest.ExpiresAt,
 			}
 
 			addLocks(repo, *lock)
@@ -1832,6 +2203,18 @@ func skipIfBadAuth(w http.ResponseWriter, r *http.Request, id string) bool {
 	return true
 }
 
+// newOidHash returns a hash of the algorithm which produced the given OID,
+// as named by algo if it is given, or determined by its length otherwise.
+func newOidHash(oid, algo string) hash.Hash {
+	if algo == "blake3" {
+		return blake3.New()
+	}
+	if len(oid) == sha512.Size*2 {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
 func init() {
 	oidHandlers = make(map[string]string)
 	for _, content := range contentHandlers {
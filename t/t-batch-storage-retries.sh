@@ -177,6 +177,54 @@ begin_test "batch storage HTTP download retries after Range header rejected"
 )
 end_test
 
+begin_test "batch storage HTTP download refreshes expired action when resuming"
+(
+  set -e
+
+  reponame="batch-storage-download-expired-range"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \"\*.dat\"" track.log
+
+  # This content announces to the server that it should interrupt the first
+  # object download halfway, and then reject the first request to resume it,
+  # as if its signed URL had expired.
+  contents="storage-download-expired-range"
+  contents_oid=$(calc_oid "$contents")
+
+  printf "%s" "$contents" > a.dat
+  git add a.dat
+  git add .gitattributes
+  git commit -m "add a.dat"
+  git push origin main
+
+  assert_server_object "$reponame" "$contents_oid"
+
+  # Test object transfer download with an interrupted initial response,
+  # after which the retried download should fetch a fresh action for the
+  # object alone and use it to fetch the remaining bytes.
+  rm -rf .git/lfs/objects
+
+  GIT_TRACE=1 GIT_CURL_VERBOSE=1 git lfs fetch 2>&1 | tee fetch.log
+  if [ "0" -ne "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs fetch' to succeed ..."
+    exit 1
+  fi
+
+  [ "1" -eq "$(grep -c "tq: retrying object $contents_oid" fetch.log)" ]
+  grep "403 Forbidden" fetch.log
+  grep "tq: refreshing actions for \"$contents_oid\"" fetch.log
+  grep "xfer: refreshed expired \"download\" action for \"$contents_oid\"" fetch.log
+  [ "2" -eq "$(grep -c "Range: bytes=$((${#contents} / 2))-$((${#contents} - 1))" fetch.log)" ]
+  grep "xfer: server accepted resume .*$contents_oid" fetch.log
+
+  assert_local_object "$contents_oid" "${#contents}"
+)
+end_test
+
 begin_test "batch storage HTTP download retries without invalid Range header"
 (
   set -e
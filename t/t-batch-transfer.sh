@@ -65,6 +65,85 @@ begin_test "batch transfer"
 )
 end_test
 
+begin_test "batch transfer with rate limits"
+(
+  set -e
+
+  reponame="batch-transfer-rate-limits"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+
+  contents="$(printf "%02048d" 0)"
+  contents_oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git config lfs.transfer.maxUploadRate "fast"
+  git push origin main 2>&1 | tee push.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo "expected push to fail"
+    exit 1
+  fi
+  grep "invalid lfs.transfer.maxUploadRate value \"fast\"" push.log
+  refute_server_object "$reponame" "$contents_oid"
+
+  git config lfs.transfer.maxUploadRate "1 KB/s"
+  git push origin main 2>&1 | tee push.log
+  grep "Uploading LFS objects: 100% (1/1), 2.0 KB | .* (limited to 1.0 KB/s)" push.log
+  assert_server_object "$reponame" "$contents_oid"
+
+  rm -rf .git/lfs/objects
+  git config lfs.transfer.maxDownloadRate "1KB"
+  git lfs fetch 2>&1 | tee fetch.log
+  grep "(limited to 1.0 KB/s)" fetch.log
+  assert_local_object "$contents_oid" 2048
+
+  rm -rf .git/lfs/objects
+  git config lfs.transfer.rateLimitWindows "00:00-00:00"
+  git lfs fetch 2>&1 | tee fetch.log
+  [ 0 -eq "$(grep -c "limited to" fetch.log)" ]
+  assert_local_object "$contents_oid" 2048
+)
+end_test
+
+begin_test "batch transfer with adaptive concurrency"
+(
+  set -e
+
+  reponame="batch-transfer-adaptive-concurrency"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+
+  for i in 1 2 3 4 5; do
+    printf "%s" "$i" > "$i.dat"
+  done
+  git add .gitattributes *.dat
+  git commit -m "add files"
+
+  git config lfs.concurrenttransfers 1
+  git config lfs.transfer.adaptiveConcurrency true
+  git config lfs.transfer.maxConcurrentTransfers 3
+  GIT_TRACE=1 GIT_TRANSFER_TRACE=1 git push origin main 2>&1 | tee push.log
+  grep "xfer: adapter \"basic\" Begin() with 3 workers" push.log
+  grep "Uploading LFS objects: 100% (5/5)" push.log
+  for i in 1 2 3 4 5; do
+    assert_server_object "$reponame" "$(calc_oid "$i")"
+  done
+
+  rm -rf .git/lfs/objects
+  GIT_TRACE=1 GIT_TRANSFER_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "xfer: adapter \"basic\" Begin() with 3 workers" fetch.log
+  for i in 1 2 3 4 5; do
+    assert_local_object "$(calc_oid "$i")" 1
+  done
+)
+end_test
+
 begin_test "batch transfers occur in reverse order by size"
 (
   set -e
@@ -142,6 +221,70 @@ begin_test "batch transfers fail with an unknown hash algorithm"
 )
 end_test
 
+begin_test "batch transfers with the sha512 hash algorithm"
+(
+  set -e
+
+  reponame="batch-test-sha512-algo"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.hashAlgorithm sha512
+  git lfs track "*.dat"
+
+  contents="sha512"
+  contents_oid="$(printf "%s" "$contents" | $SHA512SUM | cut -f 1 -d " ")"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git cat-file -p :a.dat | grep "oid sha512:$contents_oid"
+
+  GIT_CURL_VERBOSE=1 git push origin main 2>&1 | tee push.log
+  grep '"hash_algo":"sha512"' push.log
+  assert_server_object "$reponame" "$contents_oid"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone"
+  git lfs pull
+  [ "$contents" = "$(cat a.dat)" ]
+)
+end_test
+
+begin_test "batch transfers with the blake3 hash algorithm"
+(
+  set -e
+
+  reponame="batch-test-blake3-algo"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.hashAlgorithm blake3
+  git lfs track "*.dat"
+
+  # BLAKE3 object IDs have the same length as SHA-256 ones, so the algorithm
+  # must be taken from the pointer rather than guessed.
+  contents="blake3"
+  contents_oid="aca4f0133c931ea1d8420a3a9b96d7a15ef245b1755224d80db917cee17c86c7"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git cat-file -p :a.dat | grep "oid blake3:$contents_oid"
+  git lfs fsck
+
+  GIT_CURL_VERBOSE=1 git push origin main 2>&1 | tee push.log
+  grep '"hash_algo":"blake3"' push.log
+  assert_server_object "$reponame" "$contents_oid"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone"
+  git lfs pull
+  [ "$contents" = "$(cat a.dat)" ]
+  git lfs fsck
+)
+end_test
+
 begin_test "batch transfers with ssh endpoint (git-lfs-authenticate)"
 (
   set -e
@@ -0,0 +1,138 @@
+#!/usr/bin/env bash
+
+. "$(dirname "$0")/testlib.sh"
+
+# start_cache_server starts a cache server storing objects in the directory
+# "$1", run from the current repository so that its Git LFS endpoint's host is
+# allowed, and sets cacheurl and cachepid.
+start_cache_server() {
+  local dir="$1"
+
+  git lfs cache-server --listen 127.0.0.1:0 --dir "$dir" >cache-server.log 2>&1 &
+  cachepid=$!
+
+  for i in $(seq 1 50); do
+    cacheurl="$(sed -n 's/^Serving Git LFS cache in .* at \(http:.*\)$/\1/p' cache-server.log)"
+    [ -n "$cacheurl" ] && return 0
+    sleep 0.1
+  done
+
+  cat cache-server.log
+  kill "$cachepid"
+  exit 1
+}
+
+# cached_object_path prints the path at which the cache server storing objects
+# in "$1" keeps the object with OID "$2".
+cached_object_path() {
+  local dir="$1"
+  local oid="$2"
+
+  echo "$dir/objects/${oid:0:2}/${oid:2:2}/$oid"
+}
+
+begin_test "cache server: download through and from cache"
+(
+  set -e
+
+  reponame="cache-server-download"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="object-authenticated"
+  contents_oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin main
+
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone1"
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone2"
+
+  cd "$TRASHDIR/$reponame-clone1"
+  cachedir="$TRASHDIR/$reponame-cache"
+  start_cache_server "$cachedir"
+  trap 'kill "$cachepid"' EXIT
+
+  git config lfs.cacheServer "$cacheurl"
+  git lfs pull
+  [ "$contents" = "$(cat a.dat)" ]
+
+  cached="$(cached_object_path "$cachedir" "$contents_oid")"
+  [ -f "$cached" ]
+  [ "$contents" = "$(cat "$cached")" ]
+
+  cd "$TRASHDIR/$reponame-clone2"
+  git config lfs.cacheServer "$cacheurl"
+  GIT_TRACE=1 git lfs pull 2>&1 | tee pull.log
+  grep "cache server has 1 of 1 object(s)" pull.log
+  [ "$contents" = "$(cat a.dat)" ]
+)
+end_test
+
+begin_test "cache server: objects needing credentials are not downloaded through cache"
+(
+  set -e
+
+  reponame="cache-server-credentials"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="needs credentials"
+  contents_oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin main
+
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone"
+
+  cachedir="$TRASHDIR/$reponame-cache"
+  start_cache_server "$cachedir"
+  trap 'kill "$cachepid"' EXIT
+
+  git config lfs.cacheServer "$cacheurl"
+  git lfs pull
+  [ "$contents" = "$(cat a.dat)" ]
+
+  [ ! -e "$(cached_object_path "$cachedir" "$contents_oid")" ]
+)
+end_test
+
+begin_test "cache server: sources on other hosts are refused"
+(
+  set -eo pipefail
+
+  reponame="cache-server-other-host"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="object-authenticated"
+  contents_oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin main
+
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone"
+
+  # Started outside of any repository, the cache server is allowed no hosts.
+  mkdir "$TRASHDIR/$reponame-elsewhere"
+  cd "$TRASHDIR/$reponame-elsewhere"
+  cachedir="$TRASHDIR/$reponame-cache"
+  start_cache_server "$cachedir"
+  trap 'kill "$cachepid"' EXIT
+  grep "warning: no source hosts are allowed" cache-server.log
+
+  cd "$TRASHDIR/$reponame-clone"
+  git config lfs.cacheServer "$cacheurl"
+  git config lfs.transfer.maxretries 1
+  GIT_TRACE=1 git lfs pull 2>&1 | tee pull.log && exit 1
+  grep 'Source host "127.0.0.1:[0-9]*" is not allowed' pull.log
+
+  [ ! -e "$(cached_object_path "$cachedir" "$contents_oid")" ]
+)
+end_test
@@ -0,0 +1,154 @@
+#!/usr/bin/env bash
+
+. "$(dirname "$0")/testlib.sh"
+
+begin_test "events: push and fetch"
+(
+  set -e
+
+  reponame="events-push-fetch"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="events"
+  oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  GIT_LFS_EVENTS="$TRASHDIR/push.jsonl" git push origin main
+  assert_server_object "$reponame" "$oid"
+
+  grep '"event":"scan_started","time":"[^"]*","scan":"range-to-remote"' "$TRASHDIR/push.jsonl"
+  grep '"event":"scan_finished",.*"scan":"range-to-remote","objects":1' "$TRASHDIR/push.jsonl"
+  grep "\"event\":\"object_queued\",.*\"direction\":\"upload\",\"oid\":\"$oid\",\"path\":\"a.dat\",\"size\":6" "$TRASHDIR/push.jsonl"
+  grep "\"event\":\"object_started\",.*\"oid\":\"$oid\",\"path\":\"a.dat\"" "$TRASHDIR/push.jsonl"
+  grep "\"event\":\"object_progress\",.*\"oid\":\"$oid\",\"path\":\"a.dat\",\"size\":6,\"bytes\":6" "$TRASHDIR/push.jsonl"
+  grep "\"event\":\"object_completed\",.*\"oid\":\"$oid\"" "$TRASHDIR/push.jsonl"
+  grep '"event":"task_updated",.*"message":"Uploading LFS objects: 100% (1/1)' "$TRASHDIR/push.jsonl"
+
+  # The server has the object already.
+  GIT_LFS_EVENTS="$TRASHDIR/push-again.jsonl" git lfs push --object-id origin "$oid"
+  grep "\"event\":\"object_skipped\",.*\"oid\":\"$oid\"" "$TRASHDIR/push-again.jsonl"
+
+  rm -rf .git/lfs/objects
+  GIT_LFS_EVENTS="$TRASHDIR/fetch.jsonl" git lfs fetch
+  assert_local_object "$oid" "${#contents}"
+
+  grep "\"event\":\"object_queued\",.*\"direction\":\"download\",\"oid\":\"$oid\"" "$TRASHDIR/fetch.jsonl"
+  grep "\"event\":\"object_completed\",.*\"direction\":\"download\",\"oid\":\"$oid\"" "$TRASHDIR/fetch.jsonl"
+)
+end_test
+
+begin_test "events: retries and failures"
+(
+  set -e
+
+  reponame="events-retries"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="storage-upload-retry"
+  oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  GIT_LFS_EVENTS="$TRASHDIR/push.jsonl" git push origin main
+  assert_server_object "$reponame" "$oid"
+
+  grep "\"event\":\"object_retried\",.*\"oid\":\"$oid\",\"path\":\"a.dat\",.*\"retry\":1,\"error\":\"" "$TRASHDIR/push.jsonl"
+  grep "\"event\":\"object_completed\",.*\"oid\":\"$oid\"" "$TRASHDIR/push.jsonl"
+
+  # The server does not have this object.
+  contents="missing"
+  oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > b.dat
+  git add b.dat
+  git commit -m "add unpushed object"
+
+  rm -rf .git/lfs/objects
+  GIT_LFS_EVENTS="$TRASHDIR/fetch.jsonl" git lfs fetch origin HEAD && exit 1
+  grep "\"event\":\"object_failed\",.*\"direction\":\"download\",\"oid\":\"$oid\",\"path\":\"b.dat\",.*\"error\":\"" "$TRASHDIR/fetch.jsonl"
+)
+end_test
+
+begin_test "events: lock and unlock"
+(
+  set -e
+
+  reponame="events-locks"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  GIT_LFS_EVENTS="$TRASHDIR/lock.jsonl" git lfs lock --json "a.dat" | tee lock.json
+  id=$(assert_lock lock.json a.dat)
+  grep "\"event\":\"lock_created\",.*\"path\":\"a.dat\",\"lock_id\":\"$id\",\"owner\":\"Git LFS Tests\"" "$TRASHDIR/lock.jsonl"
+
+  GIT_LFS_EVENTS="$TRASHDIR/lock.jsonl" git lfs lock "a.dat" && exit 1
+  grep '"event":"lock_created",.*"path":"a.dat","error":"' "$TRASHDIR/lock.jsonl"
+
+  GIT_LFS_EVENTS="$TRASHDIR/unlock.jsonl" git lfs unlock "a.dat"
+  grep "\"event\":\"lock_deleted\",.*\"path\":\"a.dat\",\"lock_id\":\"$id\",\"owner\":\"Git LFS Tests\"" "$TRASHDIR/unlock.jsonl"
+)
+end_test
+
+begin_test "events: invalid destination"
+(
+  set -e
+
+  reponame="events-invalid"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  GIT_LFS_EVENTS="events.jsonl" git lfs env 2>&1 | tee env.log
+  grep "Error writing events: GIT_LFS_EVENTS must be a file descriptor or an absolute path" env.log
+
+  GIT_LFS_EVENTS=1 git lfs env 2>&1 | tee env.log
+  grep "Error writing events: GIT_LFS_EVENTS must not be standard input or output" env.log
+)
+end_test
+
+begin_test "events: checkout through the filters"
+(
+  set -e
+
+  reponame="events-checkout"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="events-checkout"
+  oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+  git push origin main
+  assert_server_object "$reponame" "$oid"
+
+  # The filters' standard output carries file contents to Git, so no
+  # events may be written to it, even by the transfers they start.
+  cd ..
+  GIT_LFS_EVENTS=1 git clone "$GITSERVER/$reponame" "$reponame-clone"
+  cd "$reponame-clone"
+  [ "$contents" = "$(cat a.dat)" ]
+  assert_local_object "$oid" "${#contents}"
+
+  rm -rf .git/lfs/objects a.dat
+  GIT_LFS_EVENTS=1 git checkout -- a.dat
+  [ "$contents" = "$(cat a.dat)" ]
+
+  rm -rf .git/lfs/objects a.dat
+  GIT_LFS_EVENTS="$TRASHDIR/checkout.jsonl" git checkout -- a.dat
+  [ "$contents" = "$(cat a.dat)" ]
+  # Only the post-checkout hook may have written events.
+  touch "$TRASHDIR/checkout.jsonl"
+  grep "object_" "$TRASHDIR/checkout.jsonl" && exit 1
+  true
+)
+end_test
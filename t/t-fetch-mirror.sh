@@ -0,0 +1,97 @@
+#!/usr/bin/env bash
+
+. "$(dirname "$0")/testlib.sh"
+
+reponame="$(basename "$0" ".sh")"
+mirrorname="$reponame-mirror"
+
+contents_a="a"
+contents_a_oid=$(calc_oid "$contents_a")
+contents_b="b"
+contents_b_oid=$(calc_oid "$contents_b")
+
+begin_test "init for fetch mirror tests"
+(
+  set -e
+
+  setup_remote_repo "$reponame"
+  setup_remote_repo "$mirrorname"
+
+  clone_repo "$reponame" repo
+  git remote add mirror "$GITSERVER/$mirrorname"
+
+  git lfs track "*.dat"
+  printf "%s" "$contents_a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  # The mirror only has the first object.
+  git push mirror main
+  assert_server_object "$mirrorname" "$contents_a_oid"
+
+  printf "%s" "$contents_b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+
+  git push origin main
+  assert_server_object "$reponame" "$contents_a_oid"
+  assert_server_object "$reponame" "$contents_b_oid"
+  refute_server_object "$mirrorname" "$contents_b_oid"
+)
+end_test
+
+begin_test "fetch from mirror"
+(
+  set -e
+
+  clone_repo "$reponame" clone-mirror
+  rm -rf .git/lfs/objects
+
+  git config lfs.origin.mirrors "$GITSERVER/$mirrorname.git/info/lfs"
+
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "tq: mirror $GITSERVER/$mirrorname.git/info/lfs has 1 of 2 object(s)" fetch.log
+  grep "Downloading LFS objects: 100% (2/2), 2 B" fetch.log
+
+  assert_local_object "$contents_a_oid" 1
+  assert_local_object "$contents_b_oid" 1
+)
+end_test
+
+begin_test "fetch with unavailable mirror"
+(
+  set -e
+
+  clone_repo "$reponame" clone-unavailable
+  rm -rf .git/lfs/objects
+
+  git config lfs.transfer.maxretries 1
+  git config lfs.origin.mirrors "http://127.0.0.1:1/lfs,$GITSERVER/$mirrorname.git/info/lfs"
+
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "tq: mirror http://127.0.0.1:1/lfs unavailable" fetch.log
+  grep "tq: mirror $GITSERVER/$mirrorname.git/info/lfs has 1 of 2 object(s)" fetch.log
+
+  assert_local_object "$contents_a_oid" 1
+  assert_local_object "$contents_b_oid" 1
+)
+end_test
+
+begin_test "push does not use mirror"
+(
+  set -e
+
+  cd repo
+  git config lfs.origin.mirrors "$GITSERVER/$mirrorname.git/info/lfs"
+
+  printf "c" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+
+  GIT_TRACE=1 git push origin main 2>&1 | tee push.log
+  grep "tq: mirror" push.log && exit 1
+
+  assert_server_object "$reponame" "$(calc_oid "c")"
+  refute_server_object "$mirrorname" "$(calc_oid "c")"
+)
+end_test
@@ -881,3 +881,43 @@ begin_test "fetch fails when LFS directory has wrong permissions"
   grep "error trying to create local storage directory" fetch.log
 )
 end_test
+
+begin_test "fetch --resume"
+(
+  set -e
+
+  reponame="fetch-resume"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  good="good"
+  good_oid="$(calc_oid "$good")"
+  missing="missing"
+  missing_oid="$(calc_oid "$missing")"
+  printf "%s" "$good" > good.dat
+  printf "%s" "$missing" > missing.dat
+  git add .gitattributes good.dat missing.dat
+  git commit -m "add objects"
+  git push origin main
+  delete_server_object "$reponame" "$missing_oid"
+
+  rm -rf .git/lfs/objects
+  git lfs fetch >fetch.log 2>&1 && exit 1
+  assert_local_object "$good_oid" 4
+  refute_local_object "$missing_oid"
+
+  journal=".git/lfs/journal/download-origin"
+  grep "^completed $good_oid 4$" "$journal"
+
+  GIT_CURL_VERBOSE=1 git lfs fetch --refetch --resume >fetch.log 2>&1 && exit 1
+  batch="$(grep "{\"operation\":\"download\"" fetch.log | head -1)"
+  echo "$batch" | grep "$missing_oid"
+  echo "$batch" | grep -v "$good_oid"
+
+  git rm missing.dat
+  git commit -m "remove missing object"
+  git lfs fetch --refetch --resume
+  [ ! -e "$journal" ]
+)
+end_test
@@ -0,0 +1,215 @@
+#!/usr/bin/env bash
+
+. "$(dirname "$0")/testlib.sh"
+
+# lock-watch can only watch the working tree on Linux, so each test is skipped
+# elsewhere.
+
+# start_lock_watch runs `git lfs lock-watch` in the background with the given
+# arguments, logging to watch.log, and waits until it is watching the working
+# tree. The daemon is killed when the calling subshell exits.
+start_lock_watch() {
+  git lfs lock-watch "$@" >watch.log 2>&1 &
+  watchpid=$!
+  trap 'kill "$watchpid" 2>/dev/null || true' EXIT
+
+  wait_for_watch_log "Watching"
+}
+
+# wait_for_watch_log waits for up to ten seconds for the given pattern to
+# appear in watch.log.
+wait_for_watch_log() {
+  local pattern="$1"
+
+  for i in $(seq 1 50); do
+    if grep -q "$pattern" watch.log; then
+      return 0
+    fi
+    sleep 0.2
+  done
+
+  cat watch.log
+  echo >&2 "fatal: expected \"$pattern\" in lock-watch output"
+  return 1
+}
+
+begin_test "lock-watch: locks lockable files as they are edited"
+(
+  set -e
+
+  [ "$(uname -s)" = "Linux" ] || exit 0
+
+  reponame="lock-watch-edit"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track --lockable "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.txt
+  git add .gitattributes a.dat b.txt
+  git commit -m "initial commit"
+  git push origin main
+
+  start_lock_watch
+
+  echo "b changed" > b.txt
+  chmod u+w a.dat
+  wait_for_watch_log "Locked a.dat"
+
+  echo "a changed" > a.dat
+  sleep 1
+
+  [ "1" -eq "$(grep -c "Locked" watch.log)" ]
+
+  git lfs locks 2>&1 | tee locks.log
+  [ "1" -eq "$(grep -c "a.dat" locks.log)" ]
+  [ "0" -eq "$(grep -c "b.txt" locks.log)" ]
+)
+end_test
+
+begin_test "lock-watch: ignores files written by git"
+(
+  set -e
+
+  [ "$(uname -s)" = "Linux" ] || exit 0
+
+  reponame="lock-watch-checkout"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.setlockablereadonly false
+
+  git lfs track --lockable "*.dat"
+  echo "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+  git push origin main
+
+  git checkout -b other
+  echo "other" > a.dat
+  git add a.dat
+  git commit -m "change a.dat"
+
+  start_lock_watch
+
+  git checkout main
+  git checkout other
+  sleep 1
+
+  echo "edited" > a.dat
+  wait_for_watch_log "Locked a.dat"
+
+  [ "1" -eq "$(grep -c "Locked" watch.log)" ]
+)
+end_test
+
+begin_test "lock-watch: reports locks held by someone else"
+(
+  set -e
+
+  [ "$(uname -s)" = "Linux" ] || exit 0
+
+  reponame="lock-watch-conflict"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.setlockablereadonly false
+
+  git lfs track --lockable "*.dat"
+  echo "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+  git push origin main
+
+  clone_repo "$reponame" "$reponame-other"
+  git lfs lock a.dat
+
+  cd "../$reponame"
+  start_lock_watch --notify-command='echo "notified: "%m >> notify.log'
+
+  echo "a changed" > a.dat
+  wait_for_watch_log "a.dat is locked by Git LFS Tests"
+
+  grep "notified: a.dat is locked by Git LFS Tests" notify.log
+  [ "0" -eq "$(grep -c "Locked a.dat" watch.log)" ]
+)
+end_test
+
+begin_test "lock-watch: releases locks once changes are pushed"
+(
+  set -e
+
+  [ "$(uname -s)" = "Linux" ] || exit 0
+
+  reponame="lock-watch-release"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.setlockablereadonly false
+
+  git lfs track --lockable "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "initial commit"
+  git push origin main
+
+  start_lock_watch --release-on-push
+
+  echo "a changed" > a.dat
+  echo "b changed" > b.dat
+  wait_for_watch_log "Locked a.dat"
+  wait_for_watch_log "Locked b.dat"
+
+  git add a.dat
+  git commit -m "change a.dat"
+  git push origin main
+
+  wait_for_watch_log "Released lock on a.dat"
+
+  git lfs locks 2>&1 | tee locks.log
+  [ "0" -eq "$(grep -c "a.dat" locks.log)" ]
+  grep "b.dat" locks.log
+  [ "0" -eq "$(grep -c "Released lock on b.dat" watch.log)" ]
+)
+end_test
+
+begin_test "lock-watch: started from a subdirectory"
+(
+  set -e
+
+  [ "$(uname -s)" = "Linux" ] || exit 0
+
+  reponame="lock-watch-subdir"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.setlockablereadonly false
+
+  git lfs track --lockable "*.dat"
+  mkdir sub
+  echo "a" > a.dat
+  echo "b" > sub/b.dat
+  git add .gitattributes a.dat sub/b.dat
+  git commit -m "initial commit"
+  git push origin main
+
+  cd sub
+  start_lock_watch --release-on-push
+
+  echo "a changed" > ../a.dat
+  echo "b changed" > b.dat
+  wait_for_watch_log "Locked a.dat"
+  wait_for_watch_log "Locked sub/b.dat"
+
+  git add b.dat
+  git commit -m "change sub/b.dat"
+  git push origin main
+
+  wait_for_watch_log "Released lock on sub/b.dat"
+
+  git lfs locks 2>&1 | tee locks.log
+  [ "0" -eq "$(grep -c "sub/b.dat" locks.log)" ]
+  grep "a.dat" locks.log
+)
+end_test
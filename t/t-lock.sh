@@ -437,3 +437,209 @@ begin_test "lock with git-lfs-transfer"
   assert_server_lock_ssh "$reponame" "$id" "refs/heads/main"
 )
 end_test
+
+begin_test "lock with ttl"
+(
+  set -e
+
+  reponame="lock-with-ttl"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+
+  git lfs lock --ttl 1h "a.dat" | tee lock.log
+  grep "Locked a.dat until" lock.log
+
+  git lfs locks --json | tee locks.json
+  grep '"expires_at":' locks.json
+
+  git lfs lock --ttl -1h "a.dat" 2>&1 | tee lock.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs lock --ttl -1h' to fail"
+    exit 1
+  fi
+  grep "Invalid lock lease: -1h0m0s" lock.log
+)
+end_test
+
+begin_test "lock multiple files with a glob"
+(
+  set -e
+
+  reponame="lock-multiple-files-glob"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  mkdir sub
+  echo "a" > a.dat
+  echo "b" > sub/b.dat
+  echo "c" > sub/c.txt
+  git add .gitattributes a.dat sub
+  git commit -m "add files"
+
+  GIT_TRACE=1 git lfs lock "*.dat" 2>&1 | tee lock.log
+  grep "Locked a.dat" lock.log
+  grep "Locked sub/b.dat" lock.log
+  grep "lfs.locks.batch" lock.log
+  grep "Locked sub/c.txt" lock.log && exit 1
+
+  cd sub
+  git lfs lock --json "*.txt" | tee lock.json
+  id=$(assert_lock lock.json sub/c.txt)
+  assert_server_lock "$reponame" "$id"
+
+  git lfs lock "*.psd" 2>&1 | tee lock.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs lock *.psd' to fail"
+    exit 1
+  fi
+  grep "no paths match" lock.log
+)
+end_test
+
+begin_test "lock multiple files from stdin"
+(
+  set -e
+
+  reponame="lock-multiple-files-stdin"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add dat files"
+
+  printf "a.dat\n\nb.dat\na.dat\n" | git lfs lock --stdin --json | tee lock.json
+  grep -E '\[\{"id":"[^"]+","path":"a\.dat",[^]]*\},\{"id":"[^"]+","path":"b\.dat",[^]]*\}\]' lock.json
+  [ 2 -eq "$(git lfs locks | wc -l)" ]
+)
+end_test
+
+begin_test "lock multiple files atomically"
+(
+  set -e
+
+  reponame="lock-multiple-files-atomic"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.dat
+  echo "c" > c.dat
+  git add .gitattributes a.dat b.dat c.dat
+  git commit -m "add dat files"
+
+  git lfs lock b.dat
+
+  git lfs lock --atomic --json a.dat b.dat c.dat 2>lock.log | tee lock.json
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs lock --atomic' to fail"
+    exit 1
+  fi
+  grep '{"path":"a.dat","locked":false,"reason":"server unable to create lock: aborted because another path failed"}' lock.json
+  grep '{"path":"b.dat","locked":false,"reason":"server unable to create lock: lock already created"}' lock.json
+  grep '{"path":"c.dat","locked":false,"reason":"server unable to create lock: aborted because another path failed"}' lock.json
+  grep "Locking b.dat failed: server unable to create lock: lock already created" lock.log
+  [ 1 -eq "$(git lfs locks | wc -l)" ]
+
+  git lfs lock --json a.dat b.dat c.dat 2>lock.log | tee lock.json
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs lock' to fail"
+    exit 1
+  fi
+  assert_lock lock.json a.dat
+  assert_lock lock.json c.dat
+  grep '{"path":"b.dat","locked":false,"reason":"server unable to create lock: lock already created"}' lock.json
+  grep "Locking b.dat failed" lock.log
+  [ 3 -eq "$(git lfs locks | wc -l)" ]
+)
+end_test
+
+begin_test "lock multiple files without batch support"
+(
+  set -e
+
+  reponame="lock-no-lock-batch"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.dat
+  echo "c" > c.dat
+  git add .gitattributes a.dat b.dat c.dat
+  git commit -m "add dat files"
+
+  git lfs lock b.dat
+
+  GIT_TRACE=1 git lfs lock --atomic a.dat b.dat c.dat 2>&1 | tee lock.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs lock --atomic' to fail"
+    exit 1
+  fi
+  grep "batch locking not supported by server" lock.log
+  grep "Locking a.dat failed: aborted because another path failed" lock.log
+  grep "Locking c.dat failed: aborted because another path failed" lock.log
+  [ 1 -eq "$(git lfs locks | wc -l)" ]
+
+  git lfs lock a.dat c.dat | tee lock.log
+  grep "Locked a.dat" lock.log
+  grep "Locked c.dat" lock.log
+  [ 3 -eq "$(git lfs locks | wc -l)" ]
+)
+end_test
+
+begin_test "lock queued while server is unreachable"
+(
+  set -e
+
+  reponame="lock-queued-offline"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.queuelocksoffline true
+  git config lfs.url "http://127.0.0.1:1/$reponame.git/info/lfs"
+
+  git lfs lock a.dat 2>&1 | tee lock.log
+  grep "Queued lock on a.dat until the server can be reached" lock.log
+
+  git lfs lock --json a.dat 2>lock.log | tee lock.json
+  [ '[{"path":"a.dat","locked":false,"pending":true}]' = "$(cat lock.json)" ]
+
+  git lfs locks --local | tee locks.log
+  grep "a.dat.*(pending lock)" locks.log
+
+  git config --unset lfs.url
+  git lfs locks | tee locks.log
+  [ 1 -eq "$(wc -l < locks.log)" ]
+  grep "a.dat.*(pending lock)" locks.log
+
+  git lfs locks --sync | tee sync.log
+  grep "Locked a.dat" sync.log
+  git lfs locks | tee locks.log
+  grep "a.dat.*Git LFS Tests" locks.log
+  [ 0 -eq "$(grep -c "pending" locks.log)" ]
+)
+end_test
+
+begin_test "lock not queued by default"
+(
+  set -e
+
+  reponame="lock-not-queued-offline"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.url "http://127.0.0.1:1/$reponame.git/info/lfs"
+
+  git lfs lock a.dat 2>&1 | tee lock.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs lock' to fail"
+    exit 1
+  fi
+  grep "Locking a.dat failed" lock.log
+  [ -z "$(git lfs locks --local)" ]
+)
+end_test
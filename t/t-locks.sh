@@ -350,3 +350,217 @@ begin_test "cached locks with failed lock"
   [ $(wc -l < locks.log) -eq 0 ]
 )
 end_test
+
+begin_test "renew locks"
+(
+  set -e
+
+  reponame="locks-renew"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs lock --json --ttl 1h "a.dat" | tee lock.log
+  id=$(assert_lock lock.log a.dat)
+  before=$(grep -o '"expires_at":"[^"]*"' lock.log)
+  [ -n "$before" ]
+
+  git lfs locks --renew --ttl 48h | tee renew.log
+  grep "Renewed lock on a.dat until" renew.log
+
+  git lfs locks --json | tee locks.json
+  grep "\"id\":\"$id\"" locks.json
+  after=$(grep -o '"expires_at":"[^"]*"' locks.json)
+  [ -n "$after" ]
+  [ "$before" != "$after" ]
+  grep "expires " <(git lfs locks)
+
+  # A lock which never expires is only renewed if it is chosen explicitly.
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git push origin main
+  git lfs lock "b.dat"
+
+  git lfs locks --renew --ttl 48h | tee renew.log
+  grep "Renewed lock on a.dat until" renew.log
+  grep "b.dat" renew.log && exit 1
+
+  git lfs locks --renew --ttl 48h --path "b.dat" | tee renew.log
+  grep "Renewed lock on b.dat until" renew.log
+  grep "a.dat" renew.log && exit 1
+
+  git lfs locks --renew 2>&1 | tee renew.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs locks --renew' to fail"
+    exit 1
+  fi
+  grep -- "--renew option requires a positive --ttl" renew.log
+)
+end_test
+
+begin_test "list expired locks"
+(
+  set -e
+
+  reponame="locks-expired"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs lock --ttl 1s "a.dat"
+  sleep 2
+
+  [ -z "$(git lfs locks)" ]
+  [ -z "$(git lfs locks --local)" ]
+
+  git lfs locks --expired | tee locks.log
+  [ $(wc -l < locks.log) -eq 1 ]
+  grep "a.dat" locks.log
+  grep "expired " locks.log
+
+  # An expired lock does not prevent the file from being locked again.
+  git lfs lock "a.dat" | tee lock.log
+  grep "Locked a.dat" lock.log
+  git lfs locks | tee locks.log
+  [ $(wc -l < locks.log) -eq 1 ]
+  grep -v "expire" locks.log
+)
+end_test
+
+begin_test "locks --sync reports conflicts"
+(
+  set -e
+
+  reponame="locks-sync-conflict"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.queuelocksoffline true
+  git config lfs.url "http://127.0.0.1:1/$reponame.git/info/lfs"
+  git lfs lock a.dat | grep "Queued lock on a.dat"
+
+  git lfs locks --sync 2>&1 | tee sync.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs locks --sync' to fail while unreachable"
+    exit 1
+  fi
+  grep "Unable to reach the server; 1 locks or unlocks are still queued" sync.log
+  grep "a.dat.*(pending lock)" <(git lfs locks --local)
+
+  clone_repo "$reponame" "$reponame-other"
+  git lfs lock a.dat
+
+  cd "../$reponame"
+  git config --unset lfs.url
+  git lfs locks --sync 2>&1 | tee sync.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs locks --sync' to report a conflict"
+    exit 1
+  fi
+  grep "Locking a.dat failed: already locked by Git LFS Tests" sync.log
+  [ 0 -eq "$(git lfs locks --local | wc -l)" ]
+
+  git lfs locks --sync | tee sync.log
+  grep "No queued locks or unlocks" sync.log
+)
+end_test
+
+# wait_for_log waits for up to ten seconds for the given pattern to appear in
+# the given file.
+wait_for_log() {
+  local pattern="$1" file="$2"
+
+  for i in $(seq 1 50); do
+    if grep -q "$pattern" "$file"; then
+      return 0
+    fi
+    sleep 0.2
+  done
+
+  cat "$file"
+  echo >&2 "fatal: expected \"$pattern\" in $file"
+  return 1
+}
+
+begin_test "locks --wait acquires the lock once it is released"
+(
+  set -e
+
+  reponame="locks-wait-acquire"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  clone_repo "$reponame" "$reponame-other"
+  git lfs lock --json a.dat | tee lock.log
+  id=$(assert_lock lock.log a.dat)
+
+  cd "../$reponame"
+  git lfs locks --wait a.dat --acquire --interval=100ms --json >wait.log 2>wait.err &
+  waitpid=$!
+
+  sleep 1
+  kill -0 "$waitpid"
+  [ "0" -eq "$(grep -c "unlocked" wait.log)" ]
+
+  cd "../$reponame-other"
+  git lfs unlock a.dat
+
+  cd "../$reponame"
+  wait "$waitpid"
+
+  cat wait.log
+  head -n 1 wait.log | grep "\"event\":\"unlocked\""
+  head -n 1 wait.log | grep "\"id\":\"$id\""
+  tail -n 1 wait.log | grep "\"event\":\"acquired\""
+  tail -n 1 wait.log | grep "\"message\":\"Locked a.dat\""
+
+  git lfs locks --local | grep "a.dat"
+)
+end_test
+
+begin_test "locks --wait times out"
+(
+  set -e
+
+  reponame="locks-wait-timeout"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs lock a.dat
+
+  git lfs locks --wait a.dat --interval=100ms --timeout=500ms 2>&1 | tee wait.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs locks --wait' to time out"
+    exit 1
+  fi
+  grep "Timed out waiting for a.dat to be unlocked" wait.log
+
+  git lfs locks --wait b.dat | tee wait.log
+  grep "b.dat is not locked" wait.log
+)
+end_test
+
+begin_test "locks --watch follows the server's lock events"
+(
+  set -e
+
+  reponame="locks-watch-lock-events"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  GIT_TRACE=1 git lfs locks --watch --json --interval=1h >watch.log 2>trace.log &
+  watchpid=$!
+  trap 'kill "$watchpid" 2>/dev/null || true' EXIT
+
+  wait_for_log "following lock event channel" trace.log
+
+  git lfs lock a.dat
+  git lfs unlock a.dat
+
+  wait_for_log '"event":"unlocked"' watch.log
+
+  cat watch.log
+  [ 2 -eq "$(wc -l <watch.log)" ]
+  head -n 1 watch.log | grep "\"message\":\"a.dat was locked by Git LFS Tests\""
+  tail -n 1 watch.log | grep "\"message\":\"a.dat was unlocked\""
+)
+end_test
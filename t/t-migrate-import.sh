@@ -999,6 +999,25 @@ begin_test "migrate import (--object-map)"
 )
 end_test
 
+begin_test "migrate import (--resume)"
+(
+  set -e
+
+  setup_multiple_local_branches
+
+  git lfs migrate import --resume 2>&1 | tee "$TRASHDIR/migrate.log"
+  if [ "${PIPESTATUS[0]}" -eq 0 ]; then
+    echo >&2 "fatal: expected 'git lfs migrate import --resume' to fail ..."
+    exit 1
+  fi
+  grep "no interrupted migration to resume" "$TRASHDIR/migrate.log"
+
+  git lfs migrate import --everything
+
+  [ ! -e .git/lfs/tmp/checkpoints/migrate.json ]
+)
+end_test
+
 begin_test "migrate import (--include with space)"
 (
   set -e
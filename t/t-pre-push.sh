@@ -703,6 +703,44 @@ begin_test "pre-push with our lock"
 )
 end_test
 
+begin_test "pre-push replays queued locks"
+(
+  set -e
+
+  reponame="pre_push_queued_locks"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  git add .gitattributes
+  git commit -m "initial commit"
+
+  printf "contents" > queued.dat
+  git add queued.dat
+  git commit -m "add queued.dat"
+
+  git push origin main
+
+  git config lfs.queuelocksoffline true
+  git config lfs.url "http://127.0.0.1:1/$reponame.git/info/lfs"
+  git lfs lock queued.dat | grep "Queued lock on queued.dat"
+  git config --unset lfs.url
+
+  printf "changes" >> queued.dat
+  git add queued.dat
+  git commit -m "change queued.dat"
+
+  git config "lfs.$GITSERVER/$reponame.git/info/lfs.locksverify" true
+  git push origin main 2>&1 | tee push.log
+  grep "Locked queued.dat, as queued while the server was unreachable" push.log
+  grep "Consider unlocking your own locked files" push.log
+
+  git lfs locks | tee locks.log
+  grep "queued.dat" locks.log
+  [ 0 -eq "$(grep -c "pending" locks.log)" ]
+)
+end_test
+
 begin_test "pre-push with their lock on lfs file"
 (
   set -e
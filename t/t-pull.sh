@@ -947,6 +947,50 @@ begin_test "pull with raw remote url"
 )
 end_test
 
+begin_test "pull with priority paths"
+(
+  set -e
+
+  reponame="pull-priority"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  mkdir docs
+  large_contents="$(printf "%0100d" 0)"
+  large_oid="$(calc_oid "$large_contents")"
+  printf "%s" "$large_contents" > large.dat
+  small_contents="small"
+  small_oid="$(calc_oid "$small_contents")"
+  printf "%s" "$small_contents" > docs/small.dat
+  git add .gitattributes large.dat docs/small.dat
+  git commit -m "add large and small objects"
+  git push origin main
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-flag"
+  GIT_CURL_VERBOSE=1 git lfs pull --priority "docs/" 2>&1 | tee pull.log
+  batch="$(grep "{\"operation\":\"download\"" pull.log | head -1)"
+  [ "$(substring_position "$batch" "$small_oid")" -lt "$(substring_position "$batch" "$large_oid")" ]
+  [ "$small_contents" = "$(cat docs/small.dat)" ]
+  [ "$large_contents" = "$(cat large.dat)" ]
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-config"
+  git config lfs.fetchpriority "docs/*.dat"
+  GIT_CURL_VERBOSE=1 git lfs pull 2>&1 | tee pull.log
+  batch="$(grep "{\"operation\":\"download\"" pull.log | head -1)"
+  [ "$(substring_position "$batch" "$small_oid")" -lt "$(substring_position "$batch" "$large_oid")" ]
+
+  # Without any priority paths, the largest objects are downloaded first.
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-none"
+  GIT_CURL_VERBOSE=1 git lfs pull 2>&1 | tee pull.log
+  batch="$(grep "{\"operation\":\"download\"" pull.log | head -1)"
+  [ "$(substring_position "$batch" "$large_oid")" -lt "$(substring_position "$batch" "$small_oid")" ]
+)
+end_test
+
 begin_test "pull with multiple remotes"
 (
   set -e
@@ -954,3 +954,58 @@ begin_test "push --object-id (invalid value)"
   [ "$(grep -c 'too short object ID' push.log)" -eq 2 ]
 )
 end_test
+
+begin_test "push --resume"
+(
+  set -e
+
+  reponame="push-resume"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  good="good"
+  good_oid="$(calc_oid "$good")"
+  bad="status-storage-404"
+  bad_oid="$(calc_oid "$bad")"
+  printf "%s" "$good" > good.dat
+  printf "%s" "$bad" > bad.dat
+  git add .gitattributes good.dat bad.dat
+  git commit -m "add objects"
+
+  # Don't wait for the failing upload to be retried.
+  git config lfs.transfer.maxretries 1
+
+  git lfs push origin main 2>&1 | tee push.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo "expected push to fail"
+    exit 1
+  fi
+  assert_server_object "$reponame" "$good_oid"
+  refute_server_object "$reponame" "$bad_oid"
+
+  journal=".git/lfs/journal/upload-origin"
+  grep "^completed $good_oid 4$" "$journal"
+  [ 0 -eq "$(grep -c "^completed $bad_oid" "$journal")" ]
+
+  GIT_CURL_VERBOSE=1 git lfs push --resume origin main 2>&1 | tee push.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo "expected push to fail"
+    exit 1
+  fi
+  grep "Uploading LFS objects:  50% (1/2)" push.log
+  batch="$(grep "{\"operation\":\"upload\"" push.log | head -1)"
+  echo "$batch" | grep "$bad_oid"
+  echo "$batch" | grep -v "$good_oid"
+
+  # Without --resume, all of the objects are sent to the server again.
+  GIT_CURL_VERBOSE=1 git lfs push origin main 2>&1 | tee push.log
+  batch="$(grep "{\"operation\":\"upload\"" push.log | head -1)"
+  echo "$batch" | grep "$bad_oid"
+  echo "$batch" | grep "$good_oid"
+
+  # Once a push succeeds, its journal is removed.
+  git lfs push --object-id origin "$good_oid"
+  [ ! -e "$journal" ]
+)
+end_test
@@ -0,0 +1,101 @@
+#!/usr/bin/env bash
+
+. "$(dirname "$0")/testlib.sh"
+
+begin_test "telemetry: push and fetch export traces to file"
+(
+  set -e
+
+  reponame="telemetry-file"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="telemetry"
+  oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  git config lfs.telemetry.file "$TRASHDIR/push.jsonl"
+
+  traceid="0af7651916cd43dd8448eb211c80319c"
+  TRACEPARENT="00-$traceid-b7ad6b7169203331-01" GIT_CURL_VERBOSE=1 \
+    git push origin main 2>&1 | tee push.log
+  if [ "0" -ne "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected \`git push origin main\` to succeed ..."
+    exit 1
+  fi
+  assert_server_object "$reponame" "$oid"
+
+  grep "> Traceparent: 00-$traceid-" push.log
+
+  grep '"name":"git-lfs pre-push"' "$TRASHDIR/push.jsonl"
+  grep '"name":"lfs.batch"' "$TRASHDIR/push.jsonl"
+  grep '"name":"lfs.transfer"' "$TRASHDIR/push.jsonl"
+  grep '"name":"HTTP PUT"' "$TRASHDIR/push.jsonl"
+  grep "\"traceId\":\"$traceid\"" "$TRASHDIR/push.jsonl"
+  grep '"name":"lfs.transfer.size"' "$TRASHDIR/push.jsonl"
+  [ "0" -eq "$(grep -c "sig=\|user:" "$TRASHDIR/push.jsonl")" ]
+
+  rm -rf .git/lfs/objects
+  git config lfs.telemetry.file "$TRASHDIR/fetch.jsonl"
+
+  git lfs fetch
+  assert_local_object "$oid" "${#contents}"
+
+  grep '"name":"git-lfs fetch"' "$TRASHDIR/fetch.jsonl"
+  grep '"name":"HTTP GET"' "$TRASHDIR/fetch.jsonl"
+  grep '"name":"lfs.http.client.duration"' "$TRASHDIR/fetch.jsonl"
+  [ "0" -eq "$(grep -c "\"traceId\":\"$traceid\"" "$TRASHDIR/fetch.jsonl")" ]
+)
+end_test
+
+begin_test "telemetry: disabled by default"
+(
+  set -e
+
+  reponame="telemetry-disabled"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  printf "%s" "disabled" > a.dat
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  GIT_CURL_VERBOSE=1 git push origin main 2>&1 | tee push.log
+  [ "0" -eq "$(grep -c "> Traceparent:" push.log)" ]
+)
+end_test
+
+begin_test "telemetry: push with ssh endpoint (git-lfs-transfer)"
+(
+  set -e
+
+  setup_pure_ssh
+
+  reponame="telemetry-ssh-transfer"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  sshurl=$(ssh_remote "$reponame")
+  git config lfs.url "$sshurl"
+
+  contents="ssh"
+  git lfs track "*.dat"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  git config lfs.telemetry.file "$TRASHDIR/push.jsonl"
+
+  git push origin main
+  assert_remote_object "$reponame" "$(calc_oid "$contents")" "${#contents}"
+
+  grep '"name":"ssh batch"' "$TRASHDIR/push.jsonl"
+  grep '"name":"ssh put-object"' "$TRASHDIR/push.jsonl"
+  grep '"name":"lfs.ssh.duration"' "$TRASHDIR/push.jsonl"
+)
+end_test
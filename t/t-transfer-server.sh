@@ -0,0 +1,161 @@
+#!/usr/bin/env bash
+
+. "$(dirname "$0")/testlib.sh"
+
+# setup_transfer_server puts a "git-lfs-transfer" program which runs
+# "git lfs transfer-server" at the front of PATH, so that the pure SSH
+# protocol is served by Git LFS itself.
+setup_transfer_server() {
+  mkdir -p "$TRASHDIR/transfer-server-bin"
+  cat >"$TRASHDIR/transfer-server-bin/git-lfs-transfer" <<'SCRIPT'
+#!/bin/sh
+exec git lfs transfer-server --user=lfstest "$@"
+SCRIPT
+  chmod +x "$TRASHDIR/transfer-server-bin/git-lfs-transfer"
+  export PATH="$TRASHDIR/transfer-server-bin:$PATH"
+}
+
+begin_test "transfer-server: push and clone"
+(
+  set -e
+
+  setup_transfer_server
+
+  reponame="transfer-server-push-clone"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  sshurl=$(ssh_remote "$reponame")
+  git config lfs.url "$sshurl"
+
+  contents="transfer server"
+  git lfs track "*.dat"
+  printf "%s" "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  GIT_TRACE=1 git push origin main 2>&1 | tee push.log
+  [ 0 -eq "${PIPESTATUS[0]}" ]
+  grep "pure SSH connection successful" push.log
+  assert_remote_object "$reponame" "$(calc_oid "$contents")" "${#contents}"
+
+  cd ..
+  git clone "$sshurl" "$reponame-2"
+
+  cd "$reponame-2"
+  [ "$contents" = "$(cat a.dat)" ]
+  git lfs fsck
+)
+end_test
+
+begin_test "transfer-server: locks"
+(
+  set -e
+
+  setup_transfer_server
+
+  reponame="transfer-server-locks"
+  setup_remote_repo_with_file "$reponame" "f.dat"
+  clone_repo "$reponame" "$reponame"
+
+  sshurl=$(ssh_remote "$reponame")
+  git config lfs.url "$sshurl"
+
+  git lfs lock --json "f.dat" | tee lock.log
+  id=$(assert_lock lock.log f.dat)
+
+  git lfs locks --verify | tee locks.log
+  grep "O f.dat" locks.log
+  grep "lfstest" locks.log
+
+  git lfs lock "f.dat" 2>&1 | tee lock.log
+  grep "already created lock" lock.log
+
+  git lfs unlock --id="$id"
+  [ -z "$(git lfs locks)" ]
+)
+end_test
+
+begin_test "transfer-server: lock leases"
+(
+  set -e
+
+  setup_transfer_server
+
+  reponame="transfer-server-lock-leases"
+  setup_remote_repo_with_file "$reponame" "f.dat"
+  clone_repo "$reponame" "$reponame"
+
+  sshurl=$(ssh_remote "$reponame")
+  git config lfs.url "$sshurl"
+
+  git lfs lock --ttl 1s "f.dat" | tee lock.log
+  grep "Locked f.dat until" lock.log
+  sleep 2
+
+  [ -z "$(git lfs locks)" ]
+  git lfs locks --expired | tee locks.log
+  grep "expired " locks.log
+
+  git lfs lock --json --ttl 1h "f.dat" | tee lock.log
+  id=$(assert_lock lock.log f.dat)
+
+  git lfs locks --renew --ttl 48h --id "$id" | tee renew.log
+  grep "Renewed lock on f.dat until" renew.log
+  git lfs locks --verify | tee locks.log
+  grep "O f.dat" locks.log
+  grep "expires " locks.log
+)
+end_test
+
+begin_test "transfer-server: batch locks"
+(
+  set -e
+
+  setup_transfer_server
+
+  reponame="transfer-server-batch-locks"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  sshurl=$(ssh_remote "$reponame")
+  git config lfs.url "$sshurl"
+
+  git lfs track "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.dat
+  echo "c" > c.dat
+  git add .gitattributes a.dat b.dat c.dat
+  git commit -m "add dat files"
+
+  GIT_TRACE=1 git lfs lock "*.dat" 2>&1 | tee lock.log
+  grep "batch locking not supported" lock.log && exit 1
+  grep "Locked a.dat" lock.log
+  grep "Locked b.dat" lock.log
+  grep "Locked c.dat" lock.log
+
+  git lfs unlock --atomic a.dat b.dat d.dat 2>&1 | tee unlock.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs unlock --atomic' to fail"
+    exit 1
+  fi
+  grep "aborted because another path failed" unlock.log
+  [ 3 -eq "$(git lfs locks | wc -l)" ]
+
+  printf "a.dat\nb.dat\nc.dat\n" | git lfs unlock --stdin | tee unlock.log
+  grep "Unlocked c.dat" unlock.log
+  [ -z "$(git lfs locks)" ]
+)
+end_test
+
+begin_test "transfer-server: rejects invalid repository"
+(
+  set -e
+
+  setup_transfer_server
+
+  git lfs transfer-server "$TRASHDIR/does-not-exist" download </dev/null 2>&1 | tee transfer.log
+  [ 0 -ne "${PIPESTATUS[0]}" ]
+  grep "not a Git repository" transfer.log
+)
+end_test
@@ -712,3 +712,91 @@ begin_test "unlock with git-lfs-transfer"
   refute_server_lock_ssh "$reponame" "$id" "refs/heads/main"
 )
 end_test
+
+begin_test "unlock multiple files with a glob"
+(
+  set -e
+
+  reponame="unlock-multiple-files-glob"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.dat
+  echo "c" > c.txt
+  git add .gitattributes a.dat b.dat c.txt
+  git commit -m "add files"
+
+  git lfs lock a.dat b.dat c.txt
+
+  # Locks on files which are not in the working tree match, too.
+  git rm b.dat
+  git commit -m "remove b.dat"
+
+  git lfs unlock --json "*.dat" | tee unlock.json
+  grep -F '[{"path":"a.dat","unlocked":true},{"path":"b.dat","unlocked":true}]' unlock.json
+
+  git lfs locks | tee locks.log
+  grep "c.txt" locks.log
+  [ 1 -eq "$(wc -l < locks.log)" ]
+)
+end_test
+
+begin_test "unlock multiple files atomically"
+(
+  set -e
+
+  reponame="unlock-multiple-files-atomic"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "a" > a.dat
+  echo "b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add dat files"
+
+  git lfs lock a.dat
+
+  printf "a.dat\nb.dat\n" | git lfs unlock --stdin --atomic --json 2>&1 | tee unlock.json
+  if [ "0" -eq "${PIPESTATUS[1]}" ]; then
+    echo >&2 "fatal: expected 'git lfs unlock --atomic' to fail"
+    exit 1
+  fi
+  grep '{"path":"a.dat","unlocked":false,"reason":"server unable to unlock: aborted because another path failed"}' unlock.json
+  grep '{"path":"b.dat","unlocked":false,"reason":"server unable to unlock: unable to find lock"}' unlock.json
+  [ 1 -eq "$(git lfs locks | wc -l)" ]
+
+  printf "a.dat\nb.dat\n" | git lfs unlock --stdin 2>&1 | tee unlock.log
+  grep "Unlocked a.dat" unlock.log
+  [ -z "$(git lfs locks)" ]
+)
+end_test
+
+begin_test "unlock queued while server is unreachable"
+(
+  set -e
+
+  reponame="unlock-queued-offline"
+  setup_remote_repo_with_file "$reponame" "a.dat"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs lock a.dat
+  id=$(git lfs locks --local --json | sed -e 's/.*"id":"\([^"]*\)".*/\1/')
+
+  git config lfs.queuelocksoffline true
+  git config lfs.url "http://127.0.0.1:1/$reponame.git/info/lfs"
+
+  git lfs unlock a.dat 2>&1 | tee unlock.log
+  grep "Queued unlock of a.dat until the server can be reached" unlock.log
+
+  git lfs locks --local | tee locks.log
+  grep "a.dat.*ID:$id.*(pending unlock)" locks.log
+
+  git config --unset lfs.url
+  git lfs locks --sync --json | tee sync.json
+  grep '"path":"a.dat","operation":"unlock","synced":true' sync.json
+  [ -z "$(git lfs locks)" ]
+)
+end_test
@@ -0,0 +1,61 @@
+#!/usr/bin/env bash
+
+. "$(dirname "$0")/testlib.sh"
+
+begin_test "upload sends integrity headers requested by server"
+(
+  set -e
+
+  reponame="upload-integrity"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="storage-upload-integrity"
+  oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  git push origin main 2>&1 | tee push.log
+  if [ "0" -ne "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected \`git push origin main\` to succeed ..."
+    exit 1
+  fi
+
+  assert_server_object "$reponame" "$oid"
+)
+end_test
+
+begin_test "upload sends integrity headers from configuration"
+(
+  set -e
+
+  reponame="upload-integrity-config"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="integrity"
+  oid="$(calc_oid "$contents")"
+  printf "%s" "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  git config lfs.transfer.integrityHeaders "Content-MD5"
+
+  GIT_CURL_VERBOSE=1 git push origin main 2>&1 | tee push.log
+  if [ "0" -ne "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected \`git push origin main\` to succeed ..."
+    exit 1
+  fi
+
+  md5="$(printf "%s" "$contents" | openssl md5 -binary | base64)"
+  grep "> Content-Md5: $md5" push.log
+  [ "0" -eq "$(grep -c "> Digest:" push.log)" ]
+
+  assert_server_object "$reponame" "$oid"
+)
+end_test
@@ -8,6 +8,7 @@ IS_WINDOWS=0
 IS_MAC=0
 X=""
 SHASUM="shasum -a 256"
+SHA512SUM="shasum -a 512"
 PATH_SEPARATOR="/"
 
 if [[ $UNAME == MINGW* || $UNAME == MSYS* || $UNAME == CYGWIN* ]]
@@ -19,6 +20,7 @@ then
   # script by default, so use sha256sum directly. MacOS on the other hand
   # does not have sha256sum, so still use shasum as the default.
   SHASUM="sha256sum"
+  SHA512SUM="sha512sum"
   PATH_SEPARATOR="\\"
 elif [[ $UNAME == *Darwin* ]]
 then
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/git-lfs/git-lfs/v3/events"
 	isatty "github.com/mattn/go-isatty"
 	"github.com/olekukonko/ts"
 )
@@ -220,11 +221,14 @@ func (l *Logger) logTask(task Task) {
 
 	var update *Update
 	for update = range task.Updates() {
-		if !tty(os.Stdout) && !l.forceProgress {
+		if !tty(os.Stdout) && !l.forceProgress && !events.Enabled() {
 			continue
 		}
 		if logAll || l.throttle == 0 || !update.Throttled(last.Add(l.throttle)) {
-			l.logLine(update.S)
+			events.Emit(events.Event{Type: events.TaskUpdated, Message: update.S})
+			if tty(os.Stdout) || l.forceProgress {
+				l.logLine(update.S)
+			}
 			last = update.At
 		}
 	}
@@ -233,6 +237,7 @@ func (l *Logger) logTask(task Task) {
 		// If a task sent no updates, the last recorded update will be
 		// nil. Given this, only log a message when there was at least
 		// (1) update.
+		events.Emit(events.Event{Type: events.TaskCompleted, Message: update.S})
 		l.log(fmt.Sprintf("%s, done.\n", update.S))
 	}
 
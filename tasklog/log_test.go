@@ -2,13 +2,25 @@ package tasklog
 
 import (
 	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/git-lfs/git-lfs/v3/events"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+type testEnv map[string]string
+
+func (e testEnv) Get(key string) (string, bool) {
+	v, ok := e[key]
+	return v, ok
+}
+
 type ChanTask chan *Update
 
 func (e ChanTask) Updates() <-chan *Update { return e }
@@ -59,6 +71,46 @@ func TestLoggerLogsSuppressesProgress(t *testing.T) {
 	assert.Equal(t, "second, done.\n", buf.String())
 }
 
+func TestLoggerEmitsEventsWhenProgressSuppressed(t *testing.T) {
+	var buf bytes.Buffer
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, events.Setup(testEnv{"GIT_LFS_EVENTS": path}))
+
+	task := make(chan *Update)
+	go func() {
+		task <- &Update{"first", time.Now(), false}
+		task <- &Update{"second", time.Now(), false}
+		close(task)
+	}()
+
+	l := NewLogger(&buf, ForceProgress(false))
+	l.throttle = 0
+	l.widthFn = func() int { return 0 }
+	l.Enqueue(ChanTask(task))
+	l.Close()
+	events.Close()
+
+	assert.Equal(t, "second, done.\n", buf.String())
+
+	by, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var evs []events.Event
+	for _, line := range strings.Split(strings.TrimSpace(string(by)), "\n") {
+		var ev events.Event
+		require.NoError(t, json.Unmarshal([]byte(line), &ev))
+		evs = append(evs, ev)
+	}
+	require.Len(t, evs, 3)
+	assert.Equal(t, events.TaskUpdated, evs[0].Type)
+	assert.Equal(t, "first", evs[0].Message)
+	assert.Equal(t, events.TaskUpdated, evs[1].Type)
+	assert.Equal(t, "second", evs[1].Message)
+	assert.Equal(t, events.TaskCompleted, evs[2].Type)
+	assert.Equal(t, "second", evs[2].Message)
+}
+
 func TestLoggerLogsMultipleTasksInOrder(t *testing.T) {
 	var buf bytes.Buffer
 
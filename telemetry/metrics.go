@@ -0,0 +1,181 @@
+package telemetry
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBounds are the upper bounds, in milliseconds, of the buckets of
+// histograms of durations, as recommended by OpenTelemetry.
+var durationBounds = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// instrument is a named metric, with a value for each set of attributes with
+// which it has been recorded.
+type instrument struct {
+	name        string
+	unit        string
+	description string
+	histogram   bool
+}
+
+// Counter is a metric which sums the amounts added to it, such as a number of
+// bytes or errors.
+type Counter struct {
+	instrument
+}
+
+// Histogram is a metric which records the distribution of durations, in
+// milliseconds.
+type Histogram struct {
+	instrument
+}
+
+type point struct {
+	attrs  []Attribute
+	sum    float64
+	count  int64
+	min    float64
+	max    float64
+	counts []int64
+}
+
+var (
+	metricsMu   sync.Mutex
+	instruments []*instrument
+	points      map[*instrument]map[string]*point
+	metricsFrom time.Time
+)
+
+// NewCounter returns a new counter with the given name, unit and description.
+// It should be called once for each counter, when initialising a package.
+func NewCounter(name, unit, description string) *Counter {
+	c := &Counter{instrument{name: name, unit: unit, description: description}}
+	register(&c.instrument)
+	return c
+}
+
+// NewHistogram returns a new histogram of durations with the given name and
+// description. It should be called once for each histogram, when initialising
+// a package.
+func NewHistogram(name, description string) *Histogram {
+	h := &Histogram{instrument{name: name, unit: "ms", description: description, histogram: true}}
+	register(&h.instrument)
+	return h
+}
+
+func register(i *instrument) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	instruments = append(instruments, i)
+}
+
+// Add adds n to the counter for the given attributes, if telemetry is enabled.
+func (c *Counter) Add(n int64, attrs ...Attribute) {
+	if n == 0 || !Enabled() {
+		return
+	}
+	c.record(float64(n), attrs)
+}
+
+// Record records the duration d in the histogram for the given attributes, if
+// telemetry is enabled.
+func (h *Histogram) Record(d time.Duration, attrs ...Attribute) {
+	if !Enabled() {
+		return
+	}
+	h.record(float64(d)/float64(time.Millisecond), attrs)
+}
+
+func (i *instrument) record(v float64, attrs []Attribute) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if points == nil {
+		return
+	}
+	if points[i] == nil {
+		points[i] = make(map[string]*point)
+	}
+
+	key := attributesKey(attrs)
+	p := points[i][key]
+	if p == nil {
+		p = &point{attrs: attrs, min: v, max: v}
+		if i.histogram {
+			p.counts = make([]int64, len(durationBounds)+1)
+		}
+		points[i][key] = p
+	}
+
+	p.sum += v
+	p.count++
+	p.min = min(p.min, v)
+	p.max = max(p.max, v)
+	if i.histogram {
+		p.counts[sort.SearchFloat64s(durationBounds, v)]++
+	}
+}
+
+// attributesKey returns a string which is the same for any two lists of the
+// same attributes, in any order.
+func attributesKey(attrs []Attribute) string {
+	keys := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		keys = append(keys, attr.Key+"="+attr.String())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\x00")
+}
+
+// resetMetrics discards all recorded values, so that metrics are recorded
+// from now on.
+func resetMetrics() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	points = make(map[*instrument]map[string]*point)
+	metricsFrom = time.Now()
+}
+
+// metric is the value of an instrument for each set of attributes, at the
+// end of the command.
+type metric struct {
+	*instrument
+	points []*point
+	from   time.Time
+	to     time.Time
+}
+
+// collectMetrics returns the values of all instruments which have been
+// recorded, in the order in which the instruments were created, and stops
+// recording them.
+func collectMetrics() []metric {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	var metrics []metric
+	now := time.Now()
+	for _, i := range instruments {
+		if len(points[i]) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(points[i]))
+		for key := range points[i] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		m := metric{instrument: i, from: metricsFrom, to: now}
+		for _, key := range keys {
+			m.points = append(m.points, points[i][key])
+		}
+		metrics = append(metrics, m)
+	}
+
+	points = nil
+	return metrics
+}
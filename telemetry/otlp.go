@@ -0,0 +1,333 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+// exportTimeout is the longest an export to a collector may take.
+const exportTimeout = 10 * time.Second
+
+// Attribute is a key and value describing a span or the value of a metric.
+type Attribute struct {
+	Key   string
+	value interface{}
+}
+
+// String returns an attribute with a string value.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, value: value}
+}
+
+// Int returns an attribute with an integer value.
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, value: value}
+}
+
+// Bool returns an attribute with a boolean value.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, value: value}
+}
+
+// String returns the attribute's value as a string.
+func (a Attribute) String() string {
+	switch v := a.value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// MarshalJSON encodes the attribute as an OTLP KeyValue.
+func (a Attribute) MarshalJSON() ([]byte, error) {
+	value := make(map[string]interface{})
+	switch v := a.value.(type) {
+	case string:
+		value["stringValue"] = v
+	case int64:
+		// OTLP encodes 64-bit integers as strings in JSON.
+		value["intValue"] = strconv.FormatInt(v, 10)
+	case bool:
+		value["boolValue"] = v
+	}
+	return json.Marshal(map[string]interface{}{"key": a.Key, "value": value})
+}
+
+// The following types are those of the OTLP JSON encoding of the messages
+// which export traces and metrics, omitting fields which are not used.
+
+type otlpResource struct {
+	Attributes []Attribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []Attribute `json:"attributes,omitempty"`
+	Status            otlpStatus  `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []Attribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	TimeUnixNano      string      `json:"timeUnixNano"`
+
+	// AsInt is the value of a counter.
+	AsInt string `json:"asInt,omitempty"`
+
+	// The following are the values of a histogram.
+	Count          string    `json:"count,omitempty"`
+	Sum            *float64  `json:"sum,omitempty"`
+	Min            *float64  `json:"min,omitempty"`
+	Max            *float64  `json:"max,omitempty"`
+	BucketCounts   []string  `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64 `json:"explicitBounds,omitempty"`
+}
+
+type otlpData struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic,omitempty"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Unit        string    `json:"unit"`
+	Description string    `json:"description"`
+	Sum         *otlpData `json:"sum,omitempty"`
+	Histogram   *otlpData `json:"histogram,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetrics struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// aggregationTemporalityCumulative is the OTLP temporality of metrics whose
+// values are totals since the command started.
+const aggregationTemporalityCumulative = 2
+
+func resource() otlpResource {
+	return otlpResource{Attributes: []Attribute{
+		String("service.name", "git-lfs"),
+		String("service.version", config.Version),
+	}}
+}
+
+func scope() otlpScope {
+	return otlpScope{Name: "github.com/git-lfs/git-lfs", Version: config.Version}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// encodeSpans returns an OTLP ExportTraceServiceRequest holding the given
+// spans, encoded as JSON.
+func encodeSpans(spans []*Span) []byte {
+	ss := otlpScopeSpans{Scope: scope()}
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        append([]Attribute(nil), s.attrs...),
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if len(s.err) > 0 {
+			span.Status = otlpStatus{Code: 2, Message: s.err}
+		}
+		s.mu.Unlock()
+
+		ss.Spans = append(ss.Spans, span)
+	}
+
+	by, _ := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{
+		{Resource: resource(), ScopeSpans: []otlpScopeSpans{ss}},
+	}})
+	return by
+}
+
+// encodeMetrics returns an OTLP ExportMetricsServiceRequest holding the given
+// metrics, encoded as JSON, or nil if there are none.
+func encodeMetrics(metrics []metric) []byte {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	sm := otlpScopeMetrics{Scope: scope()}
+	for _, m := range metrics {
+		data := &otlpData{AggregationTemporality: aggregationTemporalityCumulative}
+		for _, p := range m.points {
+			dp := otlpDataPoint{
+				Attributes:        p.attrs,
+				StartTimeUnixNano: unixNano(m.from),
+				TimeUnixNano:      unixNano(m.to),
+			}
+			if m.histogram {
+				sum, min, max := p.sum, p.min, p.max
+				dp.Count = strconv.FormatInt(p.count, 10)
+				dp.Sum, dp.Min, dp.Max = &sum, &min, &max
+				dp.ExplicitBounds = durationBounds
+				for _, n := range p.counts {
+					dp.BucketCounts = append(dp.BucketCounts, strconv.FormatInt(n, 10))
+				}
+			} else {
+				dp.AsInt = strconv.FormatInt(int64(p.sum), 10)
+			}
+			data.DataPoints = append(data.DataPoints, dp)
+		}
+
+		om := otlpMetric{Name: m.name, Unit: m.unit, Description: m.description}
+		if m.histogram {
+			om.Histogram = data
+		} else {
+			data.IsMonotonic = true
+			om.Sum = data
+		}
+		sm.Metrics = append(sm.Metrics, om)
+	}
+
+	by, _ := json.Marshal(otlpMetrics{ResourceMetrics: []otlpResourceMetrics{
+		{Resource: resource(), ScopeMetrics: []otlpScopeMetrics{sm}},
+	}})
+	return by
+}
+
+// exporter sends encoded traces and metrics to their destination.
+type exporter interface {
+	exportTraces(body []byte) error
+	exportMetrics(body []byte) error
+	close() error
+}
+
+// httpExporter sends traces and metrics to an OTLP/HTTP collector.
+type httpExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newHTTPExporter(endpoint string) *httpExporter {
+	return &httpExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: exportTimeout},
+	}
+}
+
+func (e *httpExporter) exportTraces(body []byte) error {
+	return e.post("/v1/traces", body)
+}
+
+func (e *httpExporter) exportMetrics(body []byte) error {
+	return e.post("/v1/metrics", body)
+}
+
+func (e *httpExporter) post(path string, body []byte) error {
+	res, err := e.client.Post(e.endpoint+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode > 299 {
+		return errors.New(tr.Tr.Get("Invalid status for %s %s: %d", "POST", e.endpoint+path, res.StatusCode))
+	}
+	return nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// fileExporter appends traces and metrics to a file, one request per line, in
+// the format read by the OpenTelemetry Collector's OTLP JSON file receiver.
+type fileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newFileExporter(f *os.File) *fileExporter {
+	return &fileExporter{f: f}
+}
+
+func (e *fileExporter) exportTraces(body []byte) error {
+	return e.write(body)
+}
+
+func (e *fileExporter) exportMetrics(body []byte) error {
+	return e.write(body)
+}
+
+func (e *fileExporter) write(body []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := e.f.Write(append(body, '\n'))
+	return err
+}
+
+func (e *fileExporter) close() error {
+	return e.f.Close()
+}
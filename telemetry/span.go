@@ -0,0 +1,200 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The kinds of span, as numbered by OTLP.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// Span is a single operation within the command's trace. A nil *Span, as
+// returned by Start when telemetry is not enabled, may be used safely, and
+// records nothing.
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+
+	mu    sync.Mutex
+	start time.Time
+	end   time.Time
+	attrs []Attribute
+	err   string
+	ended bool
+}
+
+type spanContextKey struct{}
+
+// Start starts a new span with the given name as a child of the span in ctx,
+// or otherwise of the command's root span, returning a context holding the new
+// span. It returns a nil span if telemetry is not enabled.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, spanKindInternal, attrs)
+}
+
+// StartClient is like Start, but starts a span for a request made to a remote
+// service, such as an HTTP request or an SSH command.
+func StartClient(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return start(ctx, name, spanKindClient, attrs)
+}
+
+func start(ctx context.Context, name string, kind int, attrs []Attribute) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		mu.Lock()
+		parent = root
+		mu.Unlock()
+		if parent == nil {
+			return ctx, nil
+		}
+	}
+
+	s := newSpan(parent, name, kind)
+	s.attrs = attrs
+	return ContextWithSpan(ctx, s), s
+}
+
+func newSpan(parent *Span, name string, kind int) *Span {
+	s := &Span{name: name, kind: kind, start: time.Now()}
+	rand.Read(s.spanID[:])
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	return s
+}
+
+// ContextWithSpan returns a copy of ctx holding s, so that spans started with
+// it are children of s. It returns ctx itself if s is nil.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// SpanFromContext returns the span held by ctx, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// SetAttributes adds the given attributes to s, replacing any with the same
+// keys.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attr := range attrs {
+		replaced := false
+		for i := range s.attrs {
+			if s.attrs[i].Key == attr.Key {
+				s.attrs[i] = attr
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.attrs = append(s.attrs, attr)
+		}
+	}
+}
+
+// SetError records that the operation of s failed with err. It does nothing
+// if err is nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err.Error()
+}
+
+// End records that the operation of s has finished. Only the first call has
+// any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	finish(s)
+}
+
+// Traceparent returns the value of the W3C Trace Context traceparent header
+// identifying s, or an empty string if s is nil.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// Inject sets the traceparent header in h to identify the span in ctx, or
+// otherwise the command's root span, so that the server may record its own
+// spans as part of the same trace. It does nothing if telemetry is not
+// enabled.
+func Inject(ctx context.Context, h http.Header) {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		mu.Lock()
+		s = root
+		mu.Unlock()
+	}
+	if s != nil {
+		h.Set("traceparent", s.Traceparent())
+	}
+}
+
+// parseTraceparent returns the trace and parent span IDs from the value of a
+// traceparent header, if it is valid.
+func parseTraceparent(value string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	fields := strings.Split(strings.TrimSpace(value), "-")
+	if len(fields) < 4 || len(fields[0]) != 2 || fields[0] == "ff" ||
+		len(fields[1]) != 2*len(traceID) || len(fields[2]) != 2*len(spanID) {
+		return traceID, spanID, false
+	}
+
+	if _, err := hex.Decode(traceID[:], []byte(fields[1])); err != nil {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(fields[2])); err != nil {
+		return traceID, spanID, false
+	}
+	if traceID == [16]byte{} || spanID == [8]byte{} {
+		return traceID, spanID, false
+	}
+	return traceID, spanID, true
+}
@@ -0,0 +1,155 @@
+// Package telemetry records traces and metrics of the network operations made
+// by Git LFS, such as batch requests, object transfers, credential fills and
+// SSH operations, and exports them in the JSON encoding of the OpenTelemetry
+// Protocol (OTLP), either to a collector's HTTP endpoint or to a file.
+//
+// Nothing is recorded unless telemetry has been set up with Setup, in which
+// case all spans belong to a single trace for the command being run.
+package telemetry
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// maxBatchSize is the number of finished spans which are held before they are
+// exported, rather than waiting for the command to finish.
+const maxBatchSize = 256
+
+var (
+	mu       sync.Mutex
+	exp      exporter
+	root     *Span
+	finished []*Span
+	pending  sync.WaitGroup
+)
+
+// Setup enables telemetry for the named command if lfs.telemetry.endpoint or
+// lfs.telemetry.file is set, starting the command's root span. The root span
+// is made a child of the span given by the TRACEPARENT environment variable,
+// if it is set, so that Git LFS may join a trace started by its caller.
+func Setup(gitEnv, osEnv config.Environment, command string) error {
+	var e exporter
+	if endpoint, ok := gitEnv.Get("lfs.telemetry.endpoint"); ok && len(endpoint) > 0 {
+		e = newHTTPExporter(endpoint)
+	} else if path, ok := gitEnv.Get("lfs.telemetry.file"); ok && len(path) > 0 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return errors.Wrap(err, tr.Tr.Get("telemetry"))
+		}
+		e = newFileExporter(f)
+	} else {
+		return nil
+	}
+
+	traceparent, _ := osEnv.Get("TRACEPARENT")
+	setup(e, command, traceparent)
+	return nil
+}
+
+func setup(e exporter, command, traceparent string) {
+	mu.Lock()
+	exp = e
+	mu.Unlock()
+
+	resetMetrics()
+
+	s := newSpan(nil, "git-lfs "+command, spanKindInternal)
+	if traceID, spanID, ok := parseTraceparent(traceparent); ok {
+		s.traceID, s.parentID = traceID, spanID
+	}
+	s.SetAttributes(String("lfs.command", command))
+
+	mu.Lock()
+	root = s
+	mu.Unlock()
+}
+
+// Enabled returns whether telemetry has been set up.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return exp != nil
+}
+
+// Shutdown ends the root span, and exports all remaining spans along with the
+// metrics recorded by the command. It does nothing if telemetry has not been
+// set up. Export errors are traced, rather than returned, since they should
+// not cause the command to fail.
+func Shutdown() {
+	mu.Lock()
+	s := root
+	mu.Unlock()
+	if s == nil {
+		return
+	}
+	s.End()
+
+	mu.Lock()
+	e := exp
+	spans := finished
+	exp, root, finished = nil, nil, nil
+	mu.Unlock()
+
+	pending.Wait()
+	if len(spans) > 0 {
+		exportSpans(e, spans)
+	}
+	if body := encodeMetrics(collectMetrics()); body != nil {
+		if err := e.exportMetrics(body); err != nil {
+			tracerx.Printf("telemetry: unable to export metrics: %s", err)
+		}
+	}
+	if err := e.close(); err != nil {
+		tracerx.Printf("telemetry: unable to close exporter: %s", err)
+	}
+}
+
+// finish records that s has ended, exporting the spans finished so far in the
+// background once there are enough of them.
+func finish(s *Span) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if exp == nil {
+		return
+	}
+
+	finished = append(finished, s)
+	if len(finished) < maxBatchSize {
+		return
+	}
+
+	e, spans := exp, finished
+	finished = nil
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		exportSpans(e, spans)
+	}()
+}
+
+func exportSpans(e exporter, spans []*Span) {
+	if err := e.exportTraces(encodeSpans(spans)); err != nil {
+		tracerx.Printf("telemetry: unable to export %d span(s): %s", len(spans), err)
+	}
+}
+
+// RedactURL returns rawurl without its query string or user information,
+// which may hold credentials or signatures, for use as an attribute.
+func RedactURL(rawurl string) string {
+	rawurl = strings.SplitN(rawurl, "?", 2)[0]
+	if scheme, rest, ok := strings.Cut(rawurl, "://"); ok {
+		if at := strings.LastIndex(strings.SplitN(rest, "/", 2)[0], "@"); at >= 0 {
+			rawurl = scheme + "://" + rest[at+1:]
+		}
+	}
+	return rawurl
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"io"
+	"math/bits"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+const (
+	// DefaultChunkMinSize is the smallest chunk a Chunker will emit,
+	// unless the end of its input is reached first.
+	DefaultChunkMinSize = 256 * 1024
+	// DefaultChunkAvgSize is the size a Chunker aims for on average.
+	DefaultChunkAvgSize = 1024 * 1024
+	// DefaultChunkMaxSize is the largest chunk a Chunker will emit.
+	DefaultChunkMaxSize = 4 * 1024 * 1024
+)
+
+// gearTable maps each byte value to a pseudo-random 64-bit integer for use
+// in the rolling "gear" hash. It is generated from a fixed seed so that
+// chunk boundaries are identical across every client and platform.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+
+	seed := uint64(0x6769742d6c6673) // "git-lfs"
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker splits a stream into content-defined chunks using a FastCDC-style
+// rolling hash. Because boundaries depend only on nearby content, inserting
+// or removing bytes in one part of a file changes only the chunks around the
+// edit, and the remaining chunks are identical to those of the original.
+type Chunker struct {
+	r   io.Reader
+	buf []byte
+	eof bool
+
+	// start and end delimit the unconsumed data in buf.
+	start int
+	end   int
+
+	minSize int
+	avgSize int
+	maxSize int
+
+	// maskS is used before avgSize is reached and makes a boundary less
+	// likely, maskL is used after and makes one more likely. Together
+	// they narrow the distribution of chunk sizes around avgSize.
+	maskS uint64
+	maskL uint64
+}
+
+// NewChunker returns a Chunker reading from r which uses the default chunk
+// sizes.
+func NewChunker(r io.Reader) *Chunker {
+	c, _ := NewChunkerSize(r, DefaultChunkMinSize, DefaultChunkAvgSize, DefaultChunkMaxSize)
+	return c
+}
+
+// NewChunkerSize returns a Chunker reading from r which emits chunks of
+// between minSize and maxSize bytes, averaging approximately avgSize bytes.
+// avgSize must be a power of two.
+func NewChunkerSize(r io.Reader, minSize, avgSize, maxSize int) (*Chunker, error) {
+	if minSize < 1 || minSize > avgSize || avgSize > maxSize {
+		return nil, errors.New(tr.Tr.Get("invalid chunk sizes: min %d, average %d, max %d", minSize, avgSize, maxSize))
+	}
+	if avgSize&(avgSize-1) != 0 {
+		return nil, errors.New(tr.Tr.Get("average chunk size must be a power of two: %d", avgSize))
+	}
+
+	n := bits.Len(uint(avgSize)) - 1
+	return &Chunker{
+		r:       r,
+		buf:     make([]byte, maxSize),
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   highBitsMask(n + 1),
+		maskL:   highBitsMask(max(n-1, 1)),
+	}, nil
+}
+
+// highBitsMask returns a mask of the n most significant bits. The gear hash
+// shifts left on every byte, so its high bits depend on the most input.
+func highBitsMask(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk of the input, or io.EOF once all of the input
+// has been consumed. The returned slice is only valid until the next call to
+// Next.
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// fill reads from the underlying reader until at least maxSize bytes are
+// buffered or the end of the input is reached.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.maxSize {
+		return nil
+	}
+
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+
+	for c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+
+	normal := min(c.avgSize, n)
+
+	var h uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chunkAll(t *testing.T, data []byte, minSize, avgSize, maxSize int) [][]byte {
+	c, err := NewChunkerSize(bytes.NewReader(data), minSize, avgSize, maxSize)
+	require.NoError(t, err)
+
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+	return chunks
+}
+
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestChunkerReassemblesInput(t *testing.T) {
+	data := randomBytes(1, 1<<20)
+	chunks := chunkAll(t, data, 1024, 8192, 32768)
+
+	assert.Greater(t, len(chunks), 1)
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 32768)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(chunk), 1024)
+		}
+	}
+}
+
+func TestChunkerIsDeterministic(t *testing.T) {
+	data := randomBytes(2, 1<<19)
+
+	assert.Equal(t,
+		chunkAll(t, data, 1024, 8192, 32768),
+		chunkAll(t, data, 1024, 8192, 32768))
+}
+
+func TestChunkerLocalizesEdits(t *testing.T) {
+	data := randomBytes(3, 1<<20)
+
+	edited := make([]byte, 0, len(data)+1)
+	edited = append(edited, data[:len(data)/2]...)
+	edited = append(edited, 'x')
+	edited = append(edited, data[len(data)/2:]...)
+
+	before := make(map[string]bool)
+	for _, chunk := range chunkAll(t, data, 1024, 8192, 32768) {
+		before[string(chunk)] = true
+	}
+
+	after := chunkAll(t, edited, 1024, 8192, 32768)
+	changed := 0
+	for _, chunk := range after {
+		if !before[string(chunk)] {
+			changed++
+		}
+	}
+
+	assert.LessOrEqual(t, changed, 3)
+	assert.Greater(t, len(after), 3)
+}
+
+func TestChunkerEmptyInput(t *testing.T) {
+	assert.Empty(t, chunkAll(t, nil, 1024, 8192, 32768))
+}
+
+func TestChunkerSmallInput(t *testing.T) {
+	chunks := chunkAll(t, []byte("hello"), 1024, 8192, 32768)
+	assert.Equal(t, [][]byte{[]byte("hello")}, chunks)
+}
+
+func TestChunkerInvalidSizes(t *testing.T) {
+	_, err := NewChunkerSize(nil, 0, 8192, 32768)
+	assert.Error(t, err)
+
+	_, err = NewChunkerSize(nil, 1024, 8000, 32768)
+	assert.Error(t, err)
+
+	_, err = NewChunkerSize(nil, 1024, 65536, 32768)
+	assert.Error(t, err)
+}
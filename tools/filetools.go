@@ -218,16 +218,17 @@ func ExpandConfigPath(path, defaultPath string) (string, error) {
 	return ExpandPath(fmt.Sprintf("~/.config/%s", defaultPath), false)
 }
 
-// VerifyFileHash reads a file and verifies whether the SHA is correct
+// VerifyFileHash reads a file and verifies whether its hash under the given
+// algorithm is correct
 // Returns an error if there is a problem
-func VerifyFileHash(oid, path string) error {
+func VerifyFileHash(oid, path string, algo HashAlgorithm) error {
 	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	h := NewLfsContentHash()
+	h := algo.New()
 	_, err = io.Copy(h, f)
 	if err != nil {
 		return err
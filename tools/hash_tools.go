@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/zeebo/blake3"
+)
+
+// HashAlgorithm names a hash function which may be used to compute the OIDs
+// of Git LFS objects. Its string value is the name used for it in pointer
+// files (e.g., "oid sha256:...") and in the "hash_algo" field of the Batch
+// API.
+type HashAlgorithm string
+
+const (
+	SHA256 HashAlgorithm = "sha256"
+	SHA512 HashAlgorithm = "sha512"
+	BLAKE3 HashAlgorithm = "blake3"
+
+	// DefaultHashAlgorithm is the hash algorithm used when none has been
+	// configured or negotiated.
+	DefaultHashAlgorithm = SHA256
+)
+
+var (
+	hashAlgorithmConstructors = map[HashAlgorithm]func() hash.Hash{
+		SHA256: sha256.New,
+		SHA512: sha512.New,
+		BLAKE3: func() hash.Hash { return blake3.New() },
+	}
+
+	hashAlgorithmEmptyOids = map[HashAlgorithm]string{
+		SHA256: hex.EncodeToString(sha256.New().Sum(nil)),
+		SHA512: hex.EncodeToString(sha512.New().Sum(nil)),
+		BLAKE3: hex.EncodeToString(blake3.New().Sum(nil)),
+	}
+)
+
+// HashAlgorithms returns all of the supported hash algorithms, with the
+// default algorithm first.
+func HashAlgorithms() []HashAlgorithm {
+	return []HashAlgorithm{SHA256, SHA512, BLAKE3}
+}
+
+// ParseHashAlgorithm returns the HashAlgorithm with the given name, or an
+// error if the name does not refer to a supported algorithm. Names are
+// matched case-insensitively.
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	h := HashAlgorithm(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := hashAlgorithmConstructors[h]; !ok {
+		return "", errors.New(tr.Tr.Get("unsupported hash algorithm: %q", name))
+	}
+	return h, nil
+}
+
+// IsValidOid returns whether the given string is a well-formed OID under any
+// supported hash algorithm. Since several algorithms produce OIDs of the same
+// length, this does not identify the algorithm; that must be carried
+// alongside the OID.
+func IsValidOid(oid string) bool {
+	for _, h := range HashAlgorithms() {
+		if h.IsValidOid(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// OrDefault returns the receiving algorithm, or DefaultHashAlgorithm if it is
+// empty, as when an object's algorithm was not given.
+func (h HashAlgorithm) OrDefault() HashAlgorithm {
+	if len(h) == 0 {
+		return DefaultHashAlgorithm
+	}
+	return h
+}
+
+// New returns a new hash.Hash computing the receiving algorithm.
+func (h HashAlgorithm) New() hash.Hash {
+	if fn, ok := hashAlgorithmConstructors[h]; ok {
+		return fn()
+	}
+	return NewLfsContentHash()
+}
+
+// HexSize returns the length of an OID produced by the receiving algorithm,
+// in hexadecimal characters.
+func (h HashAlgorithm) HexSize() int {
+	return h.New().Size() * 2
+}
+
+// EmptyOid returns the OID of an empty object under the receiving algorithm.
+func (h HashAlgorithm) EmptyOid() string {
+	return hashAlgorithmEmptyOids[h]
+}
+
+// IsValidOid returns whether the given string is a well-formed OID for the
+// receiving algorithm, i.e., a lowercase hexadecimal string of the right
+// length.
+func (h HashAlgorithm) IsValidOid(oid string) bool {
+	if len(oid) != h.HexSize() {
+		return false
+	}
+	for _, c := range oid {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (h HashAlgorithm) String() string {
+	return string(h)
+}
+
+// IsEmptyObjectOid returns whether the given OID is that of an empty object
+// under any supported hash algorithm.
+func IsEmptyObjectOid(oid string) bool {
+	for _, empty := range hashAlgorithmEmptyOids {
+		if oid == empty {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHashAlgorithm(t *testing.T) {
+	for name, expected := range map[string]HashAlgorithm{
+		"sha256": SHA256,
+		"SHA256": SHA256,
+		"sha512": SHA512,
+		"BLAKE3": BLAKE3,
+	} {
+		h, err := ParseHashAlgorithm(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, h, name)
+	}
+
+	for _, name := range []string{"", "sha1", "invalid"} {
+		_, err := ParseHashAlgorithm(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestIsValidOid(t *testing.T) {
+	assert.True(t, IsValidOid(strings.Repeat("a", 64)))
+	assert.True(t, IsValidOid(strings.Repeat("a", 128)))
+	assert.False(t, IsValidOid(strings.Repeat("a", 96)))
+	assert.False(t, IsValidOid("booya"))
+}
+
+func TestHashAlgorithmOrDefault(t *testing.T) {
+	assert.Equal(t, DefaultHashAlgorithm, HashAlgorithm("").OrDefault())
+	assert.Equal(t, BLAKE3, BLAKE3.OrDefault())
+}
+
+func TestHashAlgorithmEmptyOid(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", SHA256.EmptyOid())
+	assert.Equal(t, 128, len(SHA512.EmptyOid()))
+	assert.Equal(t, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262", BLAKE3.EmptyOid())
+
+	assert.True(t, IsEmptyObjectOid(SHA256.EmptyOid()))
+	assert.True(t, IsEmptyObjectOid(SHA512.EmptyOid()))
+	assert.True(t, IsEmptyObjectOid(BLAKE3.EmptyOid()))
+	assert.False(t, IsEmptyObjectOid(strings.Repeat("0", 64)))
+}
+
+func TestHashAlgorithmIsValidOid(t *testing.T) {
+	assert.True(t, SHA256.IsValidOid(strings.Repeat("0f", 32)))
+	assert.False(t, SHA256.IsValidOid(strings.Repeat("0f", 64)))
+	assert.False(t, SHA256.IsValidOid(strings.Repeat("0F", 32)))
+	assert.True(t, SHA512.IsValidOid(strings.Repeat("0f", 64)))
+	assert.False(t, SHA512.IsValidOid(strings.Repeat("0f", 32)))
+}
+
+func TestHashAlgorithmBLAKE3(t *testing.T) {
+	h := BLAKE3.New()
+	h.Write([]byte("abc"))
+	assert.Equal(t, "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85", hex.EncodeToString(h.Sum(nil)))
+	assert.Equal(t, 64, BLAKE3.HexSize())
+}
@@ -5,10 +5,13 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/git-lfs/git-lfs/v3/config"
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/fs"
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/rubyist/tracerx"
 )
@@ -32,6 +35,14 @@ type adapterBase struct {
 	jobWait *sync.WaitGroup
 	// WaitGroup to serialise the first transfer response to perform login if needed
 	authWait sync.WaitGroup
+	// throttle limits the rate at which all workers together transfer
+	// data, or is nil if it is unlimited
+	throttle *throttle
+	// gate limits how many of the workers take jobs
+	gate *workerGate
+	// refresh makes a batch request for a single object, or is nil if
+	// expired actions cannot be refreshed
+	refresh func(*Transfer) (*Transfer, error)
 }
 
 // transferImplementation must be implemented to provide the actual upload/download
@@ -84,6 +95,35 @@ func (a *adapterBase) Begin(cfg AdapterConfig, cb ProgressCallback) error {
 		a.apiClient.OSEnv().Bool("GIT_CURL_VERBOSE", false)
 	maxConcurrency := cfg.ConcurrentTransfers()
 
+	// Rate limits are looked up for the endpoint which the batch came
+	// from, which may be a mirror or cache server rather than the remote.
+	var endpointUrl string
+	if c, ok := cfg.(interface{ endpointUrl() string }); ok {
+		endpointUrl = c.endpointUrl()
+	}
+	if len(endpointUrl) == 0 {
+		operation := "download"
+		if a.direction == Upload {
+			operation = "upload"
+		}
+		endpointUrl = a.apiClient.Endpoints.Endpoint(operation, a.remote).Url
+	}
+	a.throttle = newThrottleOrWarn(config.NewURLConfig(a.apiClient.GitEnv()), endpointUrl, a.direction)
+
+	if c, ok := cfg.(interface {
+		transferRefresher() func(*Transfer) (*Transfer, error)
+	}); ok {
+		a.refresh = c.transferRefresher()
+	}
+
+	a.gate = newWorkerGate(maxConcurrency)
+	if c, ok := cfg.(interface{ initialConcurrency() int }); ok && c.initialConcurrency() > 0 {
+		a.gate.setLimit(c.initialConcurrency())
+	}
+	if idler, ok := a.transferImpl.(interface{ WorkersIdle(n int) }); ok {
+		a.gate.onIdle = idler.WorkersIdle
+	}
+
 	a.Trace("xfer: adapter %q Begin() with %d workers", a.Name(), maxConcurrency)
 
 	a.workerWait.Add(maxConcurrency)
@@ -128,11 +168,81 @@ func (a *adapterBase) Add(transfers ...*Transfer) <-chan TransferResult {
 	return results
 }
 
+// addEach is an alternative to Add for adapters which split a transfer into
+// several jobs for the workers. It calls fn on a separate goroutine for each
+// transfer, and reports the error it returns as the result of that transfer.
+// fn may use runJobs to hand jobs to the workers.
+func (a *adapterBase) addEach(transfers []*Transfer, fn func(t *Transfer) error) <-chan TransferResult {
+	results := make(chan TransferResult, len(transfers))
+
+	// Keep End() from closing the job channel until fn has returned for
+	// every transfer, as it may still submit more jobs until then.
+	a.jobWait.Add(len(transfers))
+
+	var wg sync.WaitGroup
+	wg.Add(len(transfers))
+	for _, t := range transfers {
+		go func(t *Transfer) {
+			defer wg.Done()
+			defer a.jobWait.Done()
+
+			results <- TransferResult{t, fn(t)}
+		}(t)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// runJobs hands the given transfers to the workers and waits for them all to
+// complete, returning their results in the same order. It may only be called
+// from a function passed to addEach.
+func (a *adapterBase) runJobs(transfers []*Transfer) []TransferResult {
+	results := make(chan TransferResult, len(transfers))
+
+	var wg sync.WaitGroup
+	wg.Add(len(transfers))
+	for _, t := range transfers {
+		a.jobChan <- &job{t, results, &wg}
+	}
+	wg.Wait()
+	close(results)
+
+	byTransfer := make(map[*Transfer]TransferResult, len(transfers))
+	for res := range results {
+		byTransfer[res.Transfer] = res
+	}
+
+	ordered := make([]TransferResult, 0, len(transfers))
+	for _, t := range transfers {
+		ordered = append(ordered, byTransfer[t])
+	}
+	return ordered
+}
+
+// rateLimiter returns the throttle applied to the adapter's transfers, or nil
+// if they are not limited.
+func (a *adapterBase) rateLimiter() *throttle {
+	return a.throttle
+}
+
+// setConcurrency sets the number of workers which take jobs, up to the number
+// started by Begin.
+func (a *adapterBase) setConcurrency(n int) {
+	n = a.gate.setLimit(n)
+	a.Trace("xfer: adapter %q using %d workers", a.Name(), n)
+}
+
 func (a *adapterBase) End() {
 	a.Trace("xfer: adapter %q End()", a.Name())
 
 	a.jobWait.Wait()
 	close(a.jobChan)
+	a.gate.close()
 
 	// wait for all transfers to complete
 	a.workerWait.Wait()
@@ -163,7 +273,12 @@ func (a *adapterBase) worker(workerNum int, ctx interface{}) {
 		a.Trace("xfer: adapter %q worker %d auth signal received", a.Name(), workerNum)
 	}
 
-	for job := range a.jobChan {
+	for {
+		a.gate.wait(workerNum)
+		job, ok := <-a.jobChan
+		if !ok {
+			break
+		}
 		t := job.T
 
 		var authCallback func()
@@ -177,11 +292,14 @@ func (a *adapterBase) worker(workerNum int, ctx interface{}) {
 
 		// Actual transfer happens here
 		var err error
+		a.startTransferSpan(t)
+		start := time.Now()
 		if t.Size < 0 {
 			err = errors.New(tr.Tr.Get("object %q has invalid size (got: %d)", t.Oid, t.Size))
 		} else {
 			err = a.transferImpl.DoTransfer(ctx, t, a.cb, authCallback)
 		}
+		a.endTransferSpan(t, err, time.Since(start))
 
 		// Mark the job as completed, and alter all listeners
 		job.Done(err)
@@ -225,6 +343,7 @@ func (a *adapterBase) newHTTPRequest(method string, rel *Action) (*http.Request,
 }
 
 func (a *adapterBase) doHTTP(t *Transfer, req *http.Request) (*http.Response, error) {
+	req = req.WithContext(telemetry.ContextWithSpan(req.Context(), t.span))
 	if t.Authenticated {
 		return a.apiClient.Do(req)
 	}
@@ -232,6 +351,41 @@ func (a *adapterBase) doHTTP(t *Transfer, req *http.Request) (*http.Response, er
 	return a.apiClient.DoWithAuthNoRetry(a.remote, a.apiClient.Endpoints.AccessFor(endpoint), req)
 }
 
+// refreshExpiredAction replaces the actions of t with fresh ones from the
+// batch API if a request made using action, named rel, was rejected with a 403
+// status code because its signed URL had most likely expired: either the
+// action's own expiry time has passed, or the request was resuming a transfer
+// which the same URL had already served in part. It returns whether the
+// actions were replaced, in which case the request should be made again.
+//
+// An action which was itself a replacement is not replaced again.
+func (a *adapterBase) refreshExpiredAction(t *Transfer, rel string, action *Action, res *http.Response, resuming bool) bool {
+	if a.refresh == nil || res == nil || res.StatusCode != 403 || action.refreshed {
+		return false
+	}
+	if _, expired := action.IsExpiredWithin(0); !expired && !resuming {
+		return false
+	}
+
+	fresh, err := a.refresh(t)
+	if err != nil {
+		a.Trace("xfer: unable to refresh %q action for %q: %s", rel, t.Oid, err)
+		return false
+	}
+	if fresh.Actions[rel] == nil {
+		a.Trace("xfer: no %q action for %q after refresh", rel, t.Oid)
+		return false
+	}
+
+	for _, action := range fresh.Actions {
+		action.refreshed = true
+	}
+	t.Actions = fresh.Actions
+	t.Authenticated = fresh.Authenticated
+	a.Trace("xfer: refreshed expired %q action for %q", rel, t.Oid)
+	return true
+}
+
 func advanceCallbackProgress(cb ProgressCallback, t *Transfer, numBytes int64) {
 	if cb != nil {
 		// Must split into max int sizes since read count is int
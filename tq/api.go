@@ -1,12 +1,14 @@
 package tq
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/git"
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
 	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/rubyist/tracerx"
 )
@@ -26,6 +28,7 @@ type batchRequest struct {
 	TransferAdapterNames []string    `json:"transfers,omitempty"`
 	Ref                  *batchRef   `json:"ref"`
 	HashAlgorithm        string      `json:"hash_algo"`
+	ContentEncodings     []string    `json:"content_encodings,omitempty"`
 }
 
 type BatchResponse struct {
@@ -35,20 +38,120 @@ type BatchResponse struct {
 	endpoint            lfshttp.Endpoint
 }
 
+// Batch makes a batch API request for the given objects. Since each request
+// names a single hash algorithm, objects whose OIDs were computed with
+// different algorithms are sent in separate requests, and the responses are
+// merged. Downloads consult the cache server first, if one is configured, and
+// then any mirrors of the remote, before the remote itself.
 func Batch(m Manifest, dir Direction, remote string, remoteRef *git.Ref, objects []*Transfer) (*BatchResponse, error) {
 	if len(objects) == 0 {
 		return &BatchResponse{}, nil
 	}
 
 	cm := m.Upgrade()
+	upstream := func(objects []*Transfer) (*BatchResponse, error) {
+		return batchByHashAlgorithm(cm, dir, remoteRef, objects, func(bReq *batchRequest) (*BatchResponse, error) {
+			return cm.batchClient().Batch(remote, bReq)
+		})
+	}
+	if dir == Download && cm.mirrors.Len() > 0 {
+		primary := upstream
+		upstream = func(objects []*Transfer) (*BatchResponse, error) {
+			return batchWithMirrors(cm, remote, remoteRef, objects, primary)
+		}
+	}
+	if dir == Download && len(cm.cacheServer) > 0 {
+		return batchWithCache(cm, objects, upstream)
+	}
+	return upstream(objects)
+}
 
-	return cm.batchClient().Batch(remote, &batchRequest{
-		Operation:            dir.String(),
-		Objects:              objects,
-		TransferAdapterNames: m.GetAdapterNames(dir),
-		Ref:                  &batchRef{Name: remoteRef.Refspec()},
-		HashAlgorithm:        "sha256",
-	})
+// batchByHashAlgorithm makes a batch request for each group of objects whose
+// OIDs use the same hash algorithm, using the given function, and merges the
+// responses.
+func batchByHashAlgorithm(cm *concreteManifest, dir Direction, remoteRef *git.Ref, objects []*Transfer, batch func(*batchRequest) (*BatchResponse, error)) (*BatchResponse, error) {
+	var bRes *BatchResponse
+	for _, group := range groupByHashAlgorithm(objects) {
+		res, err := batch(&batchRequest{
+			Operation:            dir.String(),
+			Objects:              group.objects,
+			TransferAdapterNames: cm.GetAdapterNames(dir),
+			Ref:                  &batchRef{Name: remoteRef.Refspec()},
+			HashAlgorithm:        group.algo.String(),
+			ContentEncodings:     cm.contentEncodings,
+		})
+		if err != nil {
+			return res, err
+		}
+		for _, o := range res.Objects {
+			o.HashAlgorithm = group.algo
+		}
+
+		if bRes == nil {
+			bRes = res
+			continue
+		}
+
+		if adapterNameOrDefault(res.TransferAdapterName) != adapterNameOrDefault(bRes.TransferAdapterName) {
+			return nil, errors.New(tr.Tr.Get("batch response: server selected transfer adapters %q and %q for different hash algorithms", bRes.TransferAdapterName, res.TransferAdapterName))
+		}
+		bRes.Objects = append(bRes.Objects, res.Objects...)
+	}
+
+	return bRes, nil
+}
+
+type hashAlgorithmGroup struct {
+	algo    tools.HashAlgorithm
+	objects []*Transfer
+}
+
+// groupByHashAlgorithm partitions the given objects by the hash algorithm
+// with which their OIDs were computed, preserving their relative order. Groups are returned in the
+// order in which their algorithm was first seen.
+func groupByHashAlgorithm(objects []*Transfer) []*hashAlgorithmGroup {
+	var groups []*hashAlgorithmGroup
+	byAlgo := make(map[tools.HashAlgorithm]*hashAlgorithmGroup)
+
+	for _, obj := range objects {
+		algo := obj.HashAlgorithm.OrDefault()
+		group, ok := byAlgo[algo]
+		if !ok {
+			group = &hashAlgorithmGroup{algo: algo}
+			byAlgo[algo] = group
+			groups = append(groups, group)
+		}
+		group.objects = append(group.objects, obj)
+	}
+
+	return groups
+}
+
+// checkHashAlgorithm returns an error if the hash algorithm named in a batch
+// response, "got", does not agree with the one we requested, "want". Per the
+// API specification, an omitted algorithm means SHA-256.
+func checkHashAlgorithm(want, got string) error {
+	if got == "" {
+		got = tools.DefaultHashAlgorithm.String()
+	}
+	if want == "" {
+		want = tools.DefaultHashAlgorithm.String()
+	}
+
+	if _, err := tools.ParseHashAlgorithm(got); err != nil {
+		return err
+	}
+	if got != want {
+		return errors.New(tr.Tr.Get("unsupported hash algorithm: server uses %q, but %q was requested", got, want))
+	}
+	return nil
+}
+
+func adapterNameOrDefault(name string) string {
+	if name == "" {
+		return BasicAdapterName
+	}
+	return name
 }
 
 type BatchClient interface {
@@ -66,6 +169,21 @@ func (c *tqClient) SetMaxRetries(n int) {
 }
 
 func (c *tqClient) Batch(remote string, bReq *batchRequest) (*BatchResponse, error) {
+	return c.batch(c.Endpoints.Endpoint(bReq.Operation, remote), bReq, func(req *http.Request) (*http.Response, error) {
+		return c.DoAPIRequestWithAuth(remote, req)
+	})
+}
+
+// mirrorBatch makes a batch request to the download mirror of the given
+// remote at endpoint e, using the credentials for the mirror's URL.
+func (c *tqClient) mirrorBatch(remote string, e lfshttp.Endpoint, bReq *batchRequest) (*BatchResponse, error) {
+	access := c.Endpoints.AccessFor(e.Url)
+	return c.batch(e, bReq, func(req *http.Request) (*http.Response, error) {
+		return c.DoWithAuth(remote, access, req)
+	})
+}
+
+func (c *tqClient) batch(e lfshttp.Endpoint, bReq *batchRequest, do func(*http.Request) (*http.Response, error)) (_ *BatchResponse, err error) {
 	bRes := &BatchResponse{}
 	if len(bReq.Objects) == 0 {
 		return bRes, nil
@@ -75,9 +193,12 @@ func (c *tqClient) Batch(remote string, bReq *batchRequest) (*BatchResponse, err
 		bReq.TransferAdapterNames = nil
 	}
 
-	bRes.endpoint = c.Endpoints.Endpoint(bReq.Operation, remote)
+	bRes.endpoint = e
 	requestedAt := time.Now()
 
+	ctx, span := startBatchSpan(e, bReq)
+	defer func() { endBatchSpan(span, bReq.Operation, err, time.Since(requestedAt)) }()
+
 	req, err := c.NewRequest("POST", bRes.endpoint, "objects/batch", bReq)
 	if err != nil {
 		return nil, errors.Wrap(err, tr.Tr.Get("batch request"))
@@ -85,8 +206,8 @@ func (c *tqClient) Batch(remote string, bReq *batchRequest) (*BatchResponse, err
 
 	tracerx.Printf("api: batch %d files", len(bReq.Objects))
 
-	req = c.Client.LogRequest(req, "lfs.batch")
-	res, err := c.DoAPIRequestWithAuth(remote, lfshttp.WithRetries(req, c.MaxRetries()))
+	req = c.Client.LogRequest(req.WithContext(ctx), "lfs.batch")
+	res, err := do(lfshttp.WithRetries(req, c.MaxRetries()))
 	if err != nil {
 		tracerx.Printf("api error: %s", err)
 		return nil, errors.Wrap(err, tr.Tr.Get("batch response"))
@@ -96,8 +217,12 @@ func (c *tqClient) Batch(remote string, bReq *batchRequest) (*BatchResponse, err
 		return bRes, errors.Wrap(err, tr.Tr.Get("batch response"))
 	}
 
-	if bRes.HashAlgorithm != "" && bRes.HashAlgorithm != "sha256" {
-		return bRes, errors.Wrap(errors.New(tr.Tr.Get("unsupported hash algorithm")), tr.Tr.Get("batch response"))
+	if err := checkHashAlgorithm(bReq.HashAlgorithm, bRes.HashAlgorithm); err != nil {
+		return bRes, errors.Wrap(err, tr.Tr.Get("batch response"))
+	}
+
+	if err := checkContentEncodings(bReq.ContentEncodings, bRes.Objects); err != nil {
+		return bRes, errors.Wrap(err, tr.Tr.Get("batch response"))
 	}
 
 	if res.StatusCode != 200 {
@@ -108,6 +233,9 @@ func (c *tqClient) Batch(remote string, bReq *batchRequest) (*BatchResponse, err
 		for _, a := range obj.Actions {
 			a.createdAt = requestedAt
 		}
+		for _, a := range obj.Parts {
+			a.createdAt = requestedAt
+		}
 	}
 
 	return bRes, nil
@@ -3,6 +3,7 @@ package tq
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
 	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/xeipuuv/gojsonschema"
@@ -139,6 +141,145 @@ func TestAPIBatchEmptyObjects(t *testing.T) {
 	assert.Equal(t, 0, len(bRes.Objects))
 }
 
+func TestAPIBatchHashAlgorithm(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bReq := &batchRequest{}
+		err := json.NewDecoder(r.Body).Decode(bReq)
+		r.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, "sha512", bReq.HashAlgorithm)
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(&BatchResponse{
+			Objects:       bReq.Objects,
+			HashAlgorithm: bReq.HashAlgorithm,
+		})
+		assert.Nil(t, err)
+	}))
+	defer srv.Close()
+
+	c := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url": srv.URL + "/api",
+	}))
+
+	tqc := &tqClient{Client: c}
+	bReq := &batchRequest{
+		Objects: []*Transfer{
+			&Transfer{Oid: strings.Repeat("a", 128), Size: 1},
+		},
+		HashAlgorithm: "sha512",
+	}
+	bRes, err := tqc.Batch("remote", bReq)
+	require.Nil(t, err)
+	assert.Equal(t, "sha512", bRes.HashAlgorithm)
+}
+
+func TestAPIBatchHashAlgorithmUnsupportedByServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bReq := &batchRequest{}
+		err := json.NewDecoder(r.Body).Decode(bReq)
+		r.Body.Close()
+		assert.Nil(t, err)
+
+		// An older server ignores the requested algorithm and
+		// omits hash_algo, which implies SHA-256.
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(&BatchResponse{
+			Objects: bReq.Objects,
+		})
+		assert.Nil(t, err)
+	}))
+	defer srv.Close()
+
+	c := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url": srv.URL + "/api",
+	}))
+
+	tqc := &tqClient{Client: c}
+	bReq := &batchRequest{
+		Objects: []*Transfer{
+			&Transfer{Oid: strings.Repeat("a", 128), Size: 1},
+		},
+		HashAlgorithm: "sha512",
+	}
+	_, err := tqc.Batch("remote", bReq)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unsupported hash algorithm")
+}
+
+func TestAPIBatchContentEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		by, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		require.Nil(t, err)
+		assertSchema(t, batchReqSchema, gojsonschema.NewBytesLoader(by))
+
+		bReq := &batchRequest{}
+		require.Nil(t, json.Unmarshal(by, bReq))
+		assert.Contains(t, bReq.ContentEncodings, "gzip")
+
+		// Always select zstd, whether or not the client offered it.
+		for _, o := range bReq.Objects {
+			o.ContentEncoding = "zstd"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		by, err = json.Marshal(&BatchResponse{Objects: bReq.Objects})
+		require.Nil(t, err)
+		assertSchema(t, batchResSchema, gojsonschema.NewBytesLoader(by))
+		w.Write(by)
+	}))
+	defer srv.Close()
+
+	c := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url": srv.URL + "/api",
+	}))
+
+	tqc := &tqClient{Client: c}
+	bReq := &batchRequest{
+		Operation: "upload",
+		Objects: []*Transfer{
+			&Transfer{Oid: "a", Size: 1},
+		},
+		ContentEncodings: []string{"zstd", "gzip"},
+	}
+	bRes, err := tqc.Batch("remote", bReq)
+	require.Nil(t, err)
+	require.Len(t, bRes.Objects, 1)
+	assert.Equal(t, "zstd", bRes.Objects[0].ContentEncoding)
+
+	bReq.ContentEncodings = []string{"gzip"}
+	_, err = tqc.Batch("remote", bReq)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unsupported content encoding")
+}
+
+func TestGroupByHashAlgorithm(t *testing.T) {
+	sha256a := &Transfer{Oid: strings.Repeat("a", 64)}
+	sha512b := &Transfer{Oid: strings.Repeat("b", 128), HashAlgorithm: tools.SHA512}
+	sha256c := &Transfer{Oid: strings.Repeat("c", 64), HashAlgorithm: tools.SHA256}
+	blake3d := &Transfer{Oid: strings.Repeat("d", 64), HashAlgorithm: tools.BLAKE3}
+
+	groups := groupByHashAlgorithm([]*Transfer{sha256a, sha512b, sha256c, blake3d})
+	require.Len(t, groups, 3)
+
+	assert.Equal(t, tools.SHA256, groups[0].algo)
+	assert.Equal(t, []*Transfer{sha256a, sha256c}, groups[0].objects)
+	assert.Equal(t, tools.SHA512, groups[1].algo)
+	assert.Equal(t, []*Transfer{sha512b}, groups[1].objects)
+	assert.Equal(t, tools.BLAKE3, groups[2].algo)
+	assert.Equal(t, []*Transfer{blake3d}, groups[2].objects)
+}
+
+func TestCheckHashAlgorithm(t *testing.T) {
+	assert.NoError(t, checkHashAlgorithm("sha256", ""))
+	assert.NoError(t, checkHashAlgorithm("", "sha256"))
+	assert.NoError(t, checkHashAlgorithm("sha512", "sha512"))
+	assert.Error(t, checkHashAlgorithm("sha512", ""))
+	assert.Error(t, checkHashAlgorithm("sha256", "sha512"))
+	assert.Error(t, checkHashAlgorithm("sha256", "invalid"))
+}
+
 var (
 	batchReqSchema *sourcedSchema
 	batchResSchema *sourcedSchema
@@ -1,6 +1,7 @@
 package tq
 
 import (
+	"compress/gzip"
 	"fmt"
 	"hash"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/git-lfs/git-lfs/v3/config"
 	"github.com/git-lfs/git-lfs/v3/errors"
@@ -19,9 +21,19 @@ import (
 	"github.com/rubyist/tracerx"
 )
 
-// Adapter for basic HTTP downloads, includes resuming via HTTP Range
+// Adapter for basic HTTP downloads, includes resuming via HTTP Range, and
+// fetching large objects as several ranges in parallel
 type basicDownloadAdapter struct {
 	*adapterBase
+
+	// rangeThreshold is the size above which objects are downloaded as
+	// rangeParts byte ranges in parallel. Zero disables ranged downloads.
+	rangeThreshold int64
+	rangeParts     int
+	maxRetries     int
+
+	rangesMu sync.Mutex
+	ranges   map[*Transfer]*downloadRange
 }
 
 type basicDownloadAdapterWorkerContext struct {
@@ -60,6 +72,10 @@ func (a *basicDownloadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progr
 		return errors.New(tr.Tr.Get("context object for basic download transfer adapter was of the wrong type"))
 	}
 
+	if r := a.rangeFor(t); r != nil {
+		return a.downloadRange(t, r, cb, authOkFunc)
+	}
+
 	// Reserve a temporary filename. We need to make sure nobody operates on the file simultaneously with us.
 	f, err := tools.TempFile(a.tempDir(), t.Oid, a.fs)
 	if err != nil {
@@ -93,7 +109,7 @@ func (a *basicDownloadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progr
 	}
 
 	// Read any existing data into hash
-	hash := tools.NewLfsContentHash()
+	hash := t.HashAlgorithm.OrDefault().New()
 	fromByte, err := io.Copy(hash, f)
 	if err != nil {
 		return err
@@ -151,6 +167,10 @@ func (a *basicDownloadAdapter) download(context *basicDownloadAdapterWorkerConte
 	if fromByte > 0 {
 		// We could just use a start byte, but since we know the length be specific
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", fromByte, t.Size-1))
+	} else if len(t.ContentEncoding) > 0 {
+		// The server selected an encoding for this object in the
+		// batch response, which overrides the configured one.
+		req.Header.Set("Accept-Encoding", t.ContentEncoding)
 	} else {
 		// Set Accept-Encoding header if configured to zstd
 		// (Go's http client handles gzip automatically when no Accept-Encoding is set)
@@ -189,6 +209,12 @@ func (a *basicDownloadAdapter) download(context *basicDownloadAdapterWorkerConte
 			return a.download(context, t, cb, authOkFunc, dlFile, 0, nil)
 		}
 
+		// A signed URL which has expired is rejected, so fetch a fresh
+		// one and carry on from the same byte.
+		if a.refreshExpiredAction(t, "download", rel, res, fromByte > 0) {
+			return a.download(context, t, cb, authOkFunc, dlFile, fromByte, hash)
+		}
+
 		// Special-cae status code 429 - retry after certain time
 		if res.StatusCode == 429 {
 			retLaterErr := errors.NewRetriableLaterError(err, res.Header.Get("Retry-After"))
@@ -260,20 +286,33 @@ func (a *basicDownloadAdapter) download(context *basicDownloadAdapterWorkerConte
 		authOkFunc()
 	}
 
-	// Handle Content-Encoding decompression for zstd
-	// (gzip is handled automatically by Go's http client when we don't set Accept-Encoding)
-	var bodyReader io.Reader = res.Body
-	if strings.ToLower(res.Header.Get("Content-Encoding")) == "zstd" {
+	// Handle Content-Encoding decompression for zstd, and for gzip when
+	// the server selected it for this object (otherwise gzip is handled
+	// automatically by Go's http client when we don't set Accept-Encoding)
+	body := a.throttle.reader(res.Body)
+	bodyReader := body
+	switch strings.ToLower(res.Header.Get("Content-Encoding")) {
+	case contentEncodingGzip:
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return errors.NewRetriableError(errors.Wrap(err, tr.Tr.Get("failed to create gzip decompressor")))
+		}
+		defer gzipReader.Close()
+		bodyReader = gzipReader
+
+		tracerx.Printf("http: decompressing gzip-encoded response")
+		res.ContentLength = -1
+	case contentEncodingZstd:
 		zstdDecoder := context.zstdDecoder
 		if zstdDecoder == nil {
-			zstdDecoder, err := zstd.NewReader(res.Body, zstd.WithDecoderConcurrency(1))
+			zstdDecoder, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
 			if err != nil {
 				return errors.Wrap(err, tr.Tr.Get("failed to create zstd decompressor"))
 			}
 			context.zstdDecoder = zstdDecoder
 			tracerx.Printf("http: initialized zstd decoder")
 		} else {
-			zstdDecoder.Reset(res.Body)
+			zstdDecoder.Reset(body)
 		}
 		bodyReader = context.zstdDecoder
 
@@ -294,7 +333,7 @@ func (a *basicDownloadAdapter) download(context *basicDownloadAdapterWorkerConte
 		// pre-load hashing reader with previous content
 		hasher = tools.NewHashingReaderPreloadHash(httpReader, hash)
 	} else {
-		hasher = tools.NewHashingReader(httpReader)
+		hasher = tools.NewHashingReaderPreloadHash(httpReader, t.HashAlgorithm.OrDefault().New())
 	}
 
 	dlfilename := dlFile.Name()
@@ -330,7 +369,13 @@ func configureBasicDownloadAdapter(m *concreteManifest) {
 	m.RegisterNewAdapterFunc(BasicAdapterName, Download, false, func(name string, dir Direction) Adapter {
 		switch dir {
 		case Download:
-			bd := &basicDownloadAdapter{newAdapterBase(m.fs, name, dir, nil)}
+			bd := &basicDownloadAdapter{
+				adapterBase:    newAdapterBase(m.fs, name, dir, nil),
+				rangeThreshold: m.rangedDownloadThreshold,
+				rangeParts:     m.rangedDownloadParts,
+				maxRetries:     m.maxRetries,
+				ranges:         make(map[*Transfer]*downloadRange),
+			}
 			// self implements impl
 			bd.transferImpl = bd
 			return bd
@@ -0,0 +1,365 @@
+package tq
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// minDownloadRangeSize is the smallest byte range an object is split into,
+// so that small objects above the threshold aren't split into many tiny
+// requests.
+const minDownloadRangeSize = 1024 * 1024
+
+var contentRangeRE = regexp.MustCompile(`bytes (\d+)\-.*`)
+
+// errRangesUnsupported is returned when a server doesn't honour a Range
+// request, in which case the object is downloaded in one piece instead.
+var errRangesUnsupported = errors.New(tr.Tr.Get("server does not support ranged downloads"))
+
+// rangedDownload is an object being downloaded as several byte ranges in
+// parallel, each written directly into its place in file.
+type rangedDownload struct {
+	t    *Transfer
+	file *os.File
+
+	// progress is the number of bytes downloaded across all ranges, and
+	// must be accessed atomically.
+	progress int64
+	// served is true once any range has been served, after which a 403
+	// response most likely means that the object's URL has expired.
+	served atomic.Bool
+
+	// refreshMu guards refreshed, the fresh actions fetched by the first
+	// range to find that the object's URL had expired, which are shared
+	// with the others.
+	refreshMu sync.Mutex
+	refreshed ActionSet
+}
+
+// advance adds n bytes to the progress of the download and reports it to cb
+// on behalf of the whole object.
+func (d *rangedDownload) advance(cb ProgressCallback, n int) error {
+	read := atomic.AddInt64(&d.progress, int64(n))
+	if cb != nil && n != 0 {
+		return cb(d.t.Name, d.t.Size, read, n)
+	}
+	return nil
+}
+
+// downloadRange is a single byte range of a rangedDownload, from start to end
+// inclusive.
+type downloadRange struct {
+	download *rangedDownload
+	start    int64
+	end      int64
+}
+
+// Add overrides adapterBase.Add so that objects above the configured size
+// threshold are split into byte ranges for the workers to download in
+// parallel. Other objects are downloaded as usual.
+func (a *basicDownloadAdapter) Add(transfers ...*Transfer) <-chan TransferResult {
+	if a.rangeThreshold <= 0 || a.rangeParts < 2 {
+		return a.adapterBase.Add(transfers...)
+	}
+
+	var whole, ranged []*Transfer
+	for _, t := range transfers {
+		if a.useRanges(t) {
+			ranged = append(ranged, t)
+		} else {
+			whole = append(whole, t)
+		}
+	}
+	if len(ranged) == 0 {
+		return a.adapterBase.Add(whole...)
+	}
+
+	results := make(chan TransferResult, len(transfers))
+	sources := []<-chan TransferResult{a.addEach(ranged, a.rangedDownload)}
+	if len(whole) > 0 {
+		sources = append(sources, a.adapterBase.Add(whole...))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(sources))
+	for _, source := range sources {
+		go func(source <-chan TransferResult) {
+			defer wg.Done()
+			for res := range source {
+				results <- res
+			}
+		}(source)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// useRanges returns whether t should be downloaded as several byte ranges.
+// Partially downloaded objects are instead resumed from where they stopped,
+// and objects the server asked to compress are downloaded in one piece.
+func (a *basicDownloadAdapter) useRanges(t *Transfer) bool {
+	if t.Size < a.rangeThreshold || t.Size < 2*minDownloadRangeSize {
+		return false
+	}
+	if len(t.ContentEncoding) > 0 {
+		return false
+	}
+	_, err := os.Stat(a.downloadFilename(t))
+	return os.IsNotExist(err)
+}
+
+func (a *basicDownloadAdapter) rangeFor(t *Transfer) *downloadRange {
+	a.rangesMu.Lock()
+	defer a.rangesMu.Unlock()
+
+	return a.ranges[t]
+}
+
+// splitRanges returns the byte ranges into which d is divided, along with a
+// Transfer for the workers to process for each.
+func (a *basicDownloadAdapter) splitRanges(d *rangedDownload) []*Transfer {
+	n := int64(a.rangeParts)
+	if max := d.t.Size / minDownloadRangeSize; n > max {
+		n = max
+	}
+	size := (d.t.Size + n - 1) / n
+
+	a.rangesMu.Lock()
+	defer a.rangesMu.Unlock()
+
+	transfers := make([]*Transfer, 0, n)
+	for start := int64(0); start < d.t.Size; start += size {
+		t := newTransfer(d.t, d.t.Name, d.t.Path)
+		a.ranges[t] = &downloadRange{
+			download: d,
+			start:    start,
+			end:      min(start+size, d.t.Size) - 1,
+		}
+		transfers = append(transfers, t)
+	}
+	return transfers
+}
+
+func (a *basicDownloadAdapter) releaseRanges(transfers []*Transfer) {
+	a.rangesMu.Lock()
+	defer a.rangesMu.Unlock()
+
+	for _, t := range transfers {
+		delete(a.ranges, t)
+	}
+}
+
+// rangedDownload downloads t as several byte ranges in parallel, retrying
+// individual ranges which fail, and then verifies the whole object before
+// moving it into place.
+func (a *basicDownloadAdapter) rangedDownload(t *Transfer) error {
+	f, err := tools.TempFile(a.tempDir(), t.Oid, a.fs)
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		f.Close()
+		os.Remove(tmpName)
+	}()
+
+	if err := f.Truncate(t.Size); err != nil {
+		return err
+	}
+
+	d := &rangedDownload{t: t, file: f}
+	ranges := a.splitRanges(d)
+	defer a.releaseRanges(ranges)
+
+	a.Trace("xfer: downloading %q in %d ranges", t.Oid, len(ranges))
+
+	pending := ranges
+	for attempt := 0; len(pending) > 0; attempt++ {
+		var failed []*Transfer
+		var lastErr error
+		for _, res := range a.runJobs(pending) {
+			if res.Error == nil {
+				continue
+			}
+			if res.Error == errRangesUnsupported {
+				tracerx.Printf("xfer: server did not honour range request for %q; downloading in one piece", t.Oid)
+				d.advance(a.cb, -int(atomic.LoadInt64(&d.progress)))
+				return a.runJobs([]*Transfer{t})[0].Error
+			}
+
+			failed = append(failed, res.Transfer)
+			if lastErr == nil || errors.IsRetriableError(lastErr) {
+				lastErr = res.Error
+			}
+		}
+
+		if lastErr == nil {
+			break
+		}
+		if !errors.IsRetriableError(lastErr) || attempt >= a.maxRetries {
+			return lastErr
+		}
+		if _, later := errors.IsRetriableLaterError(lastErr); later {
+			return lastErr
+		}
+
+		a.Trace("xfer: retrying %d failed range(s) of %q", len(failed), t.Oid)
+		pending = failed
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := t.HashAlgorithm.OrDefault().New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != t.Oid {
+		return errors.New(tr.Tr.Get("expected OID %s, got %s after %d bytes written", t.Oid, actual, t.Size))
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.New(tr.Tr.Get("can't close temporary file %q: %v", tmpName, err))
+	}
+
+	err = tools.RenameFileCopyPermissions(tmpName, t.Path)
+	if _, err2 := os.Stat(t.Path); err2 == nil {
+		// Target file already exists, possibly was downloaded by other git-lfs process
+		return nil
+	}
+	return err
+}
+
+// downloadRange downloads a single byte range of an object, as returned by
+// splitRanges, and writes it into place in the object's temporary file.
+func (a *basicDownloadAdapter) downloadRange(t *Transfer, r *downloadRange, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Rel("download")
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		return errors.New(tr.Tr.Get("Object %s not found on the server.", t.Oid))
+	}
+
+	req, err := a.newHTTPRequest("GET", rel)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.start, r.end))
+	// Content encodings apply to the whole object, not the range, so
+	// don't let Go's http client negotiate gzip.
+	req.Header.Set("Accept-Encoding", "identity")
+
+	req = a.apiClient.LogRequest(req, "lfs.data.download")
+	res, err := a.makeRequest(t, req)
+	if err != nil {
+		if res == nil {
+			return errors.NewRetriableError(err)
+		}
+		if a.refreshRangeAction(t, r, rel, res) {
+			return a.downloadRange(t, r, cb, authOkFunc)
+		}
+		if res.StatusCode == 429 {
+			retLaterErr := errors.NewRetriableLaterError(err, res.Header.Get("Retry-After"))
+			if retLaterErr != nil {
+				return retLaterErr
+			}
+		}
+		return errors.NewRetriableError(err)
+	}
+	defer res.Body.Close()
+
+	if !isContentRangeFrom(res, r.start) {
+		return errRangesUnsupported
+	}
+	r.download.served.Store(true)
+
+	// Signal auth OK on success response, before starting download to free up
+	// other workers immediately
+	if authOkFunc != nil {
+		authOkFunc()
+	}
+
+	length := r.end - r.start + 1
+	var written int64
+	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		written = readSoFar
+		return r.download.advance(cb, readSinceLast)
+	}
+
+	w := io.NewOffsetWriter(r.download.file, r.start)
+	body := io.LimitReader(tools.NewRetriableReader(a.throttle.reader(res.Body)), length)
+	if _, err := tools.CopyWithCallback(w, body, length, ccb); err != nil {
+		r.download.advance(cb, -int(written))
+		return errors.NewRetriableError(errors.Wrap(err, tr.Tr.Get("cannot write data to temporary file %q", r.download.file.Name())))
+	}
+	if written != length {
+		r.download.advance(cb, -int(written))
+		return errors.NewRetriableError(errors.New(tr.Tr.Get("expected %d bytes for range %d-%d of %s, got %d", length, r.start, r.end, t.Oid, written)))
+	}
+	return nil
+}
+
+// refreshRangeAction replaces the actions of t, a single range of an object,
+// if the request made using rel was rejected because the object's URL had
+// expired, as refreshExpiredAction does. The fresh actions are shared by all
+// the object's ranges, so that only one batch request is made for them.
+func (a *basicDownloadAdapter) refreshRangeAction(t *Transfer, r *downloadRange, rel *Action, res *http.Response) bool {
+	d := r.download
+	d.refreshMu.Lock()
+	defer d.refreshMu.Unlock()
+
+	if d.refreshed != nil && !rel.refreshed {
+		t.Actions = copyActions(d.refreshed)
+		t.Authenticated = d.t.Authenticated
+		return true
+	}
+	if !a.refreshExpiredAction(t, "download", rel, res, d.served.Load()) {
+		return false
+	}
+
+	d.refreshed = copyActions(t.Actions)
+	d.t.Actions = copyActions(t.Actions)
+	d.t.Authenticated = t.Authenticated
+	return true
+}
+
+func copyActions(actions ActionSet) ActionSet {
+	c := make(ActionSet, len(actions))
+	for rel, action := range actions {
+		c[rel] = action.copy()
+	}
+	return c
+}
+
+// isContentRangeFrom returns whether res is a partial content response whose
+// Content-Range begins at the given byte.
+func isContentRangeFrom(res *http.Response, start int64) bool {
+	if res.StatusCode != 206 {
+		return false
+	}
+	match := contentRangeRE.FindStringSubmatch(res.Header.Get("Content-Range"))
+	if len(match) < 2 {
+		return false
+	}
+	contentStart, err := strconv.ParseInt(match[1], 10, 64)
+	return err == nil && contentStart == start
+}
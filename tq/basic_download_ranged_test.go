@@ -0,0 +1,161 @@
+package tq
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rangeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	ranges   []string
+	ignore   bool
+	failures int
+}
+
+func newRangeServer(data []byte) *rangeServer {
+	s := &rangeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		ignore := s.ignore
+		fail := s.failures > 0 && r.Header.Get("Range") != ""
+		if fail {
+			s.failures--
+		}
+		s.mu.Unlock()
+
+		if fail {
+			w.WriteHeader(500)
+			return
+		}
+		if ignore {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "object", time.Time{}, bytes.NewReader(data))
+	}))
+	return s
+}
+
+func runRangedDownload(t *testing.T, srv *rangeServer, data []byte, gitEnv map[string]string) error {
+	gitDir := t.TempDir()
+	f := fs.New(config.EnvironmentOf(config.MapFetcher(nil)), gitDir, "", filepath.Join(gitDir, "lfs"), 0755)
+
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, gitEnv))
+	defer cli.Close()
+
+	m := NewManifest(f, cli, "", "")
+	a := m.NewDownloadAdapter(BasicAdapterName)
+
+	sum := sha256.Sum256(data)
+	path := filepath.Join(t.TempDir(), "object")
+	tr := &Transfer{
+		Name:          "object",
+		Oid:           hex.EncodeToString(sum[:]),
+		Size:          int64(len(data)),
+		Path:          path,
+		Authenticated: true,
+		Actions: ActionSet{
+			"download": &Action{Href: srv.URL + "/object"},
+		},
+	}
+
+	var mu sync.Mutex
+	var progress int64
+	cb := func(name string, total, read int64, current int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "object", name)
+		assert.Equal(t, tr.Size, total)
+		progress += int64(current)
+		return nil
+	}
+
+	require.NoError(t, a.Begin(&adapterConfig{apiClient: cli, concurrentTransfers: 4, remote: "origin"}, cb))
+
+	var err error
+	for res := range a.Add(tr) {
+		err = res.Error
+	}
+	a.End()
+
+	if err == nil {
+		assert.Equal(t, tr.Size, progress)
+
+		by, rerr := os.ReadFile(path)
+		require.NoError(t, rerr)
+		assert.Equal(t, data, by)
+	}
+	return err
+}
+
+func rangedTestData() []byte {
+	data := make([]byte, 3*minDownloadRangeSize+12345)
+	for i := range data {
+		data[i] = byte(i * 7 / 5)
+	}
+	return data
+}
+
+func TestBasicDownloadAdapterRanged(t *testing.T) {
+	data := rangedTestData()
+	srv := newRangeServer(data)
+	defer srv.Close()
+
+	srv.failures = 1
+
+	require.NoError(t, runRangedDownload(t, srv, data, map[string]string{
+		"lfs.transfer.rangeddownloadthreshold": "1MB",
+		"lfs.transfer.rangeddownloadparts":     "8",
+	}))
+
+	// The object is only large enough for three ranges of at least
+	// minDownloadRangeSize, one of which is retried.
+	assert.Len(t, srv.ranges, 4)
+	assert.Contains(t, srv.ranges, "bytes=0-1052690")
+	assert.Contains(t, srv.ranges, "bytes=2105382-3158072")
+}
+
+func TestBasicDownloadAdapterRangedBelowThreshold(t *testing.T) {
+	data := rangedTestData()
+	srv := newRangeServer(data)
+	defer srv.Close()
+
+	require.NoError(t, runRangedDownload(t, srv, data, map[string]string{
+		"lfs.transfer.rangeddownloadthreshold": "1GB",
+	}))
+	assert.Equal(t, []string{""}, srv.ranges)
+}
+
+func TestBasicDownloadAdapterRangedUnsupported(t *testing.T) {
+	data := rangedTestData()
+	srv := newRangeServer(data)
+	defer srv.Close()
+
+	srv.ignore = true
+
+	require.NoError(t, runRangedDownload(t, srv, data, map[string]string{
+		"lfs.transfer.rangeddownloadthreshold": "1MB",
+		"lfs.transfer.rangeddownloadparts":     "2",
+	}))
+
+	// Both ranges are attempted, and then the whole object is downloaded.
+	require.Len(t, srv.ranges, 3)
+	assert.Equal(t, "", srv.ranges[2])
+}
@@ -0,0 +1,236 @@
+package tq
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedURLServer serves an object only to requests bearing its current token,
+// as storage services do with presigned URLs. The token changes after the
+// first request, which is cut short once cutAfter bytes have been sent, if
+// that is not zero.
+type signedURLServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	token    string
+	cutAfter int
+	requests []string
+}
+
+func newSignedURLServer(data []byte, cutAfter int) *signedURLServer {
+	s := &signedURLServer{token: "old", cutAfter: cutAfter}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.Query().Get("token")+" "+r.Header.Get("Range"))
+		valid := r.URL.Query().Get("token") == s.token
+		first := len(s.requests) == 1
+		s.token = "new"
+		s.mu.Unlock()
+
+		if !valid {
+			w.WriteHeader(403)
+			return
+		}
+		if first && s.cutAfter > 0 {
+			w.Header().Set("Content-Length", "1000000")
+			w.WriteHeader(200)
+			w.Write(data[:s.cutAfter])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "object", time.Time{}, bytes.NewReader(data))
+	}))
+	return s
+}
+
+// refreshTo returns a function which refreshes transfers with actions for
+// srv's current token, counting the number of times it is called.
+func (s *signedURLServer) refreshTo(calls *int) func(*Transfer) (*Transfer, error) {
+	var mu sync.Mutex
+	return func(t *Transfer) (*Transfer, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		*calls++
+
+		return &Transfer{
+			Oid:           t.Oid,
+			Size:          t.Size,
+			Authenticated: true,
+			Actions: ActionSet{
+				"download": &Action{Href: s.URL + "/object?token=new"},
+			},
+		}, nil
+	}
+}
+
+// runSignedDownload downloads data from srv into a repository at gitDir, so
+// that a download cut short by one call may be resumed by the next.
+func runSignedDownload(t *testing.T, srv *signedURLServer, data []byte, gitDir string, gitEnv map[string]string, refresh func(*Transfer) (*Transfer, error)) error {
+	f := fs.New(config.EnvironmentOf(config.MapFetcher(nil)), gitDir, "", filepath.Join(gitDir, "lfs"), 0755)
+
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, gitEnv))
+	defer cli.Close()
+
+	m := NewManifest(f, cli, "", "")
+	a := m.NewDownloadAdapter(BasicAdapterName)
+
+	sum := sha256.Sum256(data)
+	path := filepath.Join(t.TempDir(), "object")
+	tr := &Transfer{
+		Name:          "object",
+		Oid:           hex.EncodeToString(sum[:]),
+		Size:          int64(len(data)),
+		Path:          path,
+		Authenticated: true,
+		Actions: ActionSet{
+			"download": &Action{Href: srv.URL + "/object?token=old"},
+		},
+	}
+
+	var mu sync.Mutex
+	var progress int64
+	cb := func(name string, total, read int64, current int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		progress += int64(current)
+		return nil
+	}
+
+	require.NoError(t, a.Begin(&adapterConfig{
+		apiClient:           cli,
+		concurrentTransfers: 4,
+		remote:              "origin",
+		refresh:             refresh,
+	}, cb))
+
+	var err error
+	for res := range a.Add(tr) {
+		err = res.Error
+	}
+	a.End()
+
+	if err == nil {
+		assert.Equal(t, tr.Size, progress)
+
+		by, rerr := os.ReadFile(path)
+		require.NoError(t, rerr)
+		assert.Equal(t, data, by)
+	}
+	return err
+}
+
+func TestBasicDownloadAdapterRefreshesExpiredURLWhenResuming(t *testing.T) {
+	data := bytes.Repeat([]byte("signed"), 1000000/6)
+	srv := newSignedURLServer(data, 4096)
+	defer srv.Close()
+
+	gitDir := t.TempDir()
+	var calls int
+	err := runSignedDownload(t, srv, data, gitDir, nil, srv.refreshTo(&calls))
+	require.Error(t, err)
+
+	// The interrupted download is left for the transfer queue to retry.
+	assert.True(t, errors.IsRetriableError(err))
+	assert.Equal(t, 0, calls)
+
+	require.NoError(t, runSignedDownload(t, srv, data, gitDir, nil, srv.refreshTo(&calls)))
+
+	assert.Equal(t, 1, calls)
+	require.Len(t, srv.requests, 3)
+	assert.Equal(t, "old ", srv.requests[0])
+	// The retried download resumes from where it was cut short, first
+	// with the expired URL, and then with the fresh one.
+	assert.Regexp(t, `^old bytes=\d+-999995$`, srv.requests[1])
+	assert.Equal(t, "new"+srv.requests[1][3:], srv.requests[2])
+}
+
+func TestBasicDownloadAdapterExpiredURLWithoutRefresh(t *testing.T) {
+	data := bytes.Repeat([]byte("signed"), 1000000/6)
+	srv := newSignedURLServer(data, 4096)
+	defer srv.Close()
+
+	gitDir := t.TempDir()
+	require.Error(t, runSignedDownload(t, srv, data, gitDir, nil, nil))
+	err := runSignedDownload(t, srv, data, gitDir, nil, nil)
+	require.Error(t, err)
+
+	// The object can still be retried through the transfer queue.
+	assert.True(t, errors.IsRetriableError(err))
+	assert.Len(t, srv.requests, 2)
+}
+
+func TestBasicDownloadAdapterDoesNotRefreshUnexpiredURL(t *testing.T) {
+	data := []byte("signed")
+	srv := newSignedURLServer(data, 0)
+	srv.token = "other"
+	defer srv.Close()
+
+	var calls int
+	require.Error(t, runSignedDownload(t, srv, data, t.TempDir(), nil, srv.refreshTo(&calls)))
+
+	// The URL was rejected before it served anything and hasn't passed
+	// its expiry time, so the 403 is not taken to mean it expired.
+	assert.Equal(t, 0, calls)
+}
+
+func TestBasicDownloadAdapterRefreshesURLPastExpiry(t *testing.T) {
+	data := []byte("signed")
+	srv := newSignedURLServer(data, 0)
+	srv.token = "other"
+	defer srv.Close()
+
+	gitDir := t.TempDir()
+	f := fs.New(config.EnvironmentOf(config.MapFetcher(nil)), gitDir, "", filepath.Join(gitDir, "lfs"), 0755)
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, nil))
+	defer cli.Close()
+
+	a := NewManifest(f, cli, "", "").NewDownloadAdapter(BasicAdapterName).(*basicDownloadAdapter)
+	var calls int
+	require.NoError(t, a.Begin(&adapterConfig{apiClient: cli, concurrentTransfers: 1, refresh: srv.refreshTo(&calls)}, nil))
+	defer a.End()
+
+	rel := &Action{Href: srv.URL + "/object?token=old", ExpiresAt: time.Now().Add(-time.Minute)}
+	tr := &Transfer{Oid: "oid", Actions: ActionSet{"download": rel}}
+	res := &http.Response{StatusCode: 403}
+
+	require.True(t, a.refreshExpiredAction(tr, "download", rel, res, false))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, srv.URL+"/object?token=new", tr.Actions["download"].Href)
+
+	// A fresh action is not refreshed again.
+	assert.False(t, a.refreshExpiredAction(tr, "download", tr.Actions["download"], res, true))
+	assert.Equal(t, 1, calls)
+}
+
+func TestBasicDownloadAdapterRangedRefreshesExpiredURLOnce(t *testing.T) {
+	data := rangedTestData()
+	srv := newSignedURLServer(data, 0)
+	defer srv.Close()
+
+	var calls int
+	require.NoError(t, runSignedDownload(t, srv, data, t.TempDir(), map[string]string{
+		"lfs.transfer.rangeddownloadthreshold": "1MB",
+		"lfs.transfer.rangeddownloadparts":     "3",
+	}, srv.refreshTo(&calls)))
+
+	// Only the first range is served with the original URL; the others
+	// share a single fresh one.
+	assert.Equal(t, 1, calls)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
 	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
 )
 
 const (
@@ -55,13 +56,20 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progres
 		return err
 	}
 
-	if req.Header.Get("Transfer-Encoding") == "chunked" {
+	if len(t.ContentEncoding) > 0 {
+		// The compressed size isn't known in advance.
+		req.Header.Set("Content-Encoding", t.ContentEncoding)
 		req.TransferEncoding = []string{"chunked"}
+		req.ContentLength = -1
 	} else {
-		req.Header.Set("Content-Length", strconv.FormatInt(t.Size, 10))
-	}
+		if req.Header.Get("Transfer-Encoding") == "chunked" {
+			req.TransferEncoding = []string{"chunked"}
+		} else {
+			req.Header.Set("Content-Length", strconv.FormatInt(t.Size, 10))
+		}
 
-	req.ContentLength = t.Size
+		req.ContentLength = t.Size
+	}
 
 	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
 	if err != nil {
@@ -73,6 +81,10 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progres
 		return err
 	}
 
+	if err := a.setIntegrityHeaders(req, t, rel, f); err != nil {
+		return err
+	}
+
 	// Ensure progress callbacks made while uploading
 	// Wrap callback to give name context
 	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
@@ -93,7 +105,10 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progres
 		})
 	}
 
-	req.Body = reader
+	req.Body, err = a.encodeBody(t, a.throttle.readSeekCloser(reader))
+	if err != nil {
+		return err
+	}
 
 	req = a.apiClient.LogRequest(req, "lfs.data.upload")
 	res, err := a.makeRequest(t, req)
@@ -236,9 +251,24 @@ func (a *basicUploadAdapter) makeRequest(t *Transfer, req *http.Request) (*http.
 		f, _ := os.OpenFile(t.Path, os.O_RDONLY, 0644)
 		defer f.Close()
 
-		req.Body = tools.NewBodyWithCallback(f, t.Size, nil)
+		body, err := a.encodeBody(t, tools.NewBodyWithCallback(f, t.Size, nil))
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
 		return a.makeRequest(t, req)
 	}
 
 	return res, err
 }
+
+// encodeBody returns the body to upload for the object t from r, compressed
+// with the content encoding selected by the server, if any.
+func (a *basicUploadAdapter) encodeBody(t *Transfer, r io.ReadCloser) (io.ReadCloser, error) {
+	if len(t.ContentEncoding) == 0 {
+		return r, nil
+	}
+
+	tracerx.Printf("xfer: compressing upload of %q with %s", t.Oid, t.ContentEncoding)
+	return newCompressingReader(r, t.ContentEncoding)
+}
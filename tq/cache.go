@@ -0,0 +1,154 @@
+package tq
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// batchWithCache makes a download batch request for the given objects to the
+// cache server configured with lfs.cacheServer, and then makes one to the
+// real endpoint, using upstream, for any objects which are not cached.
+//
+// Objects the cache server has are downloaded from it directly. If the real
+// endpoint selects the basic adapter, the others are downloaded through the
+// cache server, so that it stores them for later.
+func batchWithCache(cm *concreteManifest, objects []*Transfer, upstream func([]*Transfer) (*BatchResponse, error)) (*BatchResponse, error) {
+	cached, err := cacheServerBatch(cm.apiClient, cm.cacheServer, objects)
+	if err != nil {
+		// The cache is only an optimization, so carry on without it.
+		tracerx.Printf("tq: cache server %s unavailable: %s", cm.cacheServer, err)
+		return upstream(objects)
+	}
+
+	hits := make(map[string]*Transfer)
+	for _, o := range cached.Objects {
+		if o.Error == nil && o.Actions["download"] != nil {
+			hits[o.Oid] = o
+		}
+	}
+
+	var found, missing []*Transfer
+	for _, o := range objects {
+		if hit, ok := hits[o.Oid]; ok && hit.Size == o.Size {
+			found = append(found, hit)
+		} else {
+			missing = append(missing, o)
+		}
+	}
+	tracerx.Printf("tq: cache server has %d of %d object(s)", len(found), len(objects))
+
+	if len(missing) == 0 {
+		cached.Objects = found
+		cached.TransferAdapterName = BasicAdapterName
+		return cached, nil
+	}
+
+	bRes, err := upstream(missing)
+	if err != nil {
+		return bRes, err
+	}
+
+	if adapterNameOrDefault(bRes.TransferAdapterName) != BasicAdapterName {
+		// Objects must all be transferred with the same adapter, so
+		// download the cached objects from the real endpoint as well.
+		if len(found) == 0 {
+			return bRes, nil
+		}
+
+		rest, err := upstream(objectsToRequest(found))
+		if err != nil {
+			return rest, err
+		}
+		if adapterNameOrDefault(rest.TransferAdapterName) != adapterNameOrDefault(bRes.TransferAdapterName) {
+			return nil, errors.New(tr.Tr.Get("batch response: server selected transfer adapters %q and %q", bRes.TransferAdapterName, rest.TransferAdapterName))
+		}
+		bRes.Objects = append(bRes.Objects, rest.Objects...)
+		return bRes, nil
+	}
+
+	for _, o := range bRes.Objects {
+		downloadThroughCache(cm.cacheServer, o)
+	}
+	bRes.Objects = append(bRes.Objects, found...)
+	return bRes, nil
+}
+
+// cacheServerBatch asks the cache server at the given URL which of the given
+// objects it has, making one request for each hash algorithm in use.
+func cacheServerBatch(c *lfsapi.Client, cacheURL string, objects []*Transfer) (*BatchResponse, error) {
+	e := lfshttp.Endpoint{Url: strings.TrimSuffix(cacheURL, "/")}
+	bRes := &BatchResponse{endpoint: e}
+	for _, group := range groupByHashAlgorithm(objects) {
+		req, err := c.NewRequest("POST", e, "objects/batch", &batchRequest{
+			Operation:     Download.String(),
+			Objects:       objectsToRequest(group.objects),
+			HashAlgorithm: group.algo.String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		req = c.LogRequest(req, "lfs.cache.batch")
+		res, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		gRes := &BatchResponse{}
+		if err := lfshttp.DecodeJSON(res, gRes); err != nil {
+			return nil, err
+		}
+		if err := checkHashAlgorithm(group.algo.String(), gRes.HashAlgorithm); err != nil {
+			return nil, err
+		}
+		for _, o := range gRes.Objects {
+			o.HashAlgorithm = group.algo
+		}
+		bRes.Objects = append(bRes.Objects, gRes.Objects...)
+	}
+	return bRes, nil
+}
+
+// downloadThroughCache rewrites the download action of o so that the object
+// is fetched by the cache server at cacheURL on our behalf, and stored there.
+//
+// Only objects whose action needs no credentials beyond its URL and
+// non-credential headers are rewritten, since the cache server neither asks
+// for credentials nor forwards them.
+func downloadThroughCache(cacheURL string, o *Transfer) {
+	a := o.Actions["download"]
+	if a == nil || o.Error != nil || !o.Authenticated {
+		return
+	}
+	for key := range a.Header {
+		if strings.EqualFold(key, "Authorization") || strings.EqualFold(key, "Cookie") {
+			return
+		}
+	}
+
+	query := url.Values{}
+	query.Set("size", strconv.FormatInt(o.Size, 10))
+	if algo := o.HashAlgorithm.OrDefault(); algo != tools.DefaultHashAlgorithm {
+		query.Set("hash_algo", algo.String())
+	}
+	query.Set("source", a.Href)
+	a.Href = fmt.Sprintf("%s/objects/%s?%s", strings.TrimSuffix(cacheURL, "/"), o.Oid, query.Encode())
+	o.Authenticated = true
+}
+
+func objectsToRequest(objects []*Transfer) []*Transfer {
+	req := make([]*Transfer, 0, len(objects))
+	for _, o := range objects {
+		req = append(req, &Transfer{Oid: o.Oid, Size: o.Size, HashAlgorithm: o.HashAlgorithm})
+	}
+	return req
+}
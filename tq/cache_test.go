@@ -0,0 +1,176 @@
+package tq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/cacheserver"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOid(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// newUpstreamBatchServer returns a server which answers batch requests with
+// the given transfer adapter, and records the OIDs requested.
+func newUpstreamBatchServer(t *testing.T, adapter string, requested *[]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bReq := &batchRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(bReq))
+
+		for _, o := range bReq.Objects {
+			*requested = append(*requested, o.Oid)
+			o.Authenticated = true
+			o.Actions = ActionSet{
+				"download": &Action{Href: "https://storage.example/" + o.Oid},
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&BatchResponse{
+			Objects:             bReq.Objects,
+			TransferAdapterName: adapter,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newCacheTestManifest(t *testing.T, upstream, cache string) Manifest {
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.url":         upstream + "/api",
+		"lfs.cacheserver": cache,
+	}))
+	t.Cleanup(func() { cli.Close() })
+	return NewManifest(nil, cli, "download", "origin")
+}
+
+func newTestCacheServer(t *testing.T, objects ...string) *httptest.Server {
+	store, err := cacheserver.NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+	for _, data := range objects {
+		require.NoError(t, store.Put(testOid(data), tools.SHA256, int64(len(data)), strings.NewReader(data)))
+	}
+
+	srv := httptest.NewServer(cacheserver.NewServer(store, nil))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBatchWithCache(t *testing.T) {
+	var requested []string
+	upstream := newUpstreamBatchServer(t, "", &requested)
+	cache := newTestCacheServer(t, "cached")
+
+	cached, missing := testOid("cached"), testOid("missing")
+	bRes, err := Batch(newCacheTestManifest(t, upstream.URL, cache.URL), Download, "origin", nil, []*Transfer{
+		{Oid: cached, Size: 6},
+		{Oid: missing, Size: 7},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{missing}, requested)
+	require.Len(t, bRes.Objects, 2)
+
+	byOid := make(map[string]*Transfer)
+	for _, o := range bRes.Objects {
+		byOid[o.Oid] = o
+	}
+
+	assert.Equal(t, cache.URL+"/objects/"+cached, byOid[cached].Actions["download"].Href)
+
+	href, err := url.Parse(byOid[missing].Actions["download"].Href)
+	require.NoError(t, err)
+	assert.Equal(t, "/objects/"+missing, href.Path)
+	assert.Equal(t, "7", href.Query().Get("size"))
+	assert.Equal(t, "https://storage.example/"+missing, href.Query().Get("source"))
+}
+
+func TestBatchWithCacheAllCached(t *testing.T) {
+	var requested []string
+	upstream := newUpstreamBatchServer(t, "", &requested)
+	cache := newTestCacheServer(t, "cached")
+
+	bRes, err := Batch(newCacheTestManifest(t, upstream.URL, cache.URL), Download, "origin", nil, []*Transfer{
+		{Oid: testOid("cached"), Size: 6},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, requested)
+	assert.Equal(t, BasicAdapterName, bRes.TransferAdapterName)
+	require.Len(t, bRes.Objects, 1)
+}
+
+func TestBatchWithCacheOtherAdapter(t *testing.T) {
+	var requested []string
+	upstream := newUpstreamBatchServer(t, "tus", &requested)
+	cache := newTestCacheServer(t, "cached")
+
+	cached, missing := testOid("cached"), testOid("missing")
+	bRes, err := Batch(newCacheTestManifest(t, upstream.URL, cache.URL), Download, "origin", nil, []*Transfer{
+		{Oid: cached, Size: 6},
+		{Oid: missing, Size: 7},
+	})
+	require.NoError(t, err)
+
+	// The cached object can't be downloaded with a different adapter, so
+	// it is requested from the real endpoint too.
+	assert.Equal(t, []string{missing, cached}, requested)
+	for _, o := range bRes.Objects {
+		assert.Equal(t, "https://storage.example/"+o.Oid, o.Actions["download"].Href)
+	}
+}
+
+func TestBatchWithCacheUnavailable(t *testing.T) {
+	var requested []string
+	upstream := newUpstreamBatchServer(t, "", &requested)
+	cache := newTestCacheServer(t)
+	cache.Close()
+
+	oid := testOid("object")
+	bRes, err := Batch(newCacheTestManifest(t, upstream.URL, cache.URL), Download, "origin", nil, []*Transfer{
+		{Oid: oid, Size: 6},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{oid}, requested)
+	assert.Equal(t, "https://storage.example/"+oid, bRes.Objects[0].Actions["download"].Href)
+}
+
+func TestDownloadThroughCacheNeedsNoCredentials(t *testing.T) {
+	for desc, o := range map[string]*Transfer{
+		"unauthenticated": {
+			Oid: testOid("a"), Size: 1,
+			Actions: ActionSet{"download": &Action{Href: "https://storage.example/a"}},
+		},
+		"authorization header": {
+			Oid: testOid("a"), Size: 1, Authenticated: true,
+			Actions: ActionSet{"download": &Action{
+				Href:   "https://storage.example/a",
+				Header: map[string]string{"authorization": "Bearer token"},
+			}},
+		},
+		"cookie header": {
+			Oid: testOid("a"), Size: 1, Authenticated: true,
+			Actions: ActionSet{"download": &Action{
+				Href:   "https://storage.example/a",
+				Header: map[string]string{"Cookie": "session=1"},
+			}},
+		},
+	} {
+		downloadThroughCache("http://cache.example", o)
+		assert.Equal(t, "https://storage.example/a", o.Actions["download"].Href, desc)
+	}
+}
@@ -0,0 +1,587 @@
+package tq
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+)
+
+const (
+	ChunkedAdapterName = "chunked"
+
+	chunkCheckRel = "chunk-check"
+)
+
+// chunkedObject is the JSON representation of an object split into chunks.
+// It is sent to the "chunk-check" action to ask which chunks the server is
+// missing, and to the "upload" action to commit an uploaded object, and is
+// returned by the "chunk-check" and "download" actions.
+type chunkedObject struct {
+	Oid           string         `json:"oid,omitempty"`
+	Size          int64          `json:"size,omitempty"`
+	HashAlgorithm string         `json:"hash_algo,omitempty"`
+	Chunks        []*chunkObject `json:"chunks"`
+}
+
+type chunkObject struct {
+	Oid     string    `json:"oid"`
+	Size    int64     `json:"size"`
+	Actions ActionSet `json:"actions,omitempty"`
+}
+
+// Adapter for chunked transfers, which split objects into content-defined
+// chunks and transfer only those chunks missing from the destination.
+type chunkedAdapter struct {
+	*adapterBase
+
+	// local maps the OIDs of chunks of objects already in the local object
+	// store, keyed by hash algorithm, to where they may be read from. It
+	// is built from the stored chunk indexes on the first download.
+	local   map[string]localChunkSource
+	localMu sync.Mutex
+}
+
+// localChunkSource locates a chunk within a local object's file.
+type localChunkSource struct {
+	Path   string
+	Offset int64
+}
+
+func (a *chunkedAdapter) WorkerStarting(workerNum int) (interface{}, error) {
+	return nil, nil
+}
+
+func (a *chunkedAdapter) WorkerEnding(workerNum int, ctx interface{}) {
+}
+
+func (a *chunkedAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	if a.direction == Upload {
+		return a.upload(t, cb, authOkFunc)
+	}
+	return a.download(t, cb, authOkFunc)
+}
+
+func (a *chunkedAdapter) upload(t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Rel("upload")
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		return errors.New(tr.Tr.Get("No upload action for object: %s", t.Oid))
+	}
+	check, err := t.Rel(chunkCheckRel)
+	if err != nil {
+		return err
+	}
+	if check == nil {
+		return errors.New(tr.Tr.Get("No %s action for object: %s", chunkCheckRel, t.Oid))
+	}
+
+	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("chunked upload"))
+	}
+	defer f.Close()
+
+	algo := t.HashAlgorithm.OrDefault()
+	local, err := a.objectChunks(t, f, algo)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]*localChunk, len(local))
+	chunks := make([]*chunkObject, 0, len(local))
+	var size int64
+	for _, c := range local {
+		known[c.Oid] = c
+		chunks = append(chunks, &chunkObject{Oid: c.Oid, Size: c.Size})
+		size += c.Size
+	}
+	if size != t.Size {
+		return errors.New(tr.Tr.Get("chunks of %s have total size %d, expected %d", t.Oid, size, t.Size))
+	}
+	obj := &chunkedObject{
+		Oid:           t.Oid,
+		Size:          t.Size,
+		HashAlgorithm: algo.String(),
+		Chunks:        chunks,
+	}
+
+	// 1. Ask the server which chunks it needs.
+	a.Trace("xfer: sending chunk check for %q (%d chunk(s))", t.Oid, len(chunks))
+	var missing chunkedObject
+	if err := a.doJSON(t, "POST", check, obj, &missing, "lfs.data.chunk-check"); err != nil {
+		return err
+	}
+
+	// Signal auth was ok; this frees up other workers to start
+	if authOkFunc != nil {
+		authOkFunc()
+	}
+
+	var missingSize int64
+	for _, c := range missing.Chunks {
+		if _, ok := known[c.Oid]; !ok {
+			return errors.New(tr.Tr.Get("server requested unknown chunk %q for object %s", c.Oid, t.Oid))
+		}
+		missingSize += c.Size
+	}
+
+	var done int64
+	progress := func(n int64) {
+		done += n
+		if cb != nil && n > 0 {
+			cb(t.Name, t.Size, done, int(n))
+		}
+	}
+
+	a.Trace("xfer: server is missing %d of %d chunk(s) of %q", len(missing.Chunks), len(chunks), t.Oid)
+	progress(t.Size - missingSize)
+
+	// 2. Upload the missing chunks.
+	for _, c := range missing.Chunks {
+		if err := a.uploadChunk(t, f, known[c.Oid], c); err != nil {
+			return err
+		}
+		progress(c.Size)
+	}
+
+	// 3. Commit the object by sending its full list of chunks.
+	if err := a.doJSON(t, "PUT", rel, obj, nil, "lfs.data.upload"); err != nil {
+		return err
+	}
+
+	return verifyUpload(a.apiClient, a.remote, t)
+}
+
+// localChunk is a chunk of an object being uploaded, at the given offset in
+// its file.
+type localChunk struct {
+	Oid    string
+	Offset int64
+	Size   int64
+}
+
+// objectChunks returns the chunks of the object being uploaded, from its
+// stored chunk index if it has one, otherwise by splitting f, in which case
+// the index is stored for later transfers.
+func (a *chunkedAdapter) objectChunks(t *Transfer, f *os.File, algo tools.HashAlgorithm) ([]*localChunk, error) {
+	if index, err := a.fs.ReadChunkIndex(t.Oid); err == nil && index.Size == t.Size && index.HashAlgorithm == algo.String() {
+		chunks := make([]*localChunk, 0, len(index.Chunks))
+		var offset int64
+		for _, c := range index.Chunks {
+			chunks = append(chunks, &localChunk{Oid: c.Oid, Offset: offset, Size: c.Size})
+			offset += c.Size
+		}
+		return chunks, nil
+	}
+
+	chunks, err := splitChunks(f, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &fs.ChunkIndex{
+		Oid:           t.Oid,
+		Size:          t.Size,
+		HashAlgorithm: algo.String(),
+		Chunks:        make([]fs.Chunk, 0, len(chunks)),
+	}
+	for _, c := range chunks {
+		index.Chunks = append(index.Chunks, fs.Chunk{Oid: c.Oid, Size: c.Size})
+	}
+	if err := a.fs.WriteChunkIndex(index); err != nil {
+		a.Trace("xfer: unable to store chunk index of %q: %v", t.Oid, err)
+	}
+	return chunks, nil
+}
+
+// splitChunks splits the contents of r into content-defined chunks, whose
+// OIDs are computed with algo. Chunks are not kept, so they are read again
+// from the object's file if the server asks for them.
+func splitChunks(r io.Reader, algo tools.HashAlgorithm) ([]*localChunk, error) {
+	var chunks []*localChunk
+	var offset int64
+
+	chunker := tools.NewChunker(r)
+	for {
+		data, err := chunker.Next()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, tr.Tr.Get("chunked upload"))
+		}
+
+		h := algo.New()
+		h.Write(data)
+		chunks = append(chunks, &localChunk{
+			Oid:    hex.EncodeToString(h.Sum(nil)),
+			Offset: offset,
+			Size:   int64(len(data)),
+		})
+		offset += int64(len(data))
+	}
+}
+
+func (a *chunkedAdapter) uploadChunk(t *Transfer, f *os.File, local *localChunk, c *chunkObject) error {
+	rel, err := c.Actions.Get("upload")
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		return errors.New(tr.Tr.Get("No upload action for chunk %s of object: %s", c.Oid, t.Oid))
+	}
+
+	by := make([]byte, local.Size)
+	if _, err := f.ReadAt(by, local.Offset); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("chunked upload"))
+	}
+
+	req, err := a.newHTTPRequest("PUT", rel)
+	if err != nil {
+		return err
+	}
+	if len(req.Header.Get("Content-Type")) == 0 {
+		req.Header.Set("Content-Type", defaultContentType)
+	}
+	req.Body = lfshttp.NewByteBody(by)
+	req.ContentLength = int64(len(by))
+
+	a.Trace("xfer: uploading chunk %q of %q", c.Oid, t.Oid)
+	req = a.apiClient.LogRequest(req, "lfs.data.upload")
+	res, err := a.makeRequest(t, req)
+	if err != nil {
+		return chunkedRequestError(res, err)
+	}
+	return a.checkResponse(req, res)
+}
+
+func (a *chunkedAdapter) download(t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Rel("download")
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		return errors.New(tr.Tr.Get("Object %s not found on the server.", t.Oid))
+	}
+
+	// 1. Fetch the list of chunks which make up the object.
+	var obj chunkedObject
+	if err := a.doJSON(t, "GET", rel, nil, &obj, "lfs.data.download"); err != nil {
+		return err
+	}
+
+	// Signal auth was ok; this frees up other workers to start
+	if authOkFunc != nil {
+		authOkFunc()
+	}
+
+	algo := t.HashAlgorithm.OrDefault()
+	var size int64
+	for _, c := range obj.Chunks {
+		if !algo.IsValidOid(c.Oid) {
+			return errors.New(tr.Tr.Get("invalid chunk ID %q for object %s", c.Oid, t.Oid))
+		}
+		size += c.Size
+	}
+	if size != t.Size {
+		return errors.New(tr.Tr.Get("chunks of %s have total size %d, expected %d", t.Oid, size, t.Size))
+	}
+
+	f, err := tools.TempFile(a.tempDir(), t.Oid, a.fs)
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		f.Close()
+		os.Remove(tmpName)
+	}()
+
+	// 2. Reassemble the object from chunks of local objects where
+	// possible, and from downloaded chunks otherwise.
+	hash := algo.New()
+	w := io.MultiWriter(f, hash)
+
+	var done int64
+	for _, c := range obj.Chunks {
+		by, ok := a.localChunkData(c, algo)
+		if ok {
+			a.Trace("xfer: reusing local chunk %q of %q", c.Oid, t.Oid)
+		} else if by, err = a.chunkData(t, c, algo); err != nil {
+			return err
+		}
+		if _, err := w.Write(by); err != nil {
+			return errors.Wrap(err, tr.Tr.Get("cannot write data to temporary file %q", tmpName))
+		}
+
+		done += c.Size
+		if cb != nil && c.Size > 0 {
+			cb(t.Name, t.Size, done, int(c.Size))
+		}
+	}
+
+	// 3. Verify the reassembled object before moving it into place.
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != t.Oid {
+		return errors.New(tr.Tr.Get("expected OID %s, got %s after %d bytes written", t.Oid, actual, done))
+	}
+	if err := f.Close(); err != nil {
+		return errors.New(tr.Tr.Get("can't close temporary file %q: %v", tmpName, err))
+	}
+
+	err = tools.RenameFileCopyPermissions(tmpName, t.Path)
+	if _, err2 := os.Stat(t.Path); err2 == nil {
+		// Target file already exists, possibly was downloaded by other git-lfs process
+		a.indexDownloaded(t, &obj, algo)
+		return nil
+	}
+	return err
+}
+
+// localChunks returns the chunks of objects in the local object store,
+// reading their chunk indexes the first time it is called. The caller must
+// hold a.localMu.
+func (a *chunkedAdapter) localChunks() map[string]localChunkSource {
+	if a.local != nil {
+		return a.local
+	}
+
+	a.local = make(map[string]localChunkSource)
+	err := a.fs.EachChunkIndex(func(index *fs.ChunkIndex) {
+		a.addLocalChunks(index, a.fs.ObjectPathname(index.Oid))
+	})
+	if err != nil {
+		a.Trace("xfer: unable to read chunk indexes: %v", err)
+	}
+	return a.local
+}
+
+// addLocalChunks records the chunks of the given index as readable from the
+// object's file at path. The caller must hold a.localMu.
+func (a *chunkedAdapter) addLocalChunks(index *fs.ChunkIndex, path string) {
+	algo := tools.HashAlgorithm(index.HashAlgorithm).OrDefault()
+	var offset int64
+	for _, c := range index.Chunks {
+		key := localChunkKey(algo, c.Oid)
+		if _, ok := a.local[key]; !ok {
+			a.local[key] = localChunkSource{Path: path, Offset: offset}
+		}
+		offset += c.Size
+	}
+}
+
+func localChunkKey(algo tools.HashAlgorithm, oid string) string {
+	return algo.String() + ":" + oid
+}
+
+// localChunkData returns the contents of the given chunk if a local object
+// contains it. The contents are verified against the chunk's OID, since the
+// object may have changed since it was indexed.
+func (a *chunkedAdapter) localChunkData(c *chunkObject, algo tools.HashAlgorithm) ([]byte, bool) {
+	a.localMu.Lock()
+	src, ok := a.localChunks()[localChunkKey(algo, c.Oid)]
+	a.localMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	f, err := os.Open(src.Path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	by := make([]byte, c.Size)
+	if _, err := f.ReadAt(by, src.Offset); err != nil {
+		return nil, false
+	}
+
+	h := algo.New()
+	h.Write(by)
+	if hex.EncodeToString(h.Sum(nil)) != c.Oid {
+		return nil, false
+	}
+	return by, true
+}
+
+// indexDownloaded stores the chunk index of a downloaded object, so that
+// later downloads and uploads may reuse its chunks.
+func (a *chunkedAdapter) indexDownloaded(t *Transfer, obj *chunkedObject, algo tools.HashAlgorithm) {
+	index := &fs.ChunkIndex{
+		Oid:           t.Oid,
+		Size:          t.Size,
+		HashAlgorithm: algo.String(),
+		Chunks:        make([]fs.Chunk, 0, len(obj.Chunks)),
+	}
+	for _, c := range obj.Chunks {
+		index.Chunks = append(index.Chunks, fs.Chunk{Oid: c.Oid, Size: c.Size})
+	}
+	if err := a.fs.WriteChunkIndex(index); err != nil {
+		a.Trace("xfer: unable to store chunk index of %q: %v", t.Oid, err)
+	}
+
+	a.localMu.Lock()
+	a.localChunks()
+	a.addLocalChunks(index, t.Path)
+	a.localMu.Unlock()
+}
+
+// chunkData downloads the contents of the given chunk and verifies them
+// against its OID.
+func (a *chunkedAdapter) chunkData(t *Transfer, c *chunkObject, algo tools.HashAlgorithm) ([]byte, error) {
+	rel, err := c.Actions.Get("download")
+	if err != nil {
+		return nil, err
+	}
+	if rel == nil {
+		return nil, errors.New(tr.Tr.Get("Chunk %s of object %s not found on the server.", c.Oid, t.Oid))
+	}
+
+	req, err := a.newHTTPRequest("GET", rel)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Trace("xfer: downloading chunk %q of %q", c.Oid, t.Oid)
+	req = a.apiClient.LogRequest(req, "lfs.data.download")
+	res, err := a.makeRequest(t, req)
+	if err != nil {
+		return nil, chunkedRequestError(res, err)
+	}
+	defer res.Body.Close()
+
+	by, err := io.ReadAll(io.LimitReader(res.Body, c.Size+1))
+	if err != nil {
+		return nil, errors.NewRetriableError(err)
+	}
+	if int64(len(by)) != c.Size {
+		return nil, errors.NewRetriableError(errors.New(tr.Tr.Get("expected %d bytes for chunk %s, got %d", c.Size, c.Oid, len(by))))
+	}
+
+	h := algo.New()
+	h.Write(by)
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != c.Oid {
+		return nil, errors.New(tr.Tr.Get("expected chunk OID %s, got %s", c.Oid, actual))
+	}
+
+	return by, nil
+}
+
+// doJSON sends a request to the given action with in, if non-nil, as its
+// JSON body, and decodes the response into out, if non-nil.
+func (a *chunkedAdapter) doJSON(t *Transfer, method string, rel *Action, in, out interface{}, logKey string) error {
+	req, err := a.newHTTPRequest(method, rel)
+	if err != nil {
+		return err
+	}
+
+	if in != nil {
+		if err := lfsapi.MarshalToRequest(req, in); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+
+	req = a.apiClient.LogRequest(req, logKey)
+	res, err := a.makeRequest(t, req)
+	if err != nil {
+		return chunkedRequestError(res, err)
+	}
+	if out == nil || res.StatusCode > 299 {
+		return a.checkResponse(req, res)
+	}
+	return lfshttp.DecodeJSON(res, out)
+}
+
+// checkResponse discards the body of the given response and returns an
+// error if its status does not indicate success.
+func (a *chunkedAdapter) checkResponse(req *http.Request, res *http.Response) error {
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	// A status code of 403 likely means that an authentication token for the
+	// upload has expired. This can be safely retried.
+	if res.StatusCode == 403 {
+		err := errors.New(tr.Tr.Get("Received status %d", res.StatusCode))
+		return errors.NewRetriableError(err)
+	}
+
+	if res.StatusCode > 299 {
+		return errors.New(tr.Tr.Get("Invalid status for %s %s: %d",
+			req.Method,
+			strings.SplitN(req.URL.String(), "?", 2)[0],
+			res.StatusCode,
+		))
+	}
+	return nil
+}
+
+// chunkedRequestError converts an error from an HTTP request made by the
+// chunked adapter into one which the transfer queue will retry, where
+// appropriate. Since chunks already present on the server are skipped,
+// retrying an object resumes its transfer.
+func chunkedRequestError(res *http.Response, err error) error {
+	if errors.IsUnprocessableEntityError(err) {
+		return err
+	}
+	if res == nil {
+		// We encountered a network or similar error which caused us
+		// to not receive a response at all.
+		return errors.NewRetriableError(err)
+	}
+	if res.StatusCode == 429 {
+		retLaterErr := errors.NewRetriableLaterError(err, res.Header.Get("Retry-After"))
+		if retLaterErr != nil {
+			return retLaterErr
+		}
+	}
+	return errors.NewRetriableError(err)
+}
+
+func (a *chunkedAdapter) tempDir() string {
+	d := filepath.Join(a.fs.LFSStorageDir, "incomplete")
+	if err := tools.MkdirAll(d, a.fs); err != nil {
+		return os.TempDir()
+	}
+	return d
+}
+
+func (a *chunkedAdapter) makeRequest(t *Transfer, req *http.Request) (*http.Response, error) {
+	res, err := a.doHTTP(t, req)
+	if errors.IsAuthError(err) && len(req.Header.Get("Authorization")) == 0 {
+		// Rewind the body, if any, before trying again.
+		if seeker, ok := req.Body.(io.Seeker); ok {
+			seeker.Seek(0, io.SeekStart)
+		}
+		return a.makeRequest(t, req)
+	}
+
+	return res, err
+}
+
+func configureChunkedAdapter(m *concreteManifest) {
+	m.RegisterNewAdapterFunc(ChunkedAdapterName, Upload, false, newChunkedAdapterFunc(m))
+	m.RegisterNewAdapterFunc(ChunkedAdapterName, Download, false, newChunkedAdapterFunc(m))
+}
+
+func newChunkedAdapterFunc(m *concreteManifest) NewAdapterFunc {
+	return func(name string, dir Direction) Adapter {
+		ca := &chunkedAdapter{adapterBase: newAdapterBase(m.fs, name, dir, nil)}
+		// self implements impl
+		ca.transferImpl = ca
+		return ca
+	}
+}
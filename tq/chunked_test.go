@@ -0,0 +1,383 @@
+package tq
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkServer is a minimal in-memory implementation of the server side of
+// the chunked transfer protocol.
+type chunkServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	chunks      map[string][]byte
+	objects     map[string]*chunkedObject
+	chunkPuts   int
+	chunkGets   int
+	checkedOids []string
+}
+
+func newChunkServer(t *testing.T) *chunkServer {
+	s := &chunkServer{
+		chunks:  make(map[string][]byte),
+		objects: make(map[string]*chunkedObject),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		oid := filepath.Base(r.URL.Path)
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/check":
+			var obj chunkedObject
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+			s.checkedOids = append(s.checkedOids, obj.Oid)
+
+			missing := &chunkedObject{Chunks: make([]*chunkObject, 0)}
+			for _, c := range obj.Chunks {
+				if _, ok := s.chunks[c.Oid]; !ok {
+					missing.Chunks = append(missing.Chunks, &chunkObject{
+						Oid:  c.Oid,
+						Size: c.Size,
+						Actions: ActionSet{
+							"upload": &Action{Href: s.URL + "/chunks/" + c.Oid},
+						},
+					})
+				}
+			}
+			w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
+			json.NewEncoder(w).Encode(missing)
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/chunks/"):
+			by, _ := io.ReadAll(r.Body)
+			s.chunks[oid] = by
+			s.chunkPuts++
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/chunks/"):
+			s.chunkGets++
+			w.Write(s.chunks[oid])
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/objects/"):
+			var obj chunkedObject
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+			for _, c := range obj.Chunks {
+				if _, ok := s.chunks[c.Oid]; !ok {
+					w.WriteHeader(422)
+					return
+				}
+			}
+			s.objects[oid] = &obj
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/objects/"):
+			obj, ok := s.objects[oid]
+			if !ok {
+				w.WriteHeader(404)
+				return
+			}
+			res := &chunkedObject{Oid: obj.Oid, Size: obj.Size, HashAlgorithm: obj.HashAlgorithm}
+			for _, c := range obj.Chunks {
+				res.Chunks = append(res.Chunks, &chunkObject{
+					Oid:  c.Oid,
+					Size: c.Size,
+					Actions: ActionSet{
+						"download": &Action{Href: s.URL + "/chunks/" + c.Oid},
+					},
+				})
+			}
+			w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
+			json.NewEncoder(w).Encode(res)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	return s
+}
+
+func (s *chunkServer) counts() (puts, gets int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	puts, gets = s.chunkPuts, s.chunkGets
+	s.chunkPuts, s.chunkGets = 0, 0
+	return
+}
+
+func newTestChunkedAdapter(t *testing.T, dir Direction) *chunkedAdapter {
+	gitDir := t.TempDir()
+	f := fs.New(config.EnvironmentOf(config.MapFetcher(nil)), gitDir, "", filepath.Join(gitDir, "lfs"), 0755)
+
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.chunkedtransfers": "true",
+	}))
+	t.Cleanup(func() { cli.Close() })
+
+	m := NewManifest(f, cli, "", "")
+	var a Adapter
+	if dir == Upload {
+		a = m.NewUploadAdapter(ChunkedAdapterName)
+	} else {
+		a = m.NewDownloadAdapter(ChunkedAdapterName)
+	}
+
+	ca, ok := a.(*chunkedAdapter)
+	require.True(t, ok, "expected chunked adapter, got %T", a)
+	ca.apiClient = cli
+	ca.remote = "origin"
+	return ca
+}
+
+func writeTestObject(t *testing.T, data []byte) *Transfer {
+	sum := sha256.Sum256(data)
+	path := filepath.Join(t.TempDir(), "object")
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	return &Transfer{
+		Name:          "object",
+		Oid:           hex.EncodeToString(sum[:]),
+		Size:          int64(len(data)),
+		Path:          path,
+		Authenticated: true,
+	}
+}
+
+func TestChunkedAdapterRegistration(t *testing.T) {
+	cli := lfsapi.NewClient(nil)
+	defer cli.Close()
+
+	m := NewManifest(nil, cli, "", "")
+	assert.NotContains(t, m.GetUploadAdapterNames(), ChunkedAdapterName)
+	assert.NotContains(t, m.GetDownloadAdapterNames(), ChunkedAdapterName)
+
+	cli = lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.chunkedtransfers": "true",
+	}))
+	defer cli.Close()
+
+	m = NewManifest(nil, cli, "", "")
+	assert.Contains(t, m.GetUploadAdapterNames(), ChunkedAdapterName)
+	assert.Contains(t, m.GetDownloadAdapterNames(), ChunkedAdapterName)
+}
+
+func TestChunkedAdapterTransfersOnlyMissingChunks(t *testing.T) {
+	srv := newChunkServer(t)
+	defer srv.Close()
+
+	original := make([]byte, 6*1024*1024)
+	rand.New(rand.NewSource(1)).Read(original)
+
+	edited := make([]byte, 0, len(original)+1)
+	edited = append(edited, original[:len(original)/2]...)
+	edited = append(edited, 'x')
+	edited = append(edited, original[len(original)/2:]...)
+
+	up := newTestChunkedAdapter(t, Upload)
+	upload := func(data []byte) *Transfer {
+		tr := writeTestObject(t, data)
+		tr.Actions = ActionSet{
+			"upload":      &Action{Href: srv.URL + "/objects/" + tr.Oid},
+			chunkCheckRel: &Action{Href: srv.URL + "/check"},
+		}
+
+		var progress int64
+		cb := func(name string, total, read int64, current int) error {
+			progress = read
+			return nil
+		}
+		require.NoError(t, up.DoTransfer(nil, tr, cb, nil))
+		assert.Equal(t, tr.Size, progress)
+		return tr
+	}
+
+	first := upload(original)
+	puts, _ := srv.counts()
+	assert.Greater(t, puts, 2)
+
+	second := upload(edited)
+	editPuts, _ := srv.counts()
+	assert.Greater(t, editPuts, 0)
+	assert.Less(t, editPuts, puts)
+
+	down := newTestChunkedAdapter(t, Download)
+	download := func(src *Transfer) {
+		tr := &Transfer{
+			Name:          src.Name,
+			Oid:           src.Oid,
+			Size:          src.Size,
+			Path:          filepath.Join(t.TempDir(), "downloaded"),
+			Authenticated: true,
+			Actions: ActionSet{
+				"download": &Action{Href: srv.URL + "/objects/" + src.Oid},
+			},
+		}
+		require.NoError(t, down.DoTransfer(nil, tr, nil, nil))
+
+		expected, err := os.ReadFile(src.Path)
+		require.NoError(t, err)
+		actual, err := os.ReadFile(tr.Path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	chunksOf := func(src *Transfer) map[string]bool {
+		f, err := os.Open(src.Path)
+		require.NoError(t, err)
+		defer f.Close()
+		chunks, err := splitChunks(f, tools.SHA256)
+		require.NoError(t, err)
+
+		oids := make(map[string]bool)
+		for _, c := range chunks {
+			oids[c.Oid] = true
+		}
+		return oids
+	}
+
+	// Every chunk of the first object downloaded is fetched from the
+	// server, but only those chunks of the second which the first lacks.
+	download(second)
+	_, gets := srv.counts()
+	assert.Equal(t, len(chunksOf(second)), gets)
+
+	var unshared int
+	secondChunks := chunksOf(second)
+	for oid := range chunksOf(first) {
+		if !secondChunks[oid] {
+			unshared++
+		}
+	}
+	require.Greater(t, unshared, 0)
+
+	download(first)
+	_, gets = srv.counts()
+	assert.Equal(t, unshared, gets)
+}
+
+func TestChunkedAdapterReusesChunksOfLocalObjects(t *testing.T) {
+	srv := newChunkServer(t)
+	defer srv.Close()
+
+	original := make([]byte, 4*1024*1024)
+	rand.New(rand.NewSource(4)).Read(original)
+	edited := append([]byte("x"), original...)
+
+	up := newTestChunkedAdapter(t, Upload)
+	src := writeTestObject(t, edited)
+	src.Actions = ActionSet{
+		"upload":      &Action{Href: srv.URL + "/objects/" + src.Oid},
+		chunkCheckRel: &Action{Href: srv.URL + "/check"},
+	}
+	require.NoError(t, up.DoTransfer(nil, src, nil, nil))
+	srv.counts()
+
+	// Store the original object, and its chunk index, locally.
+	down := newTestChunkedAdapter(t, Download)
+	local := writeTestObject(t, original)
+	path, err := down.fs.ObjectPath(local.Oid)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, original, 0644))
+	index, err := fs.NewChunkIndex(local.Oid, tools.SHA256, bytes.NewReader(original))
+	require.NoError(t, err)
+	require.NoError(t, down.fs.WriteChunkIndex(index))
+
+	tr := &Transfer{
+		Name:          src.Name,
+		Oid:           src.Oid,
+		Size:          src.Size,
+		Path:          filepath.Join(t.TempDir(), "downloaded"),
+		Authenticated: true,
+		Actions: ActionSet{
+			"download": &Action{Href: srv.URL + "/objects/" + src.Oid},
+		},
+	}
+	var progress int64
+	cb := func(name string, total, read int64, current int) error {
+		progress = read
+		return nil
+	}
+	require.NoError(t, down.DoTransfer(nil, tr, cb, nil))
+	assert.Equal(t, tr.Size, progress)
+
+	actual, err := os.ReadFile(tr.Path)
+	require.NoError(t, err)
+	assert.Equal(t, edited, actual)
+
+	_, gets := srv.counts()
+	assert.Greater(t, gets, 0)
+	assert.Less(t, gets, len(index.Chunks))
+
+	downloaded, err := down.fs.ReadChunkIndex(tr.Oid)
+	require.NoError(t, err)
+	assert.Equal(t, tr.Size, downloaded.Size)
+}
+
+func TestSplitChunks(t *testing.T) {
+	data := make([]byte, 3*1024*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	chunks, err := splitChunks(bytes.NewReader(data), tools.SHA256)
+	require.NoError(t, err)
+	require.NotEmpty(t, chunks)
+
+	var offset int64
+	for _, c := range chunks {
+		assert.Equal(t, offset, c.Offset)
+		sum := sha256.Sum256(data[c.Offset : c.Offset+c.Size])
+		assert.Equal(t, hex.EncodeToString(sum[:]), c.Oid)
+		offset += c.Size
+	}
+	assert.Equal(t, int64(len(data)), offset)
+}
+
+func TestChunkedAdapterRejectsCorruptChunk(t *testing.T) {
+	srv := newChunkServer(t)
+	defer srv.Close()
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	up := newTestChunkedAdapter(t, Upload)
+	src := writeTestObject(t, data)
+	src.Actions = ActionSet{
+		"upload":      &Action{Href: srv.URL + "/objects/" + src.Oid},
+		chunkCheckRel: &Action{Href: srv.URL + "/check"},
+	}
+	require.NoError(t, up.DoTransfer(nil, src, nil, nil))
+
+	srv.mu.Lock()
+	for oid := range srv.chunks {
+		srv.chunks[oid][0] ^= 0xff
+	}
+	srv.mu.Unlock()
+
+	down := newTestChunkedAdapter(t, Download)
+	tr := &Transfer{
+		Oid:           src.Oid,
+		Size:          src.Size,
+		Path:          filepath.Join(t.TempDir(), "downloaded"),
+		Authenticated: true,
+		Actions: ActionSet{
+			"download": &Action{Href: srv.URL + "/objects/" + src.Oid},
+		},
+	}
+	err := down.DoTransfer(nil, tr, nil, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "expected chunk OID")
+	}
+	assert.NoFileExists(t, tr.Path)
+}
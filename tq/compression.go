@@ -0,0 +1,120 @@
+package tq
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	contentEncodingGzip = "gzip"
+	contentEncodingZstd = "zstd"
+)
+
+// supportedContentEncodings are the content encodings offered to the server
+// in batch requests by default, in order of preference.
+var supportedContentEncodings = []string{contentEncodingZstd, contentEncodingGzip}
+
+// parseContentEncodings parses a comma-separated list of content encodings
+// from the lfs.transfer.contentEncodings option, ignoring any which are not
+// supported. An empty value disables compression.
+func parseContentEncodings(v string) []string {
+	var encodings []string
+	for _, e := range strings.Split(v, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if len(e) == 0 {
+			continue
+		}
+		if !isSupportedContentEncoding(e) {
+			tracerx.Printf("tq: ignoring unsupported content encoding %q", e)
+			continue
+		}
+		encodings = append(encodings, e)
+	}
+	return encodings
+}
+
+func isSupportedContentEncoding(encoding string) bool {
+	for _, e := range supportedContentEncodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentEncodings returns an error if the server selected a content
+// encoding for any of the given objects which was not offered in the batch
+// request.
+func checkContentEncodings(offered []string, objects []*Transfer) error {
+	for _, o := range objects {
+		if len(o.ContentEncoding) == 0 {
+			continue
+		}
+
+		found := false
+		for _, e := range offered {
+			if e == o.ContentEncoding {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(tr.Tr.Get("server selected unsupported content encoding %q for object %s", o.ContentEncoding, o.Oid))
+		}
+	}
+	return nil
+}
+
+// compressingReader is an io.ReadCloser which returns the data read from
+// another reader, compressed with a given content encoding.
+type compressingReader struct {
+	*io.PipeReader
+
+	done chan struct{}
+}
+
+// newCompressingReader returns a reader which compresses the contents of r
+// with the given content encoding as they are read.
+func newCompressingReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+
+	var w io.WriteCloser
+	switch encoding {
+	case contentEncodingGzip:
+		w = gzip.NewWriter(pw)
+	case contentEncodingZstd:
+		zw, err := zstd.NewWriter(pw, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, tr.Tr.Get("failed to create zstd compressor"))
+		}
+		w = zw
+	default:
+		return nil, errors.New(tr.Tr.Get("unsupported content encoding %q", encoding))
+	}
+
+	c := &compressingReader{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+
+		_, err := io.Copy(w, r)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+	return c, nil
+}
+
+// Close stops compressing and waits until the underlying reader is no longer
+// in use.
+func (c *compressingReader) Close() error {
+	err := c.PipeReader.Close()
+	<-c.done
+	return err
+}
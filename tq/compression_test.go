@@ -0,0 +1,213 @@
+package tq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/fs"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContentEncodings(t *testing.T) {
+	assert.Equal(t, []string{"gzip", "zstd"}, parseContentEncodings("gzip, ZSTD"))
+	assert.Equal(t, []string{"zstd"}, parseContentEncodings("br,zstd,"))
+	assert.Nil(t, parseContentEncodings(""))
+}
+
+func TestManifestContentEncodings(t *testing.T) {
+	cli := lfsapi.NewClient(nil)
+	defer cli.Close()
+
+	m := NewManifest(nil, cli, "", "").Upgrade()
+	assert.Empty(t, m.contentEncodings, "compression is off by default")
+
+	cli = lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.transfer.compression": "true",
+	}))
+	defer cli.Close()
+
+	m = NewManifest(nil, cli, "", "").Upgrade()
+	assert.Equal(t, []string{"zstd", "gzip"}, m.contentEncodings)
+
+	cli = lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.transfer.compression":      "true",
+		"lfs.transfer.contentencodings": "gzip",
+	}))
+	defer cli.Close()
+
+	m = NewManifest(nil, cli, "", "").Upgrade()
+	assert.Equal(t, []string{"gzip"}, m.contentEncodings)
+
+	cli = lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.transfer.compression":      "true",
+		"lfs.transfer.contentencodings": "",
+	}))
+	defer cli.Close()
+
+	m = NewManifest(nil, cli, "", "").Upgrade()
+	assert.Empty(t, m.contentEncodings)
+
+	cli = lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.transfer.contentencodings": "gzip",
+	}))
+	defer cli.Close()
+
+	m = NewManifest(nil, cli, "", "").Upgrade()
+	assert.Empty(t, m.contentEncodings, "encodings are not offered unless compression is on")
+}
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case contentEncodingGzip:
+		w = gzip.NewWriter(&buf)
+	case contentEncodingZstd:
+		zw, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		w = zw
+	}
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func decompress(t *testing.T, encoding string, data []byte) []byte {
+	var r io.Reader
+	switch encoding {
+	case contentEncodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		r = gr
+	case contentEncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	}
+	by, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return by
+}
+
+func newCompressionTestTransfer(t *testing.T, data []byte, encoding, href string) *Transfer {
+	sum := sha256.Sum256(data)
+	return &Transfer{
+		Name:            "object",
+		Oid:             hex.EncodeToString(sum[:]),
+		Size:            int64(len(data)),
+		Path:            filepath.Join(t.TempDir(), "object"),
+		Authenticated:   true,
+		ContentEncoding: encoding,
+		Actions: ActionSet{
+			"upload":   &Action{Href: href},
+			"download": &Action{Href: href},
+		},
+	}
+}
+
+func runCompressionTestTransfer(t *testing.T, dir Direction, tr *Transfer) error {
+	gitDir := t.TempDir()
+	f := fs.New(config.EnvironmentOf(config.MapFetcher(nil)), gitDir, "", filepath.Join(gitDir, "lfs"), 0755)
+
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, nil))
+	defer cli.Close()
+
+	m := NewManifest(f, cli, "", "")
+	var a Adapter
+	if dir == Upload {
+		a = m.NewUploadAdapter(BasicAdapterName)
+	} else {
+		a = m.NewDownloadAdapter(BasicAdapterName)
+	}
+
+	require.NoError(t, a.Begin(&adapterConfig{apiClient: cli, concurrentTransfers: 1, remote: "origin"}, nil))
+
+	var err error
+	for res := range a.Add(tr) {
+		err = res.Error
+	}
+	a.End()
+	return err
+}
+
+func TestBasicUploadCompressed(t *testing.T) {
+	data := []byte(strings.Repeat("id,name,value\n", 10000))
+
+	for _, encoding := range supportedContentEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			var received []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "PUT", r.Method)
+				assert.Equal(t, encoding, r.Header.Get("Content-Encoding"))
+				assert.Equal(t, "text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+
+				by, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Less(t, len(by), len(data))
+				received = decompress(t, encoding, by)
+			}))
+			defer srv.Close()
+
+			tr := newCompressionTestTransfer(t, data, encoding, srv.URL)
+			require.NoError(t, os.WriteFile(tr.Path, data, 0644))
+
+			require.NoError(t, runCompressionTestTransfer(t, Upload, tr))
+			assert.Equal(t, data, received)
+		})
+	}
+}
+
+func TestBasicDownloadCompressed(t *testing.T) {
+	data := []byte(strings.Repeat("{\"key\": \"value\"}\n", 10000))
+
+	for _, encoding := range supportedContentEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, encoding, r.Header.Get("Accept-Encoding"))
+
+				w.Header().Set("Content-Encoding", encoding)
+				w.Write(compress(t, encoding, data))
+			}))
+			defer srv.Close()
+
+			tr := newCompressionTestTransfer(t, data, encoding, srv.URL)
+			require.NoError(t, runCompressionTestTransfer(t, Download, tr))
+
+			by, err := os.ReadFile(tr.Path)
+			require.NoError(t, err)
+			assert.Equal(t, data, by)
+		})
+	}
+}
+
+func TestBasicDownloadCompressedServerSendsIdentity(t *testing.T) {
+	data := []byte(strings.Repeat("<svg></svg>\n", 1000))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	tr := newCompressionTestTransfer(t, data, contentEncodingGzip, srv.URL)
+	require.NoError(t, runCompressionTestTransfer(t, Download, tr))
+
+	by, err := os.ReadFile(tr.Path)
+	require.NoError(t, err)
+	assert.Equal(t, data, by)
+}
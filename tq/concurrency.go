@@ -0,0 +1,226 @@
+package tq
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rubyist/tracerx"
+)
+
+var (
+	// adaptInterval is the time between adjustments of the number of
+	// workers when adapting concurrency to the observed throughput.
+	adaptInterval = 2 * time.Second
+)
+
+const (
+	// adaptThreshold is the fractional change in throughput which is
+	// considered significant when adapting concurrency.
+	adaptThreshold = 0.05
+	// adaptProbeIntervals is the number of intervals without a
+	// significant change in throughput after which an extra worker is
+	// tried in case it helps.
+	adaptProbeIntervals = 5
+)
+
+// concurrencyController decides how many workers should transfer objects,
+// between a minimum and maximum, from the throughput observed in each interval
+// and from whether the server asked us to slow down.
+//
+// While throughput keeps improving, it adds a worker at a time. If an extra
+// worker made throughput worse, it removes it again, and whenever the server
+// responds that we should retry later, it halves the number of workers.
+type concurrencyController struct {
+	min, max int
+	limit    int
+
+	lastRate float64
+	grew     bool
+	steady   int
+
+	// throttled is non-zero if the server asked us to retry later since
+	// the last adjustment.
+	throttled int32
+}
+
+func newConcurrencyController(initial, min, max int) *concurrencyController {
+	c := &concurrencyController{min: min, max: max}
+	c.limit = c.clamp(initial)
+	return c
+}
+
+func (c *concurrencyController) clamp(n int) int {
+	if n > c.max {
+		n = c.max
+	}
+	if n < c.min {
+		n = c.min
+	}
+	return n
+}
+
+// throttle records that the server asked us to retry a request later. It may
+// be called from any goroutine.
+func (c *concurrencyController) throttle() {
+	if c == nil {
+		return
+	}
+	atomic.StoreInt32(&c.throttled, 1)
+}
+
+// adjust returns the number of workers which should transfer objects, given
+// the throughput in bytes per second observed since it was last called.
+func (c *concurrencyController) adjust(rate float64) int {
+	if atomic.SwapInt32(&c.throttled, 0) != 0 {
+		c.limit = c.clamp(c.limit / 2)
+		c.grew = false
+		c.steady = 0
+		c.lastRate = 0
+		return c.limit
+	}
+
+	switch {
+	case rate > c.lastRate*(1+adaptThreshold):
+		c.grow()
+	case c.grew && rate < c.lastRate*(1-adaptThreshold):
+		c.limit = c.clamp(c.limit - 1)
+		c.grew = false
+		c.steady = 0
+	default:
+		c.grew = false
+		if c.steady++; c.steady >= adaptProbeIntervals {
+			c.grow()
+		}
+	}
+	c.lastRate = rate
+	return c.limit
+}
+
+func (c *concurrencyController) grow() {
+	c.grew = c.limit < c.max
+	c.limit = c.clamp(c.limit + 1)
+	c.steady = 0
+}
+
+// workerGate limits which of an adapter's workers take jobs, so that the
+// number of them transferring objects may be changed while they run. Only the
+// workers numbered below the limit take jobs; the others wait, having finished
+// any job they were processing, until the limit is raised or the gate closed.
+type workerGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	closed bool
+
+	// parked holds whether each worker is waiting at the gate.
+	parked []bool
+	// busy is the number of workers, counting from zero, which may hold
+	// resources for transferring objects.
+	busy int
+	// onIdle, if set, is called when the workers numbered "n" and above
+	// are all waiting at the gate, so that any resources they hold may be
+	// released.
+	onIdle func(n int)
+}
+
+func newWorkerGate(workers int) *workerGate {
+	g := &workerGate{
+		limit:  workers,
+		parked: make([]bool, workers),
+		busy:   workers,
+	}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// setLimit allows the workers numbered below "n" to take jobs, returning the
+// limit, which is at least one and at most the number of workers.
+func (g *workerGate) setLimit(n int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if n > len(g.parked) {
+		n = len(g.parked)
+	}
+	if n < 1 {
+		n = 1
+	}
+	g.limit = n
+	g.cond.Broadcast()
+	return n
+}
+
+// wait blocks until the worker may take a job.
+func (g *workerGate) wait(workerNum int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for workerNum >= g.limit && !g.closed {
+		if !g.parked[workerNum] {
+			g.parked[workerNum] = true
+
+			n := len(g.parked)
+			for n > 0 && g.parked[n-1] {
+				n--
+			}
+			if n < g.busy {
+				g.busy = n
+				if g.onIdle != nil {
+					g.onIdle(n)
+				}
+			}
+		}
+		g.cond.Wait()
+	}
+
+	g.parked[workerNum] = false
+	if workerNum >= g.busy {
+		g.busy = workerNum + 1
+	}
+}
+
+// close releases all workers waiting at the gate, and any which reach it
+// later.
+func (g *workerGate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.closed = true
+	g.cond.Broadcast()
+}
+
+// adaptConcurrency periodically sets the number of the adapter's workers which
+// transfer objects according to the throughput measured by the queue's meter,
+// until "stop" is closed.
+func (q *TransferQueue) adaptConcurrency(a concurrencyAdapter, c *concurrencyController, stop <-chan struct{}) {
+	ticker := time.NewTicker(adaptInterval)
+	defer ticker.Stop()
+
+	last := q.meter.bytesTransferred()
+	lastAt := time.Now()
+	limit := c.limit
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			bytes := q.meter.bytesTransferred()
+			rate := float64(bytes-last) / now.Sub(lastAt).Seconds()
+			last, lastAt = bytes, now
+
+			if n := c.adjust(rate); n != limit {
+				tracerx.Printf("tq: adjusting concurrent transfers from %d to %d (%.0f B/s)", limit, n, rate)
+				limit = n
+				a.setConcurrency(n)
+			}
+		}
+	}
+}
+
+// concurrencyAdapter is implemented by adapters whose number of workers
+// transferring objects can be changed while they run.
+type concurrencyAdapter interface {
+	setConcurrency(n int)
+}
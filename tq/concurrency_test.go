@@ -0,0 +1,113 @@
+package tq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyControllerClampsInitialLimit(t *testing.T) {
+	assert.Equal(t, 4, newConcurrencyController(8, 1, 4).limit)
+	assert.Equal(t, 2, newConcurrencyController(1, 2, 4).limit)
+}
+
+func TestConcurrencyControllerGrowsWhileThroughputImproves(t *testing.T) {
+	c := newConcurrencyController(2, 1, 4)
+
+	assert.Equal(t, 3, c.adjust(100))
+	assert.Equal(t, 4, c.adjust(200))
+	assert.Equal(t, 4, c.adjust(300))
+}
+
+func TestConcurrencyControllerStepsBackWhenGrowthHurts(t *testing.T) {
+	c := newConcurrencyController(2, 1, 4)
+
+	assert.Equal(t, 3, c.adjust(100))
+	assert.Equal(t, 2, c.adjust(50))
+
+	// A further drop in throughput is not a result of having grown, so
+	// the controller keeps the same number of workers.
+	assert.Equal(t, 2, c.adjust(25))
+}
+
+func TestConcurrencyControllerProbesWhenSteady(t *testing.T) {
+	c := newConcurrencyController(2, 1, 4)
+	c.lastRate = 100
+
+	for i := 1; i < adaptProbeIntervals; i++ {
+		assert.Equal(t, 2, c.adjust(100))
+	}
+	assert.Equal(t, 3, c.adjust(100))
+}
+
+func TestConcurrencyControllerHalvesWhenThrottled(t *testing.T) {
+	c := newConcurrencyController(8, 3, 8)
+
+	c.throttle()
+	assert.Equal(t, 4, c.adjust(1000))
+	c.throttle()
+	assert.Equal(t, 3, c.adjust(1000))
+
+	// Throughput is measured afresh after being throttled.
+	assert.Equal(t, 4, c.adjust(10))
+}
+
+func TestNilConcurrencyControllerThrottle(t *testing.T) {
+	var c *concurrencyController
+	c.throttle()
+}
+
+func TestWorkerGateParksWorkersAboveLimit(t *testing.T) {
+	g := newWorkerGate(3)
+	idle := make(chan int, 3)
+	g.onIdle = func(n int) { idle <- n }
+
+	assert.Equal(t, 1, g.setLimit(0))
+	assert.Equal(t, 3, g.setLimit(5))
+	assert.Equal(t, 1, g.setLimit(1))
+
+	// Worker 0 is never parked.
+	g.wait(0)
+
+	released := make([]chan struct{}, 3)
+	for i := 1; i < 3; i++ {
+		released[i] = make(chan struct{})
+		go func(n int) {
+			g.wait(n)
+			close(released[n])
+		}(i)
+	}
+
+	// Whichever order the workers park in, the last notification is
+	// that all of the workers from 1 upward are idle.
+	for n := 0; n != 1; {
+		select {
+		case n = <-idle:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for workers to park")
+		}
+	}
+
+	assert.Equal(t, 2, g.setLimit(2))
+	select {
+	case <-released[1]:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for worker 1 to be released")
+	}
+	select {
+	case <-released[2]:
+		t.Fatal("worker 2 released unexpectedly")
+	default:
+	}
+
+	g.close()
+	select {
+	case <-released[2]:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for worker 2 to be released")
+	}
+
+	// Workers reaching the gate after it is closed are not parked.
+	g.wait(2)
+}
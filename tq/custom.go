@@ -120,6 +120,12 @@ func (a *customAdapter) Begin(cfg AdapterConfig, cb ProgressCallback) error {
 	return a.adapterBase.Begin(&customAdapterConfig{AdapterConfig: cfg}, cb)
 }
 
+// rateLimiter returns nil, since custom transfer agents move the data
+// themselves and so cannot be throttled.
+func (a *customAdapter) rateLimiter() *throttle {
+	return nil
+}
+
 func (a *customAdapter) WorkerStarting(workerNum int) (interface{}, error) {
 	// Start a process per worker
 	// If concurrent = false we have already dialled back workers to 1
@@ -312,7 +318,7 @@ func (a *customAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCall
 			}
 			if a.direction == Download {
 				// So we don't have to blindly trust external providers, check SHA
-				if err = tools.VerifyFileHash(t.Oid, resp.Path); err != nil {
+				if err = tools.VerifyFileHash(t.Oid, resp.Path, t.HashAlgorithm.OrDefault()); err != nil {
 					return errors.New(tr.Tr.Get("downloaded file failed checks: %v", err))
 				}
 				// Move file to final location
@@ -0,0 +1,50 @@
+package tq
+
+import (
+	"github.com/git-lfs/git-lfs/v3/events"
+)
+
+// emitObjectEvent writes an event of the given type to the event stream for
+// the object with the given OID and size, which failed with err, if it is not
+// nil.
+func (q *TransferQueue) emitObjectEvent(typ, oid string, size int64, err error) {
+	if !events.Enabled() {
+		return
+	}
+
+	events.Emit(events.Event{
+		Type:      typ,
+		Direction: q.direction.String(),
+		Oid:       oid,
+		Path:      q.nameOf(oid),
+		Size:      size,
+		Error:     events.ErrorOf(err),
+	})
+}
+
+// emitRetryEvent writes an event to the event stream recording that the
+// transfer of t will be retried for the count-th time, after failing with err,
+// if it is not nil.
+func (q *TransferQueue) emitRetryEvent(t *objectTuple, count int, err error) {
+	events.Emit(events.Event{
+		Type:      events.ObjectRetried,
+		Direction: q.direction.String(),
+		Oid:       t.Oid,
+		Path:      t.Name,
+		Size:      t.Size,
+		Retry:     count,
+		Error:     events.ErrorOf(err),
+	})
+}
+
+// nameOf returns the name of the first file added to the queue with the given
+// OID, or an empty string if there is none.
+func (q *TransferQueue) nameOf(oid string) string {
+	q.trMutex.Lock()
+	defer q.trMutex.Unlock()
+
+	if objects, ok := q.transfers[oid]; ok {
+		return objects.First().Name
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package tq
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// integrityHashes are the hash algorithms used by the supported integrity
+// headers, named as in the Digest header.
+var integrityHashes = map[string]func() hash.Hash{
+	"MD5":     md5.New,
+	"SHA-256": sha256.New,
+	"SHA-512": sha512.New,
+}
+
+// oidDigestNames names the hash algorithms with which OIDs are computed as in
+// the Digest header, since an object's hash with the algorithm of its OID need
+// not be computed again.
+var oidDigestNames = map[tools.HashAlgorithm]string{
+	tools.SHA256: "SHA-256",
+	tools.SHA512: "SHA-512",
+}
+
+// setIntegrityHeaders sets the integrity headers which the storage backend
+// expects with the upload of t using rel, so that it may reject a corrupt
+// upload, computing them from r, which is rewound afterwards. The headers are
+// those listed by the action or, failing that, by lfs.transfer.integrityHeaders,
+// and any already set by the action are left as they are. If the upload is
+// compressed, they are computed from the compressed body.
+func (a *basicUploadAdapter) setIntegrityHeaders(req *http.Request, t *Transfer, rel *Action, r io.ReadSeeker) error {
+	list := rel.IntegrityHeaders
+	if len(list) == 0 {
+		uc := config.NewURLConfig(a.apiClient.GitEnv())
+		list, _ = uc.Get("lfs.transfer", rel.Href, "integrityheaders")
+	}
+
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) > 0 && len(req.Header.Get(name)) == 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	oid, body := t.Oid, io.Reader(r)
+	if len(t.ContentEncoding) > 0 {
+		// The headers describe the body as it is sent, so compute them
+		// from the object compressed just as it will be when it is
+		// uploaded, rather than from its OID.
+		encoded, err := newCompressingReader(r, t.ContentEncoding)
+		if err != nil {
+			return err
+		}
+		oid, body = "", encoded
+	}
+
+	headers, err := integrityHeaders(names, oid, t.HashAlgorithm.OrDefault(), rel.WantDigest, body)
+	if c, ok := body.(io.Closer); ok {
+		// Stop compressing before the object is rewound.
+		c.Close()
+	}
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("basic upload"))
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, tr.Tr.Get("basic upload"))
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return nil
+}
+
+// integrityHeaders returns the values of the named integrity headers for the
+// object with the given OID, computed with oidAlg, and contents r. The Digest
+// header uses the algorithm selected from wantDigest, or SHA-256 if that is
+// empty. Unsupported headers are ignored.
+//
+// The hash for the algorithm of the OID is taken from the OID itself, if it is
+// valid, so that a file which no longer matches its OID is rejected by the
+// backend, and r is only read if other hashes are needed.
+func integrityHeaders(names []string, oid string, oidAlg tools.HashAlgorithm, wantDigest string, r io.Reader) (map[string]string, error) {
+	algs := make(map[string]string)
+	for _, name := range names {
+		switch key := http.CanonicalHeaderKey(name); key {
+		case "Content-Md5":
+			algs[key] = "MD5"
+		case "X-Amz-Checksum-Sha256":
+			algs[key] = "SHA-256"
+		case "Digest":
+			alg := "SHA-256"
+			if len(wantDigest) > 0 {
+				var h hash.Hash
+				if alg, h = selectDigest(wantDigest); h == nil {
+					tracerx.Printf("xfer: no supported digest algorithm in %q", wantDigest)
+					continue
+				}
+			}
+			algs[key] = alg
+		default:
+			tracerx.Printf("xfer: unsupported integrity header %q", name)
+		}
+	}
+
+	sums := make(map[string][]byte)
+	if alg, ok := oidDigestNames[oidAlg]; ok && oidAlg.IsValidOid(oid) {
+		if sum, err := hex.DecodeString(oid); err == nil {
+			sums[alg] = sum
+		}
+	}
+
+	hashes := make(map[string]hash.Hash)
+	var writers []io.Writer
+	for _, alg := range algs {
+		if _, ok := sums[alg]; ok {
+			continue
+		}
+		if _, ok := hashes[alg]; !ok {
+			hashes[alg] = integrityHashes[alg]()
+			writers = append(writers, hashes[alg])
+		}
+	}
+
+	if len(writers) > 0 {
+		if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+			return nil, err
+		}
+		for alg, h := range hashes {
+			sums[alg] = h.Sum(nil)
+		}
+	}
+
+	headers := make(map[string]string, len(algs))
+	for key, alg := range algs {
+		value := base64.StdEncoding.EncodeToString(sums[alg])
+		if key == "Digest" {
+			value = alg + "=" + value
+		}
+		headers[key] = value
+	}
+	return headers, nil
+}
@@ -0,0 +1,137 @@
+package tq
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrityHeaders(t *testing.T) {
+	data := []byte("integrity")
+	md5sum := md5.Sum(data)
+	sha256sum := sha256.Sum256(data)
+	sha512sum := sha512.Sum512(data)
+	oid := hex.EncodeToString(sha256sum[:])
+
+	headers, err := integrityHeaders([]string{"content-md5", "Digest", "x-amz-checksum-sha256", "X-Unknown"}, oid, tools.SHA256, "", bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"Content-Md5":           base64.StdEncoding.EncodeToString(md5sum[:]),
+		"Digest":                "SHA-256=" + base64.StdEncoding.EncodeToString(sha256sum[:]),
+		"X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(sha256sum[:]),
+	}, headers)
+
+	headers, err = integrityHeaders([]string{"Digest"}, oid, tools.SHA256, "sha-256;q=0.5, sha-512", bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"Digest": "SHA-512=" + base64.StdEncoding.EncodeToString(sha512sum[:]),
+	}, headers)
+
+	headers, err = integrityHeaders([]string{"Digest"}, oid, tools.SHA256, "md5", bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Empty(t, headers)
+}
+
+func TestIntegrityHeadersUseOid(t *testing.T) {
+	data := []byte("integrity")
+	sum := sha256.Sum256(data)
+	oid := hex.EncodeToString(sum[:])
+
+	// The SHA-256 hash is that of the OID, not of the corrupt contents,
+	// which are not read at all.
+	r := bytes.NewReader([]byte("INTEGRITY"))
+	headers, err := integrityHeaders([]string{"x-amz-checksum-sha256"}, oid, tools.SHA256, "", r)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(sum[:]),
+	}, headers)
+	assert.Equal(t, int64(len(data)), int64(r.Len()))
+}
+
+func TestSetIntegrityHeaders(t *testing.T) {
+	data := []byte("integrity")
+	md5sum := md5.Sum(data)
+	sha256sum := sha256.Sum256(data)
+	oid := hex.EncodeToString(sha256sum[:])
+
+	cr, err := newCompressingReader(bytes.NewReader(data), contentEncodingZstd)
+	require.NoError(t, err)
+	compressed, err := io.ReadAll(cr)
+	require.NoError(t, err)
+	require.NoError(t, cr.Close())
+	compressedMD5 := md5.Sum(compressed)
+	compressedSHA256 := sha256.Sum256(compressed)
+
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.transfer.integrityheaders":                          "Content-MD5",
+		"lfs.transfer.https://storage.example/.integrityheaders": "Digest",
+	}))
+	defer cli.Close()
+	a := &basicUploadAdapter{newAdapterBase(nil, BasicAdapterName, Upload, nil)}
+	a.apiClient = cli
+
+	for desc, c := range map[string]struct {
+		Action   *Action
+		Encoding string
+		Header   http.Header
+	}{
+		"config": {
+			Action: &Action{Href: "https://other.example/" + oid},
+			Header: http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(md5sum[:])}},
+		},
+		"url config": {
+			Action: &Action{Href: "https://storage.example/" + oid},
+			Header: http.Header{"Digest": {"SHA-256=" + base64.StdEncoding.EncodeToString(sha256sum[:])}},
+		},
+		"action": {
+			Action: &Action{Href: "https://storage.example/" + oid, IntegrityHeaders: "x-amz-checksum-sha256"},
+			Header: http.Header{"X-Amz-Checksum-Sha256": {base64.StdEncoding.EncodeToString(sha256sum[:])}},
+		},
+		"action header": {
+			Action: &Action{
+				Href:             "https://storage.example/" + oid,
+				Header:           map[string]string{"Content-MD5": "signed"},
+				IntegrityHeaders: "Content-MD5",
+			},
+			Header: http.Header{"Content-Md5": {"signed"}},
+		},
+		"compressed": {
+			Action:   &Action{Href: "https://storage.example/" + oid, IntegrityHeaders: "Content-MD5, x-amz-checksum-sha256"},
+			Encoding: "zstd",
+			Header: http.Header{
+				"Content-Md5":           {base64.StdEncoding.EncodeToString(compressedMD5[:])},
+				"X-Amz-Checksum-Sha256": {base64.StdEncoding.EncodeToString(compressedSHA256[:])},
+			},
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			req, err := http.NewRequest("PUT", c.Action.Href, nil)
+			require.NoError(t, err)
+			for k, v := range c.Action.Header {
+				req.Header.Set(k, v)
+			}
+
+			tr := &Transfer{Oid: oid, Size: int64(len(data)), ContentEncoding: c.Encoding}
+			r := bytes.NewReader(data)
+			require.NoError(t, a.setIntegrityHeaders(req, tr, c.Action, r))
+			assert.Equal(t, c.Header, req.Header)
+
+			// The reader is rewound for the upload.
+			by, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, data, by)
+		})
+	}
+}
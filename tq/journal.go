@@ -0,0 +1,211 @@
+package tq
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// journalState is the state of an object recorded in a Journal.
+type journalState string
+
+const (
+	// journalQueued is recorded when an object is added to the queue.
+	journalQueued journalState = "queued"
+	// journalStarted is recorded when an object is handed to the
+	// transfer adapter.
+	journalStarted journalState = "started"
+	// journalCompleted is recorded once an object has been transferred,
+	// or the server has confirmed that it need not be.
+	journalCompleted journalState = "completed"
+)
+
+// Journal is an append-only record, kept on disk, of the objects added to a
+// TransferQueue and of which of them have been transferred. If a transfer is
+// interrupted, the journal it leaves behind allows a later transfer to the
+// same remote in the same direction to skip the objects which were already
+// completed.
+//
+// A Journal may be shared by several TransferQueues in turn.
+type Journal struct {
+	path string
+
+	mu        sync.Mutex
+	f         *os.File
+	completed map[string]struct{}
+}
+
+// JournalPath returns the path of the journal for transfers in the given
+// direction to or from the named remote, within the directory "dir".
+func JournalPath(dir string, remote string, direction Direction) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%s", direction, url.QueryEscape(remote)))
+}
+
+// OpenJournal opens the journal at "path" for transfers to or from the given
+// endpoint URL.
+//
+// If "resume" is true, the objects which an existing journal at that path
+// records as completed are skipped by any TransferQueue using the returned
+// journal, unless it was written for a different endpoint. Otherwise, any
+// existing journal is discarded.
+func OpenJournal(path, endpoint string, resume bool) (*Journal, error) {
+	j := &Journal{
+		path:      path,
+		completed: make(map[string]struct{}),
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		ok, err := j.load(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			flags = os.O_WRONLY | os.O_APPEND
+		}
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("could not open transfer journal"))
+	}
+	j.f = f
+
+	if flags&os.O_TRUNC != 0 {
+		if _, err := fmt.Fprintf(f, "endpoint %s\n", endpoint); err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, tr.Tr.Get("could not write transfer journal"))
+		}
+	}
+	return j, nil
+}
+
+// load reads the completed objects from the existing journal, returning
+// whether it exists and was written for transfers to or from "endpoint".
+func (j *Journal) load(endpoint string) (bool, error) {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		tracerx.Printf("tq: no transfer journal to resume at %s", j.path)
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, tr.Tr.Get("could not read transfer journal"))
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != "endpoint "+endpoint {
+		tracerx.Printf("tq: ignoring transfer journal at %s for a different endpoint", j.path)
+		return false, scanner.Err()
+	}
+
+	var inflight int
+	started := make(map[string]struct{})
+	for scanner.Scan() {
+		// A journal which was interrupted while it was being
+		// written may end with an incomplete line; ignore it, and
+		// any other lines we don't understand.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if _, err := strconv.ParseInt(fields[2], 10, 64); err != nil {
+			continue
+		}
+
+		switch oid := fields[1]; journalState(fields[0]) {
+		case journalStarted:
+			started[oid] = struct{}{}
+		case journalCompleted:
+			j.completed[oid] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, errors.Wrap(err, tr.Tr.Get("could not read transfer journal"))
+	}
+
+	for oid := range started {
+		if _, ok := j.completed[oid]; !ok {
+			inflight++
+		}
+	}
+	tracerx.Printf("tq: resuming from transfer journal at %s: %d object(s) completed, %d in flight",
+		j.path, len(j.completed), inflight)
+	return true, nil
+}
+
+// Completed returns whether the journal being resumed records the object as
+// having been transferred.
+func (j *Journal) Completed(oid string) bool {
+	if j == nil {
+		return false
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, ok := j.completed[oid]
+	return ok
+}
+
+// record appends the new state of an object to the journal. Since the journal
+// only serves to save work when resuming, errors writing it are traced but
+// otherwise ignored.
+func (j *Journal) record(state journalState, oid string, size int64) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return
+	}
+	if state == journalCompleted {
+		j.completed[oid] = struct{}{}
+	}
+	if _, err := fmt.Fprintf(j.f, "%s %s %d\n", state, oid, size); err != nil {
+		tracerx.Printf("tq: could not write transfer journal: %s", err)
+	}
+}
+
+// Close closes the journal, leaving it in place for a later transfer to
+// resume from.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Remove closes and deletes the journal, once all of the transfers it records
+// have succeeded.
+func (j *Journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+
+	j.Close()
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
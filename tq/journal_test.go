@@ -0,0 +1,164 @@
+package tq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const journalTestEndpoint = "https://example.com/repo.git/info/lfs"
+
+func TestJournalPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("journal", "upload-origin"),
+		JournalPath("journal", "origin", Upload))
+	assert.Equal(t, filepath.Join("journal", "download-https%3A%2F%2Fexample.com%2Frepo"),
+		JournalPath("journal", "https://example.com/repo", Download))
+}
+
+func TestJournalResumesCompletedObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload-origin")
+
+	j, err := OpenJournal(path, journalTestEndpoint, false)
+	require.NoError(t, err)
+	j.record(journalQueued, "a", 1)
+	j.record(journalQueued, "b", 2)
+	j.record(journalStarted, "a", 1)
+	j.record(journalStarted, "b", 2)
+	j.record(journalCompleted, "a", 1)
+	assert.True(t, j.Completed("a"))
+	require.NoError(t, j.Close())
+
+	// Simulate an interruption part of the way through writing a line.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("completed b")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	j, err = OpenJournal(path, journalTestEndpoint, true)
+	require.NoError(t, err)
+	assert.True(t, j.Completed("a"))
+	assert.False(t, j.Completed("b"))
+	require.NoError(t, j.Close())
+
+	j, err = OpenJournal(path, "https://example.com/other.git/info/lfs", true)
+	require.NoError(t, err)
+	assert.False(t, j.Completed("a"))
+	require.NoError(t, j.Close())
+
+	// The journal for the other endpoint replaced the original one.
+	j, err = OpenJournal(path, journalTestEndpoint, true)
+	require.NoError(t, err)
+	assert.False(t, j.Completed("a"))
+	require.NoError(t, j.Remove())
+	assert.NoFileExists(t, path)
+}
+
+func TestJournalDiscardedWithoutResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "download-origin")
+
+	j, err := OpenJournal(path, journalTestEndpoint, false)
+	require.NoError(t, err)
+	j.record(journalCompleted, "a", 1)
+	require.NoError(t, j.Close())
+
+	j, err = OpenJournal(path, journalTestEndpoint, false)
+	require.NoError(t, err)
+	assert.False(t, j.Completed("a"))
+	require.NoError(t, j.Close())
+
+	by, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "endpoint "+journalTestEndpoint+"\n", string(by))
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+
+	assert.False(t, j.Completed("a"))
+	j.record(journalCompleted, "a", 1)
+	assert.NoError(t, j.Close())
+	assert.NoError(t, j.Remove())
+}
+
+func TestTransferQueueSkipsJournaledObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload-origin")
+
+	j, err := OpenJournal(path, journalTestEndpoint, false)
+	require.NoError(t, err)
+	j.record(journalCompleted, "a", 1)
+	require.NoError(t, j.Close())
+
+	j, err = OpenJournal(path, journalTestEndpoint, true)
+	require.NoError(t, err)
+	defer j.Close()
+
+	cli := lfsapi.NewClient(nil)
+	defer cli.Close()
+
+	q := NewTransferQueue(
+		Upload, NewManifest(nil, cli, "", ""), "origin", WithJournal(j),
+	)
+	watcher := q.Watch()
+
+	// Since the object is skipped, no batch request is made, which
+	// would otherwise fail for want of an endpoint.
+	q.Add("a.dat", "a.dat", "a", 1, false, nil)
+	q.Add("b.dat", "b.dat", "a", 1, false, nil)
+	q.Wait()
+
+	assert.Empty(t, q.Errors())
+
+	var names []string
+	for t := range watcher {
+		names = append(names, t.Name)
+	}
+	assert.Equal(t, []string{"a.dat", "b.dat"}, names)
+}
+
+func TestTransferQueueDownloadsMissingJournaledObjects(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "download-origin")
+
+	j, err := OpenJournal(path, journalTestEndpoint, false)
+	require.NoError(t, err)
+	j.record(journalCompleted, "a", 1)
+	j.record(journalCompleted, "b", 1)
+	j.record(journalCompleted, "c", 1)
+	require.NoError(t, j.Close())
+
+	j, err = OpenJournal(path, journalTestEndpoint, true)
+	require.NoError(t, err)
+	defer j.Close()
+
+	// Only "a" is still present; "b" has been removed and "c" truncated.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c"), nil, 0644))
+
+	cli := lfsapi.NewClient(nil)
+	defer cli.Close()
+
+	q := NewTransferQueue(
+		Download, NewManifest(nil, cli, "", ""), "origin", WithJournal(j),
+	)
+	watcher := q.Watch()
+
+	// The missing objects are requested again, in a batch which fails
+	// for want of an endpoint.
+	for _, oid := range []string{"a", "b", "c"} {
+		q.Add(oid+".dat", filepath.Join(dir, oid), oid, 1, false, nil)
+	}
+	q.Wait()
+
+	assert.NotEmpty(t, q.Errors())
+
+	var names []string
+	for t := range watcher {
+		names = append(names, t.Name)
+	}
+	assert.Equal(t, []string{"a.dat"}, names)
+}
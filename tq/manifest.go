@@ -11,6 +11,7 @@ import (
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
 	"github.com/git-lfs/git-lfs/v3/lfshttp"
 	"github.com/git-lfs/git-lfs/v3/ssh"
+	"github.com/git-lfs/git-lfs/v3/tools/humanize"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/rubyist/tracerx"
 )
@@ -153,9 +154,17 @@ type concreteManifest struct {
 	maxRetryDelay           int
 	maxRetryTime            int
 	concurrentTransfers     int
+	adaptiveConcurrency     bool
+	minConcurrentTransfers  int
+	maxConcurrentTransfers  int
 	basicTransfersOnly      bool
 	standaloneTransferAgent string
 	tusTransfersAllowed     bool
+	rangedDownloadThreshold int64
+	rangedDownloadParts     int
+	contentEncodings        []string
+	cacheServer             string
+	mirrors                 *mirrorSet
 	downloadAdapterFuncs    map[string]NewAdapterFunc
 	uploadAdapterFuncs      map[string]NewAdapterFunc
 	customDownloadAdapters  map[string]bool
@@ -228,7 +237,7 @@ func newConcreteManifest(f *fs.Filesystem, apiClient *lfsapi.Client, operation,
 		sshTransfer:            sshTransfer,
 	}
 
-	var tusAllowed bool
+	var tusAllowed, chunkedAllowed bool
 	if git := apiClient.GitEnv(); git != nil {
 		if v := git.Int("lfs.transfer.maxretries", 0); v > 0 {
 			m.maxRetries = v
@@ -242,11 +251,37 @@ func newConcreteManifest(f *fs.Filesystem, apiClient *lfsapi.Client, operation,
 		if v := git.Int("lfs.concurrenttransfers", 0); v > 0 {
 			m.concurrentTransfers = v
 		}
+		m.adaptiveConcurrency = git.Bool("lfs.transfer.adaptiveconcurrency", false)
+		if v := git.Int("lfs.transfer.minconcurrenttransfers", 0); v > 0 {
+			m.minConcurrentTransfers = v
+		}
+		if v := git.Int("lfs.transfer.maxconcurrenttransfers", 0); v > 0 {
+			m.maxConcurrentTransfers = v
+		}
+		if v, ok := git.Get("lfs.transfer.rangeddownloadthreshold"); ok && len(v) > 0 {
+			if n, err := humanize.ParseBytes(v); err == nil {
+				m.rangedDownloadThreshold = int64(n)
+			} else {
+				tracerx.Printf("tq: invalid lfs.transfer.rangedDownloadThreshold value %q: %s", v, err)
+			}
+		}
+		if v := git.Int("lfs.transfer.rangeddownloadparts", 0); v > 0 {
+			m.rangedDownloadParts = v
+		}
+		m.cacheServer, _ = git.Get("lfs.cacheserver")
+		m.mirrors = newMirrorSet(apiClient.Endpoints.MirrorEndpoints(remote))
+		if git.Bool("lfs.transfer.compression", false) {
+			m.contentEncodings = supportedContentEncodings
+			if v, ok := git.Get("lfs.transfer.contentencodings"); ok {
+				m.contentEncodings = parseContentEncodings(v)
+			}
+		}
 		m.basicTransfersOnly = git.Bool("lfs.basictransfersonly", false)
 		m.standaloneTransferAgent = findStandaloneTransfer(
 			apiClient, operation, remote,
 		)
 		tusAllowed = git.Bool("lfs.tustransfers", false)
+		chunkedAllowed = git.Bool("lfs.chunkedtransfers", false)
 		configureCustomAdapters(git, m)
 	}
 
@@ -264,11 +299,26 @@ func newConcreteManifest(f *fs.Filesystem, apiClient *lfsapi.Client, operation,
 		m.concurrentTransfers = lfshttp.DefaultConcurrentTransfers()
 	}
 
+	if m.rangedDownloadParts < 1 {
+		m.rangedDownloadParts = m.concurrentTransfers
+	}
+
+	if m.minConcurrentTransfers < 1 {
+		m.minConcurrentTransfers = 1
+	}
+	if m.maxConcurrentTransfers < 1 {
+		m.maxConcurrentTransfers = 4 * m.concurrentTransfers
+	}
+	if m.maxConcurrentTransfers < m.minConcurrentTransfers {
+		m.maxConcurrentTransfers = m.minConcurrentTransfers
+	}
+
 	if sshTransfer != nil {
 		// Multiple concurrent transfers are not supported
 		// when SSH multiplexing is disabled.
 		if !useSSHMultiplexing {
 			m.concurrentTransfers = 1
+			m.adaptiveConcurrency = false
 		}
 
 		m.batchClientAdapter = &SSHBatchClient{
@@ -279,9 +329,13 @@ func newConcreteManifest(f *fs.Filesystem, apiClient *lfsapi.Client, operation,
 
 	configureBasicDownloadAdapter(m)
 	configureBasicUploadAdapter(m)
+	configureMultipartAdapter(m)
 	if tusAllowed {
 		configureTusAdapter(m)
 	}
+	if chunkedAllowed {
+		configureChunkedAdapter(m)
+	}
 	configureSSHAdapter(m)
 
 	if m.IsStandaloneTransfer() {
@@ -75,3 +75,29 @@ func TestManifestIgnoresNonInts(t *testing.T) {
 	assert.Equal(t, 10, m.MaxRetryDelay())
 	assert.Equal(t, 300, m.MaxRetryTime())
 }
+
+func TestManifestAdaptiveConcurrencyDefaults(t *testing.T) {
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.concurrenttransfers":          "3",
+		"lfs.transfer.adaptiveconcurrency": "true",
+	}))
+	defer cli.Close()
+
+	m := NewManifest(nil, cli, "", "").Upgrade()
+	assert.True(t, m.adaptiveConcurrency)
+	assert.Equal(t, 1, m.minConcurrentTransfers)
+	assert.Equal(t, 12, m.maxConcurrentTransfers)
+}
+
+func TestManifestAdaptiveConcurrencyBounds(t *testing.T) {
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"lfs.transfer.adaptiveconcurrency":    "true",
+		"lfs.transfer.minconcurrenttransfers": "6",
+		"lfs.transfer.maxconcurrenttransfers": "2",
+	}))
+	defer cli.Close()
+
+	m := NewManifest(nil, cli, "", "").Upgrade()
+	assert.Equal(t, 6, m.minConcurrentTransfers)
+	assert.Equal(t, 6, m.maxConcurrentTransfers)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/events"
 	"github.com/git-lfs/git-lfs/v3/tasklog"
 	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tools/humanize"
@@ -26,15 +27,18 @@ type Meter struct {
 	estimatedBytes    int64
 	lastBytes         int64
 	currentBytes      int64
+	transferredBytes  int64 // Like currentBytes, but without skipped files
 	sampleCount       uint64
 	avgBytes          float64
 	lastAvg           time.Time
 	estimatedFiles    int32
 	paused            uint32
-	fileIndex         map[string]int64 // Maps a file name to its transfer number
+	fileIndex         map[string]int64  // Maps a file name to its transfer number
+	fileOids          map[string]string // Maps a file name to its object's OID, if known
 	fileIndexMutex    *sync.Mutex
 	updates           chan *tasklog.Update
 	cfg               *config.Configuration
+	limiter           atomic.Pointer[throttle] // Limits the transfer rate, if set
 
 	DryRun    bool
 	Logger    *tools.SyncWriter
@@ -81,6 +85,7 @@ func (m *Meter) LoggerToFile(name string) *tools.SyncWriter {
 func NewMeter(cfg *config.Configuration) *Meter {
 	m := &Meter{
 		fileIndex:      make(map[string]int64),
+		fileOids:       make(map[string]string),
 		fileIndexMutex: &sync.Mutex{},
 		updates:        make(chan *tasklog.Update),
 		cfg:            cfg,
@@ -133,6 +138,12 @@ func (m *Meter) Skip(size int64) {
 // StartTransfer tells the progress meter that a transferring file is being
 // added to the TransferQueue.
 func (m *Meter) StartTransfer(name string) {
+	m.startTransfer(name, "")
+}
+
+// startTransfer is like StartTransfer, but records the OID of the file's
+// object, so that it may be included in progress events.
+func (m *Meter) startTransfer(name, oid string) {
 	if m == nil {
 		return
 	}
@@ -141,9 +152,21 @@ func (m *Meter) StartTransfer(name string) {
 	idx := atomic.AddInt64(&m.transferringFiles, 1)
 	m.fileIndexMutex.Lock()
 	m.fileIndex[name] = idx
+	if len(oid) > 0 {
+		m.fileOids[name] = oid
+	}
 	m.fileIndexMutex.Unlock()
 }
 
+// setThrottle tells the progress meter that transfers are limited by "t", so
+// that it may report the limit along with the transfer rate.
+func (m *Meter) setThrottle(t *throttle) {
+	if m == nil {
+		return
+	}
+	m.limiter.Store(t)
+}
+
 // TransferBytes increments the number of bytes transferred
 func (m *Meter) TransferBytes(direction, name string, read, total int64, current int) {
 	if m == nil {
@@ -155,6 +178,7 @@ func (m *Meter) TransferBytes(direction, name string, read, total int64, current
 	now := time.Now()
 	since := now.Sub(m.lastAvg)
 	atomic.AddInt64(&m.currentBytes, int64(current))
+	atomic.AddInt64(&m.transferredBytes, int64(current))
 	atomic.AddInt64(&m.lastBytes, int64(current))
 
 	if since > time.Second {
@@ -169,6 +193,16 @@ func (m *Meter) TransferBytes(direction, name string, read, total int64, current
 	}
 
 	m.logBytes(direction, name, read, total)
+	m.emitProgress(direction, name, read, total)
+}
+
+// bytesTransferred returns the number of bytes transferred so far, not
+// counting those of skipped files.
+func (m *Meter) bytesTransferred() int64 {
+	if m == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&m.transferredBytes)
 }
 
 // FinishTransfer increments the finished transfer count
@@ -181,6 +215,7 @@ func (m *Meter) FinishTransfer(name string) {
 	atomic.AddInt64(&m.finishedFiles, 1)
 	m.fileIndexMutex.Lock()
 	delete(m.fileIndex, name)
+	delete(m.fileOids, name)
 	m.fileIndexMutex.Unlock()
 }
 
@@ -236,12 +271,18 @@ func (m *Meter) str() string {
 	// (Uploading|Downloading) LFS objects: 100% (10/10) 100 MiB | 10 MiB/s
 	percentage := 100 * float64(m.finishedFiles) / float64(m.estimatedFiles)
 
-	return fmt.Sprintf("%s: %3.f%% (%d/%d), %s | %s",
+	s := fmt.Sprintf("%s: %3.f%% (%d/%d), %s | %s",
 		m.Direction.Progress(),
 		percentage,
 		m.finishedFiles, m.estimatedFiles,
 		humanize.FormatBytes(clamp(m.currentBytes)),
 		humanize.FormatByteRate(clampf(m.avgBytes), time.Second))
+
+	// ... | 1 MiB/s (limited to 1 MiB/s)
+	if limit := m.limiter.Load().limit(); limit > 0 {
+		s += " " + tr.Tr.Get("(limited to %s)", humanize.FormatByteRate(limit, time.Second))
+	}
+	return s
 }
 
 // clamp clamps the given "x" within the acceptable domain of the uint64 integer
@@ -283,3 +324,24 @@ func (m *Meter) logBytes(direction, name string, read, total int64) {
 		m.fileIndexMutex.Unlock()
 	}
 }
+
+// emitProgress writes an event to the event stream recording that "read" bytes
+// of the "total" bytes of the named file have been transferred.
+func (m *Meter) emitProgress(direction, name string, read, total int64) {
+	if !events.Enabled() {
+		return
+	}
+
+	m.fileIndexMutex.Lock()
+	oid := m.fileOids[name]
+	m.fileIndexMutex.Unlock()
+
+	events.Emit(events.Event{
+		Type:      events.ObjectProgress,
+		Direction: direction,
+		Oid:       oid,
+		Path:      name,
+		Size:      total,
+		Bytes:     read,
+	})
+}
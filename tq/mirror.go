@@ -0,0 +1,263 @@
+package tq
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/git"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// mirrorLatencyWeight is the weight given to the latest batch request to a
+// mirror when updating its average latency.
+const mirrorLatencyWeight = 0.3
+
+// mirror is a read-only endpoint from which objects may be downloaded instead
+// of the remote's own endpoint.
+type mirror struct {
+	endpoint lfshttp.Endpoint
+
+	// latency is the moving average of the time the mirror has taken to
+	// answer batch requests, or zero if it has not answered one yet.
+	latency time.Duration
+	// failures is the number of batch requests to the mirror which have
+	// failed since it last answered one.
+	failures int
+}
+
+// mirrorSet holds the download mirrors configured for a remote with
+// lfs.<remote>.mirrors. Mirrors which have not failed are tried first, and of
+// those, the fastest; each mirror is tried at least once before one is
+// preferred for being faster, and otherwise they are tried in the order in
+// which they were configured.
+type mirrorSet struct {
+	mu      sync.Mutex
+	mirrors []*mirror
+
+	// served records the mirror which most recently offered each object,
+	// and avoid the mirrors from which each object has failed to
+	// download.
+	served map[string]*mirror
+	avoid  map[string]map[*mirror]bool
+}
+
+func newMirrorSet(endpoints []lfshttp.Endpoint) *mirrorSet {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	s := &mirrorSet{
+		served: make(map[string]*mirror),
+		avoid:  make(map[string]map[*mirror]bool),
+	}
+	for _, e := range endpoints {
+		s.mirrors = append(s.mirrors, &mirror{endpoint: e})
+	}
+	return s
+}
+
+// Len returns the number of mirrors in the set, which may be nil.
+func (s *mirrorSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.mirrors)
+}
+
+// ordered returns the mirrors in the order in which they should be tried.
+func (s *mirrorSet) ordered() []*mirror {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ordered := make([]*mirror, len(s.mirrors))
+	copy(ordered, s.mirrors)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.failures != b.failures {
+			return a.failures < b.failures
+		}
+		return a.latency < b.latency
+	})
+	return ordered
+}
+
+// succeeded records that m answered a batch request in time d, and offered
+// the given objects.
+func (s *mirrorSet) succeeded(m *mirror, d time.Duration, offered []*Transfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.failures = 0
+	if m.latency == 0 {
+		m.latency = d
+	} else {
+		m.latency = time.Duration(mirrorLatencyWeight*float64(d) + (1-mirrorLatencyWeight)*float64(m.latency))
+	}
+	for _, o := range offered {
+		s.served[o.Oid] = m
+	}
+}
+
+// forget records that the given objects are to be downloaded from the real
+// endpoint, rather than from any mirror.
+func (s *mirrorSet) forget(objects []*Transfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range objects {
+		delete(s.served, o.Oid)
+	}
+}
+
+// failed records that a batch request to m failed.
+func (s *mirrorSet) failed(m *mirror) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.failures++
+}
+
+// transferFailed records that the object with the given OID could not be
+// downloaded, so that, if a mirror offered it, that mirror is not asked for
+// it again. It does nothing if s is nil.
+func (s *mirrorSet) transferFailed(oid string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.served[oid]
+	if !ok {
+		return
+	}
+	delete(s.served, oid)
+
+	if s.avoid[oid] == nil {
+		s.avoid[oid] = make(map[*mirror]bool)
+	}
+	s.avoid[oid][m] = true
+	tracerx.Printf("tq: not downloading %s from mirror %s again", oid, m.endpoint.Url)
+}
+
+// avoids returns whether the object with the given OID should not be
+// requested from m.
+func (s *mirrorSet) avoids(m *mirror, oid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.avoid[oid][m]
+}
+
+// batchWithMirrors makes download batch requests for the given objects to
+// each of the mirrors configured for the remote in turn, and then makes one
+// to the real endpoint, using upstream, for any objects which no mirror has.
+//
+// A mirror which fails to answer is skipped, as is one which selects a
+// different transfer adapter from the mirrors already used, since objects must
+// all be transferred with the same adapter.
+func batchWithMirrors(cm *concreteManifest, remote string, remoteRef *git.Ref, objects []*Transfer, upstream func([]*Transfer) (*BatchResponse, error)) (*BatchResponse, error) {
+	client := &tqClient{Client: cm.apiClient, maxRetries: cm.maxRetries}
+
+	var mirrored *BatchResponse
+	missing := objects
+	for _, m := range cm.mirrors.ordered() {
+		var ask, skip []*Transfer
+		for _, o := range missing {
+			if cm.mirrors.avoids(m, o.Oid) {
+				skip = append(skip, o)
+			} else {
+				ask = append(ask, o)
+			}
+		}
+		if len(ask) == 0 {
+			continue
+		}
+
+		start := time.Now()
+		bRes, err := batchByHashAlgorithm(cm, Download, remoteRef, ask, func(bReq *batchRequest) (*BatchResponse, error) {
+			return client.mirrorBatch(remote, m.endpoint, bReq)
+		})
+		if err != nil {
+			cm.mirrors.failed(m)
+			tracerx.Printf("tq: mirror %s unavailable: %s", m.endpoint.Url, err)
+			continue
+		}
+
+		if mirrored != nil && adapterNameOrDefault(bRes.TransferAdapterName) != adapterNameOrDefault(mirrored.TransferAdapterName) {
+			cm.mirrors.succeeded(m, time.Since(start), nil)
+			tracerx.Printf("tq: mirror %s selected transfer adapter %q, not %q", m.endpoint.Url, bRes.TransferAdapterName, mirrored.TransferAdapterName)
+			continue
+		}
+
+		found, rest := partitionMirrored(ask, bRes.Objects)
+		cm.mirrors.succeeded(m, time.Since(start), found)
+		tracerx.Printf("tq: mirror %s has %d of %d object(s)", m.endpoint.Url, len(found), len(ask))
+
+		if len(found) > 0 {
+			if mirrored == nil {
+				mirrored = bRes
+				mirrored.Objects = nil
+			}
+			mirrored.Objects = append(mirrored.Objects, found...)
+		}
+
+		missing = append(skip, rest...)
+		if len(missing) == 0 {
+			return mirrored, nil
+		}
+	}
+
+	bRes, err := upstream(missing)
+	if err != nil {
+		return bRes, err
+	}
+	cm.mirrors.forget(bRes.Objects)
+	if mirrored == nil {
+		return bRes, nil
+	}
+
+	if adapterNameOrDefault(bRes.TransferAdapterName) != adapterNameOrDefault(mirrored.TransferAdapterName) {
+		// Download the mirrored objects from the real endpoint as
+		// well, so that all objects use the same adapter.
+		rest, err := upstream(objectsToRequest(mirrored.Objects))
+		if err != nil {
+			return rest, err
+		}
+		if adapterNameOrDefault(rest.TransferAdapterName) != adapterNameOrDefault(bRes.TransferAdapterName) {
+			return nil, errors.New(tr.Tr.Get("batch response: server selected transfer adapters %q and %q", bRes.TransferAdapterName, rest.TransferAdapterName))
+		}
+		cm.mirrors.forget(rest.Objects)
+		bRes.Objects = append(bRes.Objects, rest.Objects...)
+		return bRes, nil
+	}
+
+	bRes.Objects = append(bRes.Objects, mirrored.Objects...)
+	return bRes, nil
+}
+
+// partitionMirrored splits the requested objects into those a mirror offered
+// to provide in its batch response, returning the response's version of each,
+// and those it did not, including those for which it returned an error.
+func partitionMirrored(requested, offered []*Transfer) (found, missing []*Transfer) {
+	offers := make(map[string]*Transfer)
+	for _, o := range offered {
+		if o.Error == nil && o.Actions["download"] != nil {
+			offers[o.Oid] = o
+		}
+	}
+
+	for _, o := range requested {
+		if offer, ok := offers[o.Oid]; ok && offer.Size == o.Size {
+			found = append(found, offer)
+		} else {
+			missing = append(missing, o)
+		}
+	}
+	return found, missing
+}
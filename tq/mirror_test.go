@@ -0,0 +1,198 @@
+package tq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMirrorBatchServer returns a server which answers batch requests with
+// download actions for the objects it has, and 404 errors for the others,
+// recording the OIDs requested.
+func newMirrorBatchServer(t *testing.T, name string, requested *[]string, has ...string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bReq := &batchRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(bReq))
+
+		for _, o := range bReq.Objects {
+			*requested = append(*requested, o.Oid)
+			o.Error = &ObjectError{Code: 404, Message: "not found"}
+			for _, oid := range has {
+				if oid == o.Oid {
+					o.Error = nil
+					o.Actions = ActionSet{
+						"download": &Action{Href: "https://" + name + ".example/" + o.Oid},
+					}
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&BatchResponse{Objects: bReq.Objects})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newMirrorTestManifest(t *testing.T, upstream string, mirrors ...string) *concreteManifest {
+	cfg := map[string]string{
+		"lfs.url":                 upstream + "/api",
+		"lfs.transfer.maxretries": "1",
+	}
+	for _, m := range mirrors {
+		if len(cfg["lfs.origin.mirrors"]) > 0 {
+			cfg["lfs.origin.mirrors"] += ","
+		}
+		cfg["lfs.origin.mirrors"] += m
+	}
+
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, cfg))
+	t.Cleanup(func() { cli.Close() })
+	return NewManifest(nil, cli, "download", "origin").Upgrade()
+}
+
+func hrefsByOid(bRes *BatchResponse) map[string]string {
+	hrefs := make(map[string]string)
+	for _, o := range bRes.Objects {
+		hrefs[o.Oid] = o.Actions["download"].Href
+	}
+	return hrefs
+}
+
+func TestBatchWithMirrorsFailsOverForMissingObjects(t *testing.T) {
+	first, second, missing := testOid("first"), testOid("second"), testOid("missing")
+
+	var upstreamRequested, nearRequested, farRequested []string
+	upstream := newUpstreamBatchServer(t, "", &upstreamRequested)
+	near := newMirrorBatchServer(t, "near", &nearRequested, first)
+	far := newMirrorBatchServer(t, "far", &farRequested, first, second)
+
+	m := newMirrorTestManifest(t, upstream.URL, near.URL, far.URL)
+	bRes, err := Batch(m, Download, "origin", nil, []*Transfer{
+		{Oid: first, Size: 5},
+		{Oid: second, Size: 6},
+		{Oid: missing, Size: 7},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{first, second, missing}, nearRequested)
+	assert.Equal(t, []string{second, missing}, farRequested)
+	assert.Equal(t, []string{missing}, upstreamRequested)
+	assert.Equal(t, map[string]string{
+		first:   "https://near.example/" + first,
+		second:  "https://far.example/" + second,
+		missing: "https://storage.example/" + missing,
+	}, hrefsByOid(bRes))
+}
+
+func TestBatchWithMirrorsSkipsUnavailableMirror(t *testing.T) {
+	oid := testOid("object")
+
+	var upstreamRequested, downRequested, upRequested []string
+	upstream := newUpstreamBatchServer(t, "", &upstreamRequested)
+	down := newMirrorBatchServer(t, "down", &downRequested, oid)
+	down.Close()
+	up := newMirrorBatchServer(t, "up", &upRequested, oid)
+
+	m := newMirrorTestManifest(t, upstream.URL, down.URL, up.URL)
+	bRes, err := Batch(m, Download, "origin", nil, []*Transfer{{Oid: oid, Size: 6}})
+	require.NoError(t, err)
+
+	assert.Empty(t, upstreamRequested)
+	assert.Equal(t, map[string]string{oid: "https://up.example/" + oid}, hrefsByOid(bRes))
+
+	// The failed mirror is now tried last.
+	ordered := m.mirrors.ordered()
+	assert.Equal(t, up.URL, ordered[0].endpoint.Url)
+	assert.Equal(t, down.URL, ordered[1].endpoint.Url)
+}
+
+func TestBatchWithMirrorsAvoidsMirrorAfterTransferFailure(t *testing.T) {
+	oid := testOid("object")
+
+	var upstreamRequested, mirrorRequested []string
+	upstream := newUpstreamBatchServer(t, "", &upstreamRequested)
+	mirror := newMirrorBatchServer(t, "mirror", &mirrorRequested, oid)
+
+	m := newMirrorTestManifest(t, upstream.URL, mirror.URL)
+	bRes, err := Batch(m, Download, "origin", nil, []*Transfer{{Oid: oid, Size: 6}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://mirror.example/"+oid, hrefsByOid(bRes)[oid])
+
+	m.mirrors.transferFailed(oid)
+
+	bRes, err = Batch(m, Download, "origin", nil, []*Transfer{{Oid: oid, Size: 6}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://storage.example/"+oid, hrefsByOid(bRes)[oid])
+	assert.Equal(t, []string{oid}, mirrorRequested)
+	assert.Equal(t, []string{oid}, upstreamRequested)
+}
+
+func TestBatchWithMirrorsOtherAdapter(t *testing.T) {
+	mirrored, missing := testOid("mirrored"), testOid("missing")
+
+	var upstreamRequested, mirrorRequested []string
+	upstream := newUpstreamBatchServer(t, "tus", &upstreamRequested)
+	mirror := newMirrorBatchServer(t, "mirror", &mirrorRequested, mirrored)
+
+	m := newMirrorTestManifest(t, upstream.URL, mirror.URL)
+	bRes, err := Batch(m, Download, "origin", nil, []*Transfer{
+		{Oid: mirrored, Size: 8},
+		{Oid: missing, Size: 7},
+	})
+	require.NoError(t, err)
+
+	// The mirrored object can't be downloaded with a different adapter,
+	// so it is requested from the real endpoint too.
+	assert.Equal(t, []string{missing, mirrored}, upstreamRequested)
+	assert.Equal(t, "tus", bRes.TransferAdapterName)
+	for _, o := range bRes.Objects {
+		assert.Equal(t, "https://storage.example/"+o.Oid, o.Actions["download"].Href)
+	}
+}
+
+func TestBatchWithMirrorsNotUsedForUploads(t *testing.T) {
+	oid := testOid("object")
+
+	var upstreamRequested, mirrorRequested []string
+	upstream := newUpstreamBatchServer(t, "", &upstreamRequested)
+	mirror := newMirrorBatchServer(t, "mirror", &mirrorRequested, oid)
+
+	m := newMirrorTestManifest(t, upstream.URL, mirror.URL)
+	_, err := Batch(m, Upload, "origin", nil, []*Transfer{{Oid: oid, Size: 6}})
+	require.NoError(t, err)
+
+	assert.Empty(t, mirrorRequested)
+	assert.Equal(t, []string{oid}, upstreamRequested)
+}
+
+func TestMirrorSetPrefersFastestMirror(t *testing.T) {
+	s := newMirrorSet([]lfshttp.Endpoint{{Url: "slow"}, {Url: "fast"}, {Url: "untried"}})
+	slow, fast := s.mirrors[0], s.mirrors[1]
+
+	s.succeeded(slow, 300*time.Millisecond, nil)
+	s.succeeded(fast, 100*time.Millisecond, nil)
+
+	// Mirrors which have not been tried yet come first.
+	urls := func() []string {
+		var urls []string
+		for _, m := range s.ordered() {
+			urls = append(urls, m.endpoint.Url)
+		}
+		return urls
+	}
+	assert.Equal(t, []string{"untried", "fast", "slow"}, urls())
+
+	s.succeeded(s.mirrors[2], 200*time.Millisecond, nil)
+	assert.Equal(t, []string{"fast", "untried", "slow"}, urls())
+
+	s.failed(fast)
+	assert.Equal(t, []string{"untried", "slow", "fast"}, urls())
+}
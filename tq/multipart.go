@@ -0,0 +1,417 @@
+package tq
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/tools"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	MultipartAdapterName = "multipart"
+
+	multipartPartsRel = "parts"
+)
+
+// Adapter for multipart uploads, as described in
+// docs/proposals/multipart_transfer_mode.md. Each object is split into the
+// parts listed by the server, which are uploaded in parallel by the
+// adapterBase workers, and then finalised with the "verify" action.
+type multipartUploadAdapter struct {
+	*adapterBase
+
+	// maxRetries is the number of times a failed part is retried before
+	// the whole object is handed back to the transfer queue.
+	maxRetries int
+
+	mu      sync.Mutex
+	uploads map[string]*multipartUpload
+}
+
+// multipartUpload tracks an object whose parts are being uploaded.
+type multipartUpload struct {
+	t *Transfer
+
+	// progress is the number of bytes uploaded across all parts, and
+	// must be accessed atomically.
+	progress int64
+}
+
+func (a *multipartUploadAdapter) WorkerStarting(workerNum int) (interface{}, error) {
+	return nil, nil
+}
+
+func (a *multipartUploadAdapter) WorkerEnding(workerNum int, ctx interface{}) {
+}
+
+// Add overrides adapterBase.Add so that the workers process individual parts
+// rather than whole objects, while results are still reported per object.
+func (a *multipartUploadAdapter) Add(transfers ...*Transfer) <-chan TransferResult {
+	return a.addEach(transfers, a.uploadObject)
+}
+
+func (a *multipartUploadAdapter) uploadObject(t *Transfer) error {
+	if t.Size < 0 {
+		return errors.New(tr.Tr.Get("object %q has invalid size (got: %d)", t.Oid, t.Size))
+	}
+
+	// An expired part can't be retried here; ask the transfer queue to
+	// request fresh actions instead.
+	for _, part := range t.Parts {
+		if at, expired := part.IsExpiredWithin(objectExpirationToTransfer); expired {
+			return errors.NewRetriableError(&ActionExpiredErr{Rel: multipartPartsRel, At: at})
+		}
+	}
+
+	parts, err := a.partTransfers(t)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.uploads[t.Oid] = &multipartUpload{t: t}
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.uploads, t.Oid)
+		a.mu.Unlock()
+	}()
+
+	a.Trace("xfer: uploading %q in %d part(s)", t.Oid, len(parts))
+
+	pending := parts
+	for attempt := 0; len(pending) > 0; attempt++ {
+		failed, err := a.uploadParts(pending)
+		if err == nil {
+			break
+		}
+
+		if !errors.IsRetriableError(err) {
+			a.abort(t)
+			return err
+		}
+		if _, later := errors.IsRetriableLaterError(err); later || attempt >= a.maxRetries {
+			// Leave any further retries to the transfer queue,
+			// which will ask the server for the remaining parts.
+			return err
+		}
+
+		a.Trace("xfer: retrying %d failed part(s) of %q", len(failed), t.Oid)
+		pending = failed
+	}
+
+	if err := verifyUpload(a.apiClient, a.remote, t); err != nil {
+		// If all parts were already uploaded, but the object still
+		// can't be verified, it may be corrupt in storage, so abort
+		// the upload and let it start again from scratch.
+		if len(parts) == 0 {
+			a.abort(t)
+		}
+		return errors.NewRetriableError(err)
+	}
+	return nil
+}
+
+// partTransfers returns one Transfer for each part of t, whose "upload"
+// action is the part's action and whose size is the part's size.
+func (a *multipartUploadAdapter) partTransfers(t *Transfer) ([]*Transfer, error) {
+	parts := make([]*Transfer, 0, len(t.Parts))
+	for _, part := range t.Parts {
+		size := part.Size
+		if size == 0 {
+			size = t.Size - part.Pos
+		}
+		if part.Pos < 0 || size < 0 || part.Pos+size > t.Size {
+			return nil, errors.New(tr.Tr.Get("invalid part of object %s: position %d, size %d", t.Oid, part.Pos, part.Size))
+		}
+
+		parts = append(parts, &Transfer{
+			Name:          t.Name,
+			Oid:           t.Oid,
+			Size:          size,
+			Authenticated: t.Authenticated,
+			Path:          t.Path,
+			Actions:       ActionSet{"upload": part},
+		})
+	}
+	return parts, nil
+}
+
+// uploadParts hands the given parts to the workers and waits for them all to
+// finish. It returns those which failed, along with the last error, which is
+// only retriable if every failure was.
+func (a *multipartUploadAdapter) uploadParts(parts []*Transfer) ([]*Transfer, error) {
+	var failed []*Transfer
+	var lastErr error
+	for _, res := range a.runJobs(parts) {
+		if res.Error == nil {
+			continue
+		}
+
+		failed = append(failed, res.Transfer)
+		if lastErr == nil || errors.IsRetriableError(lastErr) {
+			lastErr = res.Error
+		}
+	}
+	return failed, lastErr
+}
+
+// DoTransfer uploads a single part, as returned by partTransfers.
+func (a *multipartUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Rel("upload")
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		return errors.New(tr.Tr.Get("No upload action for object: %s", t.Oid))
+	}
+
+	a.mu.Lock()
+	upload := a.uploads[t.Oid]
+	a.mu.Unlock()
+	if upload == nil {
+		return errors.New(tr.Tr.Get("no multipart upload in progress for object: %s", t.Oid))
+	}
+
+	method := rel.Method
+	if len(method) == 0 {
+		method = "PUT"
+	}
+
+	req, err := a.newHTTPRequest(method, rel)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, tr.Tr.Get("multipart upload"))
+	}
+	defer f.Close()
+
+	section := io.NewSectionReader(f, rel.Pos, t.Size)
+	if name, h := selectDigest(rel.WantDigest); h != nil {
+		if _, err := io.Copy(h, section); err != nil {
+			return errors.Wrap(err, tr.Tr.Get("multipart upload"))
+		}
+		if _, err := section.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, tr.Tr.Get("multipart upload"))
+		}
+		req.Header.Set("Digest", name+"="+base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	}
+
+	req.Header.Set("Content-Length", strconv.FormatInt(t.Size, 10))
+	req.ContentLength = t.Size
+
+	// Report progress against the whole object, rather than the part
+	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		read := atomic.AddInt64(&upload.progress, int64(readSinceLast))
+		if cb != nil {
+			return cb(upload.t.Name, upload.t.Size, read, readSinceLast)
+		}
+		return nil
+	}
+
+	body := tools.NewBodyWithCallback(&sectionBody{section}, t.Size, ccb)
+	var reader lfsapi.ReadSeekCloser = body
+
+	// Signal auth was ok on first read; this frees up other workers to start
+	if authOkFunc != nil {
+		reader = newStartCallbackReader(reader, func() error {
+			authOkFunc()
+			return nil
+		})
+	}
+
+	req.Body = reader
+
+	a.Trace("xfer: uploading part of %q at %d (%d bytes)", t.Oid, rel.Pos, t.Size)
+	req = a.apiClient.LogRequest(req, "lfs.data.upload")
+	res, err := a.makeRequest(t, req)
+	if err != nil {
+		if errors.IsUnprocessableEntityError(err) {
+			return err
+		}
+
+		// Rewind the progress of this part before it is retried.
+		if perr := body.ResetProgress(); perr != nil {
+			err = errors.Wrap(err, perr.Error())
+		}
+
+		if res == nil {
+			// We encountered a network or similar error which caused us
+			// to not receive a response at all.
+			return errors.NewRetriableError(err)
+		}
+
+		if res.StatusCode == 429 {
+			retLaterErr := errors.NewRetriableLaterError(err, res.Header.Get("Retry-After"))
+			if retLaterErr != nil {
+				return retLaterErr
+			}
+		}
+		return errors.NewRetriableError(err)
+	}
+
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	// A status code of 403 likely means that an authentication token for the
+	// upload has expired. This can be safely retried.
+	if res.StatusCode == 403 {
+		body.ResetProgress()
+		err = errors.New(tr.Tr.Get("Received status %d", res.StatusCode))
+		return errors.NewRetriableError(err)
+	}
+
+	if res.StatusCode > 299 {
+		return errors.New(tr.Tr.Get("Invalid status for %s %s: %d",
+			req.Method,
+			strings.SplitN(req.URL.String(), "?", 2)[0],
+			res.StatusCode,
+		))
+	}
+
+	return nil
+}
+
+// abort sends the object's "abort" action, if any, so the server can clean up
+// a multipart upload which will not be completed. Failures are only traced,
+// as the server must clean up abandoned uploads by other means anyway.
+func (a *multipartUploadAdapter) abort(t *Transfer) {
+	rel, err := t.Rel("abort")
+	if err != nil || rel == nil {
+		return
+	}
+
+	method := rel.Method
+	if len(method) == 0 {
+		method = "POST"
+	}
+
+	req, err := a.newHTTPRequest(method, rel)
+	if err != nil {
+		tracerx.Printf("xfer: unable to abort multipart upload of %q: %s", t.Oid, err)
+		return
+	}
+
+	a.Trace("xfer: aborting multipart upload of %q", t.Oid)
+	req = a.apiClient.LogRequest(req, "lfs.data.abort")
+	res, err := a.makeRequest(t, req)
+	if err != nil {
+		tracerx.Printf("xfer: unable to abort multipart upload of %q: %s", t.Oid, err)
+		return
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+}
+
+func (a *multipartUploadAdapter) makeRequest(t *Transfer, req *http.Request) (*http.Response, error) {
+	res, err := a.doHTTP(t, req)
+	if errors.IsAuthError(err) && len(req.Header.Get("Authorization")) == 0 {
+		// Rewind the body, if any, before trying again.
+		if seeker, ok := req.Body.(io.Seeker); ok {
+			seeker.Seek(0, io.SeekStart)
+		}
+		return a.makeRequest(t, req)
+	}
+
+	return res, err
+}
+
+// sectionBody adapts an io.SectionReader to lfsapi.ReadSeekCloser. The
+// underlying file is closed by the caller once the request is complete.
+type sectionBody struct {
+	*io.SectionReader
+}
+
+func (b *sectionBody) Close() error {
+	return nil
+}
+
+var wantDigests = map[string]struct {
+	name string
+	new  func() hash.Hash
+}{
+	"sha-256": {"SHA-256", sha256.New},
+	"sha-512": {"SHA-512", sha512.New},
+}
+
+// selectDigest parses a want_digest value, in the format of the
+// Want-Digest header from RFC 3230, and returns the name of the supported
+// algorithm with the highest q-value, along with a new hash for it. If no
+// supported algorithm is acceptable, it returns a nil hash.
+func selectDigest(wantDigest string) (string, hash.Hash) {
+	var name string
+	var newHash func() hash.Hash
+	best := 0.0
+
+	for _, entry := range strings.Split(wantDigest, ",") {
+		fields := strings.Split(entry, ";")
+		alg := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.ToLower(strings.TrimSpace(k)) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		digest, ok := wantDigests[alg]
+		if ok && q > best {
+			name, newHash, best = digest.name, digest.new, q
+		}
+	}
+
+	if newHash == nil {
+		return "", nil
+	}
+	return name, newHash()
+}
+
+// needsMultipartUpload returns whether t, from a batch response which
+// selected the named adapter, has parts to upload or an upload to finalise.
+// Multipart uploads have no "upload" action, so without this check the
+// transfer queue would consider them already complete.
+func needsMultipartUpload(adapterName string, t *Transfer) bool {
+	if adapterName != MultipartAdapterName {
+		return false
+	}
+	return len(t.Parts) > 0 || t.Actions["verify"] != nil
+}
+
+func configureMultipartAdapter(m *concreteManifest) {
+	m.RegisterNewAdapterFunc(MultipartAdapterName, Upload, false, func(name string, dir Direction) Adapter {
+		switch dir {
+		case Upload:
+			mu := &multipartUploadAdapter{
+				adapterBase: newAdapterBase(m.fs, name, dir, nil),
+				maxRetries:  m.maxRetries,
+				uploads:     make(map[string]*multipartUpload),
+			}
+			// self implements impl
+			mu.transferImpl = mu
+			return mu
+		case Download:
+			panic(tr.Tr.Get("Should never ask this function to download"))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package tq
+
+import "sort"
+
+// Priority is the priority with which a TransferQueue transfers an object.
+// Objects of higher priority are transferred before those of lower priority
+// which were added to the queue at around the same time.
+type Priority int
+
+const (
+	// PriorityNormal is the priority of most objects.
+	PriorityNormal Priority = iota
+	// PriorityHigh is the priority of objects which the user has asked
+	// for ahead of others, such as those in the working tree matching
+	// lfs.fetchpriority.
+	PriorityHigh
+)
+
+// OrderingPolicy decides the order in which a TransferQueue sends the objects
+// of a batch to the server and to the transfer adapter, returning whether "a"
+// should be transferred before "b".
+type OrderingPolicy func(a, b *Transfer) bool
+
+// LargestFirst is an OrderingPolicy which transfers the largest objects first.
+// Since adding a new batch is unable to occur until the current batch has
+// finished processing, this reduces the risk of a single worker getting tied
+// up on a large item at the end of a batch while all other workers are
+// sitting idle.
+func LargestFirst(a, b *Transfer) bool {
+	return a.Size > b.Size
+}
+
+// ByPriority returns an OrderingPolicy which transfers objects of a higher
+// Priority first, and those of the same priority in the order given by
+// "then".
+func ByPriority(then OrderingPolicy) OrderingPolicy {
+	return func(a, b *Transfer) bool {
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return then(a, b)
+	}
+}
+
+// defaultOrdering is the OrderingPolicy used by a TransferQueue unless
+// another is given with WithOrdering.
+var defaultOrdering = ByPriority(LargestFirst)
+
+// sortTransfers sorts the given transfers according to the policy "less",
+// keeping those which it considers equal in the same order.
+func sortTransfers(transfers []*Transfer, less OrderingPolicy) {
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return less(transfers[i], transfers[j])
+	})
+}
+
+// sortBy sorts the batch according to the policy "less", keeping objects which
+// it considers equal in the same order.
+func (b batch) sortBy(less OrderingPolicy) {
+	transfers := make([]*Transfer, len(b))
+	for i, t := range b {
+		transfers[i] = t.ToTransfer()
+	}
+	sort.Stable(&orderedBatch{b: b, transfers: transfers, less: less})
+}
+
+// prioritize moves the objects of higher priority to the front of the batch,
+// keeping those of the same priority in the same order, so that they are
+// included in the next batch sent to the server.
+func (b batch) prioritize() {
+	sort.SliceStable(b, func(i, j int) bool {
+		return b[i].Priority > b[j].Priority
+	})
+}
+
+// orderedBatch implements sort.Interface to sort a batch according to an
+// OrderingPolicy.
+type orderedBatch struct {
+	b         batch
+	transfers []*Transfer
+	less      OrderingPolicy
+}
+
+func (o *orderedBatch) Len() int { return len(o.b) }
+
+func (o *orderedBatch) Less(i, j int) bool {
+	return o.less(o.transfers[i], o.transfers[j])
+}
+
+func (o *orderedBatch) Swap(i, j int) {
+	o.b[i], o.b[j] = o.b[j], o.b[i]
+	o.transfers[i], o.transfers[j] = o.transfers[j], o.transfers[i]
+}
@@ -0,0 +1,66 @@
+package tq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func batchOids(b batch) []string {
+	oids := make([]string, 0, len(b))
+	for _, t := range b {
+		oids = append(oids, t.Oid)
+	}
+	return oids
+}
+
+func TestBatchSortsByPriorityThenSize(t *testing.T) {
+	b := batch{
+		{Oid: "small", Size: 1},
+		{Oid: "large", Size: 3},
+		{Oid: "high-small", Size: 1, Priority: PriorityHigh},
+		{Oid: "high-large", Size: 2, Priority: PriorityHigh},
+	}
+	b.sortBy(defaultOrdering)
+
+	assert.Equal(t, []string{"high-large", "high-small", "large", "small"}, batchOids(b))
+}
+
+func TestBatchSortsByCustomOrdering(t *testing.T) {
+	b := batch{
+		{Oid: "c", Size: 1},
+		{Oid: "a", Size: 3},
+		{Oid: "b", Size: 2},
+	}
+	b.sortBy(func(a, b *Transfer) bool { return a.Oid < b.Oid })
+
+	assert.Equal(t, []string{"a", "b", "c"}, batchOids(b))
+}
+
+func TestBatchPrioritizeKeepsOrderWithinPriority(t *testing.T) {
+	b := batch{
+		{Oid: "retry", Size: 1},
+		{Oid: "pending", Size: 3},
+		{Oid: "high", Size: 1, Priority: PriorityHigh},
+		{Oid: "collected", Size: 2},
+	}
+	b.prioritize()
+
+	assert.Equal(t, []string{"high", "retry", "pending", "collected"}, batchOids(b))
+}
+
+func TestSortTransfersRestoresOrdering(t *testing.T) {
+	transfers := []*Transfer{
+		{Oid: "a", Size: 1},
+		{Oid: "b", Size: 1, Priority: PriorityHigh},
+		{Oid: "c", Size: 2},
+		{Oid: "d", Size: 1},
+	}
+	sortTransfers(transfers, defaultOrdering)
+
+	oids := make([]string, 0, len(transfers))
+	for _, t := range transfers {
+		oids = append(oids, t.Oid)
+	}
+	assert.Equal(t, []string{"b", "c", "a", "d"}, oids)
+}
@@ -61,7 +61,11 @@ func (a *SSHBatchClient) Batch(remote string, bReq *batchRequest) (*BatchRespons
 	tracerx.Printf("api: batch %d files", len(bReq.Objects))
 
 	requestedAt := time.Now()
-	args := []string{"transfer=ssh", "hash-algo=sha256"}
+	hashAlgo := bReq.HashAlgorithm
+	if hashAlgo == "" {
+		hashAlgo = tools.DefaultHashAlgorithm.String()
+	}
+	args := []string{"transfer=ssh", fmt.Sprintf("hash-algo=%s", hashAlgo)}
 	if bReq.Ref != nil {
 		args = append(args, fmt.Sprintf("refname=%s", bReq.Ref.Name))
 	}
@@ -85,8 +89,8 @@ func (a *SSHBatchClient) Batch(remote string, bReq *batchRequest) (*BatchRespons
 		}
 		if entries[0] == "hash-algo" {
 			bRes.HashAlgorithm = entries[1]
-			if bRes.HashAlgorithm != "sha256" {
-				return nil, errors.New(tr.Tr.Get("batch response: unsupported hash algorithm: %q", entries[1]))
+			if err := checkHashAlgorithm(hashAlgo, bRes.HashAlgorithm); err != nil {
+				return nil, errors.Wrap(err, tr.Tr.Get("batch response"))
 			}
 		}
 	}
@@ -170,6 +174,14 @@ func (a *SSHAdapter) WorkerStarting(workerNum int) (interface{}, error) {
 func (a *SSHAdapter) WorkerEnding(workerNum int, ctx interface{}) {
 }
 
+// WorkersIdle is called when adapting concurrency leaves the workers numbered
+// "n" and above without jobs, so that their connections may be closed.
+func (a *SSHAdapter) WorkersIdle(n int) {
+	if err := a.transfer.SetConnectionCount(n); err != nil {
+		tracerx.Printf("failed to close idle pure SSH connections: %s", err)
+	}
+}
+
 func (a *SSHAdapter) tempDir() string {
 	// Shared with the basic download adapter.
 	d := filepath.Join(a.fs.LFSStorageDir, "incomplete")
@@ -185,6 +197,8 @@ func (a *SSHAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallbac
 		authOkFunc()
 	}
 	workerNum := ctx.(int)
+	// The worker's connection may have been closed while it was idle.
+	a.transfer.SetConnectionCountAtLeast(workerNum + 1)
 	if a.adapterBase.direction == Upload {
 		return a.upload(t, workerNum, cb)
 	} else {
@@ -268,7 +282,7 @@ func (a *SSHAdapter) doDownload(t *Transfer, workerNum int, f *os.File, cb Progr
 		}
 		return nil
 	}
-	hasher := tools.NewHashingReader(data)
+	hasher := tools.NewHashingReaderPreloadHash(a.throttle.reader(data), t.HashAlgorithm.OrDefault().New())
 	written, err := tools.CopyWithCallback(f, hasher, t.Size, ccb)
 	if err != nil {
 		return errors.Wrap(err, tr.Tr.Get("cannot write data to temporary file %q", dlfilename))
@@ -336,7 +350,7 @@ func (a *SSHAdapter) doUpload(t *Transfer, workerNum int, f *os.File, cb Progres
 	conn.Lock()
 	defer conn.Unlock()
 	defer cbr.Close()
-	err = conn.SendMessageWithData(fmt.Sprintf("put-object %s", t.Oid), args, cbr)
+	err = conn.SendMessageWithData(fmt.Sprintf("put-object %s", t.Oid), args, a.throttle.reader(cbr))
 	if err != nil {
 		return 0, nil, nil, err
 	}
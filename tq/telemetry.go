@@ -0,0 +1,67 @@
+package tq
+
+import (
+	"context"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
+)
+
+var (
+	batchDuration    = telemetry.NewHistogram("lfs.batch.duration", "Time taken by batch API requests")
+	batchErrors      = telemetry.NewCounter("lfs.batch.errors", "{request}", "Number of batch API requests which failed")
+	transferDuration = telemetry.NewHistogram("lfs.transfer.duration", "Time taken to transfer objects")
+	transferBytes    = telemetry.NewCounter("lfs.transfer.size", "By", "Number of bytes of objects transferred")
+	transferErrors   = telemetry.NewCounter("lfs.transfer.errors", "{object}", "Number of attempts to transfer objects which failed")
+	transferRetries  = telemetry.NewCounter("lfs.transfer.retries", "{object}", "Number of object transfers retried")
+)
+
+// startBatchSpan starts a span for a batch request for bReq to endpoint e.
+func startBatchSpan(e lfshttp.Endpoint, bReq *batchRequest) (context.Context, *telemetry.Span) {
+	return telemetry.Start(context.Background(), "lfs.batch",
+		telemetry.String("lfs.operation", bReq.Operation),
+		telemetry.String("url.full", telemetry.RedactURL(e.Url)),
+		telemetry.Int("lfs.objects", int64(len(bReq.Objects))),
+	)
+}
+
+// endBatchSpan ends the span for a batch request for the given operation,
+// which took time d and failed with err, if it is not nil.
+func endBatchSpan(span *telemetry.Span, operation string, err error, d time.Duration) {
+	attrs := []telemetry.Attribute{telemetry.String("lfs.operation", operation)}
+	batchDuration.Record(d, attrs...)
+	if err != nil {
+		batchErrors.Add(1, attrs...)
+		span.SetError(err)
+	}
+	span.End()
+}
+
+// startTransferSpan starts a span for the transfer of t by the adapter a, to
+// which the spans of its HTTP requests belong.
+func (a *adapterBase) startTransferSpan(t *Transfer) {
+	_, t.span = telemetry.Start(context.Background(), "lfs.transfer",
+		telemetry.String("lfs.oid", t.Oid),
+		telemetry.Int("lfs.size", t.Size),
+		telemetry.String("lfs.direction", a.direction.String()),
+		telemetry.String("lfs.adapter", a.name),
+	)
+}
+
+// endTransferSpan ends the span for the transfer of t, which took time d and
+// failed with err, if it is not nil.
+func (a *adapterBase) endTransferSpan(t *Transfer, err error, d time.Duration) {
+	attrs := []telemetry.Attribute{
+		telemetry.String("lfs.direction", a.direction.String()),
+		telemetry.String("lfs.adapter", a.name),
+	}
+	transferDuration.Record(d, attrs...)
+	if err != nil {
+		transferErrors.Add(1, attrs...)
+		t.span.SetError(err)
+	} else {
+		transferBytes.Add(t.Size, attrs...)
+	}
+	t.span.End()
+}
@@ -0,0 +1,241 @@
+package tq
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/tools/humanize"
+	"github.com/git-lfs/git-lfs/v3/tr"
+	"github.com/rubyist/tracerx"
+)
+
+// throttle is a token bucket which limits the rate at which all the workers of
+// an adapter together transfer data, optionally only during certain times of
+// day.
+type throttle struct {
+	// rate is the number of bytes per second allowed.
+	rate float64
+	// windows are the times of day during which the rate applies. If
+	// empty, it always applies.
+	windows []throttleWindow
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// throttleWindow is a time of day, given as the time since midnight at which
+// it starts and ends. A window which ends before it starts spans midnight.
+type throttleWindow struct {
+	start, end time.Duration
+}
+
+// newThrottle returns a throttle for transfers in the given direction to or
+// from rawurl, as configured by lfs.transfer.<url>.maxUploadRate or
+// lfs.transfer.<url>.maxDownloadRate and lfs.transfer.<url>.rateLimitWindows,
+// or nil if no rate is configured.
+func newThrottle(uc *config.URLConfig, rawurl string, dir Direction) (*throttle, error) {
+	key := "maxDownloadRate"
+	if dir == Upload {
+		key = "maxUploadRate"
+	}
+
+	v, ok := uc.Get("lfs.transfer", rawurl, key)
+	if !ok || len(v) == 0 {
+		return nil, nil
+	}
+	rate, err := humanize.ParseBytes(strings.TrimSuffix(strings.TrimSpace(v), "/s"))
+	if err != nil {
+		return nil, errors.Wrap(err, tr.Tr.Get("invalid lfs.transfer.%s value %q", key, v))
+	}
+	if rate == 0 {
+		return nil, nil
+	}
+
+	var windows []throttleWindow
+	if v, ok := uc.Get("lfs.transfer", rawurl, "ratelimitwindows"); ok {
+		if windows, err = parseThrottleWindows(v); err != nil {
+			return nil, errors.Wrap(err, tr.Tr.Get("invalid lfs.transfer.rateLimitWindows value %q", v))
+		}
+	}
+
+	tracerx.Printf("xfer: limiting %s rate for %s to %s", dir, rawurl,
+		humanize.FormatByteRate(rate, time.Second))
+
+	now := time.Now()
+	return &throttle{
+		rate:    float64(rate),
+		windows: windows,
+		tokens:  float64(rate),
+		last:    now,
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}, nil
+}
+
+// throttleWarnings records the invalid rate limit settings which have already
+// been reported, so that each is reported only once.
+var throttleWarnings sync.Map
+
+// newThrottleOrWarn returns a throttle as newThrottle does, except that an
+// invalid setting is reported as a warning, once, and leaves transfers
+// unlimited rather than failing them.
+func newThrottleOrWarn(uc *config.URLConfig, rawurl string, dir Direction) *throttle {
+	t, err := newThrottle(uc, rawurl, dir)
+	if err != nil {
+		tracerx.Printf("xfer: ignoring rate limit for %s: %v", rawurl, err)
+		if _, seen := throttleWarnings.LoadOrStore(err.Error(), true); !seen {
+			fmt.Fprintln(os.Stderr, tr.Tr.Get("warning: %s; transfers will not be limited", err))
+		}
+		return nil
+	}
+	return t
+}
+
+// parseThrottleWindows parses a comma-separated list of times of day, such as
+// "09:00-12:30,13:30-18:00".
+func parseThrottleWindows(s string) ([]throttleWindow, error) {
+	var windows []throttleWindow
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errors.New(tr.Tr.Get("expected <start>-<end>, got %q", part))
+		}
+		start, err := parseTimeOfDay(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(to)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, throttleWindow{start: start, end: end})
+	}
+	return windows, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m > 0) {
+		return 0, errors.New(tr.Tr.Get("invalid time of day %q", s))
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// contains returns whether the time of day "d" falls within the window.
+func (w throttleWindow) contains(d time.Duration) bool {
+	if w.start <= w.end {
+		return d >= w.start && d < w.end
+	}
+	return d >= w.start || d < w.end
+}
+
+// limit returns the number of bytes per second currently allowed, or zero if
+// transfers are not currently limited.
+func (t *throttle) limit() uint64 {
+	if t == nil || !t.active(t.now()) {
+		return 0
+	}
+	return uint64(t.rate)
+}
+
+func (t *throttle) active(now time.Time) bool {
+	if len(t.windows) == 0 {
+		return true
+	}
+
+	h, m, s := now.Clock()
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	for _, w := range t.windows {
+		if w.contains(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// wait takes n bytes from the bucket, sleeping until enough have accumulated
+// to allow them if necessary.
+func (t *throttle) wait(n int) {
+	now := t.now()
+	if !t.active(now) {
+		return
+	}
+
+	t.mu.Lock()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		// Allow a burst of at most a second's worth.
+		t.tokens = t.rate
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	tokens := t.tokens
+	t.mu.Unlock()
+
+	if tokens < 0 {
+		t.sleep(time.Duration(-tokens / t.rate * float64(time.Second)))
+	}
+}
+
+// chunk returns the size of a read of n bytes, limited so that a single read
+// is not much larger than the bucket.
+func (t *throttle) chunk(n int) int {
+	if max := int(t.rate); n > max && max > 0 {
+		return max
+	}
+	return n
+}
+
+// reader returns r, throttled by t if it is not nil.
+func (t *throttle) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{Reader: r, t: t}
+}
+
+// readSeekCloser returns r, throttled by t if it is not nil.
+func (t *throttle) readSeekCloser(r lfsapi.ReadSeekCloser) lfsapi.ReadSeekCloser {
+	if t == nil {
+		return r
+	}
+	return &throttledReadSeekCloser{ReadSeekCloser: r, t: t}
+}
+
+type throttledReader struct {
+	io.Reader
+	t *throttle
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p[:r.t.chunk(len(p))])
+	r.t.wait(n)
+	return n, err
+}
+
+type throttledReadSeekCloser struct {
+	lfsapi.ReadSeekCloser
+	t *throttle
+}
+
+func (r *throttledReadSeekCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p[:r.t.chunk(len(p))])
+	r.t.wait(n)
+	return n, err
+}
@@ -0,0 +1,177 @@
+package tq
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/v3/config"
+	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock for throttles which only moves when they sleep.
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) install(t *throttle) *throttle {
+	t.now = func() time.Time { return c.now }
+	t.sleep = func(d time.Duration) {
+		c.slept += d
+		c.now = c.now.Add(d)
+	}
+	t.last = c.now
+	return t
+}
+
+func newThrottleFromConfig(t *testing.T, vals map[string][]string, rawurl string, dir Direction) (*throttle, error) {
+	uc := config.NewURLConfig(config.EnvironmentOf(config.MapFetcher(vals)))
+	return newThrottle(uc, rawurl, dir)
+}
+
+func TestNewThrottle(t *testing.T) {
+	vals := map[string][]string{
+		"lfs.transfer.maxuploadrate":                              {"1MB"},
+		"lfs.transfer.https://example.com/.maxdownloadrate":       {"2 MiB/s"},
+		"lfs.transfer.https://example.com/.ratelimitwindows":      {"09:00-18:00"},
+		"lfs.transfer.https://invalid.example.com/.maxuploadrate": {"fast"},
+	}
+
+	up, err := newThrottleFromConfig(t, vals, "https://example.com/repo.git/info/lfs", Upload)
+	require.NoError(t, err)
+	require.NotNil(t, up)
+	assert.Equal(t, float64(1000000), up.rate)
+	assert.Equal(t, []throttleWindow{{9 * time.Hour, 18 * time.Hour}}, up.windows)
+
+	down, err := newThrottleFromConfig(t, vals, "https://example.com/repo.git/info/lfs", Download)
+	require.NoError(t, err)
+	require.NotNil(t, down)
+	assert.Equal(t, float64(2*1024*1024), down.rate)
+	assert.Equal(t, []throttleWindow{{9 * time.Hour, 18 * time.Hour}}, down.windows)
+
+	down, err = newThrottleFromConfig(t, vals, "https://other.example.com/info/lfs", Download)
+	assert.NoError(t, err)
+	assert.Nil(t, down)
+
+	_, err = newThrottleFromConfig(t, vals, "https://invalid.example.com/info/lfs", Upload)
+	assert.Error(t, err)
+}
+
+func TestParseThrottleWindows(t *testing.T) {
+	windows, err := parseThrottleWindows("09:00-12:30, 22:00-06:00,")
+	require.NoError(t, err)
+	assert.Equal(t, []throttleWindow{
+		{9 * time.Hour, 12*time.Hour + 30*time.Minute},
+		{22 * time.Hour, 6 * time.Hour},
+	}, windows)
+
+	assert.True(t, windows[0].contains(9*time.Hour))
+	assert.False(t, windows[0].contains(12*time.Hour+30*time.Minute))
+	assert.True(t, windows[1].contains(23*time.Hour))
+	assert.True(t, windows[1].contains(time.Hour))
+	assert.False(t, windows[1].contains(12*time.Hour))
+
+	for _, s := range []string{"09:00", "9-17", "09:00-25:00", "09:60-10:00"} {
+		_, err := parseThrottleWindows(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestThrottleWaitSleepsOffDeficit(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)}
+	th := clock.install(&throttle{rate: 100, tokens: 100})
+
+	// The first second's worth is allowed at once.
+	th.wait(100)
+	assert.Equal(t, time.Duration(0), clock.slept)
+
+	th.wait(50)
+	assert.Equal(t, 500*time.Millisecond, clock.slept)
+
+	th.wait(100)
+	assert.Equal(t, 1500*time.Millisecond, clock.slept)
+}
+
+func TestThrottleOnlyLimitsWithinWindows(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 20, 0, 0, 0, time.Local)}
+	th := clock.install(&throttle{
+		rate:    100,
+		windows: []throttleWindow{{9 * time.Hour, 18 * time.Hour}},
+	})
+
+	assert.Equal(t, uint64(0), th.limit())
+	th.wait(1000)
+	assert.Equal(t, time.Duration(0), clock.slept)
+
+	clock.now = time.Date(2020, 1, 2, 10, 0, 0, 0, time.Local)
+	assert.Equal(t, uint64(100), th.limit())
+	th.wait(200)
+	assert.Equal(t, time.Second, clock.slept)
+}
+
+func TestThrottledReaderLimitsReads(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)}
+	th := clock.install(&throttle{rate: 10})
+
+	data := []byte(strings.Repeat("x", 45))
+	r := th.reader(bytes.NewReader(data))
+
+	buf := make([]byte, 32)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, append(buf[:n], rest...))
+	assert.Equal(t, 4500*time.Millisecond, clock.slept)
+}
+
+func TestNilThrottle(t *testing.T) {
+	var th *throttle
+
+	r := strings.NewReader("data")
+	assert.Equal(t, io.Reader(r), th.reader(r))
+	assert.Equal(t, uint64(0), th.limit())
+}
+
+func TestMeterReportsThrottle(t *testing.T) {
+	m := NewMeter(nil)
+	m.Direction = Upload
+	m.estimatedFiles = 1
+	assert.NotContains(t, m.str(), "limited")
+
+	m.setThrottle(&throttle{rate: 1024, now: time.Now})
+	assert.True(t, strings.HasSuffix(m.str(), " (limited to 1.0 KB/s)"), m.str())
+}
+
+func TestAdapterThrottleUsesBatchEndpoint(t *testing.T) {
+	cli := lfsapi.NewClient(lfshttp.NewContext(nil, nil, map[string]string{
+		"remote.origin.url": "https://example.com/repo.git",
+		"lfs.transfer.https://mirror.example.com/.maxdownloadrate": "1MB",
+		"lfs.transfer.https://bad.example.com/.maxdownloadrate":    "fast",
+	}))
+	defer cli.Close()
+
+	begin := func(endpoint string) *throttle {
+		a := NewManifest(nil, cli, "", "").NewDownloadAdapter(BasicAdapterName).(*basicDownloadAdapter)
+		require.NoError(t, a.Begin(&adapterConfig{apiClient: cli, concurrentTransfers: 1, remote: "origin", endpoint: endpoint}, nil))
+		defer a.End()
+		return a.rateLimiter()
+	}
+
+	assert.Nil(t, begin(""))
+	assert.Nil(t, begin("https://example.com/repo.git/info/lfs"))
+	if th := begin("https://mirror.example.com/repo.git/info/lfs"); assert.NotNil(t, th) {
+		assert.Equal(t, uint64(1000000), th.limit())
+	}
+
+	// An invalid rate leaves transfers unlimited rather than failing them.
+	assert.Nil(t, begin("https://bad.example.com/repo.git/info/lfs"))
+}
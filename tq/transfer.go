@@ -3,11 +3,13 @@
 package tq
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
 )
@@ -57,6 +59,82 @@ type Transfer struct {
 	Error         *ObjectError `json:"error,omitempty"`
 	Path          string       `json:"path,omitempty"`
 	Missing       bool         `json:"-"`
+	Priority      Priority     `json:"-"`
+
+	// HashAlgorithm is the algorithm with which Oid was computed. It is
+	// sent once per batch request rather than with each object, and is
+	// the default if empty.
+	HashAlgorithm tools.HashAlgorithm `json:"-"`
+
+	// ContentEncoding is the encoding, if any, which the server selected
+	// to compress the object with on the wire when using the basic
+	// adapter.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// Parts holds the "parts" actions of a multipart upload, which are
+	// sent as a list within "actions" rather than as a single action.
+	Parts []*Action `json:"-"`
+
+	// span is the telemetry span of the attempt in progress to transfer
+	// the object, if any.
+	span *telemetry.Span
+}
+
+// UnmarshalJSON decodes a Transfer, separating the list of "parts" actions
+// from its other actions.
+func (t *Transfer) UnmarshalJSON(data []byte) error {
+	type transfer Transfer
+	raw := struct {
+		*transfer
+		Actions map[string]json.RawMessage `json:"actions,omitempty"`
+	}{transfer: (*transfer)(t)}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	t.Actions = nil
+	t.Parts = nil
+	if raw.Actions == nil {
+		return nil
+	}
+
+	t.Actions = make(ActionSet, len(raw.Actions))
+	for rel, msg := range raw.Actions {
+		if rel == multipartPartsRel {
+			if err := json.Unmarshal(msg, &t.Parts); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var a *Action
+		if err := json.Unmarshal(msg, &a); err != nil {
+			return err
+		}
+		t.Actions[rel] = a
+	}
+	return nil
+}
+
+// MarshalJSON encodes a Transfer, including any "parts" actions in its
+// actions.
+func (t *Transfer) MarshalJSON() ([]byte, error) {
+	type transfer Transfer
+	if len(t.Parts) == 0 {
+		return json.Marshal((*transfer)(t))
+	}
+
+	actions := make(map[string]interface{}, len(t.Actions)+1)
+	for rel, a := range t.Actions {
+		actions[rel] = a
+	}
+	actions[multipartPartsRel] = t.Parts
+
+	return json.Marshal(struct {
+		*transfer
+		Actions map[string]interface{} `json:"actions,omitempty"`
+	}{(*transfer)(t), actions})
 }
 
 func (t *Transfer) Rel(name string) (*Action, error) {
@@ -88,12 +166,14 @@ func (e *ObjectError) Error() string {
 // values set.
 func newTransfer(tr *Transfer, name string, path string) *Transfer {
 	t := &Transfer{
-		Name:          name,
-		Path:          path,
-		Oid:           tr.Oid,
-		Size:          tr.Size,
-		Authenticated: tr.Authenticated,
-		Actions:       make(ActionSet),
+		Name:            name,
+		Path:            path,
+		Oid:             tr.Oid,
+		Size:            tr.Size,
+		Authenticated:   tr.Authenticated,
+		Actions:         make(ActionSet),
+		ContentEncoding: tr.ContentEncoding,
+		HashAlgorithm:   tr.HashAlgorithm,
 	}
 
 	if tr.Error != nil {
@@ -104,30 +184,18 @@ func newTransfer(tr *Transfer, name string, path string) *Transfer {
 	}
 
 	for rel, action := range tr.Actions {
-		t.Actions[rel] = &Action{
-			Href:      action.Href,
-			Header:    action.Header,
-			ExpiresAt: action.ExpiresAt,
-			ExpiresIn: action.ExpiresIn,
-			Id:        action.Id,
-			Token:     action.Token,
-			createdAt: action.createdAt,
-		}
+		t.Actions[rel] = action.copy()
+	}
+
+	for _, part := range tr.Parts {
+		t.Parts = append(t.Parts, part.copy())
 	}
 
 	if tr.Links != nil {
 		t.Links = make(ActionSet)
 
 		for rel, link := range tr.Links {
-			t.Links[rel] = &Action{
-				Href:      link.Href,
-				Header:    link.Header,
-				ExpiresAt: link.ExpiresAt,
-				ExpiresIn: link.ExpiresIn,
-				Id:        link.Id,
-				Token:     link.Token,
-				createdAt: link.createdAt,
-			}
+			t.Links[rel] = link.copy()
 		}
 	}
 
@@ -142,7 +210,37 @@ type Action struct {
 	Id        string            `json:"-"`
 	Token     string            `json:"-"`
 
+	// IntegrityHeaders lists the integrity headers, such as Content-MD5,
+	// which the storage backend expects with an upload, separated by
+	// commas.
+	IntegrityHeaders string `json:"integrity_headers,omitempty"`
+
+	// WantDigest lists the acceptable digest algorithms for an upload or
+	// part in the format of the Want-Digest header.
+	WantDigest string `json:"want_digest,omitempty"`
+
+	// The following are only used by the multipart adapter. Method is
+	// the HTTP method for a part upload or abort, Pos and Size are the
+	// byte range of the object to send as a part, and Params is sent
+	// verbatim when verifying.
+	Method string          `json:"method,omitempty"`
+	Pos    int64           `json:"pos,omitempty"`
+	Size   int64           `json:"size,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+
 	createdAt time.Time
+	// refreshed is true if the action replaced one which expired while
+	// its object was being transferred, in which case it is not replaced
+	// again.
+	refreshed bool
+}
+
+func (a *Action) copy() *Action {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	return &c
 }
 
 func (a *Action) IsExpiredWithin(d time.Duration) (time.Time, bool) {
@@ -206,12 +304,33 @@ type adapterConfig struct {
 	apiClient           *lfsapi.Client
 	concurrentTransfers int
 	remote              string
+	// initialTransfers is the number of workers which initially take
+	// jobs, when adapting concurrency, or zero if all of them do.
+	initialTransfers int
+	// refresh, if not nil, makes a batch request for a single object, so
+	// that an adapter can replace actions which expire mid-transfer.
+	refresh func(*Transfer) (*Transfer, error)
+	// endpoint is the URL of the LFS API endpoint from which the batch
+	// being transferred was received, if known.
+	endpoint string
 }
 
 func (c *adapterConfig) ConcurrentTransfers() int {
 	return c.concurrentTransfers
 }
 
+func (c *adapterConfig) initialConcurrency() int {
+	return c.initialTransfers
+}
+
+func (c *adapterConfig) transferRefresher() func(*Transfer) (*Transfer, error) {
+	return c.refresh
+}
+
+func (c *adapterConfig) endpointUrl() string {
+	return c.endpoint
+}
+
 func (c *adapterConfig) APIClient() *lfsapi.Client {
 	return c.apiClient
 }
@@ -3,13 +3,14 @@ package tq
 import (
 	"fmt"
 	"os"
-	"sort"
 	"sync"
 	"time"
 
 	"github.com/git-lfs/git-lfs/v3/errors"
+	"github.com/git-lfs/git-lfs/v3/events"
 	"github.com/git-lfs/git-lfs/v3/git"
 	"github.com/git-lfs/git-lfs/v3/lfshttp"
+	"github.com/git-lfs/git-lfs/v3/telemetry"
 	"github.com/git-lfs/git-lfs/v3/tools"
 	"github.com/git-lfs/git-lfs/v3/tr"
 	"github.com/rubyist/tracerx"
@@ -81,14 +82,8 @@ func (r *retryCounter) ReadyTime(oid string) time.Time {
 	return time.Now().Add(time.Duration(delay) * time.Millisecond)
 }
 
-// batch implements the sort.Interface interface and enables sorting on a slice
-// of `*Transfer`s by object size.
-//
-// This interface is implemented here so that the largest objects can be
-// processed first. Since adding a new batch is unable to occur until the
-// current batch has finished processing, this enables us to reduce the risk of
-// a single worker getting tied up on a large item at the end of a batch while
-// all other workers are sitting idle.
+// batch is a set of objects sent to the server in a single batch request, in
+// the order given by the queue's OrderingPolicy.
 type batch []*objectTuple
 
 // Concat concatenates two batches together, returning a single, clamped batch as
@@ -129,15 +124,11 @@ func (b batch) Concat(other batch, size int) (left, right batch, minWait time.Du
 func (b batch) ToTransfers() []*Transfer {
 	transfers := make([]*Transfer, 0, len(b))
 	for _, t := range b {
-		transfers = append(transfers, &Transfer{Oid: t.Oid, Size: t.Size})
+		transfers = append(transfers, &Transfer{Oid: t.Oid, Size: t.Size, HashAlgorithm: t.HashAlgorithm})
 	}
 	return transfers
 }
 
-func (b batch) Len() int           { return len(b) }
-func (b batch) Less(i, j int) bool { return b[i].Size < b[j].Size }
-func (b batch) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
-
 type abortableWaitGroup struct {
 	wq      sync.WaitGroup
 	counter int
@@ -211,6 +202,14 @@ type TransferQueue struct {
 	wait     *abortableWaitGroup
 	manifest Manifest
 	rc       *retryCounter
+	journal  *Journal
+	ordering OrderingPolicy
+
+	// concurrency adjusts the number of concurrent transfers, or is nil
+	// if it is fixed. stopAdapting is closed to stop it adjusting them
+	// for the current adapter.
+	concurrency  *concurrencyController
+	stopAdapting chan struct{}
 
 	// unsupportedContentType indicates whether the transfer queue ever saw
 	// an HTTP 422 response indicating that their upload destination does
@@ -250,17 +249,24 @@ type objectTuple struct {
 	Name, Path, Oid string
 	Size            int64
 	Missing         bool
+	Priority        Priority
+	HashAlgorithm   tools.HashAlgorithm
 	ReadyTime       time.Time
 	retryLaterTime  time.Time
+	// retryErr is the error with which the last attempt to transfer the
+	// object failed, if it is to be retried.
+	retryErr error
 }
 
 func (o *objectTuple) ToTransfer() *Transfer {
 	return &Transfer{
-		Name:    o.Name,
-		Path:    o.Path,
-		Oid:     o.Oid,
-		Size:    o.Size,
-		Missing: o.Missing,
+		Name:          o.Name,
+		Path:          o.Path,
+		Oid:           o.Oid,
+		Size:          o.Size,
+		Missing:       o.Missing,
+		Priority:      o.Priority,
+		HashAlgorithm: o.HashAlgorithm,
 	}
 }
 
@@ -298,6 +304,21 @@ func WithBufferDepth(depth int) Option {
 	return func(tq *TransferQueue) { tq.bufferDepth = depth }
 }
 
+// WithOrdering sets the policy which decides the order in which the objects of
+// each batch are transferred. By default, objects of higher Priority are
+// transferred first, and otherwise the largest objects are.
+func WithOrdering(policy OrderingPolicy) Option {
+	return func(tq *TransferQueue) {
+		tq.ordering = policy
+	}
+}
+
+// WithJournal records the progress of the queue's transfers in "j", and skips
+// any objects which it records as already transferred.
+func WithJournal(j *Journal) Option {
+	return func(tq *TransferQueue) { tq.journal = j }
+}
+
 // NewTransferQueue builds a TransferQueue, direction and underlying mechanism determined by adapter
 func NewTransferQueue(dir Direction, manifest Manifest, remote string, options ...Option) *TransferQueue {
 	q := &TransferQueue{
@@ -321,6 +342,9 @@ func NewTransferQueue(dir Direction, manifest Manifest, remote string, options .
 	if q.bufferDepth <= 0 {
 		q.bufferDepth = q.batchSize
 	}
+	if q.ordering == nil {
+		q.ordering = defaultOrdering
+	}
 	if q.meter != nil {
 		q.meter.Direction = q.direction
 	}
@@ -342,6 +366,18 @@ func (q *TransferQueue) Upgrade() {
 		q.rc.MaxRetries = manifest.maxRetries
 		q.rc.MaxRetryDelay = manifest.maxRetryDelay
 		q.client.SetMaxRetries(manifest.maxRetries)
+		if manifest.adaptiveConcurrency {
+			q.concurrency = newConcurrencyController(manifest.concurrentTransfers,
+				manifest.minConcurrentTransfers, manifest.maxConcurrentTransfers)
+			if q.meter == nil {
+				// The meter also measures throughput in order
+				// to adapt concurrency, so use one which
+				// doesn't display progress.
+				q.meter = NewMeter(nil)
+				q.meter.DryRun = true
+				q.meter.Direction = q.direction
+			}
+		}
 	}
 }
 
@@ -355,6 +391,29 @@ func (q *TransferQueue) Upgrade() {
 // Only one file will be transferred to/from the Path element of the first
 // transfer.
 func (q *TransferQueue) Add(name, path, oid string, size int64, missing bool, err error) {
+	q.AddWithPriority(name, path, oid, size, missing, PriorityNormal, err)
+}
+
+// AddWithPriority adds a *Transfer to the transfer queue like Add, but with
+// the given priority, so that it may be transferred ahead of objects of lower
+// priority which are waiting to be transferred. If a transfer with the same
+// OID has been added already, its priority is unchanged.
+func (q *TransferQueue) AddWithPriority(name, path, oid string, size int64, missing bool, priority Priority, err error) {
+	q.AddTransfer(&Transfer{
+		Name:     name,
+		Path:     path,
+		Oid:      oid,
+		Size:     size,
+		Missing:  missing,
+		Priority: priority,
+	}, err)
+}
+
+// AddTransfer adds a *Transfer to the transfer queue like AddWithPriority,
+// taking its name, path, OID, size, whether it is missing, its priority and
+// the hash algorithm of its OID from the given Transfer. If the error is
+// non-nil, it is reported instead and the transfer is not added.
+func (q *TransferQueue) AddTransfer(tr *Transfer, err error) {
 	q.Upgrade()
 
 	if err != nil {
@@ -363,11 +422,17 @@ func (q *TransferQueue) Add(name, path, oid string, size int64, missing bool, er
 	}
 
 	t := &objectTuple{
-		Name:    name,
-		Path:    path,
-		Oid:     oid,
-		Size:    size,
-		Missing: missing,
+		Name:          tr.Name,
+		Path:          tr.Path,
+		Oid:           tr.Oid,
+		Size:          tr.Size,
+		Missing:       tr.Missing,
+		Priority:      tr.Priority,
+		HashAlgorithm: tr.HashAlgorithm,
+	}
+
+	if q.skipCompleted(t) {
+		return
 	}
 
 	if objs := q.remember(t); len(objs.objects) > 1 {
@@ -386,9 +451,48 @@ func (q *TransferQueue) Add(name, path, oid string, size int64, missing bool, er
 		return
 	}
 
+	q.journal.record(journalQueued, t.Oid, t.Size)
+	q.emitObjectEvent(events.ObjectQueued, t.Oid, t.Size, nil)
 	q.incoming <- t
 }
 
+// skipCompleted skips the *Transfer "t" without transferring it if the queue's
+// journal records that it has been transferred already and, for a download,
+// it is still present, returning whether it did so.
+func (q *TransferQueue) skipCompleted(t *objectTuple) bool {
+	if !q.journal.Completed(t.Oid) {
+		return false
+	}
+
+	// A downloaded object may have been removed or damaged since, so it
+	// is only skipped while it is still present with the right size.
+	if q.direction == Download {
+		if fi, err := os.Stat(t.Path); err != nil || !fi.Mode().IsRegular() || fi.Size() != t.Size {
+			tracerx.Printf("tq: %q is missing locally despite the journal, downloading it again", t.Oid)
+			return false
+		}
+	}
+
+	q.trMutex.Lock()
+	if _, ok := q.transfers[t.Oid]; ok {
+		q.trMutex.Unlock()
+		return false
+	}
+	q.transfers[t.Oid] = &objects{
+		completed: true,
+		objects:   []*objectTuple{t},
+	}
+	q.trMutex.Unlock()
+
+	tracerx.Printf("tq: skipping %q, already transferred according to journal", t.Oid)
+	for _, w := range q.watchers {
+		w <- t.ToTransfer()
+	}
+	q.emitObjectEvent(events.ObjectSkipped, t.Oid, t.Size, nil)
+	q.Skip(t.Size)
+	return true
+}
+
 // remember remembers the *Transfer "t" if the *TransferQueue doesn't already
 // know about a Transfer with the same OID.
 //
@@ -422,13 +526,14 @@ func (q *TransferQueue) remember(t *objectTuple) objects {
 //     a. If the read was a channel close, go to step 4.
 //     b. If the read was a transferable item, go to step 3.
 //  3. Append the item to the batch.
-//  4. Sort the batch by descending object size, make a batch API call, send
+//  4. Sort the batch according to `q.ordering`, make a batch API call, send
 //     the items to the `*adapterBase`.
 //  5. In a separate goroutine, process the worker results, incrementing and
 //     appending retries if possible. On the main goroutine, accept new items
 //     into "pending".
 //  6. Concat() the "next" and "pending" batches such that no more items than
-//     the maximum allowed per batch are in next, and the rest are in pending.
+//     the maximum allowed per batch are in next, and the rest are in pending,
+//     moving items of a higher priority into next first.
 //  7. If the `q.incoming` channel is open, go to step 2.
 //  8. If the next batch is empty AND the `q.incoming` channel is closed,
 //     terminate immediately.
@@ -452,9 +557,9 @@ func (q *TransferQueue) collectBatches() {
 			next = append(next, t)
 		}
 
-		// Before enqueuing the next batch, sort by descending object
-		// size.
-		sort.Sort(sort.Reverse(next))
+		// Before enqueuing the next batch, sort it by the queue's
+		// ordering policy.
+		next.sortBy(q.ordering)
 
 		done := make(chan struct{})
 
@@ -490,9 +595,13 @@ func (q *TransferQueue) collectBatches() {
 		//
 		// - retries from the previous batch,
 		// - new additions that were enqueued behind retries, &
-		// - items collected while the batch was processing.
+		// - items collected while the batch was processing,
+		//
+		// except that items of a higher priority come first.
 		var minWaitTime time.Duration
-		next, pending, minWaitTime = retries.Concat(append(pending, collected...), q.batchSize)
+		candidates := append(retries, append(pending, collected...)...)
+		candidates.prioritize()
+		next, pending, minWaitTime = candidates.Concat(nil, q.batchSize)
 		if len(next) == 0 && len(pending) != 0 {
 			// There are some pending that could not be queued.
 			// Wait the requested time before resuming loop.
@@ -558,11 +667,16 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 		}
 		delay := time.Until(t.ReadyTime).Seconds()
 
+		if err == nil {
+			err, t.retryErr = t.retryErr, nil
+		}
+
 		var errMsg string
 		if err != nil {
 			errMsg = fmt.Sprintf(": %s", err)
 		}
 		tracerx.Printf("tq: enqueue retry #%d after %.2fs for %q (size: %d)%s", count, delay, t.Oid, t.Size, errMsg)
+		q.emitRetryEvent(t, count, err)
 		next = append(next, t)
 	}
 
@@ -573,7 +687,7 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 		// Trust the external transfer agent can do everything by itself.
 		objects := make([]*Transfer, 0, len(batch))
 		for _, t := range batch {
-			objects = append(objects, &Transfer{Oid: t.Oid, Size: t.Size, Path: t.Path})
+			objects = append(objects, &Transfer{Oid: t.Oid, Size: t.Size, Path: t.Path, HashAlgorithm: t.HashAlgorithm})
 		}
 		bRes = &BatchResponse{
 			Objects:             objects,
@@ -596,6 +710,7 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 					enqueueRetry(t, err, &readyTime)
 				} else {
 					hasNonRetriableObjects = true
+					q.emitObjectEvent(events.ObjectFailed, t.Oid, t.Size, err)
 					q.wait.Done()
 				}
 			}
@@ -625,7 +740,7 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 			// actions will be empty. It's fine if the file is
 			// missing in that case, since we don't need to upload
 			// it.
-			if len(o.Actions) != 0 {
+			if len(o.Actions) != 0 || len(o.Parts) != 0 {
 				q.trMutex.Lock()
 				objects, ok := q.transfers[o.Oid]
 				q.trMutex.Unlock()
@@ -649,6 +764,7 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 	for _, o := range bRes.Objects {
 		if o.Error != nil {
 			q.errorc <- errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message)
+			q.emitObjectEvent(events.ObjectFailed, o.Oid, o.Size, o.Error)
 			q.Skip(o.Size)
 			q.wait.Done()
 
@@ -663,14 +779,18 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 			// Transfer object, then we give up on the
 			// transfer by telling the progress meter to
 			// skip the number of bytes in "o".
-			q.errorc <- errors.New(tr.Tr.Get("[%v] The server returned an unknown OID.", o.Oid))
+			err := errors.New(tr.Tr.Get("[%v] The server returned an unknown OID.", o.Oid))
+			q.errorc <- err
 
+			q.emitObjectEvent(events.ObjectFailed, o.Oid, o.Size, err)
 			q.Skip(o.Size)
 			q.wait.Done()
 		} else {
 			// Pick t[0], since it will cover all transfers with the
 			// same OID.
 			tr := newTransfer(o, objects.First().Name, objects.First().Path)
+			tr.Priority = objects.First().Priority
+			tr.HashAlgorithm = objects.First().HashAlgorithm
 
 			if a, err := tr.Rel(q.direction.String()); err != nil {
 				if q.canRetryObject(tr.Oid, err) {
@@ -678,19 +798,31 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 				} else {
 					q.errorc <- errors.Errorf("[%v] %v", tr.Name, err)
 
+					q.emitObjectEvent(events.ObjectFailed, o.Oid, o.Size, err)
 					q.Skip(o.Size)
 					q.wait.Done()
 				}
-			} else if a == nil && manifest.standaloneTransferAgent == "" {
+			} else if a == nil && !needsMultipartUpload(bRes.TransferAdapterName, tr) && manifest.standaloneTransferAgent == "" {
+				if q.direction == Upload {
+					// The server already has the object.
+					q.journal.record(journalCompleted, tr.Oid, tr.Size)
+				}
+				q.emitObjectEvent(events.ObjectSkipped, o.Oid, o.Size, nil)
 				q.Skip(o.Size)
 				q.wait.Done()
 			} else {
-				q.meter.StartTransfer(objects.First().Name)
+				q.journal.record(journalStarted, tr.Oid, tr.Size)
+				q.meter.startTransfer(objects.First().Name, o.Oid)
+				q.emitObjectEvent(events.ObjectStarted, o.Oid, o.Size, nil)
 				toTransfer = append(toTransfer, tr)
 			}
 		}
 	}
 
+	// The server may not respond with the objects in the order we sent
+	// them, so restore it.
+	sortTransfers(toTransfer, q.ordering)
+
 	retries := q.addToAdapter(bRes.endpoint, toTransfer)
 	for t := range retries {
 		enqueueRetry(t, nil, nil)
@@ -719,6 +851,7 @@ func (q *TransferQueue) addToAdapter(e lfshttp.Endpoint, pending []*Transfer) <-
 
 		q.errorc <- err
 		for _, t := range pending {
+			q.emitObjectEvent(events.ObjectFailed, t.Oid, t.Size, err)
 			q.Skip(t.Size)
 			q.wait.Done()
 		}
@@ -811,6 +944,11 @@ func (q *TransferQueue) handleTransferResult(
 	oid := res.Transfer.Oid
 
 	if res.Error != nil {
+		if q.direction == Download {
+			// Try another mirror, or the real endpoint, next time.
+			q.manifest.Upgrade().mirrors.transferFailed(oid)
+		}
+
 		// If there was an error encountered when processing the
 		// transfer (res.Transfer), handle the error as is appropriate:
 		if readyTime, canRetry := q.canRetryObjectLater(oid, res.Error); canRetry {
@@ -818,6 +956,7 @@ func (q *TransferQueue) handleTransferResult(
 			// after a certain period of time, send it to
 			// the retry channel with a time when it's ready.
 			tracerx.Printf("tq: retrying object %s after %.2fs", oid, time.Until(readyTime).Seconds())
+			transferRetries.Add(1, telemetry.String("lfs.direction", q.direction.String()))
 			q.trMutex.Lock()
 			objects, ok := q.transfers[oid]
 			q.trMutex.Unlock()
@@ -825,6 +964,7 @@ func (q *TransferQueue) handleTransferResult(
 			if ok {
 				t := objects.First()
 				t.retryLaterTime = readyTime
+				t.retryErr = res.Error
 				retries <- t
 			} else {
 				q.errorc <- res.Error
@@ -834,13 +974,16 @@ func (q *TransferQueue) handleTransferResult(
 			// channel, where it will be read at the call-site and
 			// its retry count will be incremented.
 			tracerx.Printf("tq: retrying object %s: %s", oid, res.Error)
+			transferRetries.Add(1, telemetry.String("lfs.direction", q.direction.String()))
 
 			q.trMutex.Lock()
 			objects, ok := q.transfers[oid]
 			q.trMutex.Unlock()
 
 			if ok {
-				retries <- objects.First()
+				t := objects.First()
+				t.retryErr = res.Error
+				retries <- t
 			} else {
 				q.errorc <- res.Error
 			}
@@ -850,6 +993,7 @@ func (q *TransferQueue) handleTransferResult(
 			// the retry channel, and the error will be reported
 			// immediately (unless the error is in response to a
 			// HTTP 422).
+			q.emitObjectEvent(events.ObjectFailed, oid, res.Transfer.Size, res.Error)
 			if errors.IsUnprocessableEntityError(res.Error) {
 				q.unsupportedContentType = true
 			} else {
@@ -881,6 +1025,8 @@ func (q *TransferQueue) handleTransferResult(
 
 		q.trMutex.Unlock()
 
+		q.journal.record(journalCompleted, oid, res.Transfer.Size)
+		q.emitObjectEvent(events.ObjectCompleted, oid, res.Transfer.Size, nil)
 		q.meter.FinishTransfer(res.Transfer.Name)
 		q.wait.Done()
 	}
@@ -912,6 +1058,10 @@ func (q *TransferQueue) useAdapter(name string) {
 }
 
 func (q *TransferQueue) finishAdapter() {
+	if q.stopAdapting != nil {
+		close(q.stopAdapting)
+		q.stopAdapting = nil
+	}
 	if q.adapterInProgress {
 		q.adapter.End()
 		q.adapterInProgress = false
@@ -959,6 +1109,14 @@ func (q *TransferQueue) ensureAdapterBegun(e lfshttp.Endpoint) error {
 	}
 	q.adapterInProgress = true
 
+	if a, ok := q.adapter.(interface{ rateLimiter() *throttle }); ok {
+		q.meter.setThrottle(a.rateLimiter())
+	}
+	if a, ok := q.adapter.(concurrencyAdapter); ok && q.concurrency != nil {
+		q.stopAdapting = make(chan struct{})
+		go q.adaptConcurrency(a, q.concurrency, q.stopAdapting)
+	}
+
 	return nil
 }
 
@@ -966,11 +1124,56 @@ func (q *TransferQueue) toAdapterCfg(e lfshttp.Endpoint) AdapterConfig {
 	apiClient := q.manifest.APIClient()
 	concurrency := q.manifest.ConcurrentTransfers()
 
+	// When adapting concurrency, start as many workers as we may need,
+	// but only let as many as the controller decides take jobs.
+	var initial int
+	if q.concurrency != nil {
+		concurrency = q.concurrency.max
+		initial = q.concurrency.limit
+	}
+
+	var refresh func(*Transfer) (*Transfer, error)
+	if q.manifest.Upgrade().standaloneTransferAgent == "" {
+		name := q.adapter.Name()
+		refresh = func(t *Transfer) (*Transfer, error) {
+			return q.refreshTransfer(name, t)
+		}
+	}
+
 	return &adapterConfig{
 		concurrentTransfers: concurrency,
 		apiClient:           apiClient,
 		remote:              q.remote,
+		initialTransfers:    initial,
+		refresh:             refresh,
+		endpoint:            e.Url,
+	}
+}
+
+// refreshTransfer makes a batch request for t alone, on behalf of the adapter
+// with the given name, so that it can replace actions which expired while it
+// was transferring t. It returns the server's new copy of t.
+func (q *TransferQueue) refreshTransfer(adapterName string, t *Transfer) (*Transfer, error) {
+	tracerx.Printf("tq: refreshing actions for %q", t.Oid)
+
+	bRes, err := Batch(q.manifest, q.direction, q.remote, q.ref, []*Transfer{{Oid: t.Oid, Size: t.Size, HashAlgorithm: t.HashAlgorithm}})
+	if err != nil {
+		return nil, err
+	}
+	if name := adapterNameOrDefault(bRes.TransferAdapterName); name != adapterName {
+		return nil, errors.New(tr.Tr.Get("batch response: server selected transfer adapter %q rather than %q", name, adapterName))
+	}
+
+	for _, o := range bRes.Objects {
+		if o.Oid != t.Oid {
+			continue
+		}
+		if o.Error != nil {
+			return nil, errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message)
+		}
+		return o, nil
 	}
+	return nil, errors.New(tr.Tr.Get("[%v] The server returned no actions.", t.Oid))
 }
 
 // Wait waits for the queue to finish processing all transfers. Once Wait is
@@ -1065,6 +1268,7 @@ func (q *TransferQueue) canRetryObjectLater(oid string, err error) (time.Time, b
 	if !canRetry {
 		return retryAt, false
 	}
+	q.concurrency.throttle()
 
 	delay := time.Until(retryAt).Seconds()
 	maxRetryTime := float64(q.manifest.Upgrade().MaxRetryTime())
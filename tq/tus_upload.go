@@ -126,7 +126,7 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 		return nil
 	})
 
-	req.Body = reader
+	req.Body = a.throttle.readSeekCloser(reader)
 
 	req = a.apiClient.LogRequest(req, "lfs.data.upload")
 	res, err = a.doHTTP(t, req)
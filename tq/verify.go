@@ -1,6 +1,7 @@
 package tq
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/git-lfs/git-lfs/v3/lfsapi"
@@ -27,9 +28,10 @@ func verifyUpload(c *lfsapi.Client, remote string, t *Transfer) error {
 	}
 
 	err = lfsapi.MarshalToRequest(req, struct {
-		Oid  string `json:"oid"`
-		Size int64  `json:"size"`
-	}{Oid: t.Oid, Size: t.Size})
+		Oid    string          `json:"oid"`
+		Size   int64           `json:"size"`
+		Params json.RawMessage `json:"params,omitempty"`
+	}{Oid: t.Oid, Size: t.Size, Params: action.Params})
 	if err != nil {
 		return err
 	}